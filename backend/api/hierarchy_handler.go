@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/service"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HierarchyHandler serves the organizations and projects that keys are
+// grouped into for budgeting.
+type HierarchyHandler struct {
+	service *service.HierarchyService
+}
+
+func NewHierarchyHandler(s *service.HierarchyService) *HierarchyHandler {
+	return &HierarchyHandler{service: s}
+}
+
+type OrganizationResponse struct {
+	ID            int64                 `json:"id"`
+	Name          string                `json:"name"`
+	BudgetLimit   float64               `json:"budget_limit"`
+	BudgetUsage   float64               `json:"budget_usage"`
+	ResetPeriod   int                   `json:"reset_period"`
+	ResetSchedule *domain.ResetSchedule `json:"reset_schedule,omitempty"`
+	LastResetAt   int64                 `json:"last_reset_at"`
+	CreatedAt     int64                 `json:"created_at"`
+}
+
+type ProjectResponse struct {
+	ID            int64                 `json:"id"`
+	OrgID         int64                 `json:"org_id,omitempty"`
+	Name          string                `json:"name"`
+	BudgetLimit   float64               `json:"budget_limit"`
+	BudgetUsage   float64               `json:"budget_usage"`
+	ResetPeriod   int                   `json:"reset_period"`
+	ResetSchedule *domain.ResetSchedule `json:"reset_schedule,omitempty"`
+	LastResetAt   int64                 `json:"last_reset_at"`
+	CreatedAt     int64                 `json:"created_at"`
+}
+
+type organizationRequest struct {
+	Name          string                `json:"name"`
+	BudgetLimit   float64               `json:"budget_limit"`
+	ResetPeriod   int                   `json:"reset_period"`
+	ResetSchedule *domain.ResetSchedule `json:"reset_schedule"`
+}
+
+type projectRequest struct {
+	OrgID         int64                 `json:"org_id"`
+	Name          string                `json:"name"`
+	BudgetLimit   float64               `json:"budget_limit"`
+	ResetPeriod   int                   `json:"reset_period"`
+	ResetSchedule *domain.ResetSchedule `json:"reset_schedule"`
+}
+
+func mapOrganizationToResponse(o *domain.Organization) OrganizationResponse {
+	return OrganizationResponse{
+		ID:            int64(o.ID),
+		Name:          o.Name,
+		BudgetLimit:   o.BudgetLimit,
+		BudgetUsage:   o.BudgetUsage,
+		ResetPeriod:   o.ResetPeriod,
+		ResetSchedule: o.ResetSchedule,
+		LastResetAt:   o.LastResetAt.Unix(),
+		CreatedAt:     o.CreatedAt.Unix(),
+	}
+}
+
+func mapProjectToResponse(p *domain.Project) ProjectResponse {
+	return ProjectResponse{
+		ID:            int64(p.ID),
+		OrgID:         int64(p.OrgID),
+		Name:          p.Name,
+		BudgetLimit:   p.BudgetLimit,
+		BudgetUsage:   p.BudgetUsage,
+		ResetPeriod:   p.ResetPeriod,
+		ResetSchedule: p.ResetSchedule,
+		LastResetAt:   p.LastResetAt.Unix(),
+		CreatedAt:     p.CreatedAt.Unix(),
+	}
+}
+
+// hierarchyError maps service errors to responses.
+func hierarchyError(c echo.Context, err error) error {
+	switch {
+	case domain.IsValidationError(err):
+		return BadRequest(c, err.Error())
+	case errors.Is(err, domain.ErrOrganizationNotFound), errors.Is(err, domain.ErrProjectNotFound):
+		return NewAPIError(c, http.StatusNotFound, err.Error())
+	}
+	return InternalError(c, err.Error())
+}
+
+func (h *HierarchyHandler) ListOrganizations(c echo.Context) error {
+	orgs, err := h.service.ListOrganizations(c.Request().Context())
+	if err != nil {
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]OrganizationResponse, len(orgs))
+	for i, o := range orgs {
+		resp[i] = mapOrganizationToResponse(o)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HierarchyHandler) CreateOrganization(c echo.Context) error {
+	var req organizationRequest
+	if err := c.Bind(&req); err != nil {
+		return BadRequest(c, err.Error())
+	}
+
+	o, err := h.service.CreateOrganization(c.Request().Context(), service.OrganizationInput{
+		Name:          req.Name,
+		BudgetLimit:   req.BudgetLimit,
+		ResetPeriod:   req.ResetPeriod,
+		ResetSchedule: req.ResetSchedule,
+	})
+	if err != nil {
+		return hierarchyError(c, err)
+	}
+	return c.JSON(http.StatusCreated, mapOrganizationToResponse(o))
+}
+
+func (h *HierarchyHandler) UpdateOrganization(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return BadRequest(c, "Invalid ID")
+	}
+
+	var req organizationRequest
+	if err := c.Bind(&req); err != nil {
+		return BadRequest(c, err.Error())
+	}
+
+	err = h.service.UpdateOrganization(c.Request().Context(), domain.ID(id), service.OrganizationInput{
+		Name:          req.Name,
+		BudgetLimit:   req.BudgetLimit,
+		ResetPeriod:   req.ResetPeriod,
+		ResetSchedule: req.ResetSchedule,
+	})
+	if err != nil {
+		return hierarchyError(c, err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HierarchyHandler) DeleteOrganization(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return BadRequest(c, "Invalid ID")
+	}
+
+	if err := h.service.DeleteOrganization(c.Request().Context(), domain.ID(id)); err != nil {
+		return InternalError(c, err.Error())
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HierarchyHandler) ListProjects(c echo.Context) error {
+	projects, err := h.service.ListProjects(c.Request().Context())
+	if err != nil {
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]ProjectResponse, len(projects))
+	for i, p := range projects {
+		resp[i] = mapProjectToResponse(p)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HierarchyHandler) CreateProject(c echo.Context) error {
+	var req projectRequest
+	if err := c.Bind(&req); err != nil {
+		return BadRequest(c, err.Error())
+	}
+
+	p, err := h.service.CreateProject(c.Request().Context(), service.ProjectInput{
+		OrgID:         domain.ID(req.OrgID),
+		Name:          req.Name,
+		BudgetLimit:   req.BudgetLimit,
+		ResetPeriod:   req.ResetPeriod,
+		ResetSchedule: req.ResetSchedule,
+	})
+	if err != nil {
+		return hierarchyError(c, err)
+	}
+	return c.JSON(http.StatusCreated, mapProjectToResponse(p))
+}
+
+func (h *HierarchyHandler) UpdateProject(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return BadRequest(c, "Invalid ID")
+	}
+
+	var req projectRequest
+	if err := c.Bind(&req); err != nil {
+		return BadRequest(c, err.Error())
+	}
+
+	err = h.service.UpdateProject(c.Request().Context(), domain.ID(id), service.ProjectInput{
+		OrgID:         domain.ID(req.OrgID),
+		Name:          req.Name,
+		BudgetLimit:   req.BudgetLimit,
+		ResetPeriod:   req.ResetPeriod,
+		ResetSchedule: req.ResetSchedule,
+	})
+	if err != nil {
+		return hierarchyError(c, err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HierarchyHandler) DeleteProject(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return BadRequest(c, "Invalid ID")
+	}
+
+	if err := h.service.DeleteProject(c.Request().Context(), domain.ID(id)); err != nil {
+		return InternalError(c, err.Error())
+	}
+	return c.NoContent(http.StatusOK)
+}
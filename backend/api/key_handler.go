@@ -6,6 +6,7 @@ import (
 	"pouch-ai/backend/domain"
 	"pouch-ai/backend/service"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -25,6 +26,7 @@ type KeyResponse struct {
 	ExpiresAt     *int64                   `json:"expires_at"`
 	AutoRenew     bool                     `json:"auto_renew"`
 	BudgetUsage   float64                  `json:"budget_usage"`
+	ModelUsage    map[string]float64       `json:"model_usage,omitempty"`
 	CreatedAt     int64                    `json:"created_at"`
 	Configuration *domain.KeyConfiguration `json:"configuration"`
 }
@@ -36,6 +38,7 @@ func mapKeyToResponse(k *domain.Key) KeyResponse {
 		Prefix:        k.Prefix,
 		AutoRenew:     k.AutoRenew,
 		BudgetUsage:   k.BudgetUsage,
+		ModelUsage:    k.ModelUsage,
 		CreatedAt:     k.CreatedAt.Unix(),
 		Configuration: k.Configuration,
 	}
@@ -62,26 +65,44 @@ func (h *KeyHandler) ListKeys(c echo.Context) error {
 
 func (h *KeyHandler) CreateKey(c echo.Context) error {
 	var req struct {
-		Name        string                `json:"name"`
-		Provider    domain.PluginConfig   `json:"provider"`
-		ExpiresAt   *int64                `json:"expires_at"`
-		Middlewares []domain.PluginConfig `json:"middlewares"`
-		BudgetLimit float64               `json:"budget_limit"`
-		ResetPeriod int                   `json:"reset_period"`
-		AutoRenew   bool                  `json:"auto_renew"`
+		Name               string                    `json:"name"`
+		Provider           domain.PluginConfig       `json:"provider"`
+		ExpiresAt          *int64                    `json:"expires_at"`
+		Middlewares        []domain.PluginConfig     `json:"middlewares"`
+		BudgetLimit        float64                   `json:"budget_limit"`
+		ResetPeriod        int                       `json:"reset_period"`
+		ResetSchedule      *domain.ResetSchedule     `json:"reset_schedule"`
+		AutoRenew          bool                      `json:"auto_renew"`
+		AllowedModels      []string                  `json:"allowed_models"`
+		ClampMaxTokens     bool                      `json:"clamp_max_tokens"`
+		UnknownModelPolicy domain.UnknownModelPolicy `json:"unknown_model_policy"`
+		ProjectID          domain.ID                 `json:"project_id"`
+		ModelBudgets       []domain.ModelBudget      `json:"model_budgets"`
+		AlertThresholds    []int                     `json:"alert_thresholds"`
+		SoftLimit          bool                      `json:"soft_limit"`
+		StreamCutoff       bool                      `json:"stream_cutoff"`
 	}
 	if err := c.Bind(&req); err != nil {
 		return BadRequest(c, err.Error())
 	}
 
 	input := service.CreateKeyInput{
-		Name:        req.Name,
-		Provider:    req.Provider,
-		ExpiresAt:   req.ExpiresAt,
-		Middlewares: req.Middlewares,
-		BudgetLimit: req.BudgetLimit,
-		ResetPeriod: req.ResetPeriod,
-		AutoRenew:   req.AutoRenew,
+		Name:               req.Name,
+		Provider:           req.Provider,
+		ExpiresAt:          req.ExpiresAt,
+		Middlewares:        req.Middlewares,
+		BudgetLimit:        req.BudgetLimit,
+		ResetPeriod:        req.ResetPeriod,
+		ResetSchedule:      req.ResetSchedule,
+		AutoRenew:          req.AutoRenew,
+		AllowedModels:      req.AllowedModels,
+		ClampMaxTokens:     req.ClampMaxTokens,
+		UnknownModelPolicy: req.UnknownModelPolicy,
+		ProjectID:          req.ProjectID,
+		ModelBudgets:       req.ModelBudgets,
+		AlertThresholds:    req.AlertThresholds,
+		SoftLimit:          req.SoftLimit,
+		StreamCutoff:       req.StreamCutoff,
 	}
 
 	raw, _, err := h.service.CreateKey(c.Request().Context(), input)
@@ -104,27 +125,45 @@ func (h *KeyHandler) UpdateKey(c echo.Context) error {
 	}
 
 	var req struct {
-		Name        string                `json:"name"`
-		Provider    domain.PluginConfig   `json:"provider"`
-		ExpiresAt   *int64                `json:"expires_at"`
-		Middlewares []domain.PluginConfig `json:"middlewares"`
-		BudgetLimit float64               `json:"budget_limit"`
-		ResetPeriod int                   `json:"reset_period"`
-		AutoRenew   bool                  `json:"auto_renew"`
+		Name               string                    `json:"name"`
+		Provider           domain.PluginConfig       `json:"provider"`
+		ExpiresAt          *int64                    `json:"expires_at"`
+		Middlewares        []domain.PluginConfig     `json:"middlewares"`
+		BudgetLimit        float64                   `json:"budget_limit"`
+		ResetPeriod        int                       `json:"reset_period"`
+		ResetSchedule      *domain.ResetSchedule     `json:"reset_schedule"`
+		AutoRenew          bool                      `json:"auto_renew"`
+		AllowedModels      []string                  `json:"allowed_models"`
+		ClampMaxTokens     bool                      `json:"clamp_max_tokens"`
+		UnknownModelPolicy domain.UnknownModelPolicy `json:"unknown_model_policy"`
+		ProjectID          domain.ID                 `json:"project_id"`
+		ModelBudgets       []domain.ModelBudget      `json:"model_budgets"`
+		AlertThresholds    []int                     `json:"alert_thresholds"`
+		SoftLimit          bool                      `json:"soft_limit"`
+		StreamCutoff       bool                      `json:"stream_cutoff"`
 	}
 	if err := c.Bind(&req); err != nil {
 		return BadRequest(c, err.Error())
 	}
 
 	input := service.UpdateKeyInput{
-		ID:          id,
-		Name:        req.Name,
-		Provider:    req.Provider,
-		ExpiresAt:   req.ExpiresAt,
-		Middlewares: req.Middlewares,
-		BudgetLimit: req.BudgetLimit,
-		ResetPeriod: req.ResetPeriod,
-		AutoRenew:   req.AutoRenew,
+		ID:                 id,
+		Name:               req.Name,
+		Provider:           req.Provider,
+		ExpiresAt:          req.ExpiresAt,
+		Middlewares:        req.Middlewares,
+		BudgetLimit:        req.BudgetLimit,
+		ResetPeriod:        req.ResetPeriod,
+		ResetSchedule:      req.ResetSchedule,
+		AutoRenew:          req.AutoRenew,
+		AllowedModels:      req.AllowedModels,
+		ClampMaxTokens:     req.ClampMaxTokens,
+		UnknownModelPolicy: req.UnknownModelPolicy,
+		ProjectID:          req.ProjectID,
+		ModelBudgets:       req.ModelBudgets,
+		AlertThresholds:    req.AlertThresholds,
+		SoftLimit:          req.SoftLimit,
+		StreamCutoff:       req.StreamCutoff,
 	}
 
 	err = h.service.UpdateKey(c.Request().Context(), input)
@@ -159,6 +198,40 @@ func (h *KeyHandler) GetProviderUsage(c echo.Context) error {
 	return c.JSON(http.StatusOK, usage)
 }
 
+type ProviderCapResponse struct {
+	Provider string  `json:"provider"`
+	Limit    float64 `json:"limit"`
+	Usage    float64 `json:"usage"`
+	// Headroom is what may still be spent in the current period.
+	Headroom        float64               `json:"headroom"`
+	ResetSchedule   *domain.ResetSchedule `json:"reset_schedule,omitempty"`
+	AlertThresholds []int                 `json:"alert_thresholds,omitempty"`
+	PeriodStart     int64                 `json:"period_start"`
+}
+
+// ListProviderCaps returns the spending cap of each capped provider with its
+// usage and headroom in the current period.
+func (h *KeyHandler) ListProviderCaps(c echo.Context) error {
+	caps, err := h.service.ListProviderCaps(c.Request().Context())
+	if err != nil {
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]ProviderCapResponse, len(caps))
+	for i, pc := range caps {
+		resp[i] = ProviderCapResponse{
+			Provider:        pc.Provider,
+			Limit:           pc.Limit,
+			Usage:           pc.Usage,
+			Headroom:        pc.Headroom(),
+			ResetSchedule:   pc.Schedule,
+			AlertThresholds: pc.AlertThresholds,
+			PeriodStart:     pc.LastResetAt.Unix(),
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
 func (h *KeyHandler) ListProviders(c echo.Context) error {
 	providers, err := h.service.ListProviders(c.Request().Context())
 	if err != nil {
@@ -178,3 +251,241 @@ func (h *KeyHandler) ListMiddlewares(c echo.Context) error {
 		"middlewares": mws,
 	})
 }
+
+type ReservationResponse struct {
+	ID        int64   `json:"id"`
+	KeyID     int64   `json:"key_id"`
+	RequestID string  `json:"request_id"`
+	Model     string  `json:"model,omitempty"`
+	Amount    float64 `json:"amount"`
+	State     string  `json:"state"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+// ListReservations returns the budget reservations of in-flight requests.
+func (h *KeyHandler) ListReservations(c echo.Context) error {
+	reservations, err := h.service.ListOpenReservations(c.Request().Context())
+	if err != nil {
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]ReservationResponse, len(reservations))
+	for i, r := range reservations {
+		resp[i] = ReservationResponse{
+			ID:        r.ID,
+			KeyID:     int64(r.KeyID),
+			RequestID: r.RequestID,
+			Model:     string(r.Model),
+			Amount:    r.Amount,
+			State:     string(r.State),
+			CreatedAt: r.CreatedAt.Unix(),
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+type EventResponse struct {
+	ID        int64  `json:"id"`
+	KeyID     int64  `json:"key_id,omitempty"`
+	Type      string `json:"type"`
+	Model     string `json:"model,omitempty"`
+	Message   string `json:"message"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// defaultEventLimit and maxEventLimit bound the entries returned by
+// ListEvents, ListBudgetResets and GetKeyUsage.
+const (
+	defaultEventLimit = 100
+	maxEventLimit     = 1000
+)
+
+// ListEvents returns the most recent events, e.g. requests for models
+// without pricing.
+func (h *KeyHandler) ListEvents(c echo.Context) error {
+	limit := defaultEventLimit
+	if val := c.QueryParam("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			return BadRequest(c, "Invalid limit")
+		}
+		limit = min(n, maxEventLimit)
+	}
+
+	events, err := h.service.ListEvents(c.Request().Context(), limit)
+	if err != nil {
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]EventResponse, len(events))
+	for i, e := range events {
+		resp[i] = EventResponse{
+			ID:        e.ID,
+			KeyID:     int64(e.KeyID),
+			Type:      string(e.Type),
+			Model:     string(e.Model),
+			Message:   e.Message,
+			CreatedAt: e.CreatedAt.Unix(),
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+type BudgetResetResponse struct {
+	ID          int64   `json:"id"`
+	Scope       string  `json:"scope"`
+	ScopeID     int64   `json:"scope_id"`
+	Name        string  `json:"name"`
+	Usage       float64 `json:"usage"`
+	PeriodStart int64   `json:"period_start"`
+	ResetAt     int64   `json:"reset_at"`
+}
+
+// ListBudgetResets returns the most recent budget resets of keys, projects
+// and organizations, with what was spent in each period that ended.
+func (h *KeyHandler) ListBudgetResets(c echo.Context) error {
+	limit := defaultEventLimit
+	if val := c.QueryParam("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			return BadRequest(c, "Invalid limit")
+		}
+		limit = min(n, maxEventLimit)
+	}
+
+	resets, err := h.service.ListBudgetResets(c.Request().Context(), limit)
+	if err != nil {
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]BudgetResetResponse, len(resets))
+	for i, r := range resets {
+		resp[i] = BudgetResetResponse{
+			ID:          r.ID,
+			Scope:       string(r.Scope),
+			ScopeID:     int64(r.ScopeID),
+			Name:        r.Name,
+			Usage:       r.Usage,
+			PeriodStart: r.PeriodStart.Unix(),
+			ResetAt:     r.ResetAt.Unix(),
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+type UsageSummaryResponse struct {
+	Model        string  `json:"model,omitempty"`
+	Requests     int     `json:"requests"`
+	PromptTokens int     `json:"prompt_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+type UsageEventResponse struct {
+	ID           int64   `json:"id"`
+	RequestID    string  `json:"request_id"`
+	Model        string  `json:"model,omitempty"`
+	Provider     string  `json:"provider"`
+	Endpoint     string  `json:"endpoint,omitempty"`
+	PromptTokens int     `json:"prompt_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	ReservedCost float64 `json:"reserved_cost"`
+	ActualCost   float64 `json:"actual_cost"`
+	StatusCode   int     `json:"status_code"`
+	LatencyMs    int64   `json:"latency_ms"`
+	Stream       bool    `json:"stream"`
+	CreatedAt    int64   `json:"created_at"`
+}
+
+type KeyUsageResponse struct {
+	KeyID  int64                  `json:"key_id"`
+	Total  UsageSummaryResponse   `json:"total"`
+	Models []UsageSummaryResponse `json:"models"`
+	Events []UsageEventResponse   `json:"events"`
+}
+
+func mapUsageSummary(s *domain.UsageSummary) UsageSummaryResponse {
+	return UsageSummaryResponse{
+		Model:        string(s.Model),
+		Requests:     s.Requests,
+		PromptTokens: s.PromptTokens,
+		OutputTokens: s.OutputTokens,
+		Cost:         s.Cost,
+	}
+}
+
+// parseTimeParam reads a time given as RFC 3339, as a UTC date
+// (2006-01-02) or as Unix seconds; empty gives the zero time.
+func parseTimeParam(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if t, err := time.Parse(time.DateOnly, val); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, val)
+}
+
+// GetKeyUsage returns the key's usage ledger between ?from and ?to (see
+// parseTimeParam; to is exclusive), totalled overall and by model, with up to
+// ?limit of the most recent requests.
+func (h *KeyHandler) GetKeyUsage(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return BadRequest(c, "Invalid ID")
+	}
+
+	q := domain.UsageQuery{KeyID: domain.ID(id), Limit: defaultEventLimit}
+	if q.From, err = parseTimeParam(c.QueryParam("from")); err != nil {
+		return BadRequest(c, "Invalid from")
+	}
+	if q.To, err = parseTimeParam(c.QueryParam("to")); err != nil {
+		return BadRequest(c, "Invalid to")
+	}
+	if val := c.QueryParam("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			return BadRequest(c, "Invalid limit")
+		}
+		q.Limit = min(n, maxEventLimit)
+	}
+
+	usage, err := h.service.GetKeyUsage(c.Request().Context(), q)
+	if err != nil {
+		if errors.Is(err, domain.ErrKeyNotFound) {
+			return NewAPIError(c, http.StatusNotFound, err.Error())
+		}
+		return InternalError(c, err.Error())
+	}
+
+	resp := KeyUsageResponse{
+		KeyID:  id,
+		Total:  mapUsageSummary(&usage.Total),
+		Models: make([]UsageSummaryResponse, len(usage.Models)),
+		Events: make([]UsageEventResponse, len(usage.Events)),
+	}
+	for i, m := range usage.Models {
+		resp.Models[i] = mapUsageSummary(m)
+	}
+	for i, e := range usage.Events {
+		resp.Events[i] = UsageEventResponse{
+			ID:           e.ID,
+			RequestID:    e.RequestID,
+			Model:        string(e.Model),
+			Provider:     e.Provider,
+			Endpoint:     string(e.Endpoint),
+			PromptTokens: e.PromptTokens,
+			OutputTokens: e.OutputTokens,
+			ReservedCost: e.ReservedCost,
+			ActualCost:   e.ActualCost,
+			StatusCode:   e.StatusCode,
+			LatencyMs:    e.Latency.Milliseconds(),
+			Stream:       e.Stream,
+			CreatedAt:    e.CreatedAt.Unix(),
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -1,15 +1,24 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"path"
+	"pouch-ai/backend/config"
 	"pouch-ai/backend/domain"
 	"pouch-ai/backend/service"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-const MaxBodySize = 10 * 1024 * 1024 // 10MB
+const (
+	MaxBodySize   = 10 * 1024 * 1024 // 10MB
+	MaxUploadSize = 25 * 1024 * 1024 // 25MB, the upstream limit for audio and image files
+)
 
 type ProxyHandler struct {
 	proxyService *service.ProxyService
@@ -24,7 +33,41 @@ func NewProxyHandler(ps *service.ProxyService, r domain.ProviderRegistry) *Proxy
 }
 
 func (h *ProxyHandler) Proxy(c echo.Context) error {
-	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, MaxBodySize)
+	return h.proxy(c, domain.EndpointChat, nil)
+}
+
+// ProxyEndpoint returns a handler that proxies a non-chat endpoint to the
+// key's provider, if the provider supports it.
+func (h *ProxyHandler) ProxyEndpoint(endpoint domain.Endpoint) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return h.proxy(c, endpoint, nil)
+	}
+}
+
+// PassThrough returns a catch-all handler that forwards any other /v1 path
+// verbatim to the key's provider. Paths not covered by routes are denied.
+func (h *ProxyHandler) PassThrough(routes []config.PassThroughRoute) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path := c.Param("*")
+		if !canonicalPath(path) {
+			return BadRequest(c, "Invalid path")
+		}
+		for _, route := range routes {
+			if route.Matches(path) {
+				return h.proxy(c, domain.Endpoint(path), &route)
+			}
+		}
+		return NewAPIError(c, http.StatusForbidden, "Path not allowed")
+	}
+}
+
+func (h *ProxyHandler) proxy(c echo.Context, endpoint domain.Endpoint, route *config.PassThroughRoute) error {
+	startedAt := time.Now()
+	limit := int64(MaxBodySize)
+	if route != nil || endpoint == domain.EndpointTranscriptions || endpoint == domain.EndpointImageEdits {
+		limit = MaxUploadSize
+	}
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, limit)
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		if err.Error() == "http: request body too large" {
@@ -42,28 +85,67 @@ func (h *ProxyHandler) Proxy(c echo.Context) error {
 	if appKey.Configuration == nil || appKey.Configuration.Provider.ID == "" {
 		return BadRequest(c, "Provider not configured for this key")
 	}
-	provName := appKey.Configuration.Provider.ID
-	prov, err := h.registry.Get(provName)
+	prov, err := h.proxyService.ResolveProvider(appKey)
 	if err != nil {
-		return InternalError(c, "Provider not found")
+		if errors.Is(err, domain.ErrProviderNotFound) {
+			return InternalError(c, "Provider not found")
+		}
+		return InternalError(c, err.Error())
 	}
 
-	model, isStream, err := prov.ParseRequest(body)
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	var model domain.Model
+	var isStream bool
+	var passThrough *domain.PassThrough
+	switch {
+	case route != nil:
+		if _, ok := prov.(domain.PassThroughProvider); !ok {
+			return NewAPIError(c, http.StatusNotFound, "Endpoint not supported by provider")
+		}
+		model = passThroughModel(body)
+		passThrough = &domain.PassThrough{
+			Method: c.Request().Method,
+			Path:   string(endpoint),
+			Policy: domain.CostPolicy(route.Cost),
+			Fee:    route.Fee,
+		}
+		if q := c.Request().URL.RawQuery; q != "" {
+			passThrough.Path += "?" + q
+		}
+	case endpoint == domain.EndpointChat:
+		model, isStream, err = prov.ParseRequest(body)
+	default:
+		ep, ok := prov.(domain.EndpointProvider)
+		if !ok || !ep.SupportsEndpoint(endpoint) {
+			return NewAPIError(c, http.StatusNotFound, "Endpoint not supported by provider")
+		}
+		model, isStream, err = ep.ParseEndpointRequest(endpoint, contentType, body)
+	}
 	if err != nil {
 		return BadRequest(c, "Invalid request body")
 	}
 
 	req := &domain.Request{
-		Context:  c.Request().Context(),
-		Key:      appKey,
-		Provider: prov,
-		Model:    model,
-		RawBody:  body,
-		IsStream: isStream,
+		Context:     c.Request().Context(),
+		Key:         appKey,
+		Provider:    prov,
+		Endpoint:    endpoint,
+		Model:       model,
+		ContentType: contentType,
+		PassThrough: passThrough,
+		RawBody:     body,
+		IsStream:    isStream,
+		StartedAt:   startedAt,
 	}
 
 	resp, err := h.proxyService.Execute(req)
 	if err != nil {
+		if errors.Is(err, domain.ErrModelNotAllowed) {
+			return NewAPIError(c, http.StatusForbidden, err.Error())
+		}
+		if errors.Is(err, domain.ErrUnknownModel) {
+			return BadRequest(c, err.Error())
+		}
 		return BadGateway(c, err.Error())
 	}
 	defer resp.Body.Close()
@@ -84,3 +166,87 @@ func (h *ProxyHandler) Proxy(c echo.Context) error {
 
 	return c.Stream(resp.StatusCode, c.Response().Header().Get("Content-Type"), resp.Body)
 }
+
+type modelPricing struct {
+	Input      float64            `json:"input"`
+	Output     float64            `json:"output"`
+	PerSecond  float64            `json:"per_second,omitempty"`
+	Per1KChars float64            `json:"per_1k_chars,omitempty"`
+	PerImage   map[string]float64 `json:"per_image,omitempty"`
+}
+
+type modelEntry struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	Pouch   struct {
+		Pricing *modelPricing `json:"pricing,omitempty"`
+	} `json:"pouch"`
+}
+
+// Models lists the models the key may use in the OpenAI list format, with
+// their pricing under "pouch". Providers that cannot list models return an
+// empty list.
+func (h *ProxyHandler) Models(c echo.Context) error {
+	appKey, ok := c.Get("app_key").(*domain.Key)
+	if !ok {
+		return Unauthorized(c, "App Key not found")
+	}
+	if appKey.Configuration == nil || appKey.Configuration.Provider.ID == "" {
+		return BadRequest(c, "Provider not configured for this key")
+	}
+	prov, err := h.proxyService.ResolveProvider(appKey)
+	if err != nil {
+		if errors.Is(err, domain.ErrProviderNotFound) {
+			return InternalError(c, "Provider not found")
+		}
+		return InternalError(c, err.Error())
+	}
+
+	models, err := h.proxyService.ListModels(c.Request().Context(), appKey)
+	if err != nil && !errors.Is(err, domain.ErrNotSupported) {
+		return BadGateway(c, err.Error())
+	}
+
+	data := make([]modelEntry, 0, len(models))
+	for _, m := range models {
+		entry := modelEntry{ID: string(m), Object: "model", OwnedBy: prov.Name()}
+		if p, err := prov.GetPricing(m); err == nil {
+			entry.Pouch.Pricing = &modelPricing{
+				Input:      p.Input,
+				Output:     p.Output,
+				PerSecond:  p.PerSecond,
+				Per1KChars: p.Per1KChars,
+				PerImage:   p.PerImage,
+			}
+		}
+		data = append(data, entry)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// canonicalPath reports whether a pass-through path resolves to itself
+// upstream, so that a path matching a route cannot reach another endpoint
+// through dot or empty segments, or escaped slashes and dots.
+func canonicalPath(p string) bool {
+	if escaped := strings.ToUpper(p); strings.Contains(escaped, "%2F") || strings.Contains(escaped, "%2E") {
+		return false
+	}
+	return path.Clean("/"+p) == "/"+p
+}
+
+// passThroughModel reads the model of a JSON pass-through body, if any.
+func passThroughModel(body []byte) domain.Model {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return domain.Model(req.Model)
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"pouch-ai/backend/domain"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReportRowResponse struct {
+	// Period is the start of the period: a date, or a time for hours.
+	Period       string  `json:"period,omitempty"`
+	KeyID        int64   `json:"key_id,omitempty"`
+	KeyName      string  `json:"key_name,omitempty"`
+	Provider     string  `json:"provider,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Requests     int     `json:"requests"`
+	PromptTokens int     `json:"prompt_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+type UsageReportResponse struct {
+	Period  string               `json:"period,omitempty"`
+	GroupBy []string             `json:"group_by"`
+	Rows    []ReportRowResponse  `json:"rows"`
+	Total   UsageSummaryResponse `json:"total"`
+}
+
+func mapReportRow(q domain.ReportQuery, r *domain.ReportRow) ReportRowResponse {
+	row := ReportRowResponse{
+		KeyID:        int64(r.KeyID),
+		KeyName:      r.KeyName,
+		Provider:     r.Provider,
+		Model:        string(r.Model),
+		Requests:     r.Requests,
+		PromptTokens: r.PromptTokens,
+		OutputTokens: r.OutputTokens,
+		Cost:         r.Cost,
+	}
+	switch q.Period {
+	case domain.ReportTotal:
+	case domain.ReportHour:
+		row.Period = r.PeriodStart.Format(time.RFC3339)
+	default:
+		row.Period = r.PeriodStart.Format(time.DateOnly)
+	}
+	return row
+}
+
+// UsageReport returns spend grouped by ?period (hour, day, week or month;
+// none totals the range) and by the comma-separated ?group_by dimensions
+// (key, provider, model; default key), for periods starting between ?from
+// and ?to (see parseTimeParam; to is exclusive). ?format=csv exports the
+// rows as CSV.
+func (h *KeyHandler) UsageReport(c echo.Context) error {
+	q := domain.ReportQuery{
+		Period:  domain.ReportPeriod(c.QueryParam("period")),
+		GroupBy: []domain.ReportGroup{domain.ReportByKey},
+	}
+	var err error
+	if q.From, err = parseTimeParam(c.QueryParam("from")); err != nil {
+		return BadRequest(c, "Invalid from")
+	}
+	if q.To, err = parseTimeParam(c.QueryParam("to")); err != nil {
+		return BadRequest(c, "Invalid to")
+	}
+	if val := c.QueryParam("group_by"); val != "" {
+		q.GroupBy = nil
+		for _, g := range strings.Split(val, ",") {
+			q.GroupBy = append(q.GroupBy, domain.ReportGroup(strings.TrimSpace(g)))
+		}
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return BadRequest(c, "Invalid format")
+	}
+
+	report, err := h.service.UsageReport(c.Request().Context(), q)
+	if err != nil {
+		switch {
+		case domain.IsValidationError(err):
+			return BadRequest(c, err.Error())
+		case errors.Is(err, domain.ErrNotSupported):
+			return NewAPIError(c, http.StatusNotImplemented, err.Error())
+		}
+		return InternalError(c, err.Error())
+	}
+
+	resp := UsageReportResponse{
+		Period: string(q.Period),
+		Rows:   make([]ReportRowResponse, len(report)),
+	}
+	for _, g := range q.GroupBy {
+		resp.GroupBy = append(resp.GroupBy, string(g))
+	}
+	for i, r := range report {
+		resp.Rows[i] = mapReportRow(q, r)
+		resp.Total.Requests += r.Requests
+		resp.Total.PromptTokens += r.PromptTokens
+		resp.Total.OutputTokens += r.OutputTokens
+		resp.Total.Cost += r.Cost
+	}
+
+	if format == "csv" {
+		return writeReportCSV(c, q, resp.Rows)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// writeReportCSV writes the rows with a column for the period, if any, and
+// for each dimension grouped by.
+func writeReportCSV(c echo.Context, q domain.ReportQuery, rows []ReportRowResponse) error {
+	var header []string
+	if q.Period != domain.ReportTotal {
+		header = append(header, "period")
+	}
+	if q.Groups(domain.ReportByKey) {
+		header = append(header, "key_id", "key_name")
+	}
+	if q.Groups(domain.ReportByProvider) {
+		header = append(header, "provider")
+	}
+	if q.Groups(domain.ReportByModel) {
+		header = append(header, "model")
+	}
+	header = append(header, "requests", "prompt_tokens", "output_tokens", "cost")
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="usage-report.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	_ = w.Write(header)
+	for _, r := range rows {
+		var record []string
+		if q.Period != domain.ReportTotal {
+			record = append(record, r.Period)
+		}
+		if q.Groups(domain.ReportByKey) {
+			record = append(record, strconv.FormatInt(r.KeyID, 10), r.KeyName)
+		}
+		if q.Groups(domain.ReportByProvider) {
+			record = append(record, r.Provider)
+		}
+		if q.Groups(domain.ReportByModel) {
+			record = append(record, r.Model)
+		}
+		record = append(record,
+			strconv.Itoa(r.Requests),
+			strconv.Itoa(r.PromptTokens),
+			strconv.Itoa(r.OutputTokens),
+			strconv.FormatFloat(r.Cost, 'f', -1, 64),
+		)
+		_ = w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+type ReconciliationResponse struct {
+	Provider string `json:"provider"`
+	// PeriodStart and PeriodEnd are UTC dates; the end is exclusive.
+	PeriodStart  string  `json:"period_start"`
+	PeriodEnd    string  `json:"period_end"`
+	Billed       float64 `json:"billed"`
+	Recorded     float64 `json:"recorded"`
+	Drift        float64 `json:"drift"`
+	DriftPercent float64 `json:"drift_percent"`
+	Flagged      bool    `json:"flagged"`
+}
+
+// ReconcileBilling compares what each provider billed with the usage ledger
+// for each ?period (day, week or month; none compares the whole range;
+// default day) between ?from and ?to (see parseTimeParam; to is exclusive).
+// The range defaults to the completed days of the current UTC month, or of
+// the previous month on the 1st.
+func (h *KeyHandler) ReconcileBilling(c echo.Context) error {
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	q := domain.ReportQuery{
+		From:   time.Date(yesterday.Year(), yesterday.Month(), 1, 0, 0, 0, 0, time.UTC),
+		To:     now,
+		Period: domain.ReportDay,
+	}
+	if c.QueryParams().Has("period") {
+		q.Period = domain.ReportPeriod(c.QueryParam("period"))
+	}
+	if val := c.QueryParam("from"); val != "" {
+		t, err := parseTimeParam(val)
+		if err != nil {
+			return BadRequest(c, "Invalid from")
+		}
+		q.From = t
+	}
+	if val := c.QueryParam("to"); val != "" {
+		t, err := parseTimeParam(val)
+		if err != nil {
+			return BadRequest(c, "Invalid to")
+		}
+		q.To = t
+	}
+
+	results, err := h.service.ReconcileBilling(c.Request().Context(), q)
+	if err != nil {
+		switch {
+		case domain.IsValidationError(err):
+			return BadRequest(c, err.Error())
+		case errors.Is(err, domain.ErrNotSupported):
+			return NewAPIError(c, http.StatusNotImplemented, err.Error())
+		}
+		return InternalError(c, err.Error())
+	}
+
+	resp := make([]ReconciliationResponse, len(results))
+	for i, r := range results {
+		resp[i] = ReconciliationResponse{
+			Provider:     r.Provider,
+			PeriodStart:  r.PeriodStart.Format(time.DateOnly),
+			PeriodEnd:    r.PeriodEnd.Format(time.DateOnly),
+			Billed:       r.Billed,
+			Recorded:     r.Recorded,
+			Drift:        r.Drift,
+			DriftPercent: r.DriftPercent,
+			Flagged:      r.Flagged,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -1,10 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,14 +15,217 @@ type Config struct {
 	DataDir        string
 	AllowedOrigins []string
 	OpenAIKey      string
+	AnthropicURL   string
+	AnthropicKey   string
+	GeminiURL      string
+	GeminiKey      string
+
+	AzureOpenAIURL         string
+	AzureOpenAIKey         string
+	AzureOpenAIAPIVersion  string
+	AzureOpenAIDeployments string
+
+	BedrockRegion          string
+	BedrockURL             string
+	BedrockAccessKeyID     string
+	BedrockSecretAccessKey string
+
+	// ConfigFile is an optional JSON file with settings that do not fit in
+	// flags or env vars, such as the OpenAI-compatible provider instances.
+	ConfigFile          string
+	CompatibleProviders []CompatibleProviderConfig
+	// PassThrough lists the other /v1 paths that may be forwarded verbatim to
+	// a key's provider. Unlisted paths are denied.
+	PassThrough []PassThroughRoute
+
+	// ReservationTTL is how long a budget reservation may stay open before it
+	// is reconciled under ReservationPolicy ("refund" or "charge").
+	ReservationTTL    time.Duration
+	ReservationPolicy string
+
+	// UnknownModelPolicy is how requests for models without pricing are
+	// handled by default: "reject", "fallback" (priced at the fallback rates,
+	// USD per 1k tokens) or "allow" (unmetered).
+	UnknownModelPolicy      string
+	UnknownModelInputPrice  float64
+	UnknownModelOutputPrice float64
+
+	// BudgetTimezone is the IANA timezone calendar budget periods are
+	// aligned to unless they name their own.
+	BudgetTimezone string
+
+	// Alerts sets the default budget alert thresholds and where alerts are
+	// sent.
+	Alerts AlertsConfig
+	// ProviderCaps are hard limits on the combined spend of all keys of a
+	// provider.
+	ProviderCaps []ProviderCapConfig
+
+	// BillingDriftThreshold (a percentage) and BillingDriftMin (USD) set when
+	// the drift between a provider's billing and the usage ledger is flagged.
+	BillingDriftThreshold float64
+	BillingDriftMin       float64
+}
+
+// Reconciliation policies for stale reservations.
+const (
+	ReservationRefund = "refund"
+	ReservationCharge = "charge"
+)
+
+// Unknown model policies.
+const (
+	UnknownModelReject   = "reject"
+	UnknownModelFallback = "fallback"
+	UnknownModelAllow    = "allow"
+)
+
+// CompatibleProviderConfig describes one instance of the OpenAI-compatible
+// provider (e.g. Ollama, vLLM, Groq, OpenRouter).
+type CompatibleProviderConfig struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+	APIKey  string `json:"api_key,omitempty"`
+	// APIKeyEnv names an env var to read the API key from, so secrets can be
+	// kept out of the config file.
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	// AuthHeader defaults to "Authorization". AuthScheme defaults to "Bearer"
+	// for the Authorization header and to none for custom headers.
+	AuthHeader string `json:"auth_header,omitempty"`
+	AuthScheme string `json:"auth_scheme,omitempty"`
+	// Pricing maps models (or model prefixes, or "*") to USD per 1k tokens.
+	// An empty map makes every model free while still counting tokens.
+	Pricing json.RawMessage `json:"pricing,omitempty"`
+}
+
+// Cost policies of pass-through routes.
+const (
+	CostFree  = "free"
+	CostFlat  = "flat"
+	CostUsage = "usage"
+)
+
+// PassThroughRoute allows an upstream API path (relative to /v1) to be
+// proxied verbatim and sets how calls to it are charged.
+type PassThroughRoute struct {
+	// Path matches exactly, or as a prefix when it ends in "*" (e.g. "files/*").
+	Path string `json:"path"`
+	// Cost is "free", "flat" (Fee USD per successful call) or "usage" (priced
+	// from the token usage reported in the response).
+	Cost string  `json:"cost"`
+	Fee  float64 `json:"fee,omitempty"`
+}
+
+// Matches reports whether path (relative to /v1, without a query) is covered
+// by the route.
+func (r PassThroughRoute) Matches(path string) bool {
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == r.Path
+}
+
+func (r PassThroughRoute) validate() error {
+	if strings.Trim(r.Path, "/*") == "" {
+		return fmt.Errorf("pass-through route needs a path")
+	}
+	switch r.Cost {
+	case CostFree, CostFlat, CostUsage:
+	default:
+		return fmt.Errorf("pass-through route %s: unknown cost policy %q", r.Path, r.Cost)
+	}
+	if r.Fee < 0 {
+		return fmt.Errorf("pass-through route %s: fee must not be negative", r.Path)
+	}
+	return nil
+}
+
+// Notifier types.
+const (
+	NotifierWebhook = "webhook"
+	NotifierSlack   = "slack"
+	NotifierNtfy    = "ntfy"
+)
+
+// AlertsConfig holds the alert thresholds of keys that set none of their
+// own, as percentages of the key's budget, and the notifiers alerts go to.
+type AlertsConfig struct {
+	Thresholds []int `json:"thresholds,omitempty"`
+	// ProviderThresholds override Thresholds for the keys of a provider, by
+	// provider ID.
+	ProviderThresholds map[string][]int `json:"provider_thresholds,omitempty"`
+	Notifiers          []NotifierConfig `json:"notifiers,omitempty"`
+}
+
+// NotifierConfig describes where alerts are sent: a generic JSON "webhook",
+// a "slack" incoming webhook, or an "ntfy" topic URL.
+type NotifierConfig struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Headers are added to each request, e.g. for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (a AlertsConfig) validate() error {
+	thresholds := [][]int{a.Thresholds}
+	for _, t := range a.ProviderThresholds {
+		thresholds = append(thresholds, t)
+	}
+	for _, ts := range thresholds {
+		for _, t := range ts {
+			if t <= 0 {
+				return fmt.Errorf("alert threshold %d%% must be positive", t)
+			}
+		}
+	}
+	for _, n := range a.Notifiers {
+		switch n.Type {
+		case NotifierWebhook, NotifierSlack, NotifierNtfy:
+		default:
+			return fmt.Errorf("unknown notifier type %q", n.Type)
+		}
+		if !strings.HasPrefix(n.URL, "http://") && !strings.HasPrefix(n.URL, "https://") {
+			return fmt.Errorf("%s notifier needs an http(s) url", n.Type)
+		}
+	}
+	return nil
+}
+
+// ProviderCapConfig caps the spend of every key of a provider together.
+type ProviderCapConfig struct {
+	Provider string  `json:"provider"`
+	Limit    float64 `json:"limit"`
+	// Period is "daily", "weekly" or "monthly", aligned to the calendar like
+	// budget reset schedules, with the same Day and Timezone; empty never
+	// resets.
+	Period   string `json:"period,omitempty"`
+	Day      int    `json:"day,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// AlertThresholds default to the alerts config's thresholds.
+	AlertThresholds []int `json:"alert_thresholds,omitempty"`
+}
+
+type fileConfig struct {
+	CompatibleProviders []CompatibleProviderConfig `json:"compatible_providers"`
+	PassThrough         []PassThroughRoute         `json:"pass_through"`
+	Alerts              AlertsConfig               `json:"alerts"`
+	ProviderCaps        []ProviderCapConfig        `json:"provider_caps"`
 }
 
 func New() *Config {
 	return &Config{
-		Port:           8080,
-		OpenAIURL:      "https://api.openai.com",
-		DataDir:        "./data",
-		AllowedOrigins: []string{"*"},
+		Port:              8080,
+		OpenAIURL:         "https://api.openai.com",
+		DataDir:           "./data",
+		AllowedOrigins:    []string{"*"},
+		ReservationTTL:    time.Hour,
+		ReservationPolicy: ReservationRefund,
+
+		UnknownModelPolicy: UnknownModelReject,
+		BudgetTimezone:     "UTC",
+
+		BillingDriftThreshold: 10,
+		BillingDriftMin:       1,
 	}
 }
 
@@ -46,6 +251,137 @@ func (cfg *Config) LoadEnv() error {
 		cfg.AllowedOrigins = origins
 	}
 
+	if val := os.Getenv("POUCH_CONFIG"); val != "" {
+		cfg.ConfigFile = val
+	}
+
+	if val := os.Getenv("RESERVATION_TTL"); val != "" {
+		ttl, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid RESERVATION_TTL: %w", err)
+		}
+		cfg.ReservationTTL = ttl
+	}
+
+	if val := os.Getenv("RESERVATION_POLICY"); val != "" {
+		cfg.ReservationPolicy = val
+	}
+
+	if val := os.Getenv("UNKNOWN_MODEL_POLICY"); val != "" {
+		cfg.UnknownModelPolicy = val
+	}
+
+	if val := os.Getenv("UNKNOWN_MODEL_INPUT_PRICE"); val != "" {
+		price, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid UNKNOWN_MODEL_INPUT_PRICE: %w", err)
+		}
+		cfg.UnknownModelInputPrice = price
+	}
+
+	if val := os.Getenv("UNKNOWN_MODEL_OUTPUT_PRICE"); val != "" {
+		price, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid UNKNOWN_MODEL_OUTPUT_PRICE: %w", err)
+		}
+		cfg.UnknownModelOutputPrice = price
+	}
+
+	if val := os.Getenv("BUDGET_TIMEZONE"); val != "" {
+		cfg.BudgetTimezone = val
+	}
+
+	if val := os.Getenv("BILLING_DRIFT_THRESHOLD"); val != "" {
+		threshold, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BILLING_DRIFT_THRESHOLD: %w", err)
+		}
+		cfg.BillingDriftThreshold = threshold
+	}
+
+	if val := os.Getenv("BILLING_DRIFT_MIN"); val != "" {
+		drift, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BILLING_DRIFT_MIN: %w", err)
+		}
+		cfg.BillingDriftMin = drift
+	}
+
+	if err := cfg.validateReservations(); err != nil {
+		return err
+	}
+	if err := cfg.validateUnknownModels(); err != nil {
+		return err
+	}
+	if _, err := cfg.BudgetLocation(); err != nil {
+		return err
+	}
+	if cfg.BillingDriftThreshold < 0 || cfg.BillingDriftMin < 0 {
+		return fmt.Errorf("billing drift bounds must not be negative")
+	}
+	return nil
+}
+
+// BudgetLocation returns the location named by BudgetTimezone.
+func (cfg *Config) BudgetLocation() (*time.Location, error) {
+	loc, err := time.LoadLocation(cfg.BudgetTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid budget timezone %q: %w", cfg.BudgetTimezone, err)
+	}
+	return loc, nil
+}
+
+func (cfg *Config) validateReservations() error {
+	if cfg.ReservationTTL <= 0 {
+		return fmt.Errorf("reservation ttl must be positive")
+	}
+	switch cfg.ReservationPolicy {
+	case ReservationRefund, ReservationCharge:
+		return nil
+	}
+	return fmt.Errorf("unknown reservation policy %q (want %q or %q)", cfg.ReservationPolicy, ReservationRefund, ReservationCharge)
+}
+
+func (cfg *Config) validateUnknownModels() error {
+	if cfg.UnknownModelInputPrice < 0 || cfg.UnknownModelOutputPrice < 0 {
+		return fmt.Errorf("unknown model prices must not be negative")
+	}
+	switch cfg.UnknownModelPolicy {
+	case UnknownModelReject, UnknownModelFallback, UnknownModelAllow:
+		return nil
+	}
+	return fmt.Errorf("unknown model policy %q (want %q, %q or %q)", cfg.UnknownModelPolicy, UnknownModelReject, UnknownModelFallback, UnknownModelAllow)
+}
+
+// LoadFile reads ConfigFile, if set.
+func (cfg *Config) LoadFile() error {
+	if cfg.ConfigFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", cfg.ConfigFile, err)
+	}
+	for i := range fc.PassThrough {
+		fc.PassThrough[i].Path = strings.TrimPrefix(fc.PassThrough[i].Path, "/")
+		if err := fc.PassThrough[i].validate(); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", cfg.ConfigFile, err)
+		}
+	}
+	if err := fc.Alerts.validate(); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", cfg.ConfigFile, err)
+	}
+
+	cfg.CompatibleProviders = fc.CompatibleProviders
+	cfg.PassThrough = fc.PassThrough
+	cfg.Alerts = fc.Alerts
+	cfg.ProviderCaps = fc.ProviderCaps
 	return nil
 }
 
@@ -54,5 +390,8 @@ func Load() (*Config, error) {
 	if err := cfg.LoadEnv(); err != nil {
 		return nil, err
 	}
+	if err := cfg.LoadFile(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+	"time"
+)
+
+func (r *SQLiteKeyRepository) MarkAlerted(ctx context.Context, keyID domain.ID, threshold int, periodStart time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO budget_alerts (app_key_id, threshold, period_start, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, keyID, threshold, periodStart.Unix(), time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
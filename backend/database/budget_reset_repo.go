@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"time"
+)
+
+// budgetTables maps each budget scope to the table holding its budgets.
+var budgetTables = map[domain.BudgetScope]string{
+	domain.BudgetScopeKey:          "app_keys",
+	domain.BudgetScopeProject:      "projects",
+	domain.BudgetScopeOrganization: "organizations",
+	domain.BudgetScopeProvider:     "provider_caps",
+}
+
+// heldQueries sums the open reservations held against each budget scope.
+var heldQueries = map[domain.BudgetScope]string{
+	domain.BudgetScopeKey: `
+		SELECT COALESCE(SUM(r.amount), 0) FROM reservations r
+		WHERE r.state = 'open' AND r.app_key_id = ?`,
+	domain.BudgetScopeProject: `
+		SELECT COALESCE(SUM(r.amount), 0) FROM reservations r
+		JOIN app_keys k ON k.id = r.app_key_id
+		WHERE r.state = 'open' AND k.project_id = ?`,
+	domain.BudgetScopeOrganization: `
+		SELECT COALESCE(SUM(r.amount), 0) FROM reservations r
+		JOIN app_keys k ON k.id = r.app_key_id
+		JOIN projects p ON p.id = k.project_id
+		WHERE r.state = 'open' AND p.org_id = ?`,
+	domain.BudgetScopeProvider: `
+		SELECT COALESCE(SUM(r.amount), 0) FROM reservations r
+		JOIN app_keys k ON k.id = r.app_key_id
+		JOIN provider_caps c ON c.name = k.provider_id
+		WHERE r.state = 'open' AND c.id = ? AND k.own_credentials = 0`,
+}
+
+// ResetBudget starts a new period holding only the open reservations: they
+// are settled against the new period, which is charged what they cost.
+func (r *SQLiteKeyRepository) ResetBudget(ctx context.Context, scope domain.BudgetScope, id domain.ID, at time.Time) (*domain.BudgetReset, error) {
+	table, ok := budgetTables[scope]
+	if !ok {
+		return nil, fmt.Errorf("unknown budget scope %q", scope)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reset := &domain.BudgetReset{Scope: scope, ScopeID: id, ResetAt: at}
+	var periodStart int64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT name, budget_usage, last_reset_at FROM %s WHERE id = ?", table), id).
+		Scan(&reset.Name, &reset.Usage, &periodStart)
+	if err == sql.ErrNoRows || (err == nil && periodStart >= at.Unix()) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reset.PeriodStart = time.Unix(periodStart, 0)
+
+	if err := tx.QueryRowContext(ctx, heldQueries[scope], id).Scan(&reset.Held); err != nil {
+		return nil, err
+	}
+	reset.Usage -= reset.Held
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET budget_usage = ?, last_reset_at = ? WHERE id = ?", table), reset.Held, at.Unix(), id); err != nil {
+		return nil, err
+	}
+	if scope == domain.BudgetScopeKey {
+		// Model budgets share the key's period
+		if err := resetModelUsage(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO budget_resets (scope, scope_id, name, usage, period_start, reset_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, scope, id, reset.Name, reset.Usage, periodStart, at.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if reset.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return reset, tx.Commit()
+}
+
+// resetModelUsage zeroes the usage of the key's model budgets but for the
+// open reservations of the models they apply to.
+func resetModelUsage(ctx context.Context, tx *sql.Tx, keyID domain.ID) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM model_budget_usage WHERE app_key_id = ?", keyID); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT model, SUM(amount) FROM reservations
+		WHERE state = 'open' AND app_key_id = ? GROUP BY model`, keyID)
+	if err != nil {
+		return err
+	}
+	held := make(map[domain.Model]float64)
+	for rows.Next() {
+		var model domain.Model
+		var amount float64
+		if err := rows.Scan(&model, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		held[model] = amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for model, amount := range held {
+		if err := addModelUsage(ctx, tx, keyID, model, amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteKeyRepository) ListBudgetResets(ctx context.Context, limit int) ([]*domain.BudgetReset, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, scope, scope_id, name, usage, period_start, reset_at
+		FROM budget_resets ORDER BY reset_at DESC, id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resets []*domain.BudgetReset
+	for rows.Next() {
+		b := &domain.BudgetReset{}
+		var periodStart, resetAt int64
+		if err := rows.Scan(&b.ID, &b.Scope, &b.ScopeID, &b.Name, &b.Usage, &periodStart, &resetAt); err != nil {
+			return nil, err
+		}
+		b.PeriodStart = time.Unix(periodStart, 0)
+		b.ResetAt = time.Unix(resetAt, 0)
+		resets = append(resets, b)
+	}
+	return resets, rows.Err()
+}
+
+// marshalSchedule stores a reset schedule as JSON; nil is stored as NULL.
+func marshalSchedule(s *domain.ResetSchedule) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	b, _ := json.Marshal(s)
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+func unmarshalSchedule(ns sql.NullString) *domain.ResetSchedule {
+	if !ns.Valid || ns.String == "" {
+		return nil
+	}
+	var s domain.ResetSchedule
+	if err := json.Unmarshal([]byte(ns.String), &s); err != nil {
+		return nil
+	}
+	return &s
+}
@@ -55,7 +55,49 @@ func migrate(db *sql.DB) error {
 		provider_config TEXT,
 		-- Budget settings
 		budget_limit REAL DEFAULT 0,
-		reset_period INTEGER DEFAULT 0
+		reset_period INTEGER DEFAULT 0,
+		-- JSON calendar schedule; takes precedence over reset_period
+		reset_schedule TEXT,
+		-- JSON array of allowed models; empty allows all
+		allowed_models TEXT,
+		-- Lower max_tokens to what the remaining budget can afford
+		clamp_max_tokens INTEGER NOT NULL DEFAULT 0,
+		unknown_model_policy TEXT NOT NULL DEFAULT '',
+		-- Budget hierarchy: key -> project -> organization
+		project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL,
+		-- JSON array of per-model caps within the key's budget
+		model_budgets TEXT,
+		-- JSON array of alert thresholds, as percentages of budget_limit
+		alert_thresholds TEXT,
+		-- Allow requests past budget_limit and only alert
+		soft_limit INTEGER NOT NULL DEFAULT 0,
+		-- End chat streams once they use up the budget
+		stream_cutoff INTEGER NOT NULL DEFAULT 0,
+		-- Billed to upstream credentials of its own, outside the provider cap
+		own_credentials INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS organizations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		budget_limit REAL NOT NULL DEFAULT 0,
+		budget_usage REAL NOT NULL DEFAULT 0,
+		reset_period INTEGER NOT NULL DEFAULT 0,
+		reset_schedule TEXT,
+		last_reset_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS projects (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL,
+		name TEXT NOT NULL,
+		budget_limit REAL NOT NULL DEFAULT 0,
+		budget_usage REAL NOT NULL DEFAULT 0,
+		reset_period INTEGER NOT NULL DEFAULT 0,
+		reset_schedule TEXT,
+		last_reset_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
 	);
 
 	CREATE TABLE IF NOT EXISTS app_key_middlewares (
@@ -67,6 +109,127 @@ func migrate(db *sql.DB) error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_middlewares_key ON app_key_middlewares(app_key_id);
+
+	-- Budget held for in-flight requests; removed once the request settles
+	CREATE TABLE IF NOT EXISTS reservations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_key_id INTEGER NOT NULL REFERENCES app_keys(id) ON DELETE CASCADE,
+		request_id TEXT NOT NULL UNIQUE,
+		model TEXT NOT NULL DEFAULT '',
+		amount REAL NOT NULL,
+		state TEXT NOT NULL DEFAULT 'open',
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_reservations_state ON reservations(state, created_at);
+
+	-- Usage in the current period against each model budget of a key
+	CREATE TABLE IF NOT EXISTS model_budget_usage (
+		app_key_id INTEGER NOT NULL REFERENCES app_keys(id) ON DELETE CASCADE,
+		pattern TEXT NOT NULL,
+		usage REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (app_key_id, pattern)
+	);
+
+	-- Notable occurrences shown to admins, e.g. requests for unpriced models
+	CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_key_id INTEGER REFERENCES app_keys(id) ON DELETE SET NULL,
+		type TEXT NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_events_created ON events(created_at);
+
+	-- One row per budget period that ended, for keys, projects and organizations
+	CREATE TABLE IF NOT EXISTS budget_resets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scope TEXT NOT NULL,
+		scope_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		usage REAL NOT NULL,
+		period_start INTEGER NOT NULL,
+		reset_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_budget_resets_reset ON budget_resets(reset_at);
+
+	-- Alert thresholds already crossed, so each fires once per budget period
+	CREATE TABLE IF NOT EXISTS budget_alerts (
+		app_key_id INTEGER NOT NULL REFERENCES app_keys(id) ON DELETE CASCADE,
+		threshold INTEGER NOT NULL,
+		period_start INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (app_key_id, threshold, period_start)
+	);
+
+	-- One row per committed request; outlives its key for chargeback
+	CREATE TABLE IF NOT EXISTS usage_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_key_id INTEGER REFERENCES app_keys(id) ON DELETE SET NULL,
+		request_id TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL DEFAULT '',
+		provider TEXT NOT NULL DEFAULT '',
+		endpoint TEXT NOT NULL DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		reserved_cost REAL NOT NULL DEFAULT 0,
+		actual_cost REAL NOT NULL DEFAULT 0,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		stream INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_usage_events_key ON usage_events(app_key_id, created_at);
+
+	-- Usage per UTC hour and day, by key, provider and model, kept in step
+	-- with usage_events for reports; bucket is the start of the hour or day
+	CREATE TABLE IF NOT EXISTS usage_hourly (
+		bucket INTEGER NOT NULL,
+		app_key_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (bucket, app_key_id, provider, model)
+	);
+
+	CREATE TABLE IF NOT EXISTS usage_daily (
+		bucket INTEGER NOT NULL,
+		app_key_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (bucket, app_key_id, provider, model)
+	);
+
+	-- Caps on the combined spend of all keys of a provider, synced from the
+	-- config file; name is the provider ID
+	CREATE TABLE IF NOT EXISTS provider_caps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		budget_limit REAL NOT NULL,
+		budget_usage REAL NOT NULL DEFAULT 0,
+		reset_schedule TEXT,
+		alert_thresholds TEXT,
+		last_reset_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS provider_cap_alerts (
+		cap_id INTEGER NOT NULL REFERENCES provider_caps(id) ON DELETE CASCADE,
+		threshold INTEGER NOT NULL,
+		period_start INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (cap_id, threshold, period_start)
+	);
 	`
 
 	_, err := db.Exec(schema)
@@ -82,11 +245,38 @@ func migrate(db *sql.DB) error {
 		"ALTER TABLE app_keys ADD COLUMN budget_limit REAL DEFAULT 0",
 		"ALTER TABLE app_keys ADD COLUMN reset_period INTEGER DEFAULT 0",
 		"ALTER TABLE app_keys ADD COLUMN auto_renew INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE app_keys ADD COLUMN allowed_models TEXT",
+		"ALTER TABLE app_keys ADD COLUMN clamp_max_tokens INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE app_keys ADD COLUMN unknown_model_policy TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE app_keys ADD COLUMN project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL",
+		"ALTER TABLE app_keys ADD COLUMN reset_schedule TEXT",
+		"ALTER TABLE organizations ADD COLUMN reset_schedule TEXT",
+		"ALTER TABLE projects ADD COLUMN reset_schedule TEXT",
+		"ALTER TABLE app_keys ADD COLUMN model_budgets TEXT",
+		"ALTER TABLE reservations ADD COLUMN model TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE app_keys ADD COLUMN alert_thresholds TEXT",
+		"ALTER TABLE app_keys ADD COLUMN soft_limit INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE app_keys ADD COLUMN stream_cutoff INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE app_keys ADD COLUMN own_credentials INTEGER NOT NULL DEFAULT 0",
 	}
 
 	for _, stmt := range alterStatements {
 		_, _ = db.Exec(stmt) // Ignore errors (column may already exist)
 	}
 
+	// Roll up usage recorded before the rollup tables existed
+	for table, size := range rollupTables {
+		if _, err := db.Exec(fmt.Sprintf(`
+			INSERT INTO %[1]s (bucket, app_key_id, provider, model, requests, prompt_tokens, output_tokens, cost)
+			SELECT created_at - created_at %% %[2]d, COALESCE(app_key_id, 0), provider, model,
+			       COUNT(*), SUM(prompt_tokens), SUM(output_tokens), SUM(actual_cost)
+			FROM usage_events
+			WHERE NOT EXISTS (SELECT 1 FROM %[1]s)
+			GROUP BY 1, 2, 3, 4
+		`, table, size)); err != nil {
+			return fmt.Errorf("failed to backfill %s: %w", table, err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"pouch-ai/backend/domain"
+	"time"
+)
+
+func (r *SQLiteKeyRepository) RecordEvent(ctx context.Context, e *domain.Event) error {
+	var keyID sql.NullInt64
+	if e.KeyID != 0 {
+		keyID = sql.NullInt64{Int64: int64(e.KeyID), Valid: true}
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO events (app_key_id, type, model, message, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, keyID, e.Type, e.Model, e.Message, e.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *SQLiteKeyRepository) ListEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, app_key_id, type, model, message, created_at
+		FROM events ORDER BY created_at DESC, id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.Event
+	for rows.Next() {
+		e := &domain.Event{}
+		var keyID sql.NullInt64
+		var createdAt int64
+		if err := rows.Scan(&e.ID, &keyID, &e.Type, &e.Model, &e.Message, &createdAt); err != nil {
+			return nil, err
+		}
+		// Events outlive the keys they were recorded for
+		e.KeyID = domain.ID(keyID.Int64)
+		e.CreatedAt = time.Unix(createdAt, 0)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"time"
+)
+
+// budgetParents returns the project and organization a key's usage rolls up
+// to, if any.
+func budgetParents(ctx context.Context, db execQuerier, keyID domain.ID) (projectID, orgID sql.NullInt64, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT k.project_id, p.org_id
+		FROM app_keys k LEFT JOIN projects p ON p.id = k.project_id
+		WHERE k.id = ?
+	`, keyID).Scan(&projectID, &orgID)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return projectID, orgID, err
+}
+
+// reserveParents reserves amount against the key's project and organization.
+func reserveParents(ctx context.Context, db execQuerier, keyID domain.ID, amount float64) error {
+	projectID, orgID, err := budgetParents(ctx, db, keyID)
+	if err != nil {
+		return err
+	}
+	if projectID.Valid {
+		if err := reserveBudget(ctx, db, "projects", "project", projectID.Int64, amount); err != nil {
+			return err
+		}
+	}
+	if orgID.Valid {
+		if err := reserveBudget(ctx, db, "organizations", "organization", orgID.Int64, amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveBudget reserves amount against a project or organization with a
+// conditional UPDATE.
+func reserveBudget(ctx context.Context, db execQuerier, table, kind string, id int64, amount float64) error {
+	res, err := db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s SET budget_usage = budget_usage + ?
+		WHERE id = ? AND (budget_limit <= 0 OR budget_usage + ? <= budget_limit)`, table),
+		amount, id, amount)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	var name string
+	var usage, limit float64
+	err = db.QueryRowContext(ctx, fmt.Sprintf("SELECT name, budget_usage, budget_limit FROM %s WHERE id = ?", table), id).Scan(&name, &usage, &limit)
+	if err == sql.ErrNoRows {
+		// Deleted in the meantime; there is no budget left to enforce
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w for %s %q (limit: $%.2f, current+reservation: $%.2f)", domain.ErrBudgetExceeded, kind, name, limit, usage+amount)
+}
+
+// addUsage adds amount (which may be negative) to the usage of the key, its
+// project and its organization, and of its provider's cap.
+func addUsage(ctx context.Context, db execQuerier, keyID domain.ID, amount float64) error {
+	if _, err := db.ExecContext(ctx, "UPDATE app_keys SET budget_usage = budget_usage + ? WHERE id = ?", amount, keyID); err != nil {
+		return err
+	}
+	projectID, orgID, err := budgetParents(ctx, db, keyID)
+	if err != nil {
+		return err
+	}
+	if projectID.Valid {
+		if _, err := db.ExecContext(ctx, "UPDATE projects SET budget_usage = budget_usage + ? WHERE id = ?", amount, projectID.Int64); err != nil {
+			return err
+		}
+	}
+	if orgID.Valid {
+		if _, err := db.ExecContext(ctx, "UPDATE organizations SET budget_usage = budget_usage + ? WHERE id = ?", amount, orgID.Int64); err != nil {
+			return err
+		}
+	}
+	return addProviderCapUsage(ctx, db, keyID, amount)
+}
+
+func (r *SQLiteKeyRepository) SaveOrganization(ctx context.Context, o *domain.Organization) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO organizations (name, budget_limit, budget_usage, reset_period, reset_schedule, last_reset_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, o.Name, o.BudgetLimit, o.BudgetUsage, o.ResetPeriod, marshalSchedule(o.ResetSchedule), o.LastResetAt.Unix(), o.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	o.ID = domain.ID(id)
+	return err
+}
+
+func (r *SQLiteKeyRepository) GetOrganization(ctx context.Context, id domain.ID) (*domain.Organization, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, name, budget_limit, budget_usage, reset_period, reset_schedule, last_reset_at, created_at
+		FROM organizations WHERE id = ?
+	`, id)
+	o, err := scanOrganization(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return o, err
+}
+
+func (r *SQLiteKeyRepository) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, budget_limit, budget_usage, reset_period, reset_schedule, last_reset_at, created_at
+		FROM organizations ORDER BY name, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*domain.Organization
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+// UpdateOrganization changes the name and budget settings; usage is kept.
+func (r *SQLiteKeyRepository) UpdateOrganization(ctx context.Context, o *domain.Organization) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE organizations SET name = ?, budget_limit = ?, reset_period = ?, reset_schedule = ? WHERE id = ?
+	`, o.Name, o.BudgetLimit, o.ResetPeriod, marshalSchedule(o.ResetSchedule), o.ID)
+	return err
+}
+
+func (r *SQLiteKeyRepository) DeleteOrganization(ctx context.Context, id domain.ID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM organizations WHERE id = ?", id)
+	return err
+}
+
+func (r *SQLiteKeyRepository) SaveProject(ctx context.Context, p *domain.Project) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO projects (org_id, name, budget_limit, budget_usage, reset_period, reset_schedule, last_reset_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, nullID(p.OrgID), p.Name, p.BudgetLimit, p.BudgetUsage, p.ResetPeriod, marshalSchedule(p.ResetSchedule), p.LastResetAt.Unix(), p.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	p.ID = domain.ID(id)
+	return err
+}
+
+func (r *SQLiteKeyRepository) GetProject(ctx context.Context, id domain.ID) (*domain.Project, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, org_id, name, budget_limit, budget_usage, reset_period, reset_schedule, last_reset_at, created_at
+		FROM projects WHERE id = ?
+	`, id)
+	p, err := scanProject(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (r *SQLiteKeyRepository) ListProjects(ctx context.Context) ([]*domain.Project, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, org_id, name, budget_limit, budget_usage, reset_period, reset_schedule, last_reset_at, created_at
+		FROM projects ORDER BY name, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []*domain.Project
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// UpdateProject changes the name, organization and budget settings; usage
+// is kept.
+func (r *SQLiteKeyRepository) UpdateProject(ctx context.Context, p *domain.Project) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE projects SET org_id = ?, name = ?, budget_limit = ?, reset_period = ?, reset_schedule = ? WHERE id = ?
+	`, nullID(p.OrgID), p.Name, p.BudgetLimit, p.ResetPeriod, marshalSchedule(p.ResetSchedule), p.ID)
+	return err
+}
+
+func (r *SQLiteKeyRepository) DeleteProject(ctx context.Context, id domain.ID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM projects WHERE id = ?", id)
+	return err
+}
+
+func nullID(id domain.ID) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+func scanOrganization(sc interface{ Scan(dest ...any) error }) (*domain.Organization, error) {
+	var o domain.Organization
+	var resetSchedule sql.NullString
+	var lastResetAt, createdAt int64
+	if err := sc.Scan(&o.ID, &o.Name, &o.BudgetLimit, &o.BudgetUsage, &o.ResetPeriod, &resetSchedule, &lastResetAt, &createdAt); err != nil {
+		return nil, err
+	}
+	o.ResetSchedule = unmarshalSchedule(resetSchedule)
+	o.LastResetAt = time.Unix(lastResetAt, 0)
+	o.CreatedAt = time.Unix(createdAt, 0)
+	return &o, nil
+}
+
+func scanProject(sc interface{ Scan(dest ...any) error }) (*domain.Project, error) {
+	var p domain.Project
+	var orgID sql.NullInt64
+	var resetSchedule sql.NullString
+	var lastResetAt, createdAt int64
+	if err := sc.Scan(&p.ID, &orgID, &p.Name, &p.BudgetLimit, &p.BudgetUsage, &p.ResetPeriod, &resetSchedule, &lastResetAt, &createdAt); err != nil {
+		return nil, err
+	}
+	p.ResetSchedule = unmarshalSchedule(resetSchedule)
+	p.OrgID = domain.ID(orgID.Int64)
+	p.LastResetAt = time.Unix(lastResetAt, 0)
+	p.CreatedAt = time.Unix(createdAt, 0)
+	return &p, nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"pouch-ai/backend/domain"
+)
+
+// matchingModelBudgets returns the key's model budgets that apply to model.
+func matchingModelBudgets(ctx context.Context, db execQuerier, keyID domain.ID, model domain.Model) ([]domain.ModelBudget, error) {
+	if model == "" {
+		return nil, nil
+	}
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT model_budgets FROM app_keys WHERE id = ?", keyID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil || !raw.Valid || raw.String == "" {
+		return nil, err
+	}
+
+	var budgets []domain.ModelBudget
+	if err := json.Unmarshal([]byte(raw.String), &budgets); err != nil {
+		return nil, nil
+	}
+	matching := budgets[:0]
+	for _, b := range budgets {
+		if b.Matches(model) {
+			matching = append(matching, b)
+		}
+	}
+	return matching, nil
+}
+
+// reserveModelBudgets reserves amount against each of the key's model
+// budgets that apply to model, with the same conditional UPDATE as the key
+// budget. It must run in the transaction that reserved the key budget.
+func reserveModelBudgets(ctx context.Context, db execQuerier, keyID domain.ID, model domain.Model, amount float64) error {
+	budgets, err := matchingModelBudgets(ctx, db, keyID, model)
+	if err != nil {
+		return err
+	}
+	for _, b := range budgets {
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO model_budget_usage (app_key_id, pattern) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, keyID, b.Model); err != nil {
+			return err
+		}
+		res, err := db.ExecContext(ctx, `
+			UPDATE model_budget_usage SET usage = usage + ?
+			WHERE app_key_id = ? AND pattern = ? AND usage + ? <= ?`,
+			amount, keyID, b.Model, amount, b.Limit)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+
+		var usage float64
+		if err := db.QueryRowContext(ctx, "SELECT usage FROM model_budget_usage WHERE app_key_id = ? AND pattern = ?", keyID, b.Model).Scan(&usage); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w for model %q (limit: $%.2f, current+reservation: $%.2f)", domain.ErrBudgetExceeded, b.Model, b.Limit, usage+amount)
+	}
+	return nil
+}
+
+// addModelUsage adds amount (which may be negative) to the usage of each of
+// the key's model budgets that apply to model.
+func addModelUsage(ctx context.Context, db execQuerier, keyID domain.ID, model domain.Model, amount float64) error {
+	budgets, err := matchingModelBudgets(ctx, db, keyID, model)
+	if err != nil {
+		return err
+	}
+	for _, b := range budgets {
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO model_budget_usage (app_key_id, pattern, usage) VALUES (?, ?, ?)
+			ON CONFLICT DO UPDATE SET usage = usage + excluded.usage`,
+			keyID, b.Model, amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadModelUsage fills in the usage of the key's model budgets; budgets not
+// used yet in the current period report zero.
+func (r *SQLiteKeyRepository) loadModelUsage(ctx context.Context, k *domain.Key) (*domain.Key, error) {
+	if k.Configuration == nil || len(k.Configuration.ModelBudgets) == 0 {
+		return k, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT pattern, usage FROM model_budget_usage WHERE app_key_id = ?", k.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]float64)
+	for rows.Next() {
+		var pattern string
+		var usage float64
+		if err := rows.Scan(&pattern, &usage); err != nil {
+			return nil, err
+		}
+		stored[pattern] = usage
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Patterns no longer configured are not reported
+	k.ModelUsage = make(map[string]float64, len(k.Configuration.ModelBudgets))
+	for _, b := range k.Configuration.ModelBudgets {
+		k.ModelUsage[b.Model] = stored[b.Model]
+	}
+	return k, nil
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"strings"
+	"time"
+)
+
+// cappedProvider selects the provider whose cap a key's usage counts
+// against: none for keys billed to credentials of their own.
+const cappedProvider = "(SELECT provider_id FROM app_keys WHERE id = ? AND own_credentials = 0)"
+
+// reserveProviderCap reserves amount against the cap of the key's provider,
+// if it has one, with a conditional UPDATE. It must run in the transaction
+// that reserved the key budget.
+func reserveProviderCap(ctx context.Context, db execQuerier, keyID domain.ID, amount float64) error {
+	res, err := db.ExecContext(ctx, `
+		UPDATE provider_caps SET budget_usage = budget_usage + ?
+		WHERE name = `+cappedProvider+` AND budget_usage + ? <= budget_limit`,
+		amount, keyID, amount)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	var name string
+	var usage, limit float64
+	err = db.QueryRowContext(ctx, `
+		SELECT name, budget_usage, budget_limit FROM provider_caps
+		WHERE name = `+cappedProvider, keyID).Scan(&name, &usage, &limit)
+	if err == sql.ErrNoRows {
+		// The provider is not capped
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w for provider %q (cap: $%.2f, current+reservation: $%.2f)", domain.ErrBudgetExceeded, name, limit, usage+amount)
+}
+
+// addProviderCapUsage adds amount (which may be negative) to the usage of
+// the cap of the key's provider, if it has one.
+func addProviderCapUsage(ctx context.Context, db execQuerier, keyID domain.ID, amount float64) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE provider_caps SET budget_usage = budget_usage + ?
+		WHERE name = `+cappedProvider, amount, keyID)
+	return err
+}
+
+func (r *SQLiteKeyRepository) SyncProviderCaps(ctx context.Context, caps []*domain.ProviderCap) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	names := make([]string, len(caps))
+	args := make([]any, len(caps))
+	for i, c := range caps {
+		names[i] = "?"
+		args[i] = c.Provider
+	}
+	query := "DELETE FROM provider_caps"
+	if len(caps) > 0 {
+		query += " WHERE name NOT IN (" + strings.Join(names, ", ") + ")"
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	for _, c := range caps {
+		var thresholds sql.NullString
+		if len(c.AlertThresholds) > 0 {
+			b, _ := json.Marshal(c.AlertThresholds)
+			thresholds = sql.NullString{String: string(b), Valid: true}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO provider_caps (name, budget_limit, budget_usage, reset_schedule, alert_thresholds, last_reset_at)
+			VALUES (?, ?, (
+				SELECT COALESCE(SUM(e.actual_cost), 0)
+				FROM usage_events e LEFT JOIN app_keys k ON k.id = e.app_key_id
+				WHERE e.provider = ? AND e.created_at >= ? AND COALESCE(k.own_credentials, 0) = 0
+			), ?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET
+				budget_limit = excluded.budget_limit,
+				reset_schedule = excluded.reset_schedule,
+				alert_thresholds = excluded.alert_thresholds
+		`, c.Provider, c.Limit, c.Provider, c.LastResetAt.Unix(), marshalSchedule(c.Schedule), thresholds, c.LastResetAt.Unix()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const providerCapColumns = "id, name, budget_limit, budget_usage, reset_schedule, alert_thresholds, last_reset_at"
+
+func scanProviderCap(sc interface{ Scan(dest ...any) error }) (*domain.ProviderCap, error) {
+	c := &domain.ProviderCap{}
+	var schedule, thresholds sql.NullString
+	var lastResetAt int64
+	if err := sc.Scan(&c.ID, &c.Provider, &c.Limit, &c.Usage, &schedule, &thresholds, &lastResetAt); err != nil {
+		return nil, err
+	}
+	c.Schedule = unmarshalSchedule(schedule)
+	if thresholds.Valid && thresholds.String != "" {
+		_ = json.Unmarshal([]byte(thresholds.String), &c.AlertThresholds)
+	}
+	c.LastResetAt = time.Unix(lastResetAt, 0)
+	return c, nil
+}
+
+func (r *SQLiteKeyRepository) ListProviderCaps(ctx context.Context) ([]*domain.ProviderCap, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+providerCapColumns+" FROM provider_caps ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var caps []*domain.ProviderCap
+	for rows.Next() {
+		c, err := scanProviderCap(rows)
+		if err != nil {
+			return nil, err
+		}
+		caps = append(caps, c)
+	}
+	return caps, rows.Err()
+}
+
+func (r *SQLiteKeyRepository) GetProviderCap(ctx context.Context, provider string) (*domain.ProviderCap, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+providerCapColumns+" FROM provider_caps WHERE name = ?", provider)
+	c, err := scanProviderCap(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (r *SQLiteKeyRepository) MarkCapAlerted(ctx context.Context, capID domain.ID, threshold int, periodStart time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO provider_cap_alerts (cap_id, threshold, period_start, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, capID, threshold, periodStart.Unix(), time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"strings"
+	"time"
+)
+
+// reportPeriods maps each report period to the rollup table it is read from
+// and the expression of its start in Unix seconds.
+var reportPeriods = map[domain.ReportPeriod]struct{ table, start string }{
+	domain.ReportTotal: {"usage_daily", "0"},
+	domain.ReportHour:  {"usage_hourly", "r.bucket"},
+	domain.ReportDay:   {"usage_daily", "r.bucket"},
+	// Weeks start on Monday; 1970-01-01 was a Thursday, 3 days after one
+	domain.ReportWeek:  {"usage_daily", "r.bucket - ((r.bucket / 86400 + 3) % 7) * 86400"},
+	domain.ReportMonth: {"usage_daily", "CAST(strftime('%s', r.bucket, 'unixepoch', 'start of month') AS INTEGER)"},
+}
+
+func (r *SQLiteKeyRepository) UsageReport(ctx context.Context, q domain.ReportQuery) ([]*domain.ReportRow, error) {
+	period, ok := reportPeriods[q.Period]
+	if !ok {
+		return nil, fmt.Errorf("unknown report period %q", q.Period)
+	}
+
+	keyID, keyName, provider, model := "0", "''", "''", "''"
+	groups := []string{"1"}
+	if q.Groups(domain.ReportByKey) {
+		keyID, keyName = "r.app_key_id", "COALESCE(MAX(k.name), '')"
+		groups = append(groups, keyID)
+	}
+	if q.Groups(domain.ReportByProvider) {
+		provider = "r.provider"
+		groups = append(groups, provider)
+	}
+	if q.Groups(domain.ReportByModel) {
+		model = "r.model"
+		groups = append(groups, model)
+	}
+
+	var conds []string
+	var args []any
+	if !q.From.IsZero() {
+		conds = append(conds, "r.bucket >= ?")
+		args = append(args, q.From.Unix())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "r.bucket < ?")
+		args = append(args, q.To.Unix())
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, %s, %s, %s, %s,
+		       SUM(r.requests), SUM(r.prompt_tokens), SUM(r.output_tokens), SUM(r.cost)
+		FROM %s r LEFT JOIN app_keys k ON k.id = r.app_key_id
+		%s
+		GROUP BY %s
+		ORDER BY 1, SUM(r.cost) DESC
+	`, period.start, keyID, keyName, provider, model, period.table, where, strings.Join(groups, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []*domain.ReportRow
+	for rows.Next() {
+		row := &domain.ReportRow{}
+		var start int64
+		if err := rows.Scan(&start, &row.KeyID, &row.KeyName, &row.Provider, &row.Model,
+			&row.Requests, &row.PromptTokens, &row.OutputTokens, &row.Cost); err != nil {
+			return nil, err
+		}
+		if q.Period != domain.ReportTotal {
+			row.PeriodStart = time.Unix(start, 0).UTC()
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"time"
+)
+
+func (r *SQLiteKeyRepository) Reserve(ctx context.Context, res *domain.Reservation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reserveUsage(ctx, tx, res.KeyID, res.Amount); err != nil {
+		return err
+	}
+	if err := reserveModelBudgets(ctx, tx, res.KeyID, res.Model, res.Amount); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO reservations (app_key_id, request_id, model, amount, state, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, res.KeyID, res.RequestID, res.Model, res.Amount, domain.ReservationOpen, res.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	if res.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	res.State = domain.ReservationOpen
+
+	return tx.Commit()
+}
+
+func (r *SQLiteKeyRepository) Headroom(ctx context.Context, keyID domain.ID, model domain.Model) (float64, bool, error) {
+	remaining, limited := 0.0, false
+	room := func(limit, usage float64) {
+		if limit > 0 && (!limited || limit-usage < remaining) {
+			remaining, limited = limit-usage, true
+		}
+	}
+
+	var limit, usage float64
+	var soft bool
+	err := r.db.QueryRowContext(ctx, "SELECT budget_limit, budget_usage, soft_limit FROM app_keys WHERE id = ?", keyID).Scan(&limit, &usage, &soft)
+	if err == sql.ErrNoRows {
+		return 0, false, domain.ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if !soft {
+		room(limit, usage)
+	}
+
+	projectID, orgID, err := budgetParents(ctx, r.db, keyID)
+	if err != nil {
+		return 0, false, err
+	}
+	parents := []struct {
+		table string
+		id    sql.NullInt64
+	}{{"projects", projectID}, {"organizations", orgID}}
+	for _, p := range parents {
+		if !p.id.Valid {
+			continue
+		}
+		err := r.db.QueryRowContext(ctx, fmt.Sprintf("SELECT budget_limit, budget_usage FROM %s WHERE id = ?", p.table), p.id.Int64).Scan(&limit, &usage)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, false, err
+		}
+		if err == nil {
+			room(limit, usage)
+		}
+	}
+
+	err = r.db.QueryRowContext(ctx, "SELECT budget_limit, budget_usage FROM provider_caps WHERE name = "+cappedProvider, keyID).Scan(&limit, &usage)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if err == nil {
+		room(limit, usage)
+	}
+
+	budgets, err := matchingModelBudgets(ctx, r.db, keyID, model)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, b := range budgets {
+		usage = 0
+		err := r.db.QueryRowContext(ctx, "SELECT usage FROM model_budget_usage WHERE app_key_id = ? AND pattern = ?", keyID, b.Model).Scan(&usage)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, false, err
+		}
+		room(b.Limit, usage)
+	}
+
+	return remaining, limited, nil
+}
+
+// Commit removes the reservation from the ledger and applies the difference
+// between the actual cost and what the reservation still holds: nothing if
+// it was refunded, its amount otherwise.
+func (r *SQLiteKeyRepository) Commit(ctx context.Context, requestID string, actual float64) (float64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var keyID domain.ID
+	var model domain.Model
+	var amount float64
+	var state domain.ReservationState
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM reservations WHERE request_id = ?
+		RETURNING app_key_id, model, amount, state
+	`, requestID).Scan(&keyID, &model, &amount, &state)
+	if err == sql.ErrNoRows {
+		return 0, domain.ErrReservationNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	held := amount
+	if state == domain.ReservationRefunded {
+		held = 0
+	}
+	delta := actual - held
+	if delta != 0 {
+		if err := addUsage(ctx, tx, keyID, delta); err != nil {
+			return 0, err
+		}
+		if err := addModelUsage(ctx, tx, keyID, model, delta); err != nil {
+			return 0, err
+		}
+	}
+
+	return delta, tx.Commit()
+}
+
+func (r *SQLiteKeyRepository) Extend(ctx context.Context, requestID string, amount float64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var keyID domain.ID
+	var model domain.Model
+	err = tx.QueryRowContext(ctx, `
+		UPDATE reservations SET amount = amount + ? WHERE request_id = ? AND state = ?
+		RETURNING app_key_id, model
+	`, amount, requestID, domain.ReservationOpen).Scan(&keyID, &model)
+	if err == sql.ErrNoRows {
+		return domain.ErrReservationNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := reserveUsage(ctx, tx, keyID, amount); err != nil {
+		return err
+	}
+	if err := reserveModelBudgets(ctx, tx, keyID, model, amount); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteKeyRepository) Expire(ctx context.Context, requestID string, state domain.ReservationState) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var keyID domain.ID
+	var model domain.Model
+	var amount float64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE reservations SET state = ? WHERE request_id = ? AND state = ?
+		RETURNING app_key_id, model, amount
+	`, state, requestID, domain.ReservationOpen).Scan(&keyID, &model, &amount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if state == domain.ReservationRefunded && amount != 0 {
+		if err := addUsage(ctx, tx, keyID, -amount); err != nil {
+			return false, err
+		}
+		if err := addModelUsage(ctx, tx, keyID, model, -amount); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *SQLiteKeyRepository) ListReservations(ctx context.Context, state domain.ReservationState, before time.Time) ([]*domain.Reservation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, app_key_id, request_id, model, amount, state, created_at
+		FROM reservations WHERE state = ? AND created_at <= ?
+		ORDER BY created_at, id
+	`, state, before.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []*domain.Reservation
+	for rows.Next() {
+		res := &domain.Reservation{}
+		var createdAt int64
+		if err := rows.Scan(&res.ID, &res.KeyID, &res.RequestID, &res.Model, &res.Amount, &res.State, &createdAt); err != nil {
+			return nil, err
+		}
+		res.CreatedAt = time.Unix(createdAt, 0)
+		reservations = append(reservations, res)
+	}
+	return reservations, rows.Err()
+}
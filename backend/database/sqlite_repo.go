@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"pouch-ai/backend/domain"
 	"time"
 )
@@ -39,10 +40,47 @@ func (r *SQLiteKeyRepository) Save(ctx context.Context, k *domain.Key) error {
 	providerID := "openai"
 	budgetLimit := 0.0
 	resetPeriod := 0
+	var allowedModels string
+	clampMaxTokens := 0
+	var unknownModelPolicy string
+	var projectID sql.NullInt64
+	var resetSchedule sql.NullString
+	var modelBudgets string
+	var alertThresholds string
+	softLimit := 0
+	streamCutoff := 0
+	ownCredentials := 0
 	if k.Configuration != nil {
 		providerID = k.Configuration.Provider.ID
 		budgetLimit = k.Configuration.BudgetLimit
 		resetPeriod = k.Configuration.ResetPeriod
+		if len(k.Configuration.AllowedModels) > 0 {
+			b, _ := json.Marshal(k.Configuration.AllowedModels)
+			allowedModels = string(b)
+		}
+		if k.Configuration.ClampMaxTokens {
+			clampMaxTokens = 1
+		}
+		unknownModelPolicy = string(k.Configuration.UnknownModelPolicy)
+		projectID = nullID(k.Configuration.ProjectID)
+		resetSchedule = marshalSchedule(k.Configuration.ResetSchedule)
+		if len(k.Configuration.ModelBudgets) > 0 {
+			b, _ := json.Marshal(k.Configuration.ModelBudgets)
+			modelBudgets = string(b)
+		}
+		if len(k.Configuration.AlertThresholds) > 0 {
+			b, _ := json.Marshal(k.Configuration.AlertThresholds)
+			alertThresholds = string(b)
+		}
+		if k.Configuration.SoftLimit {
+			softLimit = 1
+		}
+		if k.Configuration.StreamCutoff {
+			streamCutoff = 1
+		}
+		if k.Configuration.OwnCredentials {
+			ownCredentials = 1
+		}
 	}
 
 	autoRenew := 0
@@ -51,9 +89,9 @@ func (r *SQLiteKeyRepository) Save(ctx context.Context, k *domain.Key) error {
 	}
 
 	res, err := tx.ExecContext(ctx, `
-		INSERT INTO app_keys (name, key_hash, prefix, expires_at, auto_renew, budget_usage, last_reset_at, created_at, provider_id, provider_config, budget_limit, reset_period)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, k.Name, k.KeyHash, k.Prefix, expiresAt, autoRenew, k.BudgetUsage, k.LastResetAt.Unix(), k.CreatedAt.Unix(), providerID, providerConfig, budgetLimit, resetPeriod)
+		INSERT INTO app_keys (name, key_hash, prefix, expires_at, auto_renew, budget_usage, last_reset_at, created_at, provider_id, provider_config, budget_limit, reset_period, allowed_models, clamp_max_tokens, unknown_model_policy, project_id, reset_schedule, model_budgets, alert_thresholds, soft_limit, stream_cutoff, own_credentials)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, k.Name, k.KeyHash, k.Prefix, expiresAt, autoRenew, k.BudgetUsage, k.LastResetAt.Unix(), k.CreatedAt.Unix(), providerID, providerConfig, budgetLimit, resetPeriod, allowedModels, clampMaxTokens, unknownModelPolicy, projectID, resetSchedule, modelBudgets, alertThresholds, softLimit, streamCutoff, ownCredentials)
 
 	if err != nil {
 		return err
@@ -89,7 +127,7 @@ func (r *SQLiteKeyRepository) Save(ctx context.Context, k *domain.Key) error {
 func (r *SQLiteKeyRepository) GetByID(ctx context.Context, id domain.ID) (*domain.Key, error) {
 	row := r.db.QueryRowContext(ctx, `
 		SELECT id, name, key_hash, prefix, expires_at, auto_renew, budget_usage, last_reset_at, created_at,
-		       provider_id, provider_config, budget_limit, reset_period
+		       provider_id, provider_config, budget_limit, reset_period, allowed_models, clamp_max_tokens, unknown_model_policy, project_id, reset_schedule, model_budgets, alert_thresholds, soft_limit, stream_cutoff, own_credentials
 		FROM app_keys WHERE id = ?
 	`, id)
 
@@ -98,13 +136,16 @@ func (r *SQLiteKeyRepository) GetByID(ctx context.Context, id domain.ID) (*domai
 		return k, err
 	}
 
-	return r.loadMiddlewares(ctx, k)
+	if _, err := r.loadMiddlewares(ctx, k); err != nil {
+		return nil, err
+	}
+	return r.loadModelUsage(ctx, k)
 }
 
 func (r *SQLiteKeyRepository) GetByHash(ctx context.Context, hash string) (*domain.Key, error) {
 	row := r.db.QueryRowContext(ctx, `
 		SELECT id, name, key_hash, prefix, expires_at, auto_renew, budget_usage, last_reset_at, created_at,
-		       provider_id, provider_config, budget_limit, reset_period
+		       provider_id, provider_config, budget_limit, reset_period, allowed_models, clamp_max_tokens, unknown_model_policy, project_id, reset_schedule, model_budgets, alert_thresholds, soft_limit, stream_cutoff, own_credentials
 		FROM app_keys WHERE key_hash = ?
 	`, hash)
 
@@ -113,13 +154,16 @@ func (r *SQLiteKeyRepository) GetByHash(ctx context.Context, hash string) (*doma
 		return k, err
 	}
 
-	return r.loadMiddlewares(ctx, k)
+	if _, err := r.loadMiddlewares(ctx, k); err != nil {
+		return nil, err
+	}
+	return r.loadModelUsage(ctx, k)
 }
 
 func (r *SQLiteKeyRepository) List(ctx context.Context) ([]*domain.Key, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, name, key_hash, prefix, expires_at, auto_renew, budget_usage, last_reset_at, created_at,
-		       provider_id, provider_config, budget_limit, reset_period
+		       provider_id, provider_config, budget_limit, reset_period, allowed_models, clamp_max_tokens, unknown_model_policy, project_id, reset_schedule, model_budgets, alert_thresholds, soft_limit, stream_cutoff, own_credentials
 		FROM app_keys ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -136,11 +180,14 @@ func (r *SQLiteKeyRepository) List(ctx context.Context) ([]*domain.Key, error) {
 		keys = append(keys, k)
 	}
 
-	// Load middlewares for all keys
+	// Load middlewares and model usage for all keys
 	for _, k := range keys {
 		if _, err := r.loadMiddlewares(ctx, k); err != nil {
 			return nil, err
 		}
+		if _, err := r.loadModelUsage(ctx, k); err != nil {
+			return nil, err
+		}
 	}
 
 	return keys, nil
@@ -162,10 +209,47 @@ func (r *SQLiteKeyRepository) Update(ctx context.Context, k *domain.Key) error {
 	providerID := "openai"
 	budgetLimit := 0.0
 	resetPeriod := 0
+	var allowedModels string
+	clampMaxTokens := 0
+	var unknownModelPolicy string
+	var projectID sql.NullInt64
+	var resetSchedule sql.NullString
+	var modelBudgets string
+	var alertThresholds string
+	softLimit := 0
+	streamCutoff := 0
+	ownCredentials := 0
 	if k.Configuration != nil {
 		providerID = k.Configuration.Provider.ID
 		budgetLimit = k.Configuration.BudgetLimit
 		resetPeriod = k.Configuration.ResetPeriod
+		if len(k.Configuration.AllowedModels) > 0 {
+			b, _ := json.Marshal(k.Configuration.AllowedModels)
+			allowedModels = string(b)
+		}
+		if k.Configuration.ClampMaxTokens {
+			clampMaxTokens = 1
+		}
+		unknownModelPolicy = string(k.Configuration.UnknownModelPolicy)
+		projectID = nullID(k.Configuration.ProjectID)
+		resetSchedule = marshalSchedule(k.Configuration.ResetSchedule)
+		if len(k.Configuration.ModelBudgets) > 0 {
+			b, _ := json.Marshal(k.Configuration.ModelBudgets)
+			modelBudgets = string(b)
+		}
+		if len(k.Configuration.AlertThresholds) > 0 {
+			b, _ := json.Marshal(k.Configuration.AlertThresholds)
+			alertThresholds = string(b)
+		}
+		if k.Configuration.SoftLimit {
+			softLimit = 1
+		}
+		if k.Configuration.StreamCutoff {
+			streamCutoff = 1
+		}
+		if k.Configuration.OwnCredentials {
+			ownCredentials = 1
+		}
 	}
 
 	autoRenew := 0
@@ -179,11 +263,26 @@ func (r *SQLiteKeyRepository) Update(ctx context.Context, k *domain.Key) error {
 		expiresAt.Valid = true
 	}
 
+	// Unsettled reservations were taken from the key's current project and
+	// organization, but would be settled against the new ones
+	var held bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT project_id IS NOT ? AND EXISTS (
+			SELECT 1 FROM reservations WHERE app_key_id = ? AND state != ?
+		) FROM app_keys WHERE id = ?
+	`, projectID, k.ID, domain.ReservationRefunded, k.ID).Scan(&held)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if held {
+		return &domain.ValidationError{Message: "key has requests in flight; move it to another project once they settle"}
+	}
+
 	_, err = tx.ExecContext(ctx, `
 		UPDATE app_keys 
-		SET name = ?, auto_renew = ?, provider_id = ?, provider_config = ?, budget_limit = ?, reset_period = ?, expires_at = ?
+		SET name = ?, auto_renew = ?, provider_id = ?, provider_config = ?, budget_limit = ?, reset_period = ?, expires_at = ?, allowed_models = ?, clamp_max_tokens = ?, unknown_model_policy = ?, project_id = ?, reset_schedule = ?, model_budgets = ?, alert_thresholds = ?, soft_limit = ?, stream_cutoff = ?, own_credentials = ?
 		WHERE id = ?
-	`, k.Name, autoRenew, providerID, providerConfig, budgetLimit, resetPeriod, expiresAt, k.ID)
+	`, k.Name, autoRenew, providerID, providerConfig, budgetLimit, resetPeriod, expiresAt, allowedModels, clampMaxTokens, unknownModelPolicy, projectID, resetSchedule, modelBudgets, alertThresholds, softLimit, streamCutoff, ownCredentials, k.ID)
 	if err != nil {
 		return err
 	}
@@ -221,13 +320,91 @@ func (r *SQLiteKeyRepository) Delete(ctx context.Context, id domain.ID) error {
 }
 
 func (r *SQLiteKeyRepository) IncrementUsage(ctx context.Context, id domain.ID, amount float64) error {
-	_, err := r.db.ExecContext(ctx, "UPDATE app_keys SET budget_usage = budget_usage + ? WHERE id = ?", amount, id)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addUsage(ctx, tx, id, amount); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReserveUsage checks each limit and adds the usage with conditional
+// UPDATEs in one transaction, so concurrent reservations cannot overshoot
+// the budget of the key, its project or its organization, or the cap of its
+// provider.
+func (r *SQLiteKeyRepository) ReserveUsage(ctx context.Context, id domain.ID, amount float64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reserveUsage(ctx, tx, id, amount); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// execQuerier is satisfied by both *sql.DB and *sql.Tx.
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// reserveUsage reserves amount against the key, then against its project
+// and organization, and then against its provider's cap. It must run in a
+// transaction, which is rolled back if any level has no room. A key with a
+// soft limit may go over its own limit, but not over the others.
+func reserveUsage(ctx context.Context, db execQuerier, id domain.ID, amount float64) error {
+	res, err := db.ExecContext(ctx, `
+		UPDATE app_keys SET budget_usage = budget_usage + ?
+		WHERE id = ? AND (budget_limit <= 0 OR soft_limit = 1 OR budget_usage + ? <= budget_limit)`,
+		amount, id, amount)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if err := reserveParents(ctx, db, id, amount); err != nil {
+			return err
+		}
+		return reserveProviderCap(ctx, db, id, amount)
+	}
+
+	// No row was updated: either the key is gone or the limit would be exceeded
+	var usage, limit float64
+	err = db.QueryRowContext(ctx, "SELECT budget_usage, budget_limit FROM app_keys WHERE id = ?", id).Scan(&usage, &limit)
+	if err == sql.ErrNoRows {
+		return domain.ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w (limit: $%.2f, current+reservation: $%.2f)", domain.ErrBudgetExceeded, limit, usage+amount)
 }
 
 func (r *SQLiteKeyRepository) ResetUsage(ctx context.Context, id domain.ID, lastResetAt time.Time) error {
-	_, err := r.db.ExecContext(ctx, "UPDATE app_keys SET budget_usage = 0, last_reset_at = ? WHERE id = ?", lastResetAt.Unix(), id)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE app_keys SET budget_usage = 0, last_reset_at = ? WHERE id = ?", lastResetAt.Unix(), id); err != nil {
+		return err
+	}
+	// Model budgets share the key's period
+	if _, err := tx.ExecContext(ctx, "DELETE FROM model_budget_usage WHERE app_key_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Helpers
@@ -243,11 +420,21 @@ func (r *SQLiteKeyRepository) scanKey(sc interface {
 	var providerConfig sql.NullString
 	var budgetLimit float64
 	var resetPeriod int
+	var allowedModels sql.NullString
+	var clampMaxTokens sql.NullInt64
+	var unknownModelPolicy sql.NullString
+	var projectID sql.NullInt64
+	var resetSchedule sql.NullString
+	var modelBudgets sql.NullString
+	var alertThresholds sql.NullString
+	var softLimit sql.NullInt64
+	var streamCutoff sql.NullInt64
+	var ownCredentials sql.NullInt64
 
 	err := sc.Scan(
 		&k.ID, &k.Name, &k.KeyHash, &k.Prefix, &expiresAt, &autoRenew,
 		&k.BudgetUsage, &lastResetAt, &createdAt,
-		&providerID, &providerConfig, &budgetLimit, &resetPeriod,
+		&providerID, &providerConfig, &budgetLimit, &resetPeriod, &allowedModels, &clampMaxTokens, &unknownModelPolicy, &projectID, &resetSchedule, &modelBudgets, &alertThresholds, &softLimit, &streamCutoff, &ownCredentials,
 	)
 
 	if err != nil {
@@ -270,8 +457,15 @@ func (r *SQLiteKeyRepository) scanKey(sc interface {
 		Provider: domain.PluginConfig{
 			ID: providerID,
 		},
-		BudgetLimit: budgetLimit,
-		ResetPeriod: resetPeriod,
+		BudgetLimit:        budgetLimit,
+		ResetPeriod:        resetPeriod,
+		ResetSchedule:      unmarshalSchedule(resetSchedule),
+		ClampMaxTokens:     clampMaxTokens.Int64 == 1,
+		UnknownModelPolicy: domain.UnknownModelPolicy(unknownModelPolicy.String),
+		ProjectID:          domain.ID(projectID.Int64),
+		SoftLimit:          softLimit.Int64 == 1,
+		StreamCutoff:       streamCutoff.Int64 == 1,
+		OwnCredentials:     ownCredentials.Int64 == 1,
 	}
 
 	if providerConfig.Valid && providerConfig.String != "" {
@@ -281,6 +475,18 @@ func (r *SQLiteKeyRepository) scanKey(sc interface {
 		}
 	}
 
+	if allowedModels.Valid && allowedModels.String != "" {
+		_ = json.Unmarshal([]byte(allowedModels.String), &k.Configuration.AllowedModels)
+	}
+
+	if modelBudgets.Valid && modelBudgets.String != "" {
+		_ = json.Unmarshal([]byte(modelBudgets.String), &k.Configuration.ModelBudgets)
+	}
+
+	if alertThresholds.Valid && alertThresholds.String != "" {
+		_ = json.Unmarshal([]byte(alertThresholds.String), &k.Configuration.AlertThresholds)
+	}
+
 	return &k, nil
 }
 
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"strings"
+	"time"
+)
+
+// rollupTables maps each usage rollup table to the size of its buckets in
+// seconds. Days are UTC days.
+var rollupTables = map[string]int64{
+	"usage_hourly": 3600,
+	"usage_daily":  86400,
+}
+
+func (r *SQLiteKeyRepository) RecordUsage(ctx context.Context, e *domain.UsageEvent) error {
+	var keyID sql.NullInt64
+	if e.KeyID != 0 {
+		keyID = sql.NullInt64{Int64: int64(e.KeyID), Valid: true}
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	stream := 0
+	if e.Stream {
+		stream = 1
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO usage_events (app_key_id, request_id, model, provider, endpoint, prompt_tokens, output_tokens,
+		                          reserved_cost, actual_cost, status_code, latency_ms, stream, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, keyID, e.RequestID, e.Model, e.Provider, e.Endpoint, e.PromptTokens, e.OutputTokens,
+		e.ReservedCost, e.ActualCost, e.StatusCode, e.Latency.Milliseconds(), stream, e.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	if e.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	createdAt := e.CreatedAt.Unix()
+	for table, size := range rollupTables {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s (bucket, app_key_id, provider, model, requests, prompt_tokens, output_tokens, cost)
+			VALUES (?, ?, ?, ?, 1, ?, ?, ?)
+			ON CONFLICT DO UPDATE SET
+				requests = requests + 1,
+				prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+				output_tokens = output_tokens + excluded.output_tokens,
+				cost = cost + excluded.cost
+		`, table), createdAt-createdAt%size, e.KeyID, e.Provider, e.Model, e.PromptTokens, e.OutputTokens, e.ActualCost); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// usageWhere builds the WHERE clause selecting the events of q.
+func usageWhere(q domain.UsageQuery) (string, []any) {
+	conds := []string{"app_key_id = ?"}
+	args := []any{q.KeyID}
+	if !q.From.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, q.From.Unix())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, q.To.Unix())
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (r *SQLiteKeyRepository) ListUsage(ctx context.Context, q domain.UsageQuery) ([]*domain.UsageEvent, error) {
+	where, args := usageWhere(q)
+	query := `
+		SELECT id, app_key_id, request_id, model, provider, endpoint, prompt_tokens, output_tokens,
+		       reserved_cost, actual_cost, status_code, latency_ms, stream, created_at
+		FROM usage_events` + where + " ORDER BY created_at DESC, id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.UsageEvent
+	for rows.Next() {
+		e := &domain.UsageEvent{}
+		var keyID sql.NullInt64
+		var latencyMs, createdAt int64
+		var stream int
+		if err := rows.Scan(&e.ID, &keyID, &e.RequestID, &e.Model, &e.Provider, &e.Endpoint, &e.PromptTokens, &e.OutputTokens,
+			&e.ReservedCost, &e.ActualCost, &e.StatusCode, &latencyMs, &stream, &createdAt); err != nil {
+			return nil, err
+		}
+		e.KeyID = domain.ID(keyID.Int64)
+		e.Latency = time.Duration(latencyMs) * time.Millisecond
+		e.Stream = stream == 1
+		e.CreatedAt = time.Unix(createdAt, 0)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *SQLiteKeyRepository) SummarizeUsage(ctx context.Context, q domain.UsageQuery) ([]*domain.UsageSummary, error) {
+	where, args := usageWhere(q)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT model, COUNT(*), SUM(prompt_tokens), SUM(output_tokens), SUM(actual_cost)
+		FROM usage_events`+where+`
+		GROUP BY model ORDER BY SUM(actual_cost) DESC, model`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*domain.UsageSummary
+	for rows.Next() {
+		s := &domain.UsageSummary{}
+		if err := rows.Scan(&s.Model, &s.Requests, &s.PromptTokens, &s.OutputTokens, &s.Cost); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Alert reports that a key's usage crossed one of its alert thresholds, or
+// the spend of a provider one of its cap's.
+type Alert struct {
+	// Scope is BudgetScopeKey or BudgetScopeProvider; provider alerts have
+	// no key.
+	Scope     BudgetScope `json:"scope"`
+	KeyID     ID          `json:"key_id"`
+	KeyName   string      `json:"key_name"`
+	KeyPrefix string      `json:"key_prefix"`
+	Provider  string      `json:"provider"`
+	// Threshold is the percentage of the budget that was crossed.
+	Threshold   int       `json:"threshold"`
+	Usage       float64   `json:"usage"`
+	Limit       float64   `json:"limit"`
+	SoftLimit   bool      `json:"soft_limit"`
+	PeriodStart time.Time `json:"period_start"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Message describes the alert in a sentence.
+func (a *Alert) Message() string {
+	if a.Scope == BudgetScopeProvider {
+		return fmt.Sprintf("Provider %q has used %d%% of its spending cap ($%.2f of $%.2f)", a.Provider, a.Threshold, a.Usage, a.Limit)
+	}
+	msg := fmt.Sprintf("Key %q has used %d%% of its budget ($%.2f of $%.2f)", a.KeyName, a.Threshold, a.Usage, a.Limit)
+	if a.SoftLimit && a.Usage >= a.Limit {
+		msg += "; the limit is soft, so requests are still allowed"
+	}
+	return msg
+}
+
+// Notifier delivers alerts, e.g. to a webhook or a chat channel.
+type Notifier interface {
+	Notify(ctx context.Context, a *Alert) error
+}
+
+// AlertRepository is optionally implemented by a Repository to remember
+// which alerts were sent, so each threshold fires once per budget period.
+type AlertRepository interface {
+	// MarkAlerted records that the key crossed threshold in the period that
+	// started at periodStart, and reports false if that was already recorded.
+	MarkAlerted(ctx context.Context, keyID ID, threshold int, periodStart time.Time) (bool, error)
+}
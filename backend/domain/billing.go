@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reconciliation compares the cost a provider billed for a period with the
+// cost recorded in the usage ledger for the provider's requests.
+type Reconciliation struct {
+	Provider string
+	// The period covers whole UTC days from PeriodStart to PeriodEnd
+	// (exclusive).
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Billed      float64
+	Recorded    float64
+	// Drift is Billed minus Recorded. It is positive when the provider
+	// billed for requests that bypassed pouch or were underestimated.
+	Drift float64
+	// DriftPercent is the drift as a percentage of the larger of Billed and
+	// Recorded.
+	DriftPercent float64
+	// Flagged reports whether the drift is above the threshold.
+	Flagged bool
+}
+
+func (r *Reconciliation) Message() string {
+	period := "on " + r.PeriodStart.Format(time.DateOnly)
+	if last := r.PeriodEnd.AddDate(0, 0, -1); last.After(r.PeriodStart) {
+		period = fmt.Sprintf("from %s to %s", r.PeriodStart.Format(time.DateOnly), last.Format(time.DateOnly))
+	}
+	return fmt.Sprintf("%s billed $%.2f %s but pouch recorded $%.2f (%.1f%% drift)",
+		r.Provider, r.Billed, period, r.Recorded, r.DriftPercent)
+}
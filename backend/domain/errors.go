@@ -8,4 +8,7 @@ var (
 	ErrInvalidKey       = errors.New("invalid API key")
 	ErrBudgetExceeded   = errors.New("budget limit exceeded")
 	ErrProviderNotFound = errors.New("provider not found")
+	ErrNotSupported     = errors.New("operation not supported by provider")
+	ErrModelNotAllowed  = errors.New("model not allowed for this key")
+	ErrUnknownModel     = errors.New("no pricing for model")
 )
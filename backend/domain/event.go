@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type EventType string
+
+const (
+	// EventUnpricedModel records a request for a model without pricing.
+	EventUnpricedModel EventType = "unpriced_model"
+	// EventBudgetAlert records a key crossing one of its alert thresholds.
+	EventBudgetAlert EventType = "budget_alert"
+	// EventBillingDrift records a provider billing more or less than the
+	// usage ledger recorded for a period.
+	EventBillingDrift EventType = "billing_drift"
+)
+
+// Event is a notable occurrence shown to admins, such as a request that
+// could not be priced.
+type Event struct {
+	ID        int64
+	KeyID     ID
+	Type      EventType
+	Model     Model
+	Message   string
+	CreatedAt time.Time
+}
+
+// EventRepository is optionally implemented by a Repository to keep a log
+// of events.
+type EventRepository interface {
+	RecordEvent(ctx context.Context, e *Event) error
+	// ListEvents returns up to limit events, newest first.
+	ListEvents(ctx context.Context, limit int) ([]*Event, error)
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrProjectNotFound      = errors.New("project not found")
+)
+
+// Organization caps the combined spend of its projects.
+type Organization struct {
+	ID          ID      `json:"id"`
+	Name        string  `json:"name"`
+	BudgetLimit float64 `json:"budget_limit"`
+	BudgetUsage float64 `json:"budget_usage"`
+	ResetPeriod int     `json:"reset_period"`
+	// ResetSchedule takes precedence over ResetPeriod, as for keys.
+	ResetSchedule *ResetSchedule `json:"reset_schedule,omitempty"`
+	LastResetAt   time.Time      `json:"last_reset_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// Project caps the combined spend of its keys. It may belong to an
+// organization, whose budget it then also counts against.
+type Project struct {
+	ID ID `json:"id"`
+	// OrgID is zero for projects outside any organization.
+	OrgID       ID      `json:"org_id"`
+	Name        string  `json:"name"`
+	BudgetLimit float64 `json:"budget_limit"`
+	BudgetUsage float64 `json:"budget_usage"`
+	ResetPeriod int     `json:"reset_period"`
+	// ResetSchedule takes precedence over ResetPeriod, as for keys.
+	ResetSchedule *ResetSchedule `json:"reset_schedule,omitempty"`
+	LastResetAt   time.Time      `json:"last_reset_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+func (o *Organization) Validate() error {
+	return validateBudgetOwner("organization", o.Name, o.BudgetLimit, o.ResetPeriod, o.ResetSchedule)
+}
+
+func (p *Project) Validate() error {
+	return validateBudgetOwner("project", p.Name, p.BudgetLimit, p.ResetPeriod, p.ResetSchedule)
+}
+
+func validateBudgetOwner(kind, name string, limit float64, resetPeriod int, schedule *ResetSchedule) error {
+	if name == "" {
+		return &ValidationError{kind + " name is required"}
+	}
+	if utf8.RuneCountInString(name) > MaxKeyNameLength {
+		return &ValidationError{fmt.Sprintf("%s name is too long (max %d characters)", kind, MaxKeyNameLength)}
+	}
+	if !keyNameRegex.MatchString(name) {
+		return &ValidationError{kind + " name contains invalid characters"}
+	}
+	if limit < 0 || resetPeriod < 0 {
+		return &ValidationError{kind + " budget limit and reset period must not be negative"}
+	}
+	if schedule != nil {
+		return schedule.Validate()
+	}
+	return nil
+}
+
+// HierarchyRepository is optionally implemented by a Repository to group
+// keys into projects and organizations. Repository.ReserveUsage then
+// reserves at every level (key, project, organization) and usage is rolled
+// up the same way; budgets are reset by the service like those of keys.
+// Get methods return nil if the entity does not exist.
+type HierarchyRepository interface {
+	SaveOrganization(ctx context.Context, o *Organization) error
+	GetOrganization(ctx context.Context, id ID) (*Organization, error)
+	ListOrganizations(ctx context.Context) ([]*Organization, error)
+	UpdateOrganization(ctx context.Context, o *Organization) error
+	// DeleteOrganization leaves its projects without an organization.
+	DeleteOrganization(ctx context.Context, id ID) error
+
+	SaveProject(ctx context.Context, p *Project) error
+	GetProject(ctx context.Context, id ID) (*Project, error)
+	ListProjects(ctx context.Context) ([]*Project, error)
+	UpdateProject(ctx context.Context, p *Project) error
+	// DeleteProject leaves its keys without a project.
+	DeleteProject(ctx context.Context, id ID) error
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 	"unicode/utf8"
 )
@@ -32,19 +33,109 @@ type KeyConfiguration struct {
 	Middlewares []PluginConfig `json:"middlewares"`
 	BudgetLimit float64        `json:"budget_limit"`
 	ResetPeriod int            `json:"reset_period"`
+	// ResetSchedule resets the budget on calendar boundaries instead, and
+	// takes precedence over ResetPeriod.
+	ResetSchedule *ResetSchedule `json:"reset_schedule,omitempty"`
+	// AllowedModels restricts the models the key may use. Entries match
+	// exactly, or as a prefix when they end in "*"; empty allows all models.
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	// ClampMaxTokens lowers a chat request's output cap to what the remaining
+	// budget can afford, instead of rejecting requests whose worst case does
+	// not fit.
+	ClampMaxTokens bool `json:"clamp_max_tokens,omitempty"`
+	// UnknownModelPolicy overrides the global policy for models without
+	// pricing; empty uses the global one.
+	UnknownModelPolicy UnknownModelPolicy `json:"unknown_model_policy,omitempty"`
+	// ProjectID places the key in a project, whose budget (and that of its
+	// organization) the key's usage also counts against. Zero means none.
+	ProjectID ID `json:"project_id,omitempty"`
+	// ModelBudgets caps the spend on some models within the key's budget.
+	// They reset together with it.
+	ModelBudgets []ModelBudget `json:"model_budgets,omitempty"`
+	// AlertThresholds are percentages of BudgetLimit at which an alert is
+	// sent, once per period; empty uses the server's defaults.
+	AlertThresholds []int `json:"alert_thresholds,omitempty"`
+	// SoftLimit lets requests through past BudgetLimit, with an alert,
+	// instead of rejecting them.
+	SoftLimit bool `json:"soft_limit,omitempty"`
+	// StreamCutoff extends a chat stream's reservation as it spends, and
+	// ends the stream, as if it reached its max tokens, once no budget it is
+	// held against can afford more.
+	StreamCutoff bool `json:"stream_cutoff,omitempty"`
+	// OwnCredentials is set when the provider config bills the key to an
+	// upstream account of its own, whose usage its provider's cap ignores.
+	OwnCredentials bool `json:"own_credentials,omitempty"`
+}
+
+// ModelBudget caps the spend of a key on the models matching Model, which
+// matches exactly, or as a prefix when it ends in "*".
+type ModelBudget struct {
+	Model string  `json:"model"`
+	Limit float64 `json:"limit"`
+}
+
+// Matches reports whether the budget applies to model.
+func (b ModelBudget) Matches(model Model) bool {
+	return matchModel(b.Model, model)
+}
+
+func matchModel(pattern string, model Model) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(string(model), prefix)
+	}
+	return string(model) == pattern
+}
+
+// UnknownModelPolicy decides how requests for models without pricing are
+// handled.
+type UnknownModelPolicy string
+
+const (
+	// UnknownModelReject refuses the request.
+	UnknownModelReject UnknownModelPolicy = "reject"
+	// UnknownModelFallback prices the request at a fallback rate.
+	UnknownModelFallback UnknownModelPolicy = "fallback"
+	// UnknownModelAllow lets the request through unmetered, with a warning.
+	UnknownModelAllow UnknownModelPolicy = "allow"
+)
+
+// Valid reports whether p is a known policy; empty is valid and means the
+// global default.
+func (p UnknownModelPolicy) Valid() bool {
+	switch p {
+	case "", UnknownModelReject, UnknownModelFallback, UnknownModelAllow:
+		return true
+	}
+	return false
+}
+
+// AllowsModel reports whether the key may use model.
+func (c *KeyConfiguration) AllowsModel(model Model) bool {
+	if c == nil || len(c.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedModels {
+		if matchModel(allowed, model) {
+			return true
+		}
+	}
+	return false
 }
 
 type Key struct {
-	ID            ID                `json:"id"`
-	Name          string            `json:"name"`
-	KeyHash       string            `json:"key_hash"`
-	Prefix        string            `json:"prefix"`
-	ExpiresAt     *time.Time        `json:"expires_at"`
-	AutoRenew     bool              `json:"auto_renew"`
-	BudgetUsage   float64           `json:"budget_usage"`
-	LastResetAt   time.Time         `json:"last_reset_at"`
-	CreatedAt     time.Time         `json:"created_at"`
-	Configuration *KeyConfiguration `json:"configuration"`
+	ID          ID         `json:"id"`
+	Name        string     `json:"name"`
+	KeyHash     string     `json:"key_hash"`
+	Prefix      string     `json:"prefix"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	AutoRenew   bool       `json:"auto_renew"`
+	BudgetUsage float64    `json:"budget_usage"`
+	// ModelUsage is the spend in the current period against each of the
+	// configuration's ModelBudgets, by pattern.
+	ModelUsage    map[string]float64 `json:"model_usage,omitempty"`
+	LastResetAt   time.Time          `json:"last_reset_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Configuration *KeyConfiguration  `json:"configuration"`
 }
 
 func (k *Key) IsExpired() bool {
@@ -67,6 +158,24 @@ func (k *Key) Validate() error {
 	if k.Configuration == nil || k.Configuration.Provider.ID == "" {
 		return &ValidationError{"provider is required"}
 	}
+	if !k.Configuration.UnknownModelPolicy.Valid() {
+		return &ValidationError{fmt.Sprintf("unknown model policy %q is invalid", k.Configuration.UnknownModelPolicy)}
+	}
+	for _, b := range k.Configuration.ModelBudgets {
+		if b.Model == "" || b.Limit <= 0 {
+			return &ValidationError{"model budgets need a model pattern and a positive limit"}
+		}
+	}
+	for _, t := range k.Configuration.AlertThresholds {
+		if t <= 0 {
+			return &ValidationError{fmt.Sprintf("alert threshold %d%% must be positive", t)}
+		}
+	}
+	if k.Configuration.ResetSchedule != nil {
+		if err := k.Configuration.ResetSchedule.Validate(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -79,5 +188,11 @@ type Repository interface {
 	Update(ctx context.Context, k *Key) error
 	Delete(ctx context.Context, id ID) error
 	IncrementUsage(ctx context.Context, id ID, amount float64) error
+	// ReserveUsage atomically adds amount to the key's usage if that keeps it
+	// within the budget limit, and returns ErrBudgetExceeded otherwise. With a
+	// HierarchyRepository, the key's project and organization must have room
+	// for it too. Model budgets are only enforced by ReservationRepository,
+	// which knows the model.
+	ReserveUsage(ctx context.Context, id ID, amount float64) error
 	ResetUsage(ctx context.Context, id ID, lastResetAt time.Time) error
 }
@@ -36,3 +36,99 @@ func TestKeyValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyConfigurationAllowsModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		model   Model
+		want    bool
+	}{
+		{"No restriction", nil, "gpt-4o", true},
+		{"Exact match", []string{"gpt-4o"}, "gpt-4o", true},
+		{"Exact mismatch", []string{"gpt-4o"}, "gpt-4o-mini", false},
+		{"Prefix match", []string{"gpt-4o*"}, "gpt-4o-mini", true},
+		{"Prefix mismatch", []string{"gpt-4o*"}, "o1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &KeyConfiguration{AllowedModels: tt.allowed}
+			if got := c.AllowsModel(tt.model); got != tt.want {
+				t.Errorf("AllowsModel(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyValidateUnknownModelPolicy(t *testing.T) {
+	for _, policy := range []UnknownModelPolicy{"", UnknownModelReject, UnknownModelFallback, UnknownModelAllow, "ignore"} {
+		k := &Key{
+			Name: "my-key",
+			Configuration: &KeyConfiguration{
+				Provider:           PluginConfig{ID: "openai"},
+				UnknownModelPolicy: policy,
+			},
+		}
+		err := k.Validate()
+		if wantErr := policy == "ignore"; (err != nil) != wantErr {
+			t.Errorf("policy %q: Key.Validate() error = %v, wantErr %v", policy, err, wantErr)
+		}
+	}
+}
+
+func TestKeyValidateModelBudgets(t *testing.T) {
+	tests := []struct {
+		name    string
+		budgets []ModelBudget
+		wantErr bool
+	}{
+		{"None", nil, false},
+		{"Valid", []ModelBudget{{Model: "gpt-4*", Limit: 5}}, false},
+		{"Missing pattern", []ModelBudget{{Limit: 5}}, true},
+		{"Zero limit", []ModelBudget{{Model: "o1"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Key{
+				Name: "my-key",
+				Configuration: &KeyConfiguration{
+					Provider:     PluginConfig{ID: "openai"},
+					ModelBudgets: tt.budgets,
+				},
+			}
+			if err := k.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Key.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyValidateAlertThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds []int
+		wantErr    bool
+	}{
+		{"None", nil, false},
+		{"Valid", []int{50, 80, 100, 120}, false},
+		{"Zero", []int{0}, true},
+		{"Negative", []int{50, -10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Key{
+				Name: "my-key",
+				Configuration: &KeyConfiguration{
+					Provider:        PluginConfig{ID: "openai"},
+					AlertThresholds: tt.thresholds,
+				},
+			}
+			if err := k.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Key.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -18,6 +18,9 @@ type FieldRole string
 const (
 	FieldRoleLimit  FieldRole = "limit"
 	FieldRolePeriod FieldRole = "period"
+	// FieldRoleCredential marks a provider field that points a key at an
+	// upstream account other than the provider's own.
+	FieldRoleCredential FieldRole = "credential"
 )
 
 type FieldSchema struct {
@@ -31,6 +34,20 @@ type FieldSchema struct {
 
 type PluginSchema map[string]FieldSchema
 
+// SetsCredentials reports whether config sets any of the schema's credential
+// fields to other than their default, billing the key to its own account.
+func (s PluginSchema) SetsCredentials(config map[string]any) bool {
+	for name, field := range s {
+		if field.Role != FieldRoleCredential {
+			continue
+		}
+		if v, ok := config[name].(string); ok && v != "" && v != field.Default {
+			return true
+		}
+	}
+	return false
+}
+
 type PluginConfig struct {
 	ID     string         `json:"id"`
 	Config map[string]any `json:"config,omitempty"`
@@ -2,29 +2,50 @@ package domain
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"pouch-ai/backend/config"
+	"time"
 )
 
 type ProviderBuilder interface {
 	Build(ctx context.Context, cfg *config.Config) (Provider, error)
 }
 
+// ProviderSetBuilder builds any number of provider instances from the
+// configuration, each registered under its own name.
+type ProviderSetBuilder interface {
+	BuildAll(ctx context.Context, cfg *config.Config) ([]Provider, error)
+}
+
 type Model string
 
 func (m Model) String() string {
 	return string(m)
 }
 
+// Pricing holds USD prices for a model. Input and Output are per 1k tokens;
+// audio models are billed per second of input audio or per 1k characters of
+// input text instead, and image models per generated image.
 type Pricing struct {
-	Input  float64
-	Output float64
+	Input      float64
+	Output     float64
+	PerSecond  float64
+	Per1KChars float64
+	// PerImage is keyed by "quality:size", e.g. "hd:1024x1024".
+	PerImage map[string]float64
+	// MaxOutputTokens is the model's output limit, used as the worst case
+	// when a request sets no cap of its own. Zero means unknown.
+	MaxOutputTokens int
 }
 
 type Usage struct {
 	InputTokens  int
 	OutputTokens int
-	TotalCost    float64
+	// ReasoningTokens is the part of OutputTokens spent on hidden reasoning.
+	// It is billed as output but never appears in the streamed content.
+	ReasoningTokens int
+	TotalCost       float64
 }
 
 type Provider interface {
@@ -47,3 +68,78 @@ type Provider interface {
 	// GetUsage returns the total usage cost from the provider side (e.g. billing)
 	GetUsage(ctx context.Context) (float64, error)
 }
+
+// FallbackPricer is implemented by providers that can price models missing
+// from their pricing table. The returned provider prices them at p.
+type FallbackPricer interface {
+	WithFallbackPricing(p Pricing) Provider
+}
+
+// BillingReporter is implemented by providers whose upstream reports what it
+// billed over a range of days.
+type BillingReporter interface {
+	// GetBilledUsage returns the cost billed for the UTC days from from up to
+	// but excluding to's day.
+	GetBilledUsage(ctx context.Context, from, to time.Time) (float64, error)
+}
+
+// ModelLister is implemented by providers that can list the models they offer.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]Model, error)
+}
+
+// ResponseTranslator is implemented by providers whose upstream API does not
+// speak the OpenAI chat format. The execution handler converts upstream
+// responses through it before metering them and returning them to the client,
+// so ParseOutputUsage and ParseStreamChunk always see OpenAI-style payloads.
+type ResponseTranslator interface {
+	TranslateResponse(model Model, body []byte) ([]byte, error)
+	TranslateStream(model Model, body io.ReadCloser) io.ReadCloser
+}
+
+// UsageParser is implemented by providers that can read the exact input and
+// output token counts from a (translated) non-streaming response body.
+type UsageParser interface {
+	ParseUsage(model Model, responseBody []byte) (*Usage, error)
+}
+
+// Endpoint identifies an upstream API (relative to the /v1 base path) that
+// can be served through the proxy.
+type Endpoint string
+
+const (
+	EndpointChat           Endpoint = "chat/completions"
+	EndpointEmbeddings     Endpoint = "embeddings"
+	EndpointTranscriptions Endpoint = "audio/transcriptions"
+	EndpointSpeech         Endpoint = "audio/speech"
+	EndpointImages         Endpoint = "images/generations"
+	EndpointImageEdits     Endpoint = "images/edits"
+	EndpointResponses      Endpoint = "responses"
+)
+
+// EndpointProvider is implemented by providers that serve endpoints other
+// than chat completions. Usage for those endpoints is estimated before the
+// call (to reserve budget) and read from the response afterwards. Request
+// bodies are not necessarily JSON (e.g. multipart audio uploads), so the
+// client's content type is passed along with them. Streaming endpoint
+// responses are metered through ParseStreamChunk, like chat streams.
+type EndpointProvider interface {
+	SupportsEndpoint(endpoint Endpoint) bool
+	// ParseEndpointRequest extracts the model, and whether a streamed
+	// response is requested, from an endpoint request body
+	ParseEndpointRequest(endpoint Endpoint, contentType string, body []byte) (Model, bool, error)
+	PrepareEndpointRequest(ctx context.Context, endpoint Endpoint, model Model, contentType string, body []byte) (*http.Request, error)
+	EstimateEndpointUsage(endpoint Endpoint, model Model, contentType string, body []byte) (*Usage, error)
+	ParseEndpointUsage(endpoint Endpoint, model Model, responseBody []byte) (*Usage, error)
+}
+
+// PassThroughProvider is implemented by providers that can forward requests
+// for arbitrary API paths verbatim, e.g. files, batches or moderations.
+type PassThroughProvider interface {
+	// PreparePassThroughRequest builds the upstream request for path, which is
+	// relative to the provider's API base and may include a query string.
+	PreparePassThroughRequest(ctx context.Context, method, path, contentType string, body []byte) (*http.Request, error)
+	// ParsePassThroughUsage prices the token usage reported in a response. An
+	// empty model is taken from the response.
+	ParsePassThroughUsage(model Model, responseBody []byte) (*Usage, error)
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ProviderCap is a hard limit on the combined spend of all keys of an
+// upstream provider, e.g. when every app shares one organization key.
+type ProviderCap struct {
+	ID       ID
+	Provider string
+	Limit    float64
+	Usage    float64
+	// Schedule resets the cap every calendar day, week or month; a cap
+	// without one never resets.
+	Schedule *ResetSchedule
+	// AlertThresholds are percentages of Limit; reaching the cap always
+	// alerts.
+	AlertThresholds []int
+	LastResetAt     time.Time
+}
+
+func (c *ProviderCap) Validate() error {
+	if c.Provider == "" {
+		return &ValidationError{"provider cap needs a provider"}
+	}
+	if c.Limit <= 0 {
+		return &ValidationError{fmt.Sprintf("cap of provider %q must be positive", c.Provider)}
+	}
+	for _, t := range c.AlertThresholds {
+		if t <= 0 {
+			return &ValidationError{fmt.Sprintf("cap of provider %q: alert threshold %d%% must be positive", c.Provider, t)}
+		}
+	}
+	if c.Schedule != nil {
+		return c.Schedule.Validate()
+	}
+	return nil
+}
+
+// Headroom returns how much may still be spent in the current period.
+func (c *ProviderCap) Headroom() float64 {
+	return max(c.Limit-c.Usage, 0)
+}
+
+// ProviderCapRepository is optionally implemented by a Repository to cap
+// the spend of providers. Repository.ReserveUsage then also reserves against
+// the cap of the key's provider, and usage is added to it the same way; caps
+// are reset by the service like other budgets, as BudgetScopeProvider.
+type ProviderCapRepository interface {
+	// SyncProviderCaps replaces the caps with caps. Providers that stay
+	// capped keep their usage and period; new caps start their period at
+	// LastResetAt with the cost the usage ledger recorded since.
+	SyncProviderCaps(ctx context.Context, caps []*ProviderCap) error
+	ListProviderCaps(ctx context.Context) ([]*ProviderCap, error)
+	// GetProviderCap returns nil if the provider is not capped.
+	GetProviderCap(ctx context.Context, provider string) (*ProviderCap, error)
+	// MarkCapAlerted records an alert for a cap threshold and period, and
+	// reports whether it was the first.
+	MarkCapAlerted(ctx context.Context, capID ID, threshold int, periodStart time.Time) (bool, error)
+}
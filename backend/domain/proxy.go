@@ -4,21 +4,63 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 )
 
 type UsageCommitter interface {
-	CommitUsage(ctx context.Context, keyID ID, reserved, actual float64) error
+	// CommitRequest settles the request's reservation at e.ActualCost and
+	// records e in the usage ledger.
+	CommitRequest(ctx context.Context, e *UsageEvent) error
+}
+
+type ReservationExtender interface {
+	// ExtendReservation adds amount to the request's reservation, or fails
+	// with ErrBudgetExceeded if a budget it is held against cannot afford it.
+	ExtendReservation(ctx context.Context, req *Request, amount float64) error
+}
+
+// CostPolicy decides how a pass-through call is charged.
+type CostPolicy string
+
+const (
+	CostFree  CostPolicy = "free"
+	CostFlat  CostPolicy = "flat"
+	CostUsage CostPolicy = "usage"
+)
+
+// PassThrough describes a request forwarded verbatim to an upstream path.
+type PassThrough struct {
+	Method string
+	// Path is relative to /v1 and includes the query string, if any.
+	Path   string
+	Policy CostPolicy
+	// Fee is charged per successful call under CostFlat.
+	Fee float64
 }
 
 type Request struct {
-	Context      context.Context
-	Key          *Key
-	Provider     Provider
-	Model        Model
-	RawBody      []byte
-	IsStream     bool
+	Context  context.Context
+	Key      *Key
+	Provider Provider
+	// Endpoint is the upstream API being called; empty means chat completions.
+	Endpoint Endpoint
+	Model    Model
+	// ContentType is the client's request content type, needed to read
+	// non-JSON bodies such as multipart uploads.
+	ContentType string
+	// PassThrough is set for requests forwarded verbatim to other paths.
+	PassThrough *PassThrough
+	RawBody     []byte
+	IsStream    bool
+	// RequestID identifies the request's budget reservation.
+	RequestID    string
 	ReservedCost float64
 	Committer    UsageCommitter
+	// Reserver is set for streams that are cut off once their reservation
+	// can no longer be extended.
+	Reserver ReservationExtender
+	// StartedAt is when the proxy received the request.
+	StartedAt time.Time
 }
 
 type Response struct {
@@ -64,3 +106,67 @@ type HandlerFunc func(req *Request) (*Response, error)
 func (f HandlerFunc) Handle(req *Request) (*Response, error) {
 	return f(req)
 }
+
+// IsChat reports whether the request targets the chat completions API.
+func (r *Request) IsChat() bool {
+	return r.PassThrough == nil && (r.Endpoint == "" || r.Endpoint == EndpointChat)
+}
+
+// UsageEvent returns the usage record of the request, given the upstream
+// status code and the usage it is charged for.
+func (r *Request) UsageEvent(statusCode int, usage *Usage) *UsageEvent {
+	now := time.Now()
+	e := &UsageEvent{
+		RequestID:    r.RequestID,
+		Model:        r.Model,
+		Endpoint:     r.Endpoint,
+		PromptTokens: usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		ReservedCost: r.ReservedCost,
+		ActualCost:   usage.TotalCost,
+		StatusCode:   statusCode,
+		Stream:       r.IsStream,
+		CreatedAt:    now,
+	}
+	if r.Key != nil {
+		e.KeyID = r.Key.ID
+		if r.Key.Configuration != nil {
+			e.Provider = r.Key.Configuration.Provider.ID
+		}
+	}
+	if !r.StartedAt.IsZero() {
+		e.Latency = now.Sub(r.StartedAt)
+	}
+	return e
+}
+
+// EstimateUsage returns the provider's pre-call usage estimate for the
+// request's endpoint, or nil if none is available.
+func (r *Request) EstimateUsage() *Usage {
+	var usage *Usage
+	if r.PassThrough != nil {
+		return r.PassThrough.estimateUsage(r)
+	}
+	if r.IsChat() {
+		usage, _ = r.Provider.EstimateUsage(r.Model, r.RawBody)
+	} else if ep, ok := r.Provider.(EndpointProvider); ok {
+		usage, _ = ep.EstimateEndpointUsage(r.Endpoint, r.Model, r.ContentType, r.RawBody)
+	}
+	return usage
+}
+
+// estimateUsage reserves the flat fee, or for usage-priced calls whatever the
+// provider can estimate from a chat-style body.
+func (p *PassThrough) estimateUsage(r *Request) *Usage {
+	switch p.Policy {
+	case CostFlat:
+		return &Usage{TotalCost: p.Fee}
+	case CostUsage:
+		if r.Model == "" {
+			return nil
+		}
+		usage, _ := r.Provider.EstimateUsage(r.Model, r.RawBody)
+		return usage
+	}
+	return nil
+}
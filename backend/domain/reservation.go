@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrReservationNotFound = errors.New("reservation not found")
+
+type ReservationState string
+
+const (
+	// ReservationOpen holds the reserved amount until the request settles.
+	ReservationOpen ReservationState = "open"
+	// ReservationRefunded expired and its amount was released.
+	ReservationRefunded ReservationState = "refunded"
+	// ReservationCharged expired and its amount was kept as the cost.
+	ReservationCharged ReservationState = "charged"
+)
+
+// Reservation records a budget amount held for an in-flight request, so it
+// can be released or charged if the request never settles (e.g. after a crash).
+type Reservation struct {
+	ID        int64
+	KeyID     ID
+	RequestID string
+	// Model is charged against the key's matching model budgets, if any.
+	Model     Model
+	Amount    float64
+	State     ReservationState
+	CreatedAt time.Time
+}
+
+// ReservationRepository is optionally implemented by a Repository to keep a
+// ledger of reservations. Each method updates the ledger and the key's usage
+// atomically.
+type ReservationRepository interface {
+	// Reserve reserves r.Amount like Repository.ReserveUsage, and against
+	// the key's model budgets matching r.Model, and records r as open.
+	Reserve(ctx context.Context, r *Reservation) error
+	// Commit settles the reservation of requestID to the actual cost, removes
+	// it from the ledger and returns the change applied to the key's usage.
+	// A reservation that has expired is still settled, taking into account
+	// whether it was refunded.
+	Commit(ctx context.Context, requestID string, actual float64) (float64, error)
+	// Extend adds amount to an open reservation, reserving it against the
+	// same budgets as Reserve. It returns ErrReservationNotFound if the
+	// reservation is no longer open.
+	Extend(ctx context.Context, requestID string, amount float64) error
+	// Expire closes an open reservation as ReservationRefunded, releasing its
+	// amount, or as ReservationCharged. It reports false if the reservation
+	// was no longer open.
+	Expire(ctx context.Context, requestID string, state ReservationState) (bool, error)
+	// ListReservations returns the reservations in state created at or
+	// before the given time, oldest first.
+	ListReservations(ctx context.Context, state ReservationState, before time.Time) ([]*Reservation, error)
+	// Headroom returns the least room left in any budget that Reserve checks
+	// for the key and model. It reports false if none of them is limited.
+	Headroom(ctx context.Context, keyID ID, model Model) (float64, bool, error)
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ResetInterval is the length of a calendar-aligned budget period.
+type ResetInterval string
+
+const (
+	ResetDaily   ResetInterval = "daily"
+	ResetWeekly  ResetInterval = "weekly"
+	ResetMonthly ResetInterval = "monthly"
+)
+
+// ResetSchedule resets a budget at the start of every calendar day, week or
+// month in a timezone, rather than a number of seconds after its last reset.
+type ResetSchedule struct {
+	Interval ResetInterval `json:"interval"`
+	// Day is the weekday weekly budgets reset on (0 = Sunday), or the day of
+	// the month monthly ones reset on (1-31, zero meaning the 1st). Months
+	// shorter than Day reset on their last day.
+	Day int `json:"day,omitempty"`
+	// Timezone is an IANA name such as "Europe/Berlin"; empty uses the
+	// server's budget timezone.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (s *ResetSchedule) Validate() error {
+	switch s.Interval {
+	case ResetDaily:
+	case ResetWeekly:
+		if s.Day < 0 || s.Day > 6 {
+			return &ValidationError{fmt.Sprintf("weekly reset day must be 0-6 (Sunday-Saturday), got %d", s.Day)}
+		}
+	case ResetMonthly:
+		if s.Day < 0 || s.Day > 31 {
+			return &ValidationError{fmt.Sprintf("monthly reset day must be 1-31, got %d", s.Day)}
+		}
+	default:
+		return &ValidationError{fmt.Sprintf("reset interval %q is invalid (want daily, weekly or monthly)", s.Interval)}
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return &ValidationError{fmt.Sprintf("reset timezone %q is invalid", s.Timezone)}
+		}
+	}
+	return nil
+}
+
+func (s *ResetSchedule) location(def *time.Location) *time.Location {
+	if s.Timezone != "" {
+		if loc, err := time.LoadLocation(s.Timezone); err == nil {
+			return loc
+		}
+	}
+	if def == nil {
+		return time.UTC
+	}
+	return def
+}
+
+// Next returns the first period boundary after t, using def as the timezone
+// if the schedule has none.
+func (s *ResetSchedule) Next(t time.Time, def *time.Location) time.Time {
+	loc := s.location(def)
+	t = t.In(loc)
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+
+	switch s.Interval {
+	case ResetWeekly:
+		days := (s.Day - int(midnight.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return midnight.AddDate(0, 0, days)
+	case ResetMonthly:
+		next := monthDay(y, m, s.Day, loc)
+		if !next.After(t) {
+			next = monthDay(y, m+1, s.Day, loc)
+		}
+		return next
+	default:
+		return midnight.AddDate(0, 0, 1)
+	}
+}
+
+// Start returns the start of the period containing t, using def as the
+// timezone if the schedule has none.
+func (s *ResetSchedule) Start(t time.Time, def *time.Location) time.Time {
+	// No period is longer than 31 days
+	start := s.Next(t.AddDate(0, 0, -32), def)
+	for next := s.Next(start, def); !next.After(t); next = s.Next(next, def) {
+		start = next
+	}
+	return start
+}
+
+// monthDay returns midnight on the given day of the month, or on its last
+// day if the month is shorter.
+func monthDay(y int, m time.Month, day int, loc *time.Location) time.Time {
+	// Day 0 of the following month normalizes to the last day of this one
+	last := time.Date(y, m+1, 0, 0, 0, 0, 0, loc).Day()
+	return time.Date(y, m, min(max(day, 1), last), 0, 0, 0, 0, loc)
+}
+
+// DueReset reports whether a budget last reset at lastReset is due to reset
+// at now and, if so, when its current period started: the latest boundary
+// of schedule, or now for budgets without one that reset every resetPeriod
+// seconds.
+func DueReset(lastReset, now time.Time, resetPeriod int, schedule *ResetSchedule, loc *time.Location) (time.Time, bool) {
+	if schedule != nil {
+		start := schedule.Next(lastReset, loc)
+		if start.After(now) {
+			return time.Time{}, false
+		}
+		// Catch up on periods missed while the server was down
+		for next := schedule.Next(start, loc); !next.After(now); next = schedule.Next(next, loc) {
+			start = next
+		}
+		return start, true
+	}
+	if resetPeriod > 0 && now.After(lastReset.Add(time.Duration(resetPeriod)*time.Second)) {
+		return now, true
+	}
+	return time.Time{}, false
+}
+
+// BudgetScope is the level of the budget hierarchy a budget belongs to.
+type BudgetScope string
+
+const (
+	BudgetScopeKey          BudgetScope = "key"
+	BudgetScopeProject      BudgetScope = "project"
+	BudgetScopeOrganization BudgetScope = "organization"
+	// BudgetScopeProvider is the cap on the combined spend of all keys of a
+	// provider.
+	BudgetScopeProvider BudgetScope = "provider"
+)
+
+// BudgetReset records a budget starting over for a new period.
+type BudgetReset struct {
+	ID      int64       `json:"id"`
+	Scope   BudgetScope `json:"scope"`
+	ScopeID ID          `json:"scope_id"`
+	Name    string      `json:"name"`
+	// Usage is what was spent in the period that ended.
+	Usage float64 `json:"usage"`
+	// Held is what open reservations hold, carried into the new period.
+	Held        float64   `json:"held"`
+	PeriodStart time.Time `json:"period_start"`
+	// ResetAt is when the new period started.
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// BudgetResetRepository is optionally implemented by a Repository to reset
+// budgets together with a record of each reset.
+type BudgetResetRepository interface {
+	// ResetBudget zeroes the usage of a key, project, organization or
+	// provider cap as of at, but for what its open reservations hold, and
+	// records it. It returns nil if the budget no longer exists or
+	// was already reset at or after at.
+	ResetBudget(ctx context.Context, scope BudgetScope, id ID, at time.Time) (*BudgetReset, error)
+	// ListBudgetResets returns up to limit resets, newest first.
+	ListBudgetResets(ctx context.Context, limit int) ([]*BudgetReset, error)
+}
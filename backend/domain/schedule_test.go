@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResetScheduleNext(t *testing.T) {
+	utc := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule ResetSchedule
+		after    time.Time
+		want     time.Time
+	}{
+		{"Daily", ResetSchedule{Interval: ResetDaily}, utc(3, 10, 15), utc(3, 11, 0)},
+		{"Daily at boundary", ResetSchedule{Interval: ResetDaily}, utc(3, 11, 0), utc(3, 12, 0)},
+		// 2026-03-10 15:00 UTC is midnight of the 11th in Tokyo
+		{"Daily in timezone", ResetSchedule{Interval: ResetDaily, Timezone: "Asia/Tokyo"}, utc(3, 10, 15), utc(3, 11, 15)},
+		{"Weekly on Monday", ResetSchedule{Interval: ResetWeekly, Day: 1}, utc(3, 11, 12), utc(3, 16, 0)},
+		{"Weekly on the same weekday", ResetSchedule{Interval: ResetWeekly, Day: 0}, utc(3, 15, 0), utc(3, 22, 0)},
+		{"Monthly later this month", ResetSchedule{Interval: ResetMonthly, Day: 15}, utc(3, 10, 8), utc(3, 15, 0)},
+		{"Monthly at boundary", ResetSchedule{Interval: ResetMonthly, Day: 15}, utc(3, 15, 0), utc(4, 15, 0)},
+		{"Monthly on a missing day", ResetSchedule{Interval: ResetMonthly, Day: 31}, utc(1, 31, 10), utc(2, 28, 0)},
+		{"Monthly default day", ResetSchedule{Interval: ResetMonthly}, utc(3, 10, 8), utc(4, 1, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Next(tt.after, time.UTC); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestResetScheduleStart(t *testing.T) {
+	utc := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule ResetSchedule
+		at       time.Time
+		want     time.Time
+	}{
+		{"Daily", ResetSchedule{Interval: ResetDaily}, utc(3, 10, 15), utc(3, 10, 0)},
+		{"Daily at boundary", ResetSchedule{Interval: ResetDaily}, utc(3, 11, 0), utc(3, 11, 0)},
+		{"Weekly on Monday", ResetSchedule{Interval: ResetWeekly, Day: 1}, utc(3, 11, 12), utc(3, 9, 0)},
+		{"Monthly", ResetSchedule{Interval: ResetMonthly}, utc(3, 31, 23), utc(3, 1, 0)},
+		{"Monthly on a later day", ResetSchedule{Interval: ResetMonthly, Day: 15}, utc(3, 10, 8), utc(2, 15, 0)},
+		{"Monthly on a missing day", ResetSchedule{Interval: ResetMonthly, Day: 31}, utc(3, 10, 8), utc(2, 28, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Start(tt.at, time.UTC); !got.Equal(tt.want) {
+				t.Errorf("Start(%v) = %v, want %v", tt.at, got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDueReset(t *testing.T) {
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	monthly := &ResetSchedule{Interval: ResetMonthly, Day: 1}
+
+	tests := []struct {
+		name      string
+		lastReset time.Time
+		period    int
+		schedule  *ResetSchedule
+		wantDue   bool
+		wantAt    time.Time
+	}{
+		{"Schedule catches up to the current period", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), 0, monthly, true, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"Schedule within the period", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 0, monthly, false, time.Time{}},
+		{"Schedule takes precedence over the period", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 60, monthly, false, time.Time{}},
+		{"Period elapsed", now.Add(-2 * time.Hour), 3600, nil, true, now},
+		{"Period not elapsed", now.Add(-30 * time.Minute), 3600, nil, false, time.Time{}},
+		{"Never resets", now.Add(-1000 * time.Hour), 0, nil, false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, due := DueReset(tt.lastReset, now, tt.period, tt.schedule, time.UTC)
+			if due != tt.wantDue || !at.Equal(tt.wantAt) {
+				t.Errorf("DueReset() = %v, %v, want %v, %v", at, due, tt.wantAt, tt.wantDue)
+			}
+		})
+	}
+}
+
+func TestResetScheduleValidate(t *testing.T) {
+	tests := []struct {
+		schedule ResetSchedule
+		wantErr  bool
+	}{
+		{ResetSchedule{Interval: ResetDaily}, false},
+		{ResetSchedule{Interval: ResetWeekly, Day: 6, Timezone: "Europe/Berlin"}, false},
+		{ResetSchedule{Interval: ResetMonthly, Day: 31}, false},
+		{ResetSchedule{Interval: ResetWeekly, Day: 7}, true},
+		{ResetSchedule{Interval: ResetMonthly, Day: 32}, true},
+		{ResetSchedule{Interval: "yearly"}, true},
+		{ResetSchedule{Interval: ResetDaily, Timezone: "Mars/Olympus_Mons"}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.schedule.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v: Validate() error = %v, wantErr %v", tt.schedule, err, tt.wantErr)
+		}
+		if err != nil && !IsValidationError(err) {
+			t.Errorf("%+v: expected a validation error, got %v", tt.schedule, err)
+		}
+	}
+}
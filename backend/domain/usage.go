@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// UsageEvent is the cost record of one request, written to the usage ledger
+// when its usage is committed.
+type UsageEvent struct {
+	ID        int64
+	KeyID     ID
+	RequestID string
+	Model     Model
+	Provider  string
+	// Endpoint is empty for chat completions and pass-through calls.
+	Endpoint     Endpoint
+	PromptTokens int
+	OutputTokens int
+	ReservedCost float64
+	ActualCost   float64
+	StatusCode   int
+	// Latency is measured from when the proxy received the request until
+	// its usage was committed, i.e. the end of the stream for streams.
+	Latency   time.Duration
+	Stream    bool
+	CreatedAt time.Time
+}
+
+// UsageQuery selects the usage events of a key. A zero From or To leaves
+// that end of the range open; To is exclusive.
+type UsageQuery struct {
+	KeyID ID
+	From  time.Time
+	To    time.Time
+	// Limit caps the number of events listed; summaries cover all of them.
+	Limit int
+}
+
+// UsageSummary aggregates usage events, e.g. those of one model.
+type UsageSummary struct {
+	Model        Model
+	Requests     int
+	PromptTokens int
+	OutputTokens int
+	Cost         float64
+}
+
+// UsageRepository is optionally implemented by a Repository to keep a
+// ledger of the usage of each request.
+type UsageRepository interface {
+	RecordUsage(ctx context.Context, e *UsageEvent) error
+	// ListUsage returns the events matching q, newest first.
+	ListUsage(ctx context.Context, q UsageQuery) ([]*UsageEvent, error)
+	// SummarizeUsage aggregates the events matching q by model.
+	SummarizeUsage(ctx context.Context, q UsageQuery) ([]*UsageSummary, error)
+}
+
+// ReportPeriod is the time bucket usage reports are grouped by. Reports
+// use UTC; weeks start on Monday.
+type ReportPeriod string
+
+const (
+	ReportTotal ReportPeriod = ""
+	ReportHour  ReportPeriod = "hour"
+	ReportDay   ReportPeriod = "day"
+	ReportWeek  ReportPeriod = "week"
+	ReportMonth ReportPeriod = "month"
+)
+
+// ReportGroup is a dimension usage reports can be grouped by.
+type ReportGroup string
+
+const (
+	ReportByKey      ReportGroup = "key"
+	ReportByProvider ReportGroup = "provider"
+	ReportByModel    ReportGroup = "model"
+)
+
+// ReportQuery selects the usage rollups of periods starting in [From, To);
+// a zero From or To leaves that end open.
+type ReportQuery struct {
+	From    time.Time
+	To      time.Time
+	Period  ReportPeriod
+	GroupBy []ReportGroup
+}
+
+func (q ReportQuery) Validate() error {
+	switch q.Period {
+	case ReportTotal, ReportHour, ReportDay, ReportWeek, ReportMonth:
+	default:
+		return &ValidationError{fmt.Sprintf("unknown report period %q", q.Period)}
+	}
+	for _, g := range q.GroupBy {
+		switch g {
+		case ReportByKey, ReportByProvider, ReportByModel:
+		default:
+			return &ValidationError{fmt.Sprintf("unknown report grouping %q", g)}
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return &ValidationError{"report range must end after it starts"}
+	}
+	return nil
+}
+
+// Groups reports whether the query groups by g.
+func (q ReportQuery) Groups(g ReportGroup) bool {
+	return slices.Contains(q.GroupBy, g)
+}
+
+// ReportRow is the usage of one period and group. Fields that are not
+// grouped by are left zero.
+type ReportRow struct {
+	PeriodStart  time.Time
+	KeyID        ID
+	KeyName      string
+	Provider     string
+	Model        Model
+	Requests     int
+	PromptTokens int
+	OutputTokens int
+	Cost         float64
+}
+
+// ReportRepository is optionally implemented by a UsageRepository that
+// keeps hourly and daily rollups of the usage ledger.
+type ReportRepository interface {
+	// UsageReport returns q's rows ordered by period, then by cost.
+	UsageReport(ctx context.Context, q ReportQuery) ([]*ReportRow, error)
+}
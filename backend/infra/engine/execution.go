@@ -2,10 +2,13 @@ package engine
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"pouch-ai/backend/domain"
 	"pouch-ai/backend/util"
+	"pouch-ai/backend/util/logger"
 )
 
 type ExecutionHandler struct {
@@ -21,18 +24,45 @@ func NewExecutionHandler(repo domain.Repository) *ExecutionHandler {
 }
 
 func (h *ExecutionHandler) Handle(req *domain.Request) (*domain.Response, error) {
+	if req.PassThrough != nil {
+		return h.handlePassThrough(req)
+	}
+	if !req.IsChat() && !req.IsStream {
+		return h.handleEndpoint(req)
+	}
+
 	// 1. Prepare Request
-	httpReq, err := req.Provider.PrepareHTTPRequest(req.Context, req.Model, req.RawBody)
+	httpReq, err := h.prepareRequest(req)
 	if err != nil {
 		return nil, err
 	}
 
+	// Capped streams are cut off by cancelling the upstream request
+	capped := req.IsStream && req.Reserver != nil
+	cancel := func() {}
+	if capped {
+		ctx, cancelUpstream := context.WithCancel(httpReq.Context())
+		httpReq, cancel = httpReq.WithContext(ctx), cancelUpstream
+	}
+
 	// 2. Execute
 	resp, err := h.client.Do(httpReq)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
+	translator, translates := req.Provider.(domain.ResponseTranslator)
+	translates = translates && resp.StatusCode >= 200 && resp.StatusCode < 300
+
+	inputUsage := req.EstimateUsage()
+	if inputUsage == nil {
+		inputUsage = &domain.Usage{}
+	}
+	// The estimate also covers the worst-case output; only its input part is known
+	pricing, _ := req.Provider.GetPricing(req.Model)
+	inputCost := float64(inputUsage.InputTokens) / 1000.0 * pricing.Input
+
 	// 3. For non-streaming, we still need to read it to count tokens reliably if the provider needs the full body.
 	// But let's try to be consistent.
 	if !req.IsStream {
@@ -42,45 +72,182 @@ func (h *ExecutionHandler) Handle(req *domain.Request) (*domain.Response, error)
 			return nil, err
 		}
 
-		inputUsage, _ := req.Provider.EstimateUsage(req.Model, req.RawBody)
+		if translates {
+			if translated, err := translator.TranslateResponse(req.Model, body); err == nil {
+				body = translated
+				resp.Header.Del("Content-Length")
+			}
+		}
+
+		promptTokens := inputUsage.InputTokens
 		outputTokens, _ := req.Provider.ParseOutputUsage(req.Model, body, false)
-		pricing, _ := req.Provider.GetPricing(req.Model)
 
-		inputCost := 0.0
-		if inputUsage != nil {
-			inputCost = inputUsage.TotalCost
-		}
 		outputCost := float64(outputTokens) / 1000.0 * pricing.Output
 		totalCost := inputCost + outputCost
 
-		// Commit usage for non-streaming
-		if req.Committer != nil && req.Key != nil {
-			_ = req.Committer.CommitUsage(req.Context, req.Key.ID, req.ReservedCost, totalCost)
+		// Prefer the exact counts reported upstream over the local estimate
+		if parser, ok := req.Provider.(domain.UsageParser); ok {
+			if usage, err := parser.ParseUsage(req.Model, body); err == nil && usage != nil {
+				promptTokens = usage.InputTokens
+				outputTokens = usage.OutputTokens
+				totalCost = usage.TotalCost
+			}
 		}
 
+		// Commit usage for non-streaming
+		commit(req, resp.StatusCode, &domain.Usage{InputTokens: promptTokens, OutputTokens: outputTokens, TotalCost: totalCost})
+
 		return &domain.Response{
 			StatusCode:   resp.StatusCode,
 			Header:       resp.Header,
 			Body:         io.NopCloser(bytes.NewBuffer(body)),
-			PromptTokens: inputUsage.InputTokens,
+			PromptTokens: promptTokens,
 			OutputTokens: outputTokens,
 			TotalCost:    totalCost,
 		}, nil
 	}
 
 	// 4. For streaming, we return the body directly but wrapped in a CountingReader.
-	inputUsage, _ := req.Provider.EstimateUsage(req.Model, req.RawBody)
-	inputCost := 0.0
-	if inputUsage != nil {
-		inputCost = inputUsage.TotalCost
+	body := resp.Body
+	if translates {
+		body = translator.TranslateStream(req.Model, body)
+		resp.Header.Del("Content-Length")
+		resp.Header.Set("Content-Type", "text/event-stream")
 	}
 
 	// Create a wrapper that will update the database on Close()
+	counter := util.NewCountingReader(body, req, resp.StatusCode, inputUsage.InputTokens)
+	if capped {
+		counter = util.NewCappedCountingReader(body, req, resp.StatusCode, inputUsage.InputTokens, cancel)
+	}
 	return &domain.Response{
 		StatusCode:   resp.StatusCode,
 		Header:       resp.Header,
-		Body:         util.NewCountingReader(resp.Body, req.Provider, req.Model, req.Committer, req.Key.ID, req.ReservedCost, req.Context),
+		Body:         counter,
 		PromptTokens: inputUsage.InputTokens,
 		TotalCost:    inputCost,
 	}, nil
 }
+
+// commit settles the request's reservation and records its usage, even if
+// the client has gone away since the response was received.
+func commit(req *domain.Request, statusCode int, usage *domain.Usage) {
+	if req.Committer == nil || req.Key == nil {
+		return
+	}
+	ctx := context.WithoutCancel(req.Context)
+	if err := req.Committer.CommitRequest(ctx, req.UsageEvent(statusCode, usage)); err != nil {
+		logger.L.Warn("failed to commit usage", "prefix", req.Key.Prefix, "request_id", req.RequestID, "error", err)
+	}
+}
+
+// prepareRequest builds the upstream request for a chat request or a
+// streaming endpoint request, which is metered like a chat stream.
+func (h *ExecutionHandler) prepareRequest(req *domain.Request) (*http.Request, error) {
+	if req.IsChat() {
+		return req.Provider.PrepareHTTPRequest(req.Context, req.Model, req.RawBody)
+	}
+	ep, ok := req.Provider.(domain.EndpointProvider)
+	if !ok || !ep.SupportsEndpoint(req.Endpoint) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrNotSupported, req.Endpoint)
+	}
+	return ep.PrepareEndpointRequest(req.Context, req.Endpoint, req.Model, req.ContentType, req.RawBody)
+}
+
+// handleEndpoint executes a non-streaming, non-chat request. The usage reported in the
+// response is committed; failed calls are not charged.
+func (h *ExecutionHandler) handleEndpoint(req *domain.Request) (*domain.Response, error) {
+	ep, ok := req.Provider.(domain.EndpointProvider)
+	if !ok || !ep.SupportsEndpoint(req.Endpoint) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrNotSupported, req.Endpoint)
+	}
+
+	httpReq, err := ep.PrepareEndpointRequest(req.Context, req.Endpoint, req.Model, req.ContentType, req.RawBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &domain.Usage{}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if estimated := req.EstimateUsage(); estimated != nil {
+			usage = estimated
+		}
+		if parsed, err := ep.ParseEndpointUsage(req.Endpoint, req.Model, body); err == nil && parsed != nil {
+			usage = parsed
+		}
+	}
+
+	commit(req, resp.StatusCode, usage)
+
+	return &domain.Response{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         io.NopCloser(bytes.NewBuffer(body)),
+		PromptTokens: usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		TotalCost:    usage.TotalCost,
+	}, nil
+}
+
+// handlePassThrough forwards a request verbatim. Free and flat-fee calls are
+// streamed through untouched; usage-priced calls are read in full so the
+// usage can be parsed. Failed calls are not charged.
+func (h *ExecutionHandler) handlePassThrough(req *domain.Request) (*domain.Response, error) {
+	pp, ok := req.Provider.(domain.PassThroughProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrNotSupported, req.PassThrough.Path)
+	}
+
+	httpReq, err := pp.PreparePassThroughRequest(req.Context, req.PassThrough.Method, req.PassThrough.Path, req.ContentType, req.RawBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := resp.StatusCode >= 200 && resp.StatusCode < 300
+
+	body := resp.Body
+	usage := &domain.Usage{}
+	switch req.PassThrough.Policy {
+	case domain.CostFlat:
+		if succeeded {
+			usage.TotalCost = req.PassThrough.Fee
+		}
+	case domain.CostUsage:
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if succeeded {
+			if parsed, err := pp.ParsePassThroughUsage(req.Model, data); err == nil && parsed != nil {
+				usage = parsed
+			}
+		}
+		body = io.NopCloser(bytes.NewBuffer(data))
+	}
+
+	commit(req, resp.StatusCode, usage)
+
+	return &domain.Response{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		PromptTokens: usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		TotalCost:    usage.TotalCost,
+	}, nil
+}
@@ -52,6 +52,21 @@ func (m *PluginManager) InitializeBuiltins() error {
 		}
 	}
 
+	// 3. Initialize configured provider instances
+	for _, b := range providers.GetSetBuilders() {
+		ps, err := b.BuildAll(ctx, m.cfg)
+		if err != nil {
+			return fmt.Errorf("failed to build providers: %w", err)
+		}
+		for _, p := range ps {
+			if _, err := m.pRegistry.Get(p.Name()); err == nil {
+				return fmt.Errorf("provider %q is already registered", p.Name())
+			}
+			m.pRegistry.Register(p.Name(), p)
+			logger.L.Info("Registered provider", "name", p.Name())
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,140 @@
+// Package notifiers delivers budget alerts over HTTP.
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+)
+
+// New builds a notifier that sends each alert to all the configured
+// notifiers. It returns nil if none are configured.
+func New(cfgs []config.NotifierConfig) (domain.Notifier, error) {
+	var notifiers Multi
+	for _, cfg := range cfgs {
+		n, err := newNotifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+	if len(notifiers) == 1 {
+		return notifiers[0], nil
+	}
+	return notifiers, nil
+}
+
+func newNotifier(cfg config.NotifierConfig) (domain.Notifier, error) {
+	hook := &HTTPNotifier{URL: cfg.URL, Headers: cfg.Headers}
+	switch cfg.Type {
+	case config.NotifierWebhook:
+		hook.Encode = encodeWebhook
+	case config.NotifierSlack:
+		hook.Encode = encodeSlack
+	case config.NotifierNtfy:
+		hook.Encode = encodeNtfy
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+	return hook, nil
+}
+
+// Multi sends each alert to every notifier in turn.
+type Multi []domain.Notifier
+
+func (m Multi) Notify(ctx context.Context, a *domain.Alert) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HTTPNotifier POSTs each alert to URL, in the format set by Encode.
+type HTTPNotifier struct {
+	URL     string
+	Headers map[string]string
+	// Encode returns the request body and the headers the format needs.
+	Encode func(a *domain.Alert) ([]byte, http.Header, error)
+	Client *http.Client
+}
+
+func (n *HTTPNotifier) Notify(ctx context.Context, a *domain.Alert) error {
+	body, header, err := n.Encode(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notifier returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": {"application/json"}}
+}
+
+// encodeWebhook sends the alert as JSON, with its message.
+func encodeWebhook(a *domain.Alert) ([]byte, http.Header, error) {
+	body, err := json.Marshal(struct {
+		*domain.Alert
+		Message string `json:"message"`
+	}{a, a.Message()})
+	return body, jsonHeader(), err
+}
+
+// encodeSlack sends a message in the format of Slack incoming webhooks,
+// which Mattermost, Discord ("/slack" URLs) and others accept too.
+func encodeSlack(a *domain.Alert) ([]byte, http.Header, error) {
+	body, err := json.Marshal(map[string]string{"text": a.Message()})
+	return body, jsonHeader(), err
+}
+
+// encodeNtfy publishes the message as plain text to an ntfy topic URL.
+func encodeNtfy(a *domain.Alert) ([]byte, http.Header, error) {
+	priority := "default"
+	if a.Threshold >= 100 {
+		priority = "high"
+	}
+	title := "Budget alert: " + a.KeyName
+	if a.Scope == domain.BudgetScopeProvider {
+		title = "Provider cap alert: " + a.Provider
+	}
+	header := http.Header{
+		"Content-Type": {"text/plain; charset=utf-8"},
+		"Title":        {title},
+		"Priority":     {priority},
+		"Tags":         {"warning"},
+	}
+	return []byte(a.Message()), header, nil
+}
@@ -0,0 +1,122 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"strings"
+	"testing"
+)
+
+type received struct {
+	header http.Header
+	body   string
+}
+
+func newReceiver(t *testing.T, status int) (*httptest.Server, <-chan received) {
+	t.Helper()
+	ch := make(chan received, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func testAlert() *domain.Alert {
+	return &domain.Alert{KeyID: 7, KeyName: "ci", KeyPrefix: "sk-pouch-ab", Provider: "openai", Threshold: 80, Usage: 8, Limit: 10}
+}
+
+func TestNotifiers(t *testing.T) {
+	srv, ch := newReceiver(t, http.StatusOK)
+
+	tests := []struct {
+		cfg   config.NotifierConfig
+		check func(t *testing.T, r received)
+	}{
+		{
+			cfg: config.NotifierConfig{Type: config.NotifierWebhook, URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer s3cret"}},
+			check: func(t *testing.T, r received) {
+				var got map[string]any
+				if err := json.Unmarshal([]byte(r.body), &got); err != nil {
+					t.Fatalf("invalid JSON %q: %v", r.body, err)
+				}
+				if got["key_name"] != "ci" || got["threshold"] != 80.0 || got["limit"] != 10.0 {
+					t.Errorf("unexpected payload %v", got)
+				}
+				if !strings.Contains(got["message"].(string), "80%") {
+					t.Errorf("unexpected message %q", got["message"])
+				}
+				if r.header.Get("Authorization") != "Bearer s3cret" {
+					t.Errorf("expected the configured header, got %v", r.header)
+				}
+			},
+		},
+		{
+			cfg: config.NotifierConfig{Type: config.NotifierSlack, URL: srv.URL},
+			check: func(t *testing.T, r received) {
+				want := `{"text":"Key \"ci\" has used 80% of its budget ($8.00 of $10.00)"}`
+				if r.body != want {
+					t.Errorf("body = %s, want %s", r.body, want)
+				}
+			},
+		},
+		{
+			cfg: config.NotifierConfig{Type: config.NotifierNtfy, URL: srv.URL},
+			check: func(t *testing.T, r received) {
+				if !strings.HasPrefix(r.body, `Key "ci" has used 80%`) {
+					t.Errorf("unexpected body %q", r.body)
+				}
+				if r.header.Get("Title") != "Budget alert: ci" || r.header.Get("Priority") != "default" {
+					t.Errorf("unexpected headers %v", r.header)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cfg.Type, func(t *testing.T) {
+			n, err := New([]config.NotifierConfig{tt.cfg})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if err := n.Notify(context.Background(), testAlert()); err != nil {
+				t.Fatalf("Notify failed: %v", err)
+			}
+			tt.check(t, <-ch)
+		})
+	}
+}
+
+func TestNotifiers_Errors(t *testing.T) {
+	if _, err := New([]config.NotifierConfig{{Type: "email", URL: "http://localhost"}}); err == nil {
+		t.Error("expected an error for an unknown notifier type")
+	}
+	if n, err := New(nil); n != nil || err != nil {
+		t.Errorf("New(nil) = %v, %v, want nil, nil", n, err)
+	}
+
+	failing, _ := newReceiver(t, http.StatusInternalServerError)
+	ok, okCh := newReceiver(t, http.StatusNoContent)
+	n, err := New([]config.NotifierConfig{
+		{Type: config.NotifierSlack, URL: failing.URL},
+		{Type: config.NotifierSlack, URL: ok.URL},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := n.Notify(context.Background(), testAlert()); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("expected the failing notifier's status, got %v", err)
+	}
+	select {
+	case <-okCh:
+	default:
+		t.Error("expected the other notifier to be sent the alert")
+	}
+}
@@ -0,0 +1,551 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"strings"
+	"time"
+)
+
+//go:embed anthropic_pricing.json
+var anthropicPricingJSON []byte
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultBaseURL   = "https://api.anthropic.com/v1"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicProvider serves OpenAI-style chat requests from the Anthropic
+// Messages API, translating requests, responses and streams on the fly.
+type AnthropicProvider struct {
+	chatMeter
+	apiKey  string
+	baseURL string
+}
+
+type AnthropicBuilder struct{}
+
+func (b *AnthropicBuilder) Build(ctx context.Context, cfg *config.Config) (domain.Provider, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		apiKey = cfg.AnthropicKey
+	}
+
+	apiURL := os.Getenv("ANTHROPIC_URL")
+	if apiURL == "" {
+		apiURL = cfg.AnthropicURL
+	}
+
+	if apiKey == "" {
+		fmt.Println("WARN: Anthropic API Key not found. 'anthropic' provider will be unavailable.")
+		return nil, nil
+	}
+
+	pricing, err := NewAnthropicPricing()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAnthropicProvider(apiKey, apiURL, pricing, NewTiktokenCounter()), nil
+}
+
+func NewAnthropicPricing() (*PricingTable, error) {
+	pricing, err := ParsePricingTable(anthropicPricingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse anthropic_pricing.json: %w", err)
+	}
+	return pricing, nil
+}
+
+func NewAnthropicProvider(apiKey string, baseURL string, pricing *PricingTable, counter TokenCounter) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+
+	return &AnthropicProvider{
+		chatMeter: chatMeter{pricing: pricing, tokenCounter: counter, defaultMaxTokens: anthropicDefaultMaxTokens},
+		apiKey:    apiKey,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (p *AnthropicProvider) Schema() domain.PluginSchema {
+	return domain.PluginSchema{
+		"api_key": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "API Key",
+			Description: "Your Anthropic API Key",
+			Role:        domain.FieldRoleCredential,
+		},
+		"base_url": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Base URL",
+			Default:     anthropicDefaultBaseURL,
+			Description: "Anthropic API Base URL",
+			Role:        domain.FieldRoleCredential,
+		},
+	}
+}
+
+func (p *AnthropicProvider) Configure(config map[string]any) (domain.Provider, error) {
+	newP := *p
+	if s, ok := config["api_key"].(string); ok && s != "" {
+		newP.apiKey = s
+	}
+	if s, ok := config["base_url"].(string); ok && s != "" {
+		newP.baseURL = strings.TrimSuffix(s, "/")
+	}
+	return &newP, nil
+}
+
+func (p *AnthropicProvider) WithFallbackPricing(pricing domain.Pricing) domain.Provider {
+	newP := *p
+	newP.fallback = &pricing
+	return &newP
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *AnthropicProvider) PrepareHTTPRequest(ctx context.Context, model domain.Model, body []byte) (*http.Request, error) {
+	translated, err := p.translateRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewBuffer(translated))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	p.setHeaders(req)
+	return req, nil
+}
+
+// PreparePassThroughRequest forwards native Anthropic API calls (e.g.
+// messages/count_tokens or messages/batches) without translation.
+func (p *AnthropicProvider) PreparePassThroughRequest(ctx context.Context, method, path, contentType string, body []byte) (*http.Request, error) {
+	req, err := newPassThroughRequest(ctx, method, p.baseURL+"/"+path, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+	return req, nil
+}
+
+func (p *AnthropicProvider) ParsePassThroughUsage(model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	responseModel, usage, err := parsePassThroughUsage(responseBody)
+	if err != nil || usage == nil {
+		return nil, err
+	}
+	if model == "" {
+		model = responseModel
+	}
+	return p.usageCost(model, usage), nil
+}
+
+func (p *AnthropicProvider) setHeaders(req *http.Request) {
+	req.Header.Set("anthropic-version", anthropicVersion)
+	if p.apiKey != "" {
+		req.Header.Set("x-api-key", p.apiKey)
+	}
+}
+
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]domain.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+	return fetchModelIDs(req, "anthropic")
+}
+
+// GetUsage is not available: Anthropic only exposes billing through the
+// organization admin API, which regular API keys cannot access.
+func (p *AnthropicProvider) GetUsage(ctx context.Context) (float64, error) {
+	return 0, domain.ErrNotSupported
+}
+
+// Request translation (OpenAI chat -> Anthropic messages)
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]any     `json:"tool_choice,omitempty"`
+	Metadata      map[string]string  `json:"metadata,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+func (p *AnthropicProvider) translateRequest(body []byte) ([]byte, error) {
+	var in chatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+
+	out := anthropicRequest{
+		Model:         in.Model,
+		MaxTokens:     in.maxOutputTokens(),
+		TopP:          in.TopP,
+		StopSequences: stopSequences(in.Stop),
+		Stream:        in.Stream,
+	}
+	if out.MaxTokens <= 0 {
+		out.MaxTokens = anthropicDefaultMaxTokens
+	}
+	if in.Temperature != nil {
+		// OpenAI accepts 0-2, Anthropic 0-1
+		t := min(*in.Temperature, 1.0)
+		out.Temperature = &t
+	}
+	if in.User != "" {
+		out.Metadata = map[string]string{"user_id": in.User}
+	}
+
+	var system []string
+	for _, m := range in.Messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, contentText(m.Content))
+		case "assistant":
+			blocks := anthropicContentBlocks(m.Content)
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+			out.Messages = appendAnthropicMessage(out.Messages, "assistant", blocks)
+		case "tool":
+			out.Messages = appendAnthropicMessage(out.Messages, "user", []anthropicBlock{{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   contentText(m.Content),
+			}})
+		default:
+			out.Messages = appendAnthropicMessage(out.Messages, "user", anthropicContentBlocks(m.Content))
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, t := range in.Tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	out.ToolChoice = anthropicToolChoice(in.ToolChoice)
+	if out.ToolChoice != nil && out.ToolChoice["type"] == "none" {
+		out.Tools = nil
+		out.ToolChoice = nil
+	}
+
+	return json.Marshal(out)
+}
+
+// appendAnthropicMessage merges consecutive turns of the same role, which is
+// how tool results following each other have to be sent.
+func appendAnthropicMessage(msgs []anthropicMessage, role string, blocks []anthropicBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		msgs[n-1].Content = append(msgs[n-1].Content, blocks...)
+		return msgs
+	}
+	return append(msgs, anthropicMessage{Role: role, Content: blocks})
+}
+
+func anthropicContentBlocks(raw json.RawMessage) []anthropicBlock {
+	var blocks []anthropicBlock
+	for _, part := range contentParts(raw) {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL != nil {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: anthropicImage(part.ImageURL.URL)})
+			}
+		}
+	}
+	return blocks
+}
+
+func anthropicImage(url string) *anthropicImageSource {
+	// data:image/png;base64,....
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok {
+			return &anthropicImageSource{
+				Type:      "base64",
+				MediaType: strings.TrimSuffix(meta, ";base64"),
+				Data:      data,
+			}
+		}
+	}
+	return &anthropicImageSource{Type: "url", URL: url}
+}
+
+func anthropicToolChoice(raw json.RawMessage) map[string]any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		switch s {
+		case "auto":
+			return map[string]any{"type": "auto"}
+		case "required":
+			return map[string]any{"type": "any"}
+		case "none":
+			return map[string]any{"type": "none"}
+		}
+		return nil
+	}
+	var choice struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &choice); err == nil && choice.Function.Name != "" {
+		return map[string]any{"type": "tool", "name": choice.Function.Name}
+	}
+	return nil
+}
+
+// Response translation (Anthropic messages -> OpenAI chat)
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (u anthropicUsage) promptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+func (p *AnthropicProvider) TranslateResponse(model domain.Model, body []byte) ([]byte, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Type != "message" {
+		return nil, fmt.Errorf("unexpected anthropic response type: %q", resp.Type)
+	}
+
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			tc := chatToolCall{ID: block.ID, Type: "function"}
+			tc.Function.Name = block.Name
+			tc.Function.Arguments = string(block.Input)
+			toolCalls = append(toolCalls, tc)
+		}
+	}
+
+	message := &chatResponse{Role: "assistant", ToolCalls: toolCalls}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		message.Content = stringPtr(text.String())
+	}
+
+	return json.Marshal(chatCompletion{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []chatChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: stringPtr(anthropicFinishReason(resp.StopReason)),
+		}},
+		Usage: newChatUsage(resp.Usage.promptTokens(), resp.Usage.OutputTokens),
+	})
+}
+
+func (p *AnthropicProvider) TranslateStream(model domain.Model, body io.ReadCloser) io.ReadCloser {
+	s := &anthropicStream{
+		model:     string(model),
+		created:   time.Now().Unix(),
+		toolIndex: make(map[int]int),
+	}
+	return newSSETranslator(body, s.handle, nil)
+}
+
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+// anthropicStream holds the state needed to turn Anthropic's typed events
+// (message_start, content_block_delta, message_delta, ...) into OpenAI chunks.
+type anthropicStream struct {
+	id        string
+	model     string
+	created   int64
+	usage     anthropicUsage
+	toolIndex map[int]int
+}
+
+type anthropicEvent struct {
+	Type    string             `json:"type"`
+	Index   int                `json:"index"`
+	Message *anthropicResponse `json:"message"`
+	Block   *anthropicBlock    `json:"content_block"`
+	Delta   struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+func (s *anthropicStream) chunk(delta *chatResponse, finishReason *string) *chatCompletion {
+	return &chatCompletion{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []chatChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+func (s *anthropicStream) handle(data []byte) [][]byte {
+	var ev anthropicEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil
+	}
+
+	switch ev.Type {
+	case "message_start":
+		if ev.Message != nil {
+			s.id = ev.Message.ID
+			if ev.Message.Model != "" {
+				s.model = ev.Message.Model
+			}
+			s.usage = ev.Message.Usage
+		}
+		return encodeChunks(s.chunk(&chatResponse{Role: "assistant", Content: stringPtr("")}, nil))
+
+	case "content_block_start":
+		if ev.Block == nil || ev.Block.Type != "tool_use" {
+			return nil
+		}
+		idx := len(s.toolIndex)
+		s.toolIndex[ev.Index] = idx
+		tc := chatToolCall{Index: &idx, ID: ev.Block.ID, Type: "function"}
+		tc.Function.Name = ev.Block.Name
+		return encodeChunks(s.chunk(&chatResponse{ToolCalls: []chatToolCall{tc}}, nil))
+
+	case "content_block_delta":
+		switch ev.Delta.Type {
+		case "text_delta":
+			return encodeChunks(s.chunk(&chatResponse{Content: stringPtr(ev.Delta.Text)}, nil))
+		case "input_json_delta":
+			idx, ok := s.toolIndex[ev.Index]
+			if !ok {
+				return nil
+			}
+			tc := chatToolCall{Index: &idx}
+			tc.Function.Arguments = ev.Delta.PartialJSON
+			return encodeChunks(s.chunk(&chatResponse{ToolCalls: []chatToolCall{tc}}, nil))
+		}
+
+	case "message_delta":
+		if ev.Usage != nil {
+			// output_tokens is cumulative; input counts are only repeated by some API versions
+			s.usage.OutputTokens = ev.Usage.OutputTokens
+			if ev.Usage.InputTokens > 0 {
+				s.usage.InputTokens = ev.Usage.InputTokens
+			}
+		}
+		if ev.Delta.StopReason != "" {
+			return encodeChunks(s.chunk(&chatResponse{}, stringPtr(anthropicFinishReason(ev.Delta.StopReason))))
+		}
+
+	case "message_stop":
+		usageChunk := s.chunk(nil, nil)
+		usageChunk.Choices = []chatChoice{}
+		usageChunk.Usage = newChatUsage(s.usage.promptTokens(), s.usage.OutputTokens)
+		return encodeChunks(usageChunk)
+
+	case "error":
+		b, _ := json.Marshal(map[string]json.RawMessage{"error": ev.Error})
+		return [][]byte{b}
+	}
+
+	return nil
+}
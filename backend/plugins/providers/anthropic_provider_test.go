@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/domain"
+	"strings"
+	"testing"
+)
+
+type approxCounter struct{}
+
+func (c *approxCounter) Count(model string, text string) (int, error) {
+	return len(text) / 4, nil
+}
+
+func newTestAnthropicProvider(t *testing.T, baseURL string) *AnthropicProvider {
+	t.Helper()
+	pricing, err := NewAnthropicPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	return NewAnthropicProvider("test-key", baseURL, pricing, &approxCounter{})
+}
+
+func TestAnthropicProvider_PrepareHTTPRequest(t *testing.T) {
+	p := newTestAnthropicProvider(t, "http://anthropic.local/v1")
+
+	body := `{"model": "claude-3-5-sonnet-20241022", "max_tokens": 256, "temperature": 1.5, "stop": "END", "messages": [
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": [{"type": "text", "text": "Weather?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]},
+		{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Tokyo\"}"}}]},
+		{"role": "tool", "tool_call_id": "call_1", "content": "sunny"}
+	], "tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object"}}}]}`
+
+	req, err := p.PrepareHTTPRequest(context.Background(), "claude-3-5-sonnet-20241022", []byte(body))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+
+	if req.URL.String() != "http://anthropic.local/v1/messages" {
+		t.Errorf("unexpected URL: %s", req.URL)
+	}
+	if req.Header.Get("x-api-key") != "test-key" || req.Header.Get("anthropic-version") == "" {
+		t.Errorf("missing anthropic auth headers: %v", req.Header)
+	}
+
+	var out anthropicRequest
+	if err := json.NewDecoder(req.Body).Decode(&out); err != nil {
+		t.Fatalf("failed to decode translated body: %v", err)
+	}
+
+	if out.System != "Be brief." {
+		t.Errorf("expected system prompt to be lifted, got %q", out.System)
+	}
+	if out.MaxTokens != 256 || out.Temperature == nil || *out.Temperature != 1 {
+		t.Errorf("unexpected sampling params: max_tokens=%d temperature=%v", out.MaxTokens, out.Temperature)
+	}
+	if len(out.StopSequences) != 1 || out.StopSequences[0] != "END" {
+		t.Errorf("unexpected stop sequences: %v", out.StopSequences)
+	}
+	if len(out.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(out.Messages))
+	}
+	if img := out.Messages[0].Content[1]; img.Type != "image" || img.Source.MediaType != "image/png" || img.Source.Data != "AAAA" {
+		t.Errorf("unexpected image block: %+v", img)
+	}
+	if tu := out.Messages[1].Content[0]; tu.Type != "tool_use" || tu.Name != "weather" || string(tu.Input) != `{"city":"Tokyo"}` {
+		t.Errorf("unexpected tool_use block: %+v", tu)
+	}
+	if tr := out.Messages[2].Content[0]; out.Messages[2].Role != "user" || tr.Type != "tool_result" || tr.ToolUseID != "call_1" {
+		t.Errorf("unexpected tool_result message: %+v", out.Messages[2])
+	}
+	if len(out.Tools) != 1 || out.Tools[0].Name != "weather" {
+		t.Errorf("unexpected tools: %+v", out.Tools)
+	}
+}
+
+func TestAnthropicProvider_TranslateResponse(t *testing.T) {
+	p := newTestAnthropicProvider(t, "")
+
+	upstream := `{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-sonnet-20241022",
+		"content": [{"type": "text", "text": "Hello!"}], "stop_reason": "max_tokens",
+		"usage": {"input_tokens": 1000, "output_tokens": 2000}}`
+
+	body, err := p.TranslateResponse("claude-3-5-sonnet-20241022", []byte(upstream))
+	if err != nil {
+		t.Fatalf("TranslateResponse failed: %v", err)
+	}
+
+	var resp chatCompletion
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("failed to decode translated response: %v", err)
+	}
+	if *resp.Choices[0].Message.Content != "Hello!" || *resp.Choices[0].FinishReason != "length" {
+		t.Errorf("unexpected choice: %s", body)
+	}
+
+	usage, err := p.ParseUsage("claude-3-5-sonnet-20241022", body)
+	if err != nil {
+		t.Fatalf("ParseUsage failed: %v", err)
+	}
+	// 1k input at $0.003 + 2k output at $0.015
+	if usage.InputTokens != 1000 || usage.OutputTokens != 2000 || fmt.Sprintf("%.3f", usage.TotalCost) != "0.033" {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestAnthropicProvider_TranslateStream(t *testing.T) {
+	events := []string{
+		`event: message_start` + "\n" + `data: {"type":"message_start","message":{"id":"msg_1","type":"message","model":"claude-3-5-sonnet-20241022","usage":{"input_tokens":1000,"output_tokens":1}}}`,
+		`event: content_block_start` + "\n" + `data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`event: ping` + "\n" + `data: {"type": "ping"}`,
+		`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+		`event: content_block_stop` + "\n" + `data: {"type":"content_block_stop","index":0}`,
+		`event: message_delta` + "\n" + `data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2000}}`,
+		`event: message_stop` + "\n" + `data: {"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Errorf("expected stream flag to be forwarded")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			fmt.Fprintf(w, "%s\n\n", ev)
+		}
+	}))
+	defer server.Close()
+
+	p := newTestAnthropicProvider(t, server.URL)
+	model := domain.Model("claude-3-5-sonnet-20241022")
+
+	req, err := p.PrepareHTTPRequest(context.Background(), model, []byte(`{"model":"claude-3-5-sonnet-20241022","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	stream := p.TranslateStream(model, resp.Body)
+	out, err := io.ReadAll(stream)
+	stream.Close()
+	if err != nil {
+		t.Fatalf("failed to read translated stream: %v", err)
+	}
+
+	var content strings.Builder
+	var finalCost float64
+	var outputTokens int
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		text, _, usage, err := p.ParseStreamChunk(model, line)
+		if err != nil {
+			t.Fatalf("translated chunk is not OpenAI-compatible: %q: %v", line, err)
+		}
+		content.WriteString(text)
+		if usage != nil {
+			finalCost = usage.TotalCost
+			outputTokens = usage.OutputTokens
+		}
+	}
+
+	if content.String() != "Hello world" {
+		t.Errorf("expected content 'Hello world', got %q", content.String())
+	}
+	if outputTokens != 2000 || fmt.Sprintf("%.3f", finalCost) != "0.033" {
+		t.Errorf("unexpected final usage: tokens=%d cost=%f", outputTokens, finalCost)
+	}
+	if !bytes.Contains(out, []byte(`"finish_reason":"stop"`)) {
+		t.Errorf("expected finish_reason chunk, got: %s", out)
+	}
+	if !bytes.HasSuffix(out, []byte("data: [DONE]\n\n")) {
+		t.Errorf("expected stream to end with [DONE], got: %s", out)
+	}
+}
+
+func TestAnthropicProvider_EstimateUsage_DefaultMaxTokens(t *testing.T) {
+	p := newTestAnthropicProvider(t, "http://anthropic.local/v1")
+
+	// Requests without max_tokens are sent with the provider default, not
+	// the model's 64000 token limit
+	usage, err := p.EstimateUsage("claude-sonnet-4-20250514", []byte(`{"model": "claude-sonnet-4-20250514", "messages": [{"role": "user", "content": "hello"}]}`))
+	if err != nil {
+		t.Fatalf("EstimateUsage failed: %v", err)
+	}
+	if usage.OutputTokens != anthropicDefaultMaxTokens {
+		t.Errorf("expected %d output tokens, got %d", anthropicDefaultMaxTokens, usage.OutputTokens)
+	}
+}
+
+func TestAnthropicProvider_FallbackPricing(t *testing.T) {
+	p := newTestAnthropicProvider(t, "http://anthropic.local/v1")
+
+	if _, err := p.GetPricing("unknown-model"); !errors.Is(err, domain.ErrUnknownModel) {
+		t.Fatalf("expected ErrUnknownModel, got %v", err)
+	}
+
+	fallback := domain.Pricing{Input: 1, Output: 2}
+	priced := p.WithFallbackPricing(fallback)
+	if pricing, err := priced.GetPricing("unknown-model"); err != nil || pricing.Input != 1 || pricing.Output != 2 {
+		t.Errorf("expected the fallback pricing, got %+v, %v", pricing, err)
+	}
+	if pricing, err := priced.GetPricing("claude-sonnet-4-20250514"); err != nil || pricing.Input != 0.003 {
+		t.Errorf("expected the table pricing for a known model, got %+v, %v", pricing, err)
+	}
+	// The original provider is unchanged
+	if _, err := p.GetPricing("unknown-model"); err == nil {
+		t.Errorf("expected the original provider to still reject unknown models")
+	}
+}
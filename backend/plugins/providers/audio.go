@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+)
+
+const (
+	// wavHeaderSize is the size of a canonical WAV (RIFF) header.
+	wavHeaderSize = 44
+	// assumedAudioBytesPerSecond is used to estimate the duration of
+	// compressed audio before it is transcribed. 32 kbps is low for speech,
+	// so durations are over- rather than under-estimated when reserving.
+	assumedAudioBytesPerSecond = 4000
+	maxFormFieldSize           = 64 * 1024
+)
+
+// multipartUpload is a multipart/form-data body with its form fields read
+// and its file reduced to its size and leading bytes.
+type multipartUpload struct {
+	fields   map[string]string
+	fileSize int
+	fileHead []byte
+}
+
+func isMultipart(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+func parseMultipart(contentType string, body []byte) (*multipartUpload, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != "multipart/form-data" {
+		return nil, fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	upload := &multipartUpload{fields: make(map[string]string)}
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FileName() != "" {
+			head := make([]byte, wavHeaderSize)
+			n, err := io.ReadFull(part, head)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			rest, err := io.Copy(io.Discard, part)
+			if err != nil {
+				return nil, err
+			}
+			upload.fileHead = head[:n]
+			upload.fileSize = n + int(rest)
+		} else {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			if err != nil {
+				return nil, err
+			}
+			upload.fields[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+	return upload, nil
+}
+
+// audioSeconds estimates the duration of an uploaded audio file. WAV files
+// carry their byte rate in the header; other formats are assumed to be
+// encoded at a low bitrate.
+func audioSeconds(head []byte, size int) float64 {
+	if len(head) >= wavHeaderSize && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WAVE" {
+		if byteRate := binary.LittleEndian.Uint32(head[28:32]); byteRate > 0 {
+			return float64(size-wavHeaderSize) / float64(byteRate)
+		}
+	}
+	return float64(size) / assumedAudioBytesPerSecond
+}
@@ -0,0 +1,280 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"sort"
+	"strings"
+)
+
+const azureDefaultAPIVersion = "2024-10-21"
+
+// AzureOpenAIProvider sends OpenAI chat requests to Azure OpenAI deployments.
+// Clients keep using model names; the deployment is looked up in a
+// model=deployment mapping, so pricing always resolves from the model.
+type AzureOpenAIProvider struct {
+	OpenAIProvider
+	apiVersion string
+	// deployments maps model names to deployment names.
+	deployments map[string]string
+}
+
+type AzureOpenAIBuilder struct{}
+
+func (b *AzureOpenAIBuilder) Build(ctx context.Context, cfg *config.Config) (domain.Provider, error) {
+	apiKey := os.Getenv("AZURE_OPENAI_API_KEY")
+	if apiKey == "" {
+		apiKey = cfg.AzureOpenAIKey
+	}
+
+	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
+	if endpoint == "" {
+		endpoint = cfg.AzureOpenAIURL
+	}
+
+	apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
+	if apiVersion == "" {
+		apiVersion = cfg.AzureOpenAIAPIVersion
+	}
+
+	deployments := os.Getenv("AZURE_OPENAI_DEPLOYMENTS")
+	if deployments == "" {
+		deployments = cfg.AzureOpenAIDeployments
+	}
+
+	if apiKey == "" || endpoint == "" {
+		fmt.Println("WARN: Azure OpenAI API Key or endpoint not found. 'azure_openai' provider will be unavailable.")
+		return nil, nil
+	}
+
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openai pricing: %w", err)
+	}
+
+	return NewAzureOpenAIProvider(apiKey, endpoint, apiVersion, ParseDeployments(deployments), pricing, NewTiktokenCounter()), nil
+}
+
+func NewAzureOpenAIProvider(apiKey, endpoint, apiVersion string, deployments map[string]string, pricing *PricingTable, counter TokenCounter) *AzureOpenAIProvider {
+	if apiVersion == "" {
+		apiVersion = azureDefaultAPIVersion
+	}
+	endpoint = normalizeAzureEndpoint(endpoint)
+
+	return &AzureOpenAIProvider{
+		OpenAIProvider: OpenAIProvider{
+			name:         "azure_openai",
+			title:        "Azure OpenAI",
+			apiKey:       apiKey,
+			baseURL:      endpoint,
+			authHeader:   "api-key",
+			pricing:      pricing,
+			tokenCounter: counter,
+		},
+		apiVersion:  apiVersion,
+		deployments: deployments,
+	}
+}
+
+// ParseDeployments parses a "model=deployment,model=deployment" mapping.
+// Entries without "=" map a model to a deployment of the same name.
+func ParseDeployments(s string) map[string]string {
+	deployments := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, deployment, ok := strings.Cut(entry, "=")
+		if !ok {
+			deployment = model
+		}
+		deployments[strings.TrimSpace(model)] = strings.TrimSpace(deployment)
+	}
+	return deployments
+}
+
+// normalizeAzureEndpoint accepts the resource endpoint with or without a
+// trailing slash or "/openai" suffix.
+func normalizeAzureEndpoint(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	return strings.TrimSuffix(endpoint, "/openai")
+}
+
+func (p *AzureOpenAIProvider) Schema() domain.PluginSchema {
+	return domain.PluginSchema{
+		"api_key": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "API Key",
+			Description: "Your Azure OpenAI API Key",
+			Role:        domain.FieldRoleCredential,
+		},
+		"endpoint": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Endpoint",
+			Description: "Azure OpenAI resource endpoint (e.g. https://my-resource.openai.azure.com)",
+			Role:        domain.FieldRoleCredential,
+		},
+		"api_version": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "API Version",
+			Default:     azureDefaultAPIVersion,
+			Description: "Azure OpenAI API version",
+		},
+		"deployments": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Deployments",
+			Description: "Comma-separated model=deployment mapping (e.g. gpt-4o=prod-gpt4o)",
+		},
+	}
+}
+
+func (p *AzureOpenAIProvider) Configure(config map[string]any) (domain.Provider, error) {
+	newP := *p
+	if val, ok := config["api_key"]; ok {
+		if s, ok := val.(string); ok && s != "" {
+			newP.apiKey = s
+		}
+	}
+	if val, ok := config["endpoint"]; ok {
+		if s, ok := val.(string); ok && s != "" {
+			newP.baseURL = normalizeAzureEndpoint(s)
+		}
+	}
+	if val, ok := config["api_version"]; ok {
+		if s, ok := val.(string); ok && s != "" {
+			newP.apiVersion = s
+		}
+	}
+	if val, ok := config["deployments"]; ok {
+		switch v := val.(type) {
+		case string:
+			if v != "" {
+				newP.deployments = ParseDeployments(v)
+			}
+		case map[string]any:
+			deployments := make(map[string]string, len(v))
+			for model, d := range v {
+				s, ok := d.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid deployment for model %s", model)
+				}
+				deployments[model] = s
+			}
+			newP.deployments = deployments
+		}
+	}
+	return &newP, nil
+}
+
+func (p *AzureOpenAIProvider) WithFallbackPricing(pricing domain.Pricing) domain.Provider {
+	newP := *p
+	newP.fallback = &pricing
+	return &newP
+}
+
+func (p *AzureOpenAIProvider) PrepareHTTPRequest(ctx context.Context, model domain.Model, body []byte) (*http.Request, error) {
+	return p.PrepareEndpointRequest(ctx, domain.EndpointChat, model, "", body)
+}
+
+func (p *AzureOpenAIProvider) PrepareEndpointRequest(ctx context.Context, endpoint domain.Endpoint, model domain.Model, contentType string, body []byte) (*http.Request, error) {
+	if p.baseURL == "" {
+		return nil, fmt.Errorf("azure openai endpoint is not configured")
+	}
+	u := fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+		p.baseURL, url.PathEscape(p.deployment(model)), endpoint, url.QueryEscape(p.apiVersion))
+	return p.newEndpointRequest(ctx, u, contentType, body)
+}
+
+// PreparePassThroughRequest forwards to the resource-level data plane API
+// (e.g. /openai/files), which also requires the api-version parameter.
+func (p *AzureOpenAIProvider) PreparePassThroughRequest(ctx context.Context, method, path, contentType string, body []byte) (*http.Request, error) {
+	if p.baseURL == "" {
+		return nil, fmt.Errorf("azure openai endpoint is not configured")
+	}
+	u, err := url.Parse(p.baseURL + "/openai/" + path)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if q.Get("api-version") == "" {
+		q.Set("api-version", p.apiVersion)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := newPassThroughRequest(ctx, method, u.String(), contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	p.setAuth(req)
+	return req, nil
+}
+
+// ParseRequest maps a deployment name sent as the model back to its model,
+// so requests are priced by the underlying model.
+func (p *AzureOpenAIProvider) ParseRequest(body []byte) (domain.Model, bool, error) {
+	model, stream, err := p.OpenAIProvider.ParseRequest(body)
+	if err != nil {
+		return "", false, err
+	}
+	return p.model(model), stream, nil
+}
+
+func (p *AzureOpenAIProvider) ParseEndpointRequest(endpoint domain.Endpoint, contentType string, body []byte) (domain.Model, bool, error) {
+	model, stream, err := p.OpenAIProvider.ParseEndpointRequest(endpoint, contentType, body)
+	if err != nil {
+		return "", false, err
+	}
+	return p.model(model), stream, nil
+}
+
+// SupportsEndpoint excludes the Responses API, which Azure serves at the
+// resource level rather than per deployment.
+func (p *AzureOpenAIProvider) SupportsEndpoint(endpoint domain.Endpoint) bool {
+	return endpoint != domain.EndpointResponses && p.OpenAIProvider.SupportsEndpoint(endpoint)
+}
+
+// model returns the model a deployment name refers to, or the name itself if
+// it is not a known deployment.
+func (p *AzureOpenAIProvider) model(name domain.Model) domain.Model {
+	if _, ok := p.deployments[string(name)]; !ok {
+		for m, d := range p.deployments {
+			if d == string(name) {
+				return domain.Model(m)
+			}
+		}
+	}
+	return name
+}
+
+// ListModels returns the models of the deployment mapping, or the priced
+// models if there is none, as Azure lists base models rather than deployments.
+func (p *AzureOpenAIProvider) ListModels(ctx context.Context) ([]domain.Model, error) {
+	var names []string
+	if len(p.deployments) > 0 {
+		for model := range p.deployments {
+			names = append(names, model)
+		}
+		sort.Strings(names)
+	} else {
+		names = p.pricing.Models()
+	}
+
+	models := make([]domain.Model, len(names))
+	for i, name := range names {
+		models[i] = domain.Model(name)
+	}
+	return models, nil
+}
+
+func (p *AzureOpenAIProvider) deployment(model domain.Model) string {
+	if d, ok := p.deployments[string(model)]; ok && d != "" {
+		return d
+	}
+	return string(model)
+}
@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"pouch-ai/backend/domain"
+	"reflect"
+	"testing"
+)
+
+func newTestAzureProvider(t *testing.T) *AzureOpenAIProvider {
+	t.Helper()
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	return NewAzureOpenAIProvider("azure-key", "https://contoso.openai.azure.com/openai/", "", ParseDeployments("gpt-4o=prod-4o, gpt-4o-mini"), pricing, &approxCounter{})
+}
+
+func TestAzureOpenAIProvider_PrepareHTTPRequest(t *testing.T) {
+	p := newTestAzureProvider(t)
+
+	req, err := p.PrepareHTTPRequest(context.Background(), "gpt-4o", []byte(`{"model": "gpt-4o", "stream": true}`))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	if req.URL.String() != "https://contoso.openai.azure.com/openai/deployments/prod-4o/chat/completions?api-version="+azureDefaultAPIVersion {
+		t.Errorf("unexpected URL: %s", req.URL)
+	}
+	if req.Header.Get("api-key") != "azure-key" || req.Header.Get("Authorization") != "" {
+		t.Errorf("unexpected auth headers: %v", req.Header)
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if _, ok := body["stream_options"]; !ok {
+		t.Errorf("expected stream_options to be injected")
+	}
+
+	req, _ = p.PrepareEndpointRequest(context.Background(), domain.EndpointEmbeddings, "text-embedding-3-small", "", []byte(`{}`))
+	if req.URL.Path != "/openai/deployments/text-embedding-3-small/embeddings" || req.Header.Get("api-key") != "azure-key" {
+		t.Errorf("unexpected embeddings request: %s", req.URL)
+	}
+
+	// Models without a mapping entry use a deployment of the same name
+	req, _ = p.PrepareHTTPRequest(context.Background(), "gpt-4", []byte(`{}`))
+	if req.URL.Path != "/openai/deployments/gpt-4/chat/completions" {
+		t.Errorf("unexpected path: %s", req.URL.Path)
+	}
+}
+
+func TestAzureOpenAIProvider_PricingUsesModel(t *testing.T) {
+	p := newTestAzureProvider(t)
+
+	// Clients sending the deployment name are priced by the mapped model
+	model, stream, err := p.ParseRequest([]byte(`{"model": "prod-4o", "stream": true}`))
+	if err != nil || model != "gpt-4o" || !stream {
+		t.Fatalf("ParseRequest = %q, %v, %v", model, stream, err)
+	}
+
+	deployed, err := p.GetPricing(model)
+	if err != nil {
+		t.Fatalf("GetPricing failed: %v", err)
+	}
+	openai, _ := NewOpenAIProvider("", "", p.pricing, nil).GetPricing("gpt-4o")
+	if !reflect.DeepEqual(deployed, openai) {
+		t.Errorf("expected gpt-4o pricing %+v, got %+v", openai, deployed)
+	}
+
+	if _, err := p.GetUsage(context.Background()); !errors.Is(err, domain.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported from GetUsage, got %v", err)
+	}
+}
+
+func TestAzureOpenAIProvider_Configure(t *testing.T) {
+	p := newTestAzureProvider(t)
+
+	configured, err := p.Configure(map[string]any{
+		"endpoint":    "https://fabrikam.openai.azure.com",
+		"api_version": "2025-01-01-preview",
+		"deployments": map[string]any{"gpt-4o": "eu-4o"},
+		"api_key":     "",
+	})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	req, err := configured.PrepareHTTPRequest(context.Background(), "gpt-4o", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	if req.URL.String() != "https://fabrikam.openai.azure.com/openai/deployments/eu-4o/chat/completions?api-version=2025-01-01-preview" {
+		t.Errorf("unexpected URL: %s", req.URL)
+	}
+	if req.Header.Get("api-key") != "azure-key" {
+		t.Errorf("expected api key to be kept")
+	}
+	if configured.Name() != "azure_openai" {
+		t.Errorf("unexpected name: %s", configured.Name())
+	}
+
+	// The original instance is unchanged
+	req, _ = p.PrepareHTTPRequest(context.Background(), "gpt-4o", []byte(`{}`))
+	if req.URL.Host != "contoso.openai.azure.com" {
+		t.Errorf("Configure modified the original provider: %s", req.URL)
+	}
+}
+
+func TestAzureOpenAIProvider_PassThrough(t *testing.T) {
+	p := newTestAzureProvider(t)
+
+	req, err := p.PreparePassThroughRequest(context.Background(), "GET", "files?purpose=batch", "", nil)
+	if err != nil {
+		t.Fatalf("PreparePassThroughRequest failed: %v", err)
+	}
+	if req.URL.String() != "https://contoso.openai.azure.com/openai/files?api-version="+azureDefaultAPIVersion+"&purpose=batch" {
+		t.Errorf("unexpected URL: %s", req.URL)
+	}
+	if req.Method != "GET" || req.Header.Get("api-key") != "azure-key" {
+		t.Errorf("unexpected request: %s %v", req.Method, req.Header)
+	}
+}
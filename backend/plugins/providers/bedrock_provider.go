@@ -0,0 +1,582 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"strings"
+	"time"
+)
+
+//go:embed bedrock_pricing.json
+var bedrockPricingJSON []byte
+
+// BedrockProvider serves OpenAI-style chat requests from the Bedrock
+// Converse / ConverseStream API, signing requests with AWS SigV4.
+type BedrockProvider struct {
+	chatMeter
+	creds    awsCredentials
+	region   string
+	endpoint string
+	now      func() time.Time
+}
+
+type BedrockBuilder struct{}
+
+func (b *BedrockBuilder) Build(ctx context.Context, cfg *config.Config) (domain.Provider, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = cfg.BedrockRegion
+	}
+
+	creds := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" {
+		creds = awsCredentials{
+			AccessKeyID:     cfg.BedrockAccessKeyID,
+			SecretAccessKey: cfg.BedrockSecretAccessKey,
+		}
+	}
+
+	endpoint := os.Getenv("BEDROCK_URL")
+	if endpoint == "" {
+		endpoint = cfg.BedrockURL
+	}
+
+	if region == "" {
+		fmt.Println("WARN: AWS region not found. 'bedrock' provider will be unavailable.")
+		return nil, nil
+	}
+
+	pricing, err := NewBedrockPricing()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBedrockProvider(creds, region, endpoint, pricing, NewTiktokenCounter()), nil
+}
+
+func NewBedrockPricing() (*PricingTable, error) {
+	pricing, err := ParsePricingTable(bedrockPricingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bedrock_pricing.json: %w", err)
+	}
+	return pricing, nil
+}
+
+func NewBedrockProvider(creds awsCredentials, region, endpoint string, pricing *PricingTable, counter TokenCounter) *BedrockProvider {
+	return &BedrockProvider{
+		chatMeter: chatMeter{pricing: pricing, tokenCounter: counter, pricedAs: bedrockBaseModel},
+		creds:     creds,
+		region:    region,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		now:       time.Now,
+	}
+}
+
+// bedrockBaseModel strips the geography prefix of cross-region inference
+// profiles ("us.anthropic.claude-..." -> "anthropic.claude-...").
+func bedrockBaseModel(model string) string {
+	prefix, rest, ok := strings.Cut(model, ".")
+	if !ok {
+		return model
+	}
+	switch prefix {
+	case "us", "eu", "apac", "us-gov", "global":
+		return rest
+	}
+	return model
+}
+
+func (p *BedrockProvider) Schema() domain.PluginSchema {
+	return domain.PluginSchema{
+		"access_key_id": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Access Key ID",
+			Description: "AWS access key ID",
+			Role:        domain.FieldRoleCredential,
+		},
+		"secret_access_key": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Secret Access Key",
+			Description: "AWS secret access key",
+			Role:        domain.FieldRoleCredential,
+		},
+		"session_token": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Session Token",
+			Description: "AWS session token (temporary credentials only)",
+		},
+		"region": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Region",
+			Default:     p.region,
+			Description: "AWS region of the Bedrock runtime (e.g. us-east-1)",
+		},
+		"endpoint": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Endpoint",
+			Description: "Bedrock runtime endpoint override (e.g. a VPC endpoint)",
+		},
+	}
+}
+
+func (p *BedrockProvider) Configure(config map[string]any) (domain.Provider, error) {
+	newP := *p
+	if s, ok := config["access_key_id"].(string); ok && s != "" {
+		// A new key pair replaces the whole credential set
+		newP.creds = awsCredentials{AccessKeyID: s}
+		newP.creds.SecretAccessKey, _ = config["secret_access_key"].(string)
+		newP.creds.SessionToken, _ = config["session_token"].(string)
+		if newP.creds.SecretAccessKey == "" {
+			return nil, fmt.Errorf("bedrock: secret_access_key is required with access_key_id")
+		}
+	}
+	if s, ok := config["region"].(string); ok && s != "" {
+		newP.region = s
+	}
+	if s, ok := config["endpoint"].(string); ok && s != "" {
+		newP.endpoint = strings.TrimSuffix(s, "/")
+	}
+	return &newP, nil
+}
+
+func (p *BedrockProvider) WithFallbackPricing(pricing domain.Pricing) domain.Provider {
+	newP := *p
+	newP.fallback = &pricing
+	return &newP
+}
+
+func (p *BedrockProvider) Name() string {
+	return "bedrock"
+}
+
+func (p *BedrockProvider) PrepareHTTPRequest(ctx context.Context, model domain.Model, body []byte) (*http.Request, error) {
+	if p.creds.AccessKeyID == "" || p.creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("bedrock: AWS credentials are not configured")
+	}
+
+	translated, stream, err := p.translateRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := p.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", p.region)
+	}
+	action := "converse"
+	if stream {
+		action = "converse-stream"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/model/%s/%s", endpoint, awsURIEncode(string(model)), action), bytes.NewReader(translated))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+	signV4(req, translated, p.creds, p.region, "bedrock", p.now())
+	return req, nil
+}
+
+// GetUsage is not available: Bedrock costs are only reported through
+// Cost Explorer, which needs separate permissions.
+func (p *BedrockProvider) GetUsage(ctx context.Context) (float64, error) {
+	return 0, domain.ErrNotSupported
+}
+
+// Request translation (OpenAI chat -> Bedrock Converse)
+
+type bedrockRequest struct {
+	Messages        []bedrockMessage        `json:"messages"`
+	System          []bedrockBlock          `json:"system,omitempty"`
+	InferenceConfig *bedrockInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *bedrockToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type bedrockMessage struct {
+	Role    string         `json:"role"`
+	Content []bedrockBlock `json:"content"`
+}
+
+type bedrockBlock struct {
+	Text       *string            `json:"text,omitempty"`
+	Image      *bedrockImage      `json:"image,omitempty"`
+	ToolUse    *bedrockToolUse    `json:"toolUse,omitempty"`
+	ToolResult *bedrockToolResult `json:"toolResult,omitempty"`
+}
+
+type bedrockImage struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes string `json:"bytes"`
+	} `json:"source"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type bedrockToolResult struct {
+	ToolUseID string         `json:"toolUseId"`
+	Content   []bedrockBlock `json:"content"`
+}
+
+type bedrockInferenceConfig struct {
+	MaxTokens     *int     `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type bedrockToolConfig struct {
+	Tools      []bedrockTool  `json:"tools"`
+	ToolChoice map[string]any `json:"toolChoice,omitempty"`
+}
+
+type bedrockTool struct {
+	ToolSpec struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		InputSchema struct {
+			JSON json.RawMessage `json:"json"`
+		} `json:"inputSchema"`
+	} `json:"toolSpec"`
+}
+
+func (p *BedrockProvider) translateRequest(body []byte) ([]byte, bool, error) {
+	var in chatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, false, err
+	}
+
+	var out bedrockRequest
+
+	cfg := bedrockInferenceConfig{TopP: in.TopP, StopSequences: stopSequences(in.Stop)}
+	if max := in.maxOutputTokens(); max > 0 {
+		cfg.MaxTokens = &max
+	}
+	if in.Temperature != nil {
+		// OpenAI accepts 0-2, Converse 0-1
+		t := min(*in.Temperature, 1.0)
+		cfg.Temperature = &t
+	}
+	if cfg.MaxTokens != nil || cfg.Temperature != nil || cfg.TopP != nil || len(cfg.StopSequences) > 0 {
+		out.InferenceConfig = &cfg
+	}
+
+	for _, m := range in.Messages {
+		switch m.Role {
+		case "system", "developer":
+			if text := contentText(m.Content); text != "" {
+				out.System = append(out.System, bedrockBlock{Text: &text})
+			}
+		case "assistant":
+			blocks, err := bedrockContentBlocks(m.Content)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, bedrockBlock{ToolUse: &bedrockToolUse{ToolUseID: tc.ID, Name: tc.Function.Name, Input: input}})
+			}
+			out.Messages = appendBedrockMessage(out.Messages, "assistant", blocks)
+		case "tool":
+			text := contentText(m.Content)
+			out.Messages = appendBedrockMessage(out.Messages, "user", []bedrockBlock{{
+				ToolResult: &bedrockToolResult{ToolUseID: m.ToolCallID, Content: []bedrockBlock{{Text: &text}}},
+			}})
+		default:
+			blocks, err := bedrockContentBlocks(m.Content)
+			if err != nil {
+				return nil, false, err
+			}
+			out.Messages = appendBedrockMessage(out.Messages, "user", blocks)
+		}
+	}
+
+	if len(in.Tools) > 0 {
+		choice := anthropicToolChoice(in.ToolChoice)
+		if choice == nil || choice["type"] != "none" {
+			tc := &bedrockToolConfig{}
+			for _, t := range in.Tools {
+				var bt bedrockTool
+				bt.ToolSpec.Name = t.Function.Name
+				bt.ToolSpec.Description = t.Function.Description
+				bt.ToolSpec.InputSchema.JSON = t.Function.Parameters
+				if len(bt.ToolSpec.InputSchema.JSON) == 0 {
+					bt.ToolSpec.InputSchema.JSON = json.RawMessage(`{"type":"object","properties":{}}`)
+				}
+				tc.Tools = append(tc.Tools, bt)
+			}
+			if choice != nil {
+				switch choice["type"] {
+				case "auto":
+					tc.ToolChoice = map[string]any{"auto": map[string]any{}}
+				case "any":
+					tc.ToolChoice = map[string]any{"any": map[string]any{}}
+				case "tool":
+					tc.ToolChoice = map[string]any{"tool": map[string]any{"name": choice["name"]}}
+				}
+			}
+			out.ToolConfig = tc
+		}
+	}
+
+	translated, err := json.Marshal(out)
+	return translated, in.Stream, err
+}
+
+// appendBedrockMessage merges consecutive turns of the same role, since
+// Converse requires user and assistant turns to alternate.
+func appendBedrockMessage(msgs []bedrockMessage, role string, blocks []bedrockBlock) []bedrockMessage {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		msgs[n-1].Content = append(msgs[n-1].Content, blocks...)
+		return msgs
+	}
+	return append(msgs, bedrockMessage{Role: role, Content: blocks})
+}
+
+func bedrockContentBlocks(raw json.RawMessage) ([]bedrockBlock, error) {
+	var blocks []bedrockBlock
+	for _, part := range contentParts(raw) {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				text := part.Text
+				blocks = append(blocks, bedrockBlock{Text: &text})
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			img := anthropicImage(part.ImageURL.URL)
+			if img.Type != "base64" {
+				return nil, fmt.Errorf("bedrock: only base64 data URLs are supported for images")
+			}
+			bi := &bedrockImage{Format: strings.TrimPrefix(img.MediaType, "image/")}
+			bi.Source.Bytes = img.Data
+			blocks = append(blocks, bedrockBlock{Image: bi})
+		}
+	}
+	return blocks, nil
+}
+
+// Response translation (Bedrock Converse -> OpenAI chat)
+
+type bedrockUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+}
+
+func (u bedrockUsage) promptTokens() int {
+	return u.InputTokens + u.CacheReadInputTokens + u.CacheWriteInputTokens
+}
+
+type bedrockResponse struct {
+	Output struct {
+		Message *bedrockMessage `json:"message"`
+	} `json:"output"`
+	StopReason string       `json:"stopReason"`
+	Usage      bedrockUsage `json:"usage"`
+}
+
+func (p *BedrockProvider) TranslateResponse(model domain.Model, body []byte) ([]byte, error) {
+	var resp bedrockResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Output.Message == nil {
+		return nil, fmt.Errorf("bedrock response has no output message")
+	}
+
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, block := range resp.Output.Message.Content {
+		switch {
+		case block.Text != nil:
+			text.WriteString(*block.Text)
+		case block.ToolUse != nil:
+			tc := chatToolCall{ID: block.ToolUse.ToolUseID, Type: "function"}
+			tc.Function.Name = block.ToolUse.Name
+			tc.Function.Arguments = string(block.ToolUse.Input)
+			toolCalls = append(toolCalls, tc)
+		}
+	}
+
+	message := &chatResponse{Role: "assistant", ToolCalls: toolCalls}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		message.Content = stringPtr(text.String())
+	}
+
+	now := time.Now()
+	return json.Marshal(chatCompletion{
+		ID:      fmt.Sprintf("chatcmpl-%d", now.UnixNano()),
+		Object:  "chat.completion",
+		Created: now.Unix(),
+		Model:   string(model),
+		Choices: []chatChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: stringPtr(bedrockFinishReason(resp.StopReason)),
+		}},
+		Usage: newChatUsage(resp.Usage.promptTokens(), resp.Usage.OutputTokens),
+	})
+}
+
+func (p *BedrockProvider) TranslateStream(model domain.Model, body io.ReadCloser) io.ReadCloser {
+	now := time.Now()
+	s := &bedrockStream{
+		id:        fmt.Sprintf("chatcmpl-%d", now.UnixNano()),
+		model:     string(model),
+		created:   now.Unix(),
+		toolIndex: make(map[int]int),
+	}
+	return newEventStreamTranslator(body, s.handle, nil)
+}
+
+func bedrockFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "content_filtered", "guardrail_intervened":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// bedrockStream turns ConverseStream events into OpenAI chunks.
+type bedrockStream struct {
+	id        string
+	model     string
+	created   int64
+	toolIndex map[int]int
+}
+
+type bedrockEvent struct {
+	MessageStart *struct {
+		Role string `json:"role"`
+	} `json:"messageStart"`
+	ContentBlockStart *struct {
+		ContentBlockIndex int `json:"contentBlockIndex"`
+		Start             struct {
+			ToolUse *bedrockToolUse `json:"toolUse"`
+		} `json:"start"`
+	} `json:"contentBlockStart"`
+	ContentBlockDelta *struct {
+		ContentBlockIndex int `json:"contentBlockIndex"`
+		Delta             struct {
+			Text    *string `json:"text"`
+			ToolUse *struct {
+				Input string `json:"input"`
+			} `json:"toolUse"`
+		} `json:"delta"`
+	} `json:"contentBlockDelta"`
+	MessageStop *struct {
+		StopReason string `json:"stopReason"`
+	} `json:"messageStop"`
+	Metadata *struct {
+		Usage bedrockUsage `json:"usage"`
+	} `json:"metadata"`
+	Exception *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"exception"`
+}
+
+func (s *bedrockStream) chunk(delta *chatResponse, finishReason *string) *chatCompletion {
+	return &chatCompletion{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []chatChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+func (s *bedrockStream) handle(data []byte) [][]byte {
+	var ev bedrockEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil
+	}
+
+	switch {
+	case ev.MessageStart != nil:
+		return encodeChunks(s.chunk(&chatResponse{Role: "assistant", Content: stringPtr("")}, nil))
+
+	case ev.ContentBlockStart != nil:
+		tu := ev.ContentBlockStart.Start.ToolUse
+		if tu == nil {
+			return nil
+		}
+		idx := len(s.toolIndex)
+		s.toolIndex[ev.ContentBlockStart.ContentBlockIndex] = idx
+		tc := chatToolCall{Index: &idx, ID: tu.ToolUseID, Type: "function"}
+		tc.Function.Name = tu.Name
+		return encodeChunks(s.chunk(&chatResponse{ToolCalls: []chatToolCall{tc}}, nil))
+
+	case ev.ContentBlockDelta != nil:
+		delta := ev.ContentBlockDelta.Delta
+		if delta.Text != nil {
+			return encodeChunks(s.chunk(&chatResponse{Content: delta.Text}, nil))
+		}
+		if delta.ToolUse != nil {
+			idx, ok := s.toolIndex[ev.ContentBlockDelta.ContentBlockIndex]
+			if !ok {
+				return nil
+			}
+			tc := chatToolCall{Index: &idx}
+			tc.Function.Arguments = delta.ToolUse.Input
+			return encodeChunks(s.chunk(&chatResponse{ToolCalls: []chatToolCall{tc}}, nil))
+		}
+
+	case ev.MessageStop != nil:
+		return encodeChunks(s.chunk(&chatResponse{}, stringPtr(bedrockFinishReason(ev.MessageStop.StopReason))))
+
+	case ev.Metadata != nil:
+		usageChunk := s.chunk(nil, nil)
+		usageChunk.Choices = []chatChoice{}
+		usageChunk.Usage = newChatUsage(ev.Metadata.Usage.promptTokens(), ev.Metadata.Usage.OutputTokens)
+		return encodeChunks(usageChunk)
+
+	case ev.Exception != nil:
+		b, _ := json.Marshal(map[string]any{"error": map[string]string{
+			"type":    ev.Exception.Type,
+			"message": ev.Exception.Message,
+		}})
+		return [][]byte{b}
+	}
+
+	return nil
+}
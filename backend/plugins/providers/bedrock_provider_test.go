@@ -0,0 +1,283 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAWSCreds = awsCredentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "secret/test"}
+
+// newBedrockStandIn starts a server that rejects requests whose SigV4
+// signature does not match testAWSCreds, then delegates to handler.
+func newBedrockStandIn(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body []byte)) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		auth := r.Header.Get("Authorization")
+		_, signed, ok := strings.Cut(auth, "SignedHeaders=")
+		if !ok {
+			http.Error(w, `{"message": "missing signature"}`, http.StatusForbidden)
+			return
+		}
+		signed, _, _ = strings.Cut(signed, ",")
+
+		check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		for _, name := range strings.Split(signed, ";") {
+			if name != "host" {
+				check.Header.Set(name, r.Header.Get(name))
+			}
+		}
+		ts, err := time.Parse(sigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			http.Error(w, `{"message": "bad date"}`, http.StatusForbidden)
+			return
+		}
+		signV4(check, body, testAWSCreds, "us-west-2", "bedrock", ts)
+		if check.Header.Get("Authorization") != auth {
+			http.Error(w, `{"message": "The request signature we calculated does not match the signature you provided."}`, http.StatusForbidden)
+			return
+		}
+
+		handler(w, r, body)
+	}))
+}
+
+func newTestBedrockProvider(t *testing.T, endpoint string) *BedrockProvider {
+	t.Helper()
+	pricing, err := NewBedrockPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	return NewBedrockProvider(testAWSCreds, "us-west-2", endpoint, pricing, &approxCounter{})
+}
+
+// encodeEventStreamMessage frames an event the way Bedrock does.
+func encodeEventStreamMessage(headers map[string]string, payload []byte) []byte {
+	var hb bytes.Buffer
+	for name, value := range headers {
+		hb.WriteByte(byte(len(name)))
+		hb.WriteString(name)
+		hb.WriteByte(7)
+		binary.Write(&hb, binary.BigEndian, uint16(len(value)))
+		hb.WriteString(value)
+	}
+
+	total := eventStreamPreludeLen + hb.Len() + len(payload) + eventStreamCRCLen
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(total))
+	binary.Write(&msg, binary.BigEndian, uint32(hb.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(hb.Bytes())
+	msg.Write(payload)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func bedrockEventFrame(eventType, payload string) []byte {
+	return encodeEventStreamMessage(map[string]string{
+		":message-type": "event",
+		":event-type":   eventType,
+		":content-type": "application/json",
+	}, []byte(payload))
+}
+
+func TestBedrockProvider_Converse(t *testing.T) {
+	var gotPath string
+	var gotBody bedrockRequest
+	server := newBedrockStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		gotPath = r.URL.EscapedPath()
+		json.Unmarshal(body, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"output": {"message": {"role": "assistant", "content": [{"text": "Hi there"}]}},
+			"stopReason": "end_turn", "usage": {"inputTokens": 1000, "outputTokens": 2000, "totalTokens": 3000}}`)
+	})
+	defer server.Close()
+
+	p := newTestBedrockProvider(t, server.URL)
+	model := domain.Model("us.anthropic.claude-3-5-haiku-20241022-v1:0")
+	reqBody := []byte(`{"model": "us.anthropic.claude-3-5-haiku-20241022-v1:0", "max_tokens": 64, "temperature": 1.5, "messages": [
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": "Hello"}
+	]}`)
+
+	req, err := p.PrepareHTTPRequest(context.Background(), model, reqBody)
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stand-in rejected request: %d %s", resp.StatusCode, body)
+	}
+
+	if gotPath != "/model/us.anthropic.claude-3-5-haiku-20241022-v1%3A0/converse" {
+		t.Errorf("unexpected path: %s", gotPath)
+	}
+	if len(gotBody.System) != 1 || *gotBody.System[0].Text != "Be brief." {
+		t.Errorf("unexpected system: %+v", gotBody.System)
+	}
+	if cfg := gotBody.InferenceConfig; cfg == nil || *cfg.MaxTokens != 64 || *cfg.Temperature != 1.0 {
+		t.Errorf("unexpected inference config: %+v", cfg)
+	}
+
+	translated, err := p.TranslateResponse(model, body)
+	if err != nil {
+		t.Fatalf("TranslateResponse failed: %v", err)
+	}
+	var out chatCompletion
+	json.Unmarshal(translated, &out)
+	if *out.Choices[0].Message.Content != "Hi there" || *out.Choices[0].FinishReason != "stop" {
+		t.Errorf("unexpected translated response: %s", translated)
+	}
+
+	// Cross-region profiles are priced as the base model: 1k * 0.0008 + 2k * 0.004
+	usage, err := p.ParseUsage(model, translated)
+	if err != nil || usage.InputTokens != 1000 || fmt.Sprintf("%.4f", usage.TotalCost) != "0.0088" {
+		t.Errorf("unexpected usage: %+v, %v", usage, err)
+	}
+}
+
+func TestBedrockProvider_RejectedSignature(t *testing.T) {
+	server := newBedrockStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		t.Error("request with a bad signature reached the handler")
+	})
+	defer server.Close()
+
+	p := newTestBedrockProvider(t, server.URL)
+	configured, err := p.Configure(map[string]any{"access_key_id": "AKIDTEST", "secret_access_key": "wrong"})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	req, err := configured.PrepareHTTPRequest(context.Background(), "amazon.nova-lite-v1:0", []byte(`{"messages": [{"role": "user", "content": "Hi"}]}`))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestBedrockProvider_ConverseStream(t *testing.T) {
+	server := newBedrockStandIn(t, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if !strings.HasSuffix(r.URL.Path, "/converse-stream") {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, frame := range [][]byte{
+			bedrockEventFrame("messageStart", `{"role": "assistant", "p": "abc"}`),
+			bedrockEventFrame("contentBlockDelta", `{"contentBlockIndex": 0, "delta": {"text": "Hello"}}`),
+			bedrockEventFrame("contentBlockDelta", `{"contentBlockIndex": 0, "delta": {"text": " world"}}`),
+			bedrockEventFrame("contentBlockStart", `{"contentBlockIndex": 1, "start": {"toolUse": {"toolUseId": "t1", "name": "lookup"}}}`),
+			bedrockEventFrame("contentBlockDelta", `{"contentBlockIndex": 1, "delta": {"toolUse": {"input": "{\"q\":1}"}}}`),
+			bedrockEventFrame("contentBlockStop", `{"contentBlockIndex": 1}`),
+			bedrockEventFrame("messageStop", `{"stopReason": "tool_use"}`),
+			bedrockEventFrame("metadata", `{"usage": {"inputTokens": 1000, "outputTokens": 2000, "totalTokens": 3000}, "metrics": {"latencyMs": 100}}`),
+		} {
+			w.Write(frame)
+		}
+	})
+	defer server.Close()
+
+	p := newTestBedrockProvider(t, server.URL)
+	model := domain.Model("anthropic.claude-3-haiku-20240307-v1:0")
+
+	req, err := p.PrepareHTTPRequest(context.Background(), model, []byte(`{"stream": true, "messages": [{"role": "user", "content": "Hi"}]}`))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("stand-in rejected request: %d %s", resp.StatusCode, b)
+	}
+
+	stream := p.TranslateStream(model, resp.Body)
+	out, err := io.ReadAll(stream)
+	stream.Close()
+	if err != nil {
+		t.Fatalf("failed to read translated stream: %v", err)
+	}
+
+	var content strings.Builder
+	var usage *domain.Usage
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		text, _, u, err := p.ParseStreamChunk(model, line)
+		if err != nil {
+			t.Fatalf("translated chunk is not OpenAI-compatible: %q: %v", line, err)
+		}
+		content.WriteString(text)
+		if u != nil {
+			usage = u
+		}
+	}
+
+	if content.String() != "Hello world" {
+		t.Errorf("expected 'Hello world', got %q", content.String())
+	}
+	if !bytes.Contains(out, []byte(`"arguments":"{\"q\":1}"`)) || !bytes.Contains(out, []byte(`"finish_reason":"tool_calls"`)) {
+		t.Errorf("expected tool call chunks, got: %s", out)
+	}
+	// 1k input at $0.00025 + 2k output at $0.00125
+	if usage == nil || usage.OutputTokens != 2000 || fmt.Sprintf("%.5f", usage.TotalCost) != "0.00275" {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+	if !bytes.HasSuffix(out, []byte("data: [DONE]\n\n")) {
+		t.Errorf("expected stream to end with [DONE], got: %s", out)
+	}
+}
+
+func TestEventStreamDecoder(t *testing.T) {
+	frame := bedrockEventFrame("contentBlockDelta", `{"delta": {"text": "x"}}`)
+
+	msg, err := newEventStreamDecoder(bytes.NewReader(frame)).Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if msg.header(":event-type") != "contentBlockDelta" || string(msg.Payload) != `{"delta": {"text": "x"}}` {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	corrupt := append([]byte(nil), frame...)
+	corrupt[len(corrupt)-6] ^= 0xFF
+	if _, err := newEventStreamDecoder(bytes.NewReader(corrupt)).Next(); err == nil {
+		t.Error("expected checksum error")
+	}
+
+	if _, err := newEventStreamDecoder(bytes.NewReader(frame[:20])).Next(); err == nil {
+		t.Error("expected error for truncated message")
+	}
+
+	exception := encodeEventStreamMessage(map[string]string{
+		":message-type":   "exception",
+		":exception-type": "throttlingException",
+	}, []byte(`{"message": "Too many requests"}`))
+	out, _ := io.ReadAll(newEventStreamTranslator(io.NopCloser(bytes.NewReader(exception)), (&bedrockStream{toolIndex: map[int]int{}}).handle, nil))
+	if !bytes.Contains(out, []byte(`data: {"error":{"message":"Too many requests","type":"throttlingException"}}`)) {
+		t.Errorf("expected error chunk, got: %s", out)
+	}
+}
@@ -0,0 +1,389 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"pouch-ai/backend/domain"
+	"strings"
+)
+
+// OpenAI chat completion wire types shared by providers that translate the
+// OpenAI format to and from their own upstream API.
+
+type chatRequest struct {
+	Model               string          `json:"model"`
+	Messages            []chatMessage   `json:"messages"`
+	Stream              bool            `json:"stream"`
+	MaxTokens           *int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	N                   *int            `json:"n,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	Stop                json.RawMessage `json:"stop,omitempty"`
+	Tools               []chatTool      `json:"tools,omitempty"`
+	ToolChoice          json.RawMessage `json:"tool_choice,omitempty"`
+	User                string          `json:"user,omitempty"`
+}
+
+type chatMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []chatToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+type chatContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+type chatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type chatToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int            `json:"index"`
+	Message      *chatResponse  `json:"message,omitempty"`
+	Delta        *chatResponse  `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+	Logprobs     map[string]any `json:"logprobs,omitempty"`
+}
+
+type chatResponse struct {
+	Role      string         `json:"role,omitempty"`
+	Content   *string        `json:"content,omitempty"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+}
+
+func newChatUsage(prompt, completion int) *chatUsage {
+	return &chatUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// contentParts normalizes a message content, which may be a plain string or
+// an array of typed parts, into a list of parts.
+func contentParts(raw json.RawMessage) []chatContentPart {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []chatContentPart{{Type: "text", Text: s}}
+	}
+	var parts []chatContentPart
+	_ = json.Unmarshal(raw, &parts)
+	return parts
+}
+
+// contentText concatenates the text parts of a message content.
+func contentText(raw json.RawMessage) string {
+	var b strings.Builder
+	for _, part := range contentParts(raw) {
+		if part.Type == "text" {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
+
+// stopSequences reads the "stop" field, which may be a string or an array.
+func stopSequences(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s == "" {
+			return nil
+		}
+		return []string{s}
+	}
+	var list []string
+	_ = json.Unmarshal(raw, &list)
+	return list
+}
+
+// requestText returns all text in a chat request that counts as input.
+func (r *chatRequest) requestText() string {
+	var b strings.Builder
+	for _, m := range r.Messages {
+		b.WriteString(contentText(m.Content))
+		for _, tc := range m.ToolCalls {
+			b.WriteString(tc.Function.Arguments)
+		}
+	}
+	for _, t := range r.Tools {
+		b.WriteString(t.Function.Name)
+		b.WriteString(t.Function.Description)
+		b.Write(t.Function.Parameters)
+	}
+	return b.String()
+}
+
+// maxOutputTokens returns the output cap requested by the client, if any.
+func (r *chatRequest) maxOutputTokens() int {
+	if r.MaxCompletionTokens != nil {
+		return *r.MaxCompletionTokens
+	}
+	if r.MaxTokens != nil {
+		return *r.MaxTokens
+	}
+	return 0
+}
+
+// outputTokens returns the most output the request may produce: the output
+// cap of each of the choices it asks for.
+func (r *chatRequest) outputTokens(providerDefault int, pricing domain.Pricing) int {
+	choices := 1
+	if r.N != nil && *r.N > 1 {
+		choices = *r.N
+	}
+	return outputCap(r.maxOutputTokens(), providerDefault, pricing) * choices
+}
+
+// outputCap returns the most output tokens a request can produce: the
+// client's cap, else the provider's default cap, else the model's limit. A
+// cap above the model's limit is lowered to it. Zero means unbounded.
+func outputCap(requested, providerDefault int, pricing domain.Pricing) int {
+	n := requested
+	if n <= 0 {
+		n = providerDefault
+	}
+	if n <= 0 || (pricing.MaxOutputTokens > 0 && n > pricing.MaxOutputTokens) {
+		n = pricing.MaxOutputTokens
+	}
+	return n
+}
+
+// estimateChatUsage prices the worst case of a chat request: its input plus
+// the most output it may produce, so the reservation covers the full call.
+func estimateChatUsage(inputTokens, outputTokens int, pricing domain.Pricing) *domain.Usage {
+	return &domain.Usage{
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		TotalCost:    float64(inputTokens)/1000.0*pricing.Input + float64(outputTokens)/1000.0*pricing.Output,
+	}
+}
+
+// parseChatChunk decodes a single OpenAI-style SSE line. It returns the delta
+// content and, when present, the usage block of the chunk.
+func parseChatChunk(chunk []byte) (string, *chatUsage, error) {
+	chunk = bytes.TrimSpace(chunk)
+	if !bytes.HasPrefix(chunk, []byte("data: ")) || bytes.HasSuffix(chunk, []byte("[DONE]")) {
+		return "", nil, nil
+	}
+	dataBytes := bytes.TrimPrefix(chunk, []byte("data: "))
+
+	var streamChunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *chatUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(dataBytes, &streamChunk); err != nil {
+		return "", nil, err
+	}
+
+	content := ""
+	if len(streamChunk.Choices) > 0 {
+		content = streamChunk.Choices[0].Delta.Content
+	}
+	return content, streamChunk.Usage, nil
+}
+
+// parseChatUsage reads the usage block of a non-streaming OpenAI-style response.
+func parseChatUsage(body []byte) (*chatUsage, error) {
+	var resp struct {
+		Usage *chatUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Usage, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// chatMeter implements the metering half of domain.Provider for providers
+// whose responses are translated to the OpenAI chat format before they are
+// metered. It is embedded by those providers.
+type chatMeter struct {
+	pricing      *PricingTable
+	tokenCounter TokenCounter
+	// pricedAs, if set, maps a model name to the name it is priced under.
+	pricedAs func(model string) string
+	// defaultMaxTokens is the output cap sent upstream when the client sets
+	// none, if the provider sets one.
+	defaultMaxTokens int
+	// fallback, if set, prices models missing from the pricing table.
+	fallback *domain.Pricing
+}
+
+func (m *chatMeter) GetPricing(model domain.Model) (domain.Pricing, error) {
+	name := string(model)
+	if m.pricedAs != nil {
+		name = m.pricedAs(name)
+	}
+	mp, err := m.pricing.GetPrice(name)
+	if errors.Is(err, domain.ErrUnknownModel) && m.fallback != nil {
+		return *m.fallback, nil
+	}
+	if err != nil {
+		return domain.Pricing{}, err
+	}
+	return domain.Pricing{
+		Input:           mp.Input,
+		Output:          mp.Output,
+		MaxOutputTokens: mp.MaxOutputTokens,
+	}, nil
+}
+
+// ListModels returns the priced models (or model prefixes), for upstreams
+// without a model list API of their own.
+func (m *chatMeter) ListModels(ctx context.Context) ([]domain.Model, error) {
+	names := m.pricing.Models()
+	models := make([]domain.Model, len(names))
+	for i, name := range names {
+		models[i] = domain.Model(name)
+	}
+	return models, nil
+}
+
+// CountTokens approximates the upstream tokenizer with a BPE tokenizer; the
+// exact counts are taken from the response usage once the request completes.
+func (m *chatMeter) CountTokens(model domain.Model, text string) (int, error) {
+	return m.tokenCounter.Count(string(model), text)
+}
+
+func (m *chatMeter) EstimateUsage(model domain.Model, body []byte) (*domain.Usage, error) {
+	var req chatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	inputTokens, err := m.CountTokens(model, req.requestText())
+	if err != nil {
+		return nil, err
+	}
+
+	pricing, err := m.GetPricing(model)
+	if err != nil {
+		return nil, err
+	}
+
+	return estimateChatUsage(inputTokens, req.outputTokens(m.defaultMaxTokens, pricing), pricing), nil
+}
+
+func (m *chatMeter) ParseOutputUsage(model domain.Model, responseBody []byte, isStream bool) (int, error) {
+	if !isStream {
+		usage, err := parseChatUsage(responseBody)
+		if err == nil && usage != nil {
+			return usage.CompletionTokens, nil
+		}
+		return len(responseBody) / 4, nil
+	}
+
+	totalTokens := 0
+	for _, line := range strings.Split(string(responseBody), "\n") {
+		_, tokens, usage, err := m.ParseStreamChunk(model, []byte(line))
+		if err == nil {
+			if usage != nil {
+				return usage.OutputTokens, nil
+			}
+			totalTokens += tokens
+		}
+	}
+	return totalTokens, nil
+}
+
+func (m *chatMeter) ParseStreamChunk(model domain.Model, chunk []byte) (string, int, *domain.Usage, error) {
+	content, chunkUsage, err := parseChatChunk(chunk)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	var usage *domain.Usage
+	if chunkUsage != nil {
+		usage = m.usageCost(model, chunkUsage)
+	}
+
+	tokens := 0
+	if content != "" {
+		tokens, _ = m.CountTokens(model, content)
+	}
+
+	return content, tokens, usage, nil
+}
+
+// ParseUsage reads the exact token counts the upstream reported for a
+// non-streaming response (after translation to the OpenAI format).
+func (m *chatMeter) ParseUsage(model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	usage, err := parseChatUsage(responseBody)
+	if err != nil || usage == nil {
+		return nil, err
+	}
+	return m.usageCost(model, usage), nil
+}
+
+func (m *chatMeter) ParseRequest(body []byte) (domain.Model, bool, error) {
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", false, err
+	}
+	return domain.Model(req.Model), req.Stream, nil
+}
+
+func (m *chatMeter) usageCost(model domain.Model, usage *chatUsage) *domain.Usage {
+	pricing, _ := m.GetPricing(model)
+	return &domain.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalCost:    (float64(usage.PromptTokens) / 1000.0 * pricing.Input) + (float64(usage.CompletionTokens) / 1000.0 * pricing.Output),
+	}
+}
@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"strings"
+)
+
+// CompatibleBuilder creates one OpenAIProvider per entry in the
+// "compatible_providers" section of the config file, for local servers and
+// third-party APIs that speak the OpenAI chat completions API (Ollama, vLLM,
+// llama.cpp server, Groq, OpenRouter, Together, ...).
+type CompatibleBuilder struct{}
+
+func (b *CompatibleBuilder) BuildAll(ctx context.Context, cfg *config.Config) ([]domain.Provider, error) {
+	seen := make(map[string]bool)
+	var result []domain.Provider
+	for _, pc := range cfg.CompatibleProviders {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("compatible provider without a name")
+		}
+		if seen[pc.Name] {
+			return nil, fmt.Errorf("duplicate compatible provider: %s", pc.Name)
+		}
+		seen[pc.Name] = true
+
+		if pc.BaseURL == "" {
+			return nil, fmt.Errorf("compatible provider %s: base_url is required", pc.Name)
+		}
+
+		pricing := NewPricingTable(map[string]ModelPrice{wildcardModel: {}})
+		if len(pc.Pricing) > 0 {
+			var err error
+			if pricing, err = ParsePricingTable(pc.Pricing); err != nil {
+				return nil, fmt.Errorf("compatible provider %s: invalid pricing: %w", pc.Name, err)
+			}
+		}
+
+		apiKey := pc.APIKey
+		if pc.APIKeyEnv != "" {
+			if val := os.Getenv(pc.APIKeyEnv); val != "" {
+				apiKey = val
+			}
+		}
+
+		result = append(result, NewCompatibleProvider(pc.Name, apiKey, pc.BaseURL, pc.AuthHeader, pc.AuthScheme, pricing, NewTiktokenCounter()))
+	}
+	return result, nil
+}
+
+// NewCompatibleProvider returns an OpenAIProvider registered under name that
+// sends requests to baseURL. authHeader defaults to "Authorization", in which
+// case authScheme defaults to "Bearer". Token counts use the OpenAI tokenizer
+// as an approximation unless the upstream reports usage.
+func NewCompatibleProvider(name, apiKey, baseURL, authHeader, authScheme string, pricing *PricingTable, counter TokenCounter) *OpenAIProvider {
+	if authHeader == "" {
+		authHeader = "Authorization"
+	}
+	if authScheme == "" && http.CanonicalHeaderKey(authHeader) == "Authorization" {
+		authScheme = "Bearer"
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	return &OpenAIProvider{
+		name:         name,
+		title:        name,
+		apiKey:       apiKey,
+		baseURL:      baseURL,
+		defaultURL:   baseURL,
+		authHeader:   authHeader,
+		authScheme:   authScheme,
+		pricing:      pricing,
+		tokenCounter: counter,
+		responses:    newResponseStore(),
+	}
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"testing"
+)
+
+func TestCompatibleBuilder_BuildAll(t *testing.T) {
+	t.Setenv("TEST_GROQ_KEY", "groq-secret")
+
+	cfg := config.New()
+	cfg.CompatibleProviders = []config.CompatibleProviderConfig{
+		{Name: "ollama", BaseURL: "http://localhost:11434/v1/"},
+		{
+			Name:      "groq",
+			BaseURL:   "https://api.groq.com/openai/v1",
+			APIKeyEnv: "TEST_GROQ_KEY",
+			Pricing:   json.RawMessage(`{"llama-3.1-8b": {"input": 0.00005, "output": 0.00008}}`),
+		},
+		{Name: "gateway", BaseURL: "https://gateway.local", APIKey: "gw-key", AuthHeader: "X-Api-Key"},
+	}
+
+	ps, err := (&CompatibleBuilder{}).BuildAll(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+	if len(ps) != 3 || ps[0].Name() != "ollama" || ps[1].Name() != "groq" {
+		t.Fatalf("unexpected providers: %v", ps)
+	}
+
+	// Without a pricing map every model is free
+	if price, err := ps[0].GetPricing("llama3.2"); err != nil || price.Input != 0 || price.Output != 0 {
+		t.Errorf("expected free pricing, got %+v, %v", price, err)
+	}
+
+	// With a pricing map, unknown models are not silently free
+	if price, err := ps[1].GetPricing("llama-3.1-8b-instant"); err != nil || price.Input != 0.00005 {
+		t.Errorf("expected prefix pricing, got %+v, %v", price, err)
+	}
+	if _, err := ps[1].GetPricing("mixtral"); err == nil {
+		t.Errorf("expected error for unpriced model")
+	}
+
+	tests := []struct {
+		provider domain.Provider
+		url      string
+		header   string
+		value    string
+	}{
+		{ps[0], "http://localhost:11434/v1/chat/completions", "Authorization", ""},
+		{ps[1], "https://api.groq.com/openai/v1/chat/completions", "Authorization", "Bearer groq-secret"},
+		{ps[2], "https://gateway.local/chat/completions", "X-Api-Key", "gw-key"},
+	}
+	for _, tt := range tests {
+		req, err := tt.provider.PrepareHTTPRequest(context.Background(), "m", []byte(`{"model": "m"}`))
+		if err != nil {
+			t.Fatalf("%s: PrepareHTTPRequest failed: %v", tt.provider.Name(), err)
+		}
+		if req.URL.String() != tt.url {
+			t.Errorf("%s: expected URL %s, got %s", tt.provider.Name(), tt.url, req.URL)
+		}
+		if got := req.Header.Get(tt.header); got != tt.value {
+			t.Errorf("%s: expected %s %q, got %q", tt.provider.Name(), tt.header, tt.value, got)
+		}
+	}
+
+	if _, err := ps[0].GetUsage(context.Background()); !errors.Is(err, domain.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported from GetUsage, got %v", err)
+	}
+}
+
+func TestCompatibleBuilder_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []config.CompatibleProviderConfig
+	}{
+		{"missing name", []config.CompatibleProviderConfig{{BaseURL: "http://a"}}},
+		{"missing base_url", []config.CompatibleProviderConfig{{Name: "a"}}},
+		{"duplicate name", []config.CompatibleProviderConfig{{Name: "a", BaseURL: "http://a"}, {Name: "a", BaseURL: "http://b"}}},
+		{"invalid pricing", []config.CompatibleProviderConfig{{Name: "a", BaseURL: "http://a", Pricing: json.RawMessage(`[]`)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.CompatibleProviders = tt.providers
+			if _, err := (&CompatibleBuilder{}).BuildAll(context.Background(), cfg); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestCompatibleProvider_FreeModelCountsTokens(t *testing.T) {
+	p := NewCompatibleProvider("local", "", "http://localhost:8000/v1", "", "", NewPricingTable(map[string]ModelPrice{wildcardModel: {}}), &approxCounter{})
+
+	usage, err := p.EstimateUsage("qwen2.5", []byte(`{"model": "qwen2.5", "messages": [{"role": "user", "content": "0123456789abcdef"}]}`))
+	if err != nil {
+		t.Fatalf("EstimateUsage failed: %v", err)
+	}
+	if usage.InputTokens != 4 || usage.TotalCost != 0 {
+		t.Errorf("expected 4 free input tokens, got %+v", usage)
+	}
+
+	_, _, streamUsage, err := p.ParseStreamChunk("qwen2.5", []byte(`data: {"choices": [], "usage": {"prompt_tokens": 10, "completion_tokens": 20}}`))
+	if err != nil || streamUsage == nil || streamUsage.OutputTokens != 20 || streamUsage.TotalCost != 0 {
+		t.Errorf("unexpected stream usage: %+v, %v", streamUsage, err)
+	}
+
+	// Per-key overrides must not wipe the configured base URL
+	configured, err := p.Configure(map[string]any{"base_url": "", "api_key": "k"})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	req, _ := configured.PrepareHTTPRequest(context.Background(), "qwen2.5", []byte(`{}`))
+	if req.URL.String() != "http://localhost:8000/v1/chat/completions" || req.Header.Get("Authorization") != "Bearer k" {
+		t.Errorf("unexpected request: %s %v", req.URL, req.Header)
+	}
+}
@@ -0,0 +1,176 @@
+package providers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// AWS event stream framing (application/vnd.amazon.eventstream), as used by
+// Bedrock's streaming APIs. Each message is:
+//
+//	total length (4) | headers length (4) | prelude CRC (4) | headers | payload | message CRC (4)
+//
+// with all integers big-endian and both CRCs being CRC32 (IEEE).
+
+const (
+	eventStreamPreludeLen = 12
+	eventStreamCRCLen     = 4
+	// eventStreamMaxMessage guards against allocating huge buffers on a
+	// corrupt length prefix.
+	eventStreamMaxMessage = 16 << 20
+)
+
+type eventStreamMessage struct {
+	Headers map[string]any
+	Payload []byte
+}
+
+func (m *eventStreamMessage) header(name string) string {
+	s, _ := m.Headers[name].(string)
+	return s
+}
+
+type eventStreamDecoder struct {
+	r io.Reader
+}
+
+func newEventStreamDecoder(r io.Reader) *eventStreamDecoder {
+	return &eventStreamDecoder{r: r}
+}
+
+// Next reads one message. It returns io.EOF at a clean end of stream.
+func (d *eventStreamDecoder) Next() (*eventStreamMessage, error) {
+	prelude := make([]byte, eventStreamPreludeLen)
+	if _, err := io.ReadFull(d.r, prelude); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("event stream: truncated prelude")
+		}
+		return nil, err
+	}
+
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, fmt.Errorf("event stream: prelude checksum mismatch")
+	}
+	if totalLen > eventStreamMaxMessage || uint64(totalLen) < uint64(eventStreamPreludeLen)+uint64(headersLen)+eventStreamCRCLen {
+		return nil, fmt.Errorf("event stream: invalid message length %d", totalLen)
+	}
+
+	msg := make([]byte, totalLen)
+	copy(msg, prelude)
+	if _, err := io.ReadFull(d.r, msg[eventStreamPreludeLen:]); err != nil {
+		return nil, fmt.Errorf("event stream: truncated message: %w", err)
+	}
+
+	crcOffset := totalLen - eventStreamCRCLen
+	if crc32.ChecksumIEEE(msg[:crcOffset]) != binary.BigEndian.Uint32(msg[crcOffset:]) {
+		return nil, fmt.Errorf("event stream: message checksum mismatch")
+	}
+
+	headersEnd := eventStreamPreludeLen + headersLen
+	headers, err := decodeEventStreamHeaders(msg[eventStreamPreludeLen:headersEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventStreamMessage{
+		Headers: headers,
+		Payload: msg[headersEnd:crcOffset],
+	}, nil
+}
+
+func decodeEventStreamHeaders(b []byte) (map[string]any, error) {
+	headers := make(map[string]any)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, fmt.Errorf("event stream: truncated header")
+		}
+		name := string(b[1 : 1+nameLen])
+		valueType := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		var size int
+		switch valueType {
+		case 0, 1: // bool true / false
+			headers[name] = valueType == 0
+			continue
+		case 2: // byte
+			size = 1
+		case 3: // int16
+			size = 2
+		case 4: // int32
+			size = 4
+		case 5, 8: // int64, timestamp (ms)
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // bytes, string: 2-byte length prefix
+			if len(b) < 2 {
+				return nil, fmt.Errorf("event stream: truncated header %s", name)
+			}
+			n := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+n {
+				return nil, fmt.Errorf("event stream: truncated header %s", name)
+			}
+			if valueType == 7 {
+				headers[name] = string(b[2 : 2+n])
+			} else {
+				headers[name] = append([]byte(nil), b[2:2+n]...)
+			}
+			b = b[2+n:]
+			continue
+		default:
+			return nil, fmt.Errorf("event stream: unknown header type %d for %s", valueType, name)
+		}
+
+		if len(b) < size {
+			return nil, fmt.Errorf("event stream: truncated header %s", name)
+		}
+		headers[name] = append([]byte(nil), b[:size]...)
+		b = b[size:]
+	}
+	return headers, nil
+}
+
+// newEventStreamTranslator reads the messages of an AWS event stream. Each
+// event is handed to handle as {"<event-type>": payload}; exceptions as
+// {"exception": {"type": "<exception-type>", "message": ...}}.
+func newEventStreamTranslator(body io.ReadCloser, handle func(data []byte) [][]byte, finish func() [][]byte) *streamTranslator {
+	dec := newEventStreamDecoder(body)
+	next := func() ([]byte, error) {
+		for {
+			msg, err := dec.Next()
+			if err != nil {
+				return nil, err
+			}
+
+			switch msg.header(":message-type") {
+			case "event":
+				eventType := msg.header(":event-type")
+				if eventType == "" || !json.Valid(msg.Payload) {
+					continue
+				}
+				return json.Marshal(map[string]json.RawMessage{eventType: msg.Payload})
+			case "exception", "error":
+				exType := msg.header(":exception-type")
+				if exType == "" {
+					exType = msg.header(":error-code")
+				}
+				var ex struct {
+					Message string `json:"message"`
+				}
+				_ = json.Unmarshal(msg.Payload, &ex)
+				if ex.Message == "" {
+					ex.Message = msg.header(":error-message")
+				}
+				return json.Marshal(map[string]any{"exception": map[string]string{"type": exType, "message": ex.Message}})
+			}
+		}
+	}
+	return &streamTranslator{next: next, body: body, handle: handle, finish: finish}
+}
@@ -0,0 +1,573 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+	"strings"
+	"time"
+)
+
+//go:embed gemini_pricing.json
+var geminiPricingJSON []byte
+
+const geminiDefaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiProvider serves OpenAI-style chat requests from the Gemini
+// generateContent / streamGenerateContent API.
+type GeminiProvider struct {
+	chatMeter
+	apiKey  string
+	baseURL string
+}
+
+type GeminiBuilder struct{}
+
+func (b *GeminiBuilder) Build(ctx context.Context, cfg *config.Config) (domain.Provider, error) {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("GOOGLE_API_KEY")
+	}
+	if apiKey == "" {
+		apiKey = cfg.GeminiKey
+	}
+
+	apiURL := os.Getenv("GEMINI_URL")
+	if apiURL == "" {
+		apiURL = cfg.GeminiURL
+	}
+
+	if apiKey == "" {
+		fmt.Println("WARN: Gemini API Key not found. 'gemini' provider will be unavailable.")
+		return nil, nil
+	}
+
+	pricing, err := NewGeminiPricing()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGeminiProvider(apiKey, apiURL, pricing, NewTiktokenCounter()), nil
+}
+
+func NewGeminiPricing() (*PricingTable, error) {
+	pricing, err := ParsePricingTable(geminiPricingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gemini_pricing.json: %w", err)
+	}
+	return pricing, nil
+}
+
+func NewGeminiProvider(apiKey string, baseURL string, pricing *PricingTable, counter TokenCounter) *GeminiProvider {
+	if baseURL == "" {
+		baseURL = geminiDefaultBaseURL
+	}
+
+	return &GeminiProvider{
+		chatMeter: chatMeter{pricing: pricing, tokenCounter: counter},
+		apiKey:    apiKey,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (p *GeminiProvider) Schema() domain.PluginSchema {
+	return domain.PluginSchema{
+		"api_key": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "API Key",
+			Description: "Your Google AI Studio (Gemini) API Key",
+			Role:        domain.FieldRoleCredential,
+		},
+		"base_url": {
+			Type:        domain.FieldTypeString,
+			DisplayName: "Base URL",
+			Default:     geminiDefaultBaseURL,
+			Description: "Gemini API Base URL",
+			Role:        domain.FieldRoleCredential,
+		},
+	}
+}
+
+func (p *GeminiProvider) Configure(config map[string]any) (domain.Provider, error) {
+	newP := *p
+	if s, ok := config["api_key"].(string); ok && s != "" {
+		newP.apiKey = s
+	}
+	if s, ok := config["base_url"].(string); ok && s != "" {
+		newP.baseURL = strings.TrimSuffix(s, "/")
+	}
+	return &newP, nil
+}
+
+func (p *GeminiProvider) WithFallbackPricing(pricing domain.Pricing) domain.Provider {
+	newP := *p
+	newP.fallback = &pricing
+	return &newP
+}
+
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+// ParseRequest accepts both "gemini-2.0-flash" and "models/gemini-2.0-flash".
+func (p *GeminiProvider) ParseRequest(body []byte) (domain.Model, bool, error) {
+	model, stream, err := p.chatMeter.ParseRequest(body)
+	if err != nil {
+		return "", false, err
+	}
+	return domain.Model(strings.TrimPrefix(string(model), "models/")), stream, nil
+}
+
+func (p *GeminiProvider) PrepareHTTPRequest(ctx context.Context, model domain.Model, body []byte) (*http.Request, error) {
+	translated, stream, err := p.translateRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/models/%s:generateContent", p.baseURL, strings.TrimPrefix(string(model), "models/"))
+	if stream {
+		url = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", p.baseURL, strings.TrimPrefix(string(model), "models/"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(translated))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("x-goog-api-key", p.apiKey)
+	}
+	return req, nil
+}
+
+func (p *GeminiProvider) ListModels(ctx context.Context) ([]domain.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models?pageSize=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("x-goog-api-key", p.apiKey)
+	}
+	return fetchGeminiModels(req)
+}
+
+// GetUsage is not available: Gemini spend is only reported through Google
+// Cloud Billing, not the Generative Language API.
+func (p *GeminiProvider) GetUsage(ctx context.Context) (float64, error) {
+	return 0, domain.ErrNotSupported
+}
+
+// Request translation (OpenAI chat -> Gemini generateContent)
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+func (p *GeminiProvider) translateRequest(body []byte) ([]byte, bool, error) {
+	var in chatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, false, err
+	}
+
+	var out geminiRequest
+	gen := geminiGenerationConfig{
+		Temperature:   in.Temperature,
+		TopP:          in.TopP,
+		StopSequences: stopSequences(in.Stop),
+	}
+	if n := in.maxOutputTokens(); n > 0 {
+		gen.MaxOutputTokens = &n
+	}
+	if gen.MaxOutputTokens != nil || gen.Temperature != nil || gen.TopP != nil || len(gen.StopSequences) > 0 {
+		out.GenerationConfig = &gen
+	}
+
+	// Tool results only carry the call ID; Gemini wants the function name.
+	toolNames := make(map[string]string)
+	var system []geminiPart
+	for _, m := range in.Messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, geminiPart{Text: contentText(m.Content)})
+		case "assistant":
+			parts := geminiContentParts(m.Content)
+			for _, tc := range m.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				args := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: tc.Function.Name, Args: args}})
+			}
+			out.Contents = appendGeminiContent(out.Contents, "model", parts)
+		case "tool":
+			text := contentText(m.Content)
+			response := json.RawMessage(text)
+			if !json.Valid(response) || !strings.HasPrefix(strings.TrimSpace(text), "{") {
+				response, _ = json.Marshal(map[string]string{"content": text})
+			}
+			out.Contents = appendGeminiContent(out.Contents, "user", []geminiPart{{
+				FunctionResponse: &geminiFunctionResponse{Name: toolNames[m.ToolCallID], Response: response},
+			}})
+		default:
+			out.Contents = appendGeminiContent(out.Contents, "user", geminiContentParts(m.Content))
+		}
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(in.Tools) > 0 {
+		var decls []geminiFunctionDeclaration
+		for _, t := range in.Tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			})
+		}
+		out.Tools = []geminiTool{{FunctionDeclarations: decls}}
+		out.ToolConfig = geminiToolChoice(in.ToolChoice)
+	}
+
+	translated, err := json.Marshal(out)
+	return translated, in.Stream, err
+}
+
+func appendGeminiContent(contents []geminiContent, role string, parts []geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+func geminiContentParts(raw json.RawMessage) []geminiPart {
+	var parts []geminiPart
+	for _, part := range contentParts(raw) {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				parts = append(parts, geminiPart{Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL != nil {
+				parts = append(parts, geminiImage(part.ImageURL.URL))
+			}
+		}
+	}
+	return parts
+}
+
+func geminiImage(url string) geminiPart {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok {
+			return geminiPart{InlineData: &geminiBlob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}}
+		}
+	}
+	mimeType := mime.TypeByExtension(path.Ext(url))
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return geminiPart{FileData: &geminiFileData{MimeType: mimeType, FileURI: url}}
+}
+
+func geminiToolChoice(raw json.RawMessage) *geminiToolConfig {
+	if len(raw) == 0 {
+		return nil
+	}
+	cfg := &geminiToolConfig{}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		switch s {
+		case "none":
+			cfg.FunctionCallingConfig.Mode = "NONE"
+		case "required":
+			cfg.FunctionCallingConfig.Mode = "ANY"
+		default:
+			cfg.FunctionCallingConfig.Mode = "AUTO"
+		}
+		return cfg
+	}
+	var choice struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Function.Name == "" {
+		return nil
+	}
+	cfg.FunctionCallingConfig.Mode = "ANY"
+	cfg.FunctionCallingConfig.AllowedFunctionNames = []string{choice.Function.Name}
+	return cfg
+}
+
+// Response translation (Gemini -> OpenAI chat)
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+		Index        int           `json:"index"`
+	} `json:"candidates"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+	ModelVersion  string       `json:"modelVersion"`
+	ResponseID    string       `json:"responseId"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// chatUsage maps usageMetadata to OpenAI usage. Thinking tokens are billed as
+// output, so they are counted as completion tokens.
+func (u *geminiUsage) chatUsage() *chatUsage {
+	return newChatUsage(u.PromptTokenCount, u.CandidatesTokenCount+u.ThoughtsTokenCount)
+}
+
+func geminiFinishReason(reason string, hasToolCalls bool) string {
+	switch {
+	case hasToolCalls:
+		return "tool_calls"
+	case reason == "MAX_TOKENS":
+		return "length"
+	case reason == "SAFETY", reason == "RECITATION", reason == "BLOCKLIST", reason == "PROHIBITED_CONTENT", reason == "SPII":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// geminiParts splits candidate parts into visible text and tool calls.
+func geminiParts(parts []geminiPart, toolOffset int) (string, []chatToolCall) {
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, part := range parts {
+		switch {
+		case part.FunctionCall != nil:
+			idx := toolOffset + len(toolCalls)
+			tc := chatToolCall{Index: &idx, ID: fmt.Sprintf("call_%d", idx), Type: "function"}
+			tc.Function.Name = part.FunctionCall.Name
+			tc.Function.Arguments = string(part.FunctionCall.Args)
+			if tc.Function.Arguments == "" {
+				tc.Function.Arguments = "{}"
+			}
+			toolCalls = append(toolCalls, tc)
+		case !part.Thought:
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), toolCalls
+}
+
+func (p *GeminiProvider) TranslateResponse(model domain.Model, body []byte) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Candidates == nil && resp.UsageMetadata == nil {
+		return nil, fmt.Errorf("unexpected gemini response: no candidates")
+	}
+
+	out := chatCompletion{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   string(model),
+		Choices: []chatChoice{},
+	}
+	for i, c := range resp.Candidates {
+		text, toolCalls := geminiParts(c.Content.Parts, 0)
+		for j := range toolCalls {
+			toolCalls[j].Index = nil
+		}
+		message := &chatResponse{Role: "assistant", ToolCalls: toolCalls}
+		if text != "" || len(toolCalls) == 0 {
+			message.Content = stringPtr(text)
+		}
+		out.Choices = append(out.Choices, chatChoice{
+			Index:        i,
+			Message:      message,
+			FinishReason: stringPtr(geminiFinishReason(c.FinishReason, len(toolCalls) > 0)),
+		})
+	}
+	if resp.UsageMetadata != nil {
+		out.Usage = resp.UsageMetadata.chatUsage()
+	}
+
+	return json.Marshal(out)
+}
+
+// TranslateStream handles both the SSE form (alt=sse, which this provider
+// requests) and the default streamed JSON array form of streamGenerateContent.
+func (p *GeminiProvider) TranslateStream(model domain.Model, body io.ReadCloser) io.ReadCloser {
+	s := &geminiStream{
+		model:   string(model),
+		created: time.Now().Unix(),
+	}
+
+	br := bufio.NewReader(body)
+	for {
+		b, err := br.Peek(1)
+		if err != nil || !isJSONSpace(b[0]) {
+			if err == nil && b[0] == '[' {
+				return newJSONArrayTranslator(br, body, s.handle, s.finish)
+			}
+			break
+		}
+		br.ReadByte()
+	}
+	return newSSETranslator(struct {
+		io.Reader
+		io.Closer
+	}{br, body}, s.handle, s.finish)
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+type geminiStream struct {
+	id        string
+	model     string
+	created   int64
+	started   bool
+	toolCalls int
+	usage     *geminiUsage
+}
+
+func (s *geminiStream) chunk(delta *chatResponse, finishReason *string) *chatCompletion {
+	return &chatCompletion{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []chatChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+func (s *geminiStream) handle(data []byte) [][]byte {
+	var resp geminiResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil
+	}
+	if resp.ResponseID != "" {
+		s.id = resp.ResponseID
+	}
+	if resp.UsageMetadata != nil {
+		// usageMetadata is cumulative; the last one seen is authoritative
+		s.usage = resp.UsageMetadata
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+
+	c := resp.Candidates[0]
+	text, toolCalls := geminiParts(c.Content.Parts, s.toolCalls)
+	s.toolCalls += len(toolCalls)
+
+	var chunks []*chatCompletion
+	if text != "" || len(toolCalls) > 0 || !s.started {
+		delta := &chatResponse{ToolCalls: toolCalls}
+		if !s.started {
+			delta.Role = "assistant"
+			s.started = true
+		}
+		if text != "" || len(toolCalls) == 0 {
+			delta.Content = stringPtr(text)
+		}
+		chunks = append(chunks, s.chunk(delta, nil))
+	}
+	if c.FinishReason != "" {
+		chunks = append(chunks, s.chunk(&chatResponse{}, stringPtr(geminiFinishReason(c.FinishReason, s.toolCalls > 0))))
+	}
+	return encodeChunks(chunks...)
+}
+
+func (s *geminiStream) finish() [][]byte {
+	if s.usage == nil {
+		return nil
+	}
+	usageChunk := s.chunk(nil, nil)
+	usageChunk.Choices = []chatChoice{}
+	usageChunk.Usage = s.usage.chatUsage()
+	return encodeChunks(usageChunk)
+}
@@ -0,0 +1,158 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/domain"
+	"strings"
+	"testing"
+)
+
+func newTestGeminiProvider(t *testing.T, baseURL string) *GeminiProvider {
+	t.Helper()
+	pricing, err := NewGeminiPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	return NewGeminiProvider("test-key", baseURL, pricing, &approxCounter{})
+}
+
+func TestGeminiProvider_PrepareHTTPRequest(t *testing.T) {
+	p := newTestGeminiProvider(t, "http://gemini.local/v1beta")
+
+	body := `{"model": "models/gemini-2.0-flash", "stream": true, "max_tokens": 128, "messages": [
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": "Weather in Tokyo?"},
+		{"role": "assistant", "tool_calls": [{"id": "call_0", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Tokyo\"}"}}]},
+		{"role": "tool", "tool_call_id": "call_0", "content": "sunny"}
+	]}`
+
+	model, stream, err := p.ParseRequest([]byte(body))
+	if err != nil || model != "gemini-2.0-flash" || !stream {
+		t.Fatalf("ParseRequest = %q, %v, %v", model, stream, err)
+	}
+
+	req, err := p.PrepareHTTPRequest(context.Background(), model, []byte(body))
+	if err != nil {
+		t.Fatalf("PrepareHTTPRequest failed: %v", err)
+	}
+	if req.URL.String() != "http://gemini.local/v1beta/models/gemini-2.0-flash:streamGenerateContent?alt=sse" {
+		t.Errorf("unexpected URL: %s", req.URL)
+	}
+	if req.Header.Get("x-goog-api-key") != "test-key" {
+		t.Errorf("missing api key header")
+	}
+
+	var out geminiRequest
+	if err := json.NewDecoder(req.Body).Decode(&out); err != nil {
+		t.Fatalf("failed to decode translated body: %v", err)
+	}
+	if out.SystemInstruction == nil || out.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("expected system instruction, got %+v", out.SystemInstruction)
+	}
+	if out.GenerationConfig == nil || *out.GenerationConfig.MaxOutputTokens != 128 {
+		t.Errorf("expected maxOutputTokens 128, got %+v", out.GenerationConfig)
+	}
+	if len(out.Contents) != 3 || out.Contents[1].Role != "model" {
+		t.Fatalf("unexpected contents: %+v", out.Contents)
+	}
+	if fr := out.Contents[2].Parts[0].FunctionResponse; fr == nil || fr.Name != "weather" || string(fr.Response) != `{"content":"sunny"}` {
+		t.Errorf("unexpected function response: %+v", fr)
+	}
+}
+
+func TestGeminiProvider_TranslateResponse(t *testing.T) {
+	p := newTestGeminiProvider(t, "")
+
+	upstream := `{"candidates": [{"content": {"role": "model", "parts": [{"text": "thinking...", "thought": true}, {"text": "Hi!"}]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 1000, "candidatesTokenCount": 1500, "thoughtsTokenCount": 500}}`
+
+	body, err := p.TranslateResponse("gemini-2.5-pro", []byte(upstream))
+	if err != nil {
+		t.Fatalf("TranslateResponse failed: %v", err)
+	}
+
+	var resp chatCompletion
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("failed to decode translated response: %v", err)
+	}
+	if *resp.Choices[0].Message.Content != "Hi!" {
+		t.Errorf("expected thought parts to be dropped, got %s", body)
+	}
+
+	usage, err := p.ParseUsage("gemini-2.5-pro", body)
+	if err != nil {
+		t.Fatalf("ParseUsage failed: %v", err)
+	}
+	// Thinking tokens are billed as output: 1k input at $0.00125 + 2k output at $0.01
+	if usage.OutputTokens != 2000 || fmt.Sprintf("%.5f", usage.TotalCost) != "0.02125" {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestGeminiProvider_TranslateStream(t *testing.T) {
+	chunks := []string{
+		`{"candidates": [{"content": {"role": "model", "parts": [{"text": "Hello"}]}}], "usageMetadata": {"promptTokenCount": 1000}, "responseId": "r1"}`,
+		`{"candidates": [{"content": {"role": "model", "parts": [{"text": " world"}]}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 1000, "candidatesTokenCount": 2000}, "responseId": "r1"}`,
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"SSE", "data: " + chunks[0] + "\r\n\r\ndata: " + chunks[1] + "\r\n\r\n"},
+		{"JSON array", "[" + chunks[0] + ",\r\n" + chunks[1] + "]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			p := newTestGeminiProvider(t, server.URL)
+			model := domain.Model("gemini-2.0-flash")
+
+			resp, err := http.Get(server.URL)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			stream := p.TranslateStream(model, resp.Body)
+			out, err := io.ReadAll(stream)
+			stream.Close()
+			if err != nil {
+				t.Fatalf("failed to read translated stream: %v", err)
+			}
+
+			var content strings.Builder
+			var usage *domain.Usage
+			for _, line := range bytes.Split(out, []byte("\n")) {
+				text, _, u, err := p.ParseStreamChunk(model, line)
+				if err != nil {
+					t.Fatalf("translated chunk is not OpenAI-compatible: %q: %v", line, err)
+				}
+				content.WriteString(text)
+				if u != nil {
+					usage = u
+				}
+			}
+
+			if content.String() != "Hello world" {
+				t.Errorf("expected 'Hello world', got %q", content.String())
+			}
+			// 1k input at $0.0001 + 2k output at $0.0004
+			if usage == nil || usage.InputTokens != 1000 || fmt.Sprintf("%.4f", usage.TotalCost) != "0.0009" {
+				t.Errorf("unexpected usage: %+v", usage)
+			}
+			if !bytes.HasSuffix(out, []byte("data: [DONE]\n\n")) {
+				t.Errorf("expected stream to end with [DONE], got: %s", out)
+			}
+		})
+	}
+}
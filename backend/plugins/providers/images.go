@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Request defaults of the OpenAI image API.
+const (
+	defaultImageModel   = "dall-e-2"
+	defaultImageQuality = "standard"
+	defaultImageSize    = "1024x1024"
+)
+
+// imageRequest holds the parameters of an image request that determine its
+// price.
+type imageRequest struct {
+	Model   string
+	N       int
+	Quality string
+	Size    string
+}
+
+// parseImageRequest reads a JSON generation request or a multipart edit
+// request.
+func parseImageRequest(contentType string, body []byte) (*imageRequest, error) {
+	req := &imageRequest{}
+	if isMultipart(contentType) {
+		upload, err := parseMultipart(contentType, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Model = upload.fields["model"]
+		req.Quality = upload.fields["quality"]
+		req.Size = upload.fields["size"]
+		if n := upload.fields["n"]; n != "" {
+			if req.N, err = strconv.Atoi(n); err != nil {
+				return nil, fmt.Errorf("invalid n: %w", err)
+			}
+		}
+	} else {
+		var r struct {
+			Model   string `json:"model"`
+			N       int    `json:"n"`
+			Quality string `json:"quality"`
+			Size    string `json:"size"`
+		}
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		*req = imageRequest(r)
+	}
+
+	if req.Model == "" {
+		req.Model = defaultImageModel
+	}
+	if req.N <= 0 {
+		req.N = 1
+	}
+	return req, nil
+}
+
+// imagePrice looks up the price of one image in a "quality:size" table.
+// Unset values take the API defaults where the model prices them; "auto" (or
+// an unset quality without a default) resolves to the most expensive
+// matching entry, so reservations are never too small.
+func imagePrice(prices map[string]float64, quality, size string) (float64, error) {
+	if size == "" {
+		size = defaultImageSize
+	}
+	if quality == "" {
+		if _, ok := prices[defaultImageQuality+":"+size]; ok {
+			quality = defaultImageQuality
+		}
+	}
+	if price, ok := prices[quality+":"+size]; ok {
+		return price, nil
+	}
+
+	found := false
+	var max float64
+	for key, price := range prices {
+		q, s, _ := strings.Cut(key, ":")
+		if (quality == "" || quality == "auto" || q == quality) && (size == "auto" || s == size) {
+			if !found || price > max {
+				max = price
+			}
+			found = true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("image price not found for quality %q and size %q", quality, size)
+	}
+	return max, nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"pouch-ai/backend/config"
 	"pouch-ai/backend/domain"
 	"strings"
@@ -73,8 +74,16 @@ func (p *MockProvider) CountTokens(model domain.Model, text string) (int, error)
 }
 
 func (p *MockProvider) PrepareHTTPRequest(ctx context.Context, model domain.Model, body []byte) (*http.Request, error) {
-	// Direct the request to our internal mock server
-	req, err := http.NewRequestWithContext(ctx, "POST", p.server.URL, bytes.NewBuffer(body))
+	// Direct the request to our internal mock server. The server is shared by
+	// all configured copies, so per-key settings travel with the request.
+	target := p.server.URL
+	p.mu.RLock()
+	if customResp := p.config["mock_response"]; customResp != "" {
+		target += "?" + url.Values{"mock_response": {customResp}}.Encode()
+	}
+	p.mu.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
@@ -202,13 +211,11 @@ func (p *MockProvider) handleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	responseContent := "This is a mock response from the Pouch AI Mock Provider."
-	p.mu.RLock()
-	if customResp, ok := p.config["mock_response"]; ok && customResp != "" {
+	if customResp := r.URL.Query().Get("mock_response"); customResp != "" {
 		// If it's a valid JSON response from the user, we try to use it
 		// For the simplest case, we just use it as the content of a successful response
 		responseContent = customResp
 	}
-	p.mu.RUnlock()
 
 	if len(req.Messages) > 0 && responseContent == "This is a mock response from the Pouch AI Mock Provider." {
 		lastMsg := req.Messages[len(req.Messages)-1]
@@ -0,0 +1,75 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pouch-ai/backend/domain"
+	"strings"
+)
+
+// fetchModelIDs reads a model list in the {"data": [{"id": ...}]} format
+// shared by the OpenAI and Anthropic APIs.
+func fetchModelIDs(req *http.Request, provider string) ([]domain.Model, error) {
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s models api returned status: %d", provider, resp.StatusCode)
+	}
+
+	var data struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	models := make([]domain.Model, len(data.Data))
+	for i, m := range data.Data {
+		models[i] = domain.Model(m.ID)
+	}
+	return models, nil
+}
+
+// fetchGeminiModels reads the Gemini model list, keeping the models that
+// can generate content.
+func fetchGeminiModels(req *http.Request) ([]domain.Model, error) {
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gemini models api returned status: %d", resp.StatusCode)
+	}
+
+	var data struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	var models []domain.Model
+	for _, m := range data.Models {
+		for _, method := range m.SupportedGenerationMethods {
+			if method == "generateContent" {
+				models = append(models, domain.Model(strings.TrimPrefix(m.Name, "models/")))
+				break
+			}
+		}
+	}
+	return models, nil
+}
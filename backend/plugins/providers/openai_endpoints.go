@@ -0,0 +1,284 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"pouch-ai/backend/domain"
+	"strings"
+	"unicode/utf8"
+)
+
+// Endpoints other than chat completions served by OpenAI and
+// OpenAI-compatible upstreams.
+
+func (p *OpenAIProvider) SupportsEndpoint(endpoint domain.Endpoint) bool {
+	switch endpoint {
+	case domain.EndpointEmbeddings, domain.EndpointTranscriptions, domain.EndpointSpeech,
+		domain.EndpointImages, domain.EndpointImageEdits, domain.EndpointResponses:
+		return true
+	}
+	return false
+}
+
+func (p *OpenAIProvider) ParseEndpointRequest(endpoint domain.Endpoint, contentType string, body []byte) (domain.Model, bool, error) {
+	switch endpoint {
+	case domain.EndpointImages, domain.EndpointImageEdits:
+		req, err := parseImageRequest(contentType, body)
+		if err != nil {
+			return "", false, err
+		}
+		return domain.Model(req.Model), false, nil
+	}
+
+	if isMultipart(contentType) {
+		upload, err := parseMultipart(contentType, body)
+		if err != nil {
+			return "", false, err
+		}
+		return domain.Model(upload.fields["model"]), false, nil
+	}
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", false, err
+	}
+	// Only the Responses API streams in a format ParseStreamChunk can meter
+	return domain.Model(req.Model), req.Stream && endpoint == domain.EndpointResponses, nil
+}
+
+func (p *OpenAIProvider) PrepareEndpointRequest(ctx context.Context, endpoint domain.Endpoint, model domain.Model, contentType string, body []byte) (*http.Request, error) {
+	return p.newEndpointRequest(ctx, p.baseURL+"/"+string(endpoint), contentType, body)
+}
+
+// newEndpointRequest is newRequest for bodies that may not be JSON; the
+// client's content type (e.g. with its multipart boundary) is kept.
+func (p *OpenAIProvider) newEndpointRequest(ctx context.Context, url string, contentType string, body []byte) (*http.Request, error) {
+	req, err := p.newRequest(ctx, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func (p *OpenAIProvider) EstimateEndpointUsage(endpoint domain.Endpoint, model domain.Model, contentType string, body []byte) (*domain.Usage, error) {
+	switch endpoint {
+	case domain.EndpointResponses:
+		return p.estimateResponseUsage(model, body)
+	case domain.EndpointTranscriptions:
+		upload, err := parseMultipart(contentType, body)
+		if err != nil {
+			return nil, err
+		}
+		return p.audioUsage(model, audioSeconds(upload.fileHead, upload.fileSize))
+	case domain.EndpointSpeech:
+		var req struct {
+			Input string `json:"input"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		pricing, err := p.GetPricing(model)
+		if err != nil {
+			return nil, err
+		}
+		chars := utf8.RuneCountInString(req.Input)
+		return &domain.Usage{
+			TotalCost: float64(chars) / 1000.0 * pricing.Per1KChars,
+		}, nil
+	case domain.EndpointImages, domain.EndpointImageEdits:
+		req, err := parseImageRequest(contentType, body)
+		if err != nil {
+			return nil, err
+		}
+		return p.imageUsage(model, req.N, req.Quality, req.Size)
+	case domain.EndpointEmbeddings:
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		text, tokens := embeddingInput(req.Input)
+		if text != "" {
+			counted, err := p.CountTokens(model, text)
+			if err != nil {
+				return nil, err
+			}
+			tokens += counted
+		}
+		return p.inputUsage(model, tokens)
+	}
+	return nil, domain.ErrNotSupported
+}
+
+func (p *OpenAIProvider) ParseEndpointUsage(endpoint domain.Endpoint, model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	switch endpoint {
+	case domain.EndpointEmbeddings:
+		usage, err := parseChatUsage(responseBody)
+		if err != nil || usage == nil {
+			return nil, err
+		}
+		return p.inputUsage(model, usage.PromptTokens)
+	case domain.EndpointTranscriptions:
+		return p.parseTranscriptionUsage(model, responseBody)
+	case domain.EndpointSpeech:
+		// The response is audio; the estimate from the input text is exact.
+		return nil, nil
+	case domain.EndpointImages, domain.EndpointImageEdits:
+		return p.parseImageUsage(model, responseBody)
+	case domain.EndpointResponses:
+		return p.parseResponseUsage(model, responseBody)
+	}
+	return nil, domain.ErrNotSupported
+}
+
+// parseTranscriptionUsage reads the usage of a JSON transcription response.
+// Whisper reports the audio duration, while the GPT-4o transcribe models
+// report tokens. Plain text formats carry no usage, so nil is returned and
+// the estimate stands.
+func (p *OpenAIProvider) parseTranscriptionUsage(model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	var resp struct {
+		Duration float64 `json:"duration"`
+		Usage    *struct {
+			Type         string  `json:"type"`
+			Seconds      float64 `json:"seconds"`
+			InputTokens  int     `json:"input_tokens"`
+			OutputTokens int     `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(responseBody, &resp); err != nil {
+		return nil, nil
+	}
+
+	switch {
+	case resp.Usage != nil && resp.Usage.Type == "tokens":
+		pricing, err := p.GetPricing(model)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.Usage{
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+			TotalCost:    (float64(resp.Usage.InputTokens)/1000.0)*pricing.Input + (float64(resp.Usage.OutputTokens)/1000.0)*pricing.Output,
+		}, nil
+	case resp.Usage != nil && resp.Usage.Type == "duration":
+		return p.audioUsage(model, resp.Usage.Seconds)
+	case resp.Duration > 0:
+		return p.audioUsage(model, resp.Duration)
+	}
+	return nil, nil
+}
+
+// parseImageUsage prices the images in a response. Only the GPT image models
+// report the quality and size they rendered; for the others nil is returned
+// and the estimate from the request parameters stands.
+func (p *OpenAIProvider) parseImageUsage(model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	var resp struct {
+		Data    []json.RawMessage `json:"data"`
+		Quality string            `json:"quality"`
+		Size    string            `json:"size"`
+	}
+	if err := json.Unmarshal(responseBody, &resp); err != nil || resp.Quality == "" || resp.Size == "" {
+		return nil, nil
+	}
+	return p.imageUsage(model, len(resp.Data), resp.Quality, resp.Size)
+}
+
+// imageUsage prices n images of the given quality and size.
+func (p *OpenAIProvider) imageUsage(model domain.Model, n int, quality, size string) (*domain.Usage, error) {
+	pricing, err := p.GetPricing(model)
+	if err != nil {
+		return nil, err
+	}
+	price, err := imagePrice(pricing.PerImage, quality, size)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Usage{
+		TotalCost: float64(n) * price,
+	}, nil
+}
+
+// audioUsage prices seconds of input audio.
+func (p *OpenAIProvider) audioUsage(model domain.Model, seconds float64) (*domain.Usage, error) {
+	pricing, err := p.GetPricing(model)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Usage{
+		TotalCost: seconds * pricing.PerSecond,
+	}, nil
+}
+
+func (p *OpenAIProvider) PreparePassThroughRequest(ctx context.Context, method, path, contentType string, body []byte) (*http.Request, error) {
+	req, err := newPassThroughRequest(ctx, method, p.baseURL+"/"+path, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	p.setAuth(req)
+	return req, nil
+}
+
+func (p *OpenAIProvider) ParsePassThroughUsage(model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	responseModel, usage, err := parsePassThroughUsage(responseBody)
+	if err != nil || usage == nil {
+		return nil, err
+	}
+	if model == "" {
+		model = responseModel
+	}
+	pricing, err := p.GetPricing(model)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalCost:    (float64(usage.PromptTokens)/1000.0)*pricing.Input + (float64(usage.CompletionTokens)/1000.0)*pricing.Output,
+	}, nil
+}
+
+// inputUsage prices tokens that are only billed as input.
+func (p *OpenAIProvider) inputUsage(model domain.Model, tokens int) (*domain.Usage, error) {
+	pricing, err := p.GetPricing(model)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Usage{
+		InputTokens: tokens,
+		TotalCost:   float64(tokens) / 1000.0 * pricing.Input,
+	}, nil
+}
+
+// embeddingInput reads an embeddings "input", which may be a string, an
+// array of strings, or pre-tokenized arrays of token IDs. It returns the text
+// to tokenize and the number of tokens that were passed pre-tokenized.
+func embeddingInput(raw json.RawMessage) (string, int) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, 0
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.Join(list, "\n"), 0
+	}
+	var tokens []int
+	if err := json.Unmarshal(raw, &tokens); err == nil {
+		return "", len(tokens)
+	}
+	var batches [][]int
+	if err := json.Unmarshal(raw, &batches); err == nil {
+		n := 0
+		for _, b := range batches {
+			n += len(b)
+		}
+		return "", n
+	}
+	return "", 0
+}
@@ -0,0 +1,235 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"mime/multipart"
+	"pouch-ai/backend/domain"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIProvider_Embeddings(t *testing.T) {
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	p := NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, &approxCounter{})
+
+	if !p.SupportsEndpoint(domain.EndpointEmbeddings) {
+		t.Fatal("expected embeddings to be supported")
+	}
+
+	req, err := p.PrepareEndpointRequest(context.Background(), domain.EndpointEmbeddings, "text-embedding-3-small", "", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("PrepareEndpointRequest failed: %v", err)
+	}
+	if req.URL.String() != "http://openai.local/v1/embeddings" || req.Header.Get("Authorization") != "Bearer test-key" {
+		t.Errorf("unexpected request: %s %v", req.URL, req.Header)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		tokens int
+	}{
+		{"string", `{"input": "0123456789abcdef"}`, 4},
+		{"string array", `{"input": ["0123456789", "abcdef"]}`, 4},
+		{"token array", `{"input": [1, 2, 3]}`, 3},
+		{"token arrays", `{"input": [[1, 2], [3, 4, 5]]}`, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := p.EstimateEndpointUsage(domain.EndpointEmbeddings, "text-embedding-3-small", "application/json", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("EstimateEndpointUsage failed: %v", err)
+			}
+			if usage.InputTokens != tt.tokens {
+				t.Errorf("expected %d tokens, got %d", tt.tokens, usage.InputTokens)
+			}
+		})
+	}
+
+	usage, err := p.ParseEndpointUsage(domain.EndpointEmbeddings, "text-embedding-3-large", []byte(`{"object": "list", "data": [], "usage": {"prompt_tokens": 2000, "total_tokens": 2000}}`))
+	if err != nil {
+		t.Fatalf("ParseEndpointUsage failed: %v", err)
+	}
+	if usage.InputTokens != 2000 || fmt.Sprintf("%.5f", usage.TotalCost) != "0.00026" {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+// newTranscriptionBody builds a multipart transcription request with a
+// 16 kHz, 16-bit mono WAV file of the given duration.
+func newTranscriptionBody(t *testing.T, model string, seconds int) (string, []byte) {
+	t.Helper()
+	const byteRate = 32000
+	wav := make([]byte, wavHeaderSize+seconds*byteRate)
+	copy(wav[0:4], "RIFF")
+	copy(wav[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(wav[28:32], byteRate)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("model", model)
+	fw, err := w.CreateFormFile("file", "speech.wav")
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	fw.Write(wav)
+	w.WriteField("response_format", "json")
+	w.Close()
+	return w.FormDataContentType(), buf.Bytes()
+}
+
+func TestOpenAIProvider_Transcriptions(t *testing.T) {
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	p := NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, &approxCounter{})
+	contentType, body := newTranscriptionBody(t, "whisper-1", 60)
+
+	model, _, err := p.ParseEndpointRequest(domain.EndpointTranscriptions, contentType, body)
+	if err != nil || model != "whisper-1" {
+		t.Fatalf("ParseEndpointRequest = %q, %v", model, err)
+	}
+
+	req, err := p.PrepareEndpointRequest(context.Background(), domain.EndpointTranscriptions, model, contentType, body)
+	if err != nil {
+		t.Fatalf("PrepareEndpointRequest failed: %v", err)
+	}
+	if req.URL.String() != "http://openai.local/v1/audio/transcriptions" || req.Header.Get("Content-Type") != contentType {
+		t.Errorf("unexpected request: %s %v", req.URL, req.Header)
+	}
+
+	// 60 seconds of WAV at $0.0001/s
+	usage, err := p.EstimateEndpointUsage(domain.EndpointTranscriptions, model, contentType, body)
+	if err != nil {
+		t.Fatalf("EstimateEndpointUsage failed: %v", err)
+	}
+	if fmt.Sprintf("%.4f", usage.TotalCost) != "0.0060" {
+		t.Errorf("expected estimated cost 0.0060, got %f", usage.TotalCost)
+	}
+
+	tests := []struct {
+		name  string
+		model domain.Model
+		resp  string
+		cost  string
+	}{
+		{"duration usage", "whisper-1", `{"text": "hi", "usage": {"type": "duration", "seconds": 30}}`, "0.003000"},
+		{"verbose json", "whisper-1", `{"text": "hi", "duration": 12.5}`, "0.001250"},
+		{"token usage", "gpt-4o-transcribe", `{"text": "hi", "usage": {"type": "tokens", "input_tokens": 1000, "output_tokens": 100}}`, "0.003500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := p.ParseEndpointUsage(domain.EndpointTranscriptions, tt.model, []byte(tt.resp))
+			if err != nil || usage == nil {
+				t.Fatalf("ParseEndpointUsage = %v, %v", usage, err)
+			}
+			if got := fmt.Sprintf("%.6f", usage.TotalCost); got != tt.cost {
+				t.Errorf("expected cost %s, got %s", tt.cost, got)
+			}
+		})
+	}
+
+	// Text responses carry no usage; the estimate stands
+	if usage, err := p.ParseEndpointUsage(domain.EndpointTranscriptions, "whisper-1", []byte("hello world")); usage != nil || err != nil {
+		t.Errorf("expected no usage for text responses, got %v, %v", usage, err)
+	}
+}
+
+func TestOpenAIProvider_Speech(t *testing.T) {
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	p := NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, &approxCounter{})
+	body := []byte(`{"model": "tts-1-hd", "voice": "alloy", "input": "` + strings.Repeat("é", 500) + `"}`)
+
+	model, _, err := p.ParseEndpointRequest(domain.EndpointSpeech, "application/json", body)
+	if err != nil || model != "tts-1-hd" {
+		t.Fatalf("ParseEndpointRequest = %q, %v", model, err)
+	}
+
+	// 500 characters at $0.03 per 1k
+	usage, err := p.EstimateEndpointUsage(domain.EndpointSpeech, model, "application/json", body)
+	if err != nil {
+		t.Fatalf("EstimateEndpointUsage failed: %v", err)
+	}
+	if fmt.Sprintf("%.3f", usage.TotalCost) != "0.015" {
+		t.Errorf("expected cost 0.015, got %f", usage.TotalCost)
+	}
+}
+
+func TestOpenAIProvider_Images(t *testing.T) {
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	p := NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, &approxCounter{})
+
+	tests := []struct {
+		name  string
+		body  string
+		model domain.Model
+		cost  string
+	}{
+		{"defaults", `{"prompt": "a cat"}`, "dall-e-2", "0.020"},
+		{"dall-e-3 default quality", `{"model": "dall-e-3", "prompt": "a cat", "size": "1792x1024"}`, "dall-e-3", "0.080"},
+		{"dall-e-3 hd", `{"model": "dall-e-3", "prompt": "a cat", "quality": "hd", "n": 2}`, "dall-e-3", "0.160"},
+		{"gpt-image auto quality", `{"model": "gpt-image-1", "prompt": "a cat", "size": "1024x1536"}`, "gpt-image-1", "0.250"},
+		{"gpt-image auto size", `{"model": "gpt-image-1", "prompt": "a cat", "quality": "low", "size": "auto", "n": 3}`, "gpt-image-1", "0.048"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, _, err := p.ParseEndpointRequest(domain.EndpointImages, "application/json", []byte(tt.body))
+			if err != nil || model != tt.model {
+				t.Fatalf("ParseEndpointRequest = %q, %v", model, err)
+			}
+			usage, err := p.EstimateEndpointUsage(domain.EndpointImages, model, "application/json", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("EstimateEndpointUsage failed: %v", err)
+			}
+			if got := fmt.Sprintf("%.3f", usage.TotalCost); got != tt.cost {
+				t.Errorf("expected cost %s, got %s", tt.cost, got)
+			}
+		})
+	}
+
+	if _, err := p.EstimateEndpointUsage(domain.EndpointImages, "dall-e-2", "application/json", []byte(`{"size": "4096x4096"}`)); err == nil {
+		t.Error("expected an error for an unpriced size")
+	}
+
+	// Edits are multipart; the price comes from the form fields
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("model", "dall-e-2")
+	w.WriteField("n", "4")
+	w.WriteField("size", "512x512")
+	fw, _ := w.CreateFormFile("image", "cat.png")
+	fw.Write([]byte("png"))
+	w.Close()
+	usage, err := p.EstimateEndpointUsage(domain.EndpointImageEdits, "dall-e-2", w.FormDataContentType(), buf.Bytes())
+	if err != nil {
+		t.Fatalf("EstimateEndpointUsage failed: %v", err)
+	}
+	if fmt.Sprintf("%.3f", usage.TotalCost) != "0.072" {
+		t.Errorf("expected cost 0.072, got %f", usage.TotalCost)
+	}
+
+	// GPT image responses report what was rendered
+	usage, err = p.ParseEndpointUsage(domain.EndpointImages, "gpt-image-1", []byte(`{"data": [{"b64_json": "x"}, {"b64_json": "y"}], "quality": "medium", "size": "1024x1024"}`))
+	if err != nil || usage == nil {
+		t.Fatalf("ParseEndpointUsage = %v, %v", usage, err)
+	}
+	if fmt.Sprintf("%.3f", usage.TotalCost) != "0.084" {
+		t.Errorf("expected cost 0.084, got %f", usage.TotalCost)
+	}
+	if usage, err := p.ParseEndpointUsage(domain.EndpointImages, "dall-e-3", []byte(`{"data": [{"url": "https://x"}]}`)); usage != nil || err != nil {
+		t.Errorf("expected the estimate to stand, got %v, %v", usage, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -17,11 +18,25 @@ type TokenCounter interface {
 	Count(model string, text string) (int, error)
 }
 
+const defaultOpenAIURL = "https://api.openai.com/v1"
+
 type OpenAIProvider struct {
-	pricing      *OpenAIPricing
+	name         string
+	title        string
+	pricing      *PricingTable
 	tokenCounter TokenCounter
 	apiKey       string
 	baseURL      string
+	defaultURL   string
+	authHeader   string
+	authScheme   string
+	// billing reports whether the upstream serves the OpenAI billing API
+	// used by GetUsage; OpenAI-compatible servers generally do not.
+	billing bool
+	// responses is shared by configured copies of the provider.
+	responses *responseStore
+	// fallback, if set, prices models missing from the pricing table.
+	fallback *domain.Pricing
 }
 
 type OpenAIBuilder struct{}
@@ -55,18 +70,25 @@ func (b *OpenAIBuilder) Build(ctx context.Context, cfg *config.Config) (domain.P
 	return NewOpenAIProvider(apiKey, apiURL, pricing, tokenCounter), nil
 }
 
-func NewOpenAIProvider(apiKey string, baseURL string, pricing *OpenAIPricing, counter TokenCounter) *OpenAIProvider {
+func NewOpenAIProvider(apiKey string, baseURL string, pricing *PricingTable, counter TokenCounter) *OpenAIProvider {
 	if baseURL == "" {
-		baseURL = "https://api.openai.com/v1"
+		baseURL = defaultOpenAIURL
 	}
 	// Ensure no trailing slash
 	baseURL = strings.TrimSuffix(baseURL, "/")
 
 	return &OpenAIProvider{
+		name:         "openai",
+		title:        "OpenAI",
 		apiKey:       apiKey,
 		baseURL:      baseURL,
+		defaultURL:   defaultOpenAIURL,
+		authHeader:   "Authorization",
+		authScheme:   "Bearer",
+		billing:      true,
 		pricing:      pricing,
 		tokenCounter: counter,
+		responses:    newResponseStore(),
 	}
 }
 
@@ -75,13 +97,15 @@ func (p *OpenAIProvider) Schema() domain.PluginSchema {
 		"api_key": {
 			Type:        domain.FieldTypeString,
 			DisplayName: "API Key",
-			Description: "Your OpenAI API Key",
+			Description: fmt.Sprintf("Your %s API Key", p.title),
+			Role:        domain.FieldRoleCredential,
 		},
 		"base_url": {
 			Type:        domain.FieldTypeString,
 			DisplayName: "Base URL",
-			Default:     "https://api.openai.com/v1",
-			Description: "OpenAI API Base URL",
+			Default:     p.defaultURL,
+			Description: fmt.Sprintf("%s API Base URL", p.title),
+			Role:        domain.FieldRoleCredential,
 		},
 	}
 }
@@ -89,30 +113,43 @@ func (p *OpenAIProvider) Schema() domain.PluginSchema {
 func (p *OpenAIProvider) Configure(config map[string]any) (domain.Provider, error) {
 	newP := *p
 	if val, ok := config["api_key"]; ok {
-		if s, ok := val.(string); ok {
+		if s, ok := val.(string); ok && s != "" {
 			newP.apiKey = s
 		}
 	}
 	if val, ok := config["base_url"]; ok {
-		if s, ok := val.(string); ok {
+		if s, ok := val.(string); ok && s != "" {
 			newP.baseURL = strings.TrimSuffix(s, "/")
 		}
 	}
 	return &newP, nil
 }
 
+func (p *OpenAIProvider) WithFallbackPricing(pricing domain.Pricing) domain.Provider {
+	newP := *p
+	newP.fallback = &pricing
+	return &newP
+}
+
 func (p *OpenAIProvider) Name() string {
-	return "openai"
+	return p.name
 }
 
 func (p *OpenAIProvider) GetPricing(model domain.Model) (domain.Pricing, error) {
 	mp, err := p.pricing.GetPrice(string(model))
+	if errors.Is(err, domain.ErrUnknownModel) && p.fallback != nil {
+		return *p.fallback, nil
+	}
 	if err != nil {
 		return domain.Pricing{}, err
 	}
 	return domain.Pricing{
-		Input:  mp.Input,
-		Output: mp.Output,
+		Input:           mp.Input,
+		Output:          mp.Output,
+		PerSecond:       mp.PerSecond,
+		Per1KChars:      mp.Per1KChars,
+		PerImage:        mp.Images,
+		MaxOutputTokens: mp.MaxOutputTokens,
 	}, nil
 }
 
@@ -121,6 +158,12 @@ func (p *OpenAIProvider) CountTokens(model domain.Model, text string) (int, erro
 }
 
 func (p *OpenAIProvider) PrepareHTTPRequest(ctx context.Context, model domain.Model, body []byte) (*http.Request, error) {
+	return p.newRequest(ctx, p.baseURL+"/chat/completions", body)
+}
+
+// newRequest builds an authenticated JSON request to url and, for chat
+// streams, asks the upstream to report usage at the end of the stream.
+func (p *OpenAIProvider) newRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
 	// Inject stream_options: {include_usage: true} if streaming
 	var reqMap map[string]any
 	if err := json.Unmarshal(body, &reqMap); err == nil {
@@ -132,35 +175,22 @@ func (p *OpenAIProvider) PrepareHTTPRequest(ctx context.Context, model domain.Mo
 		}
 	}
 
-	url := p.baseURL + "/chat/completions"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	}
+	p.setAuth(req)
 	return req, nil
 }
 
 func (p *OpenAIProvider) EstimateUsage(model domain.Model, body []byte) (*domain.Usage, error) {
-	var req struct {
-		Model    string `json:"model"`
-		Messages []struct {
-			Content string `json:"content"`
-		} `json:"messages"`
-	}
+	var req chatRequest
 	if err := json.Unmarshal(body, &req); err != nil {
 		return nil, err
 	}
 
-	var inputBuilder strings.Builder
-	for _, m := range req.Messages {
-		inputBuilder.WriteString(m.Content)
-	}
-
-	inputTokens, err := p.CountTokens(model, inputBuilder.String())
+	inputTokens, err := p.CountTokens(model, req.requestText())
 	if err != nil {
 		return nil, err
 	}
@@ -170,10 +200,7 @@ func (p *OpenAIProvider) EstimateUsage(model domain.Model, body []byte) (*domain
 		return nil, err
 	}
 
-	return &domain.Usage{
-		InputTokens: inputTokens,
-		TotalCost:   float64(inputTokens) / 1000.0 * pricing.Input,
-	}, nil
+	return estimateChatUsage(inputTokens, req.outputTokens(0, pricing), pricing), nil
 }
 
 func (p *OpenAIProvider) ParseOutputUsage(model domain.Model, responseBody []byte, isStream bool) (int, error) {
@@ -215,21 +242,29 @@ func (p *OpenAIProvider) ParseStreamChunk(model domain.Model, chunk []byte) (str
 	dataBytes := bytes.TrimPrefix(chunk, []byte("data: "))
 
 	var streamChunk struct {
+		// Type is set on Responses API events
+		Type    string `json:"type"`
 		Choices []struct {
 			Delta struct {
 				Content string `json:"content"`
 			} `json:"delta"`
 		} `json:"choices"`
 		Usage *struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
+			PromptTokens            int `json:"prompt_tokens"`
+			CompletionTokens        int `json:"completion_tokens"`
+			TotalTokens             int `json:"total_tokens"`
+			CompletionTokensDetails struct {
+				ReasoningTokens int `json:"reasoning_tokens"`
+			} `json:"completion_tokens_details"`
 		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(dataBytes, &streamChunk); err != nil {
 		return "", 0, nil, err
 	}
+	if strings.HasPrefix(streamChunk.Type, "response.") {
+		return p.parseResponseEvent(model, dataBytes)
+	}
 
 	content := ""
 	if len(streamChunk.Choices) > 0 {
@@ -240,9 +275,10 @@ func (p *OpenAIProvider) ParseStreamChunk(model domain.Model, chunk []byte) (str
 	if streamChunk.Usage != nil {
 		pricing, _ := p.GetPricing(model)
 		usage = &domain.Usage{
-			InputTokens:  streamChunk.Usage.PromptTokens,
-			OutputTokens: streamChunk.Usage.CompletionTokens,
-			TotalCost:    (float64(streamChunk.Usage.PromptTokens) / 1000.0 * pricing.Input) + (float64(streamChunk.Usage.CompletionTokens) / 1000.0 * pricing.Output),
+			InputTokens:     streamChunk.Usage.PromptTokens,
+			OutputTokens:    streamChunk.Usage.CompletionTokens,
+			ReasoningTokens: streamChunk.Usage.CompletionTokensDetails.ReasoningTokens,
+			TotalCost:       (float64(streamChunk.Usage.PromptTokens) / 1000.0 * pricing.Input) + (float64(streamChunk.Usage.CompletionTokens) / 1000.0 * pricing.Output),
 		}
 	}
 
@@ -265,17 +301,38 @@ func (p *OpenAIProvider) ParseRequest(body []byte) (domain.Model, bool, error) {
 	return domain.Model(req.Model), req.Stream, nil
 }
 
+func (p *OpenAIProvider) setAuth(req *http.Request) {
+	if p.apiKey == "" {
+		return
+	}
+	if p.authScheme == "" {
+		req.Header.Set(p.authHeader, p.apiKey)
+		return
+	}
+	req.Header.Set(p.authHeader, p.authScheme+" "+p.apiKey)
+}
+
 func (p *OpenAIProvider) GetUsage(ctx context.Context) (float64, error) {
 	now := time.Now()
-	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
-	end := now.Format("2006-01-02")
+	return p.GetBilledUsage(ctx, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), now)
+}
+
+// GetBilledUsage returns the cost reported by the billing API, whose end
+// date is exclusive.
+func (p *OpenAIProvider) GetBilledUsage(ctx context.Context, from, to time.Time) (float64, error) {
+	if !p.billing {
+		return 0, domain.ErrNotSupported
+	}
+
+	start := from.UTC().Format(time.DateOnly)
+	end := to.UTC().Format(time.DateOnly)
 
 	url := fmt.Sprintf("%s/dashboard/billing/usage?start_date=%s&end_date=%s", p.baseURL, start, end)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setAuth(req)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -297,3 +354,13 @@ func (p *OpenAIProvider) GetUsage(ctx context.Context) (float64, error) {
 
 	return data.TotalUsage / 100.0, nil // Convert cents to dollars
 }
+
+// ListModels returns the models served by the upstream /models API.
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]domain.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setAuth(req)
+	return fetchModelIDs(req, p.name)
+}
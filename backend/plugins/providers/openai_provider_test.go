@@ -3,6 +3,7 @@ package providers
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -51,3 +52,39 @@ func TestOpenAIProvider_GetUsage_UsesBaseURL(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenAIProvider_EstimateUsage_OutputCap(t *testing.T) {
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	p := NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, &approxCounter{})
+
+	tests := []struct {
+		name   string
+		body   string
+		output int
+	}{
+		{"max_tokens", `{"model": "gpt-4o", "max_tokens": 1000, "messages": [{"role": "user", "content": "01234567"}]}`, 1000},
+		{"max_completion_tokens", `{"model": "gpt-4o", "max_tokens": 1000, "max_completion_tokens": 500, "messages": [{"role": "user", "content": "01234567"}]}`, 500},
+		{"model default", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "01234567"}]}`, 16384},
+		{"above model limit", `{"model": "gpt-4o", "max_tokens": 100000, "messages": [{"role": "user", "content": "01234567"}]}`, 16384},
+		{"array content", `{"model": "gpt-4o", "max_tokens": 1000, "messages": [{"role": "user", "content": [{"type": "text", "text": "0123"}, {"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}, {"type": "text", "text": "4567"}]}]}`, 1000},
+		{"n choices", `{"model": "gpt-4o", "max_tokens": 1000, "n": 3, "messages": [{"role": "user", "content": "01234567"}]}`, 3000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := p.EstimateUsage("gpt-4o", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("EstimateUsage failed: %v", err)
+			}
+			if usage.InputTokens != 2 || usage.OutputTokens != tt.output {
+				t.Errorf("expected 2 input and %d output tokens, got %d and %d", tt.output, usage.InputTokens, usage.OutputTokens)
+			}
+			want := 2/1000.0*0.005 + float64(tt.output)/1000.0*0.015
+			if math.Abs(usage.TotalCost-want) > 1e-9 {
+				t.Errorf("expected cost %f, got %f", want, usage.TotalCost)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package providers
+
+import (
+	"encoding/json"
+	"pouch-ai/backend/domain"
+	"strings"
+	"sync"
+)
+
+// The OpenAI Responses API takes "instructions" and "input" instead of chat
+// messages, reports usage as input/output tokens, and streams typed events
+// (e.g. response.output_text.delta) rather than chat completion chunks.
+
+// responseStoreLimit bounds the number of responses remembered for
+// previous_response_id lookups.
+const responseStoreLimit = 1000
+
+// responseStore remembers the conversation size behind recent responses. A
+// request continuing one with previous_response_id is billed for that
+// conversation again as input, so the reservation has to include it.
+type responseStore struct {
+	mu     sync.Mutex
+	tokens map[string]int
+	order  []string
+}
+
+func newResponseStore() *responseStore {
+	return &responseStore{tokens: make(map[string]int)}
+}
+
+func (s *responseStore) put(id string, tokens int) {
+	if s == nil || id == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[id]; !ok {
+		s.order = append(s.order, id)
+		if len(s.order) > responseStoreLimit {
+			delete(s.tokens, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	s.tokens[id] = tokens
+}
+
+func (s *responseStore) get(id string) int {
+	if s == nil || id == "" {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[id]
+}
+
+type responseUsage struct {
+	InputTokens         int `json:"input_tokens"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+}
+
+type responseObject struct {
+	ID    string         `json:"id"`
+	Usage *responseUsage `json:"usage"`
+}
+
+type responseEvent struct {
+	Type     string          `json:"type"`
+	Delta    string          `json:"delta"`
+	Response *responseObject `json:"response"`
+}
+
+func (p *OpenAIProvider) estimateResponseUsage(model domain.Model, body []byte) (*domain.Usage, error) {
+	var req struct {
+		Instructions       string          `json:"instructions"`
+		Input              json.RawMessage `json:"input"`
+		PreviousResponseID string          `json:"previous_response_id"`
+		MaxOutputTokens    int             `json:"max_output_tokens"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := p.CountTokens(model, req.Instructions+responseInputText(req.Input))
+	if err != nil {
+		return nil, err
+	}
+	pricing, err := p.GetPricing(model)
+	if err != nil {
+		return nil, err
+	}
+	return estimateChatUsage(tokens+p.responses.get(req.PreviousResponseID), outputCap(req.MaxOutputTokens, 0, pricing), pricing), nil
+}
+
+// responseInputText flattens a Responses API "input", which is either a
+// string or a list of items (messages with string or part content, tool
+// call outputs, ...).
+func responseInputText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var items []struct {
+		Content   json.RawMessage `json:"content"`
+		Output    string          `json:"output"`
+		Arguments string          `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, item := range items {
+		if err := json.Unmarshal(item.Content, &s); err == nil {
+			b.WriteString(s)
+		} else {
+			var parts []struct {
+				Text string `json:"text"`
+			}
+			_ = json.Unmarshal(item.Content, &parts)
+			for _, part := range parts {
+				b.WriteString(part.Text)
+			}
+		}
+		b.WriteString(item.Output)
+		b.WriteString(item.Arguments)
+	}
+	return b.String()
+}
+
+func (p *OpenAIProvider) parseResponseUsage(model domain.Model, responseBody []byte) (*domain.Usage, error) {
+	var resp responseObject
+	if err := json.Unmarshal(responseBody, &resp); err != nil || resp.Usage == nil {
+		return nil, err
+	}
+	return p.responseUsage(model, &resp), nil
+}
+
+// parseResponseEvent meters one event of a streamed response. Text deltas
+// are counted as they arrive; the final event carries the exact usage.
+func (p *OpenAIProvider) parseResponseEvent(model domain.Model, data []byte) (string, int, *domain.Usage, error) {
+	var event responseEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", 0, nil, err
+	}
+
+	switch event.Type {
+	case "response.output_text.delta":
+		tokens, _ := p.CountTokens(model, event.Delta)
+		return event.Delta, tokens, nil, nil
+	case "response.refusal.delta", "response.function_call_arguments.delta", "response.reasoning_summary_text.delta":
+		tokens, _ := p.CountTokens(model, event.Delta)
+		return "", tokens, nil, nil
+	case "response.completed", "response.incomplete", "response.failed":
+		if event.Response != nil && event.Response.Usage != nil {
+			return "", 0, p.responseUsage(model, event.Response), nil
+		}
+	}
+	return "", 0, nil, nil
+}
+
+// responseUsage prices a finished response and remembers its conversation
+// size for follow-up requests. Reasoning is billed as output but is not
+// carried over into the next turn's input.
+func (p *OpenAIProvider) responseUsage(model domain.Model, resp *responseObject) *domain.Usage {
+	u := resp.Usage
+	reasoning := u.OutputTokensDetails.ReasoningTokens
+	p.responses.put(resp.ID, u.InputTokens+u.OutputTokens-reasoning)
+
+	pricing, _ := p.GetPricing(model)
+	return &domain.Usage{
+		InputTokens:     u.InputTokens,
+		OutputTokens:    u.OutputTokens,
+		ReasoningTokens: reasoning,
+		TotalCost:       (float64(u.InputTokens) / 1000.0 * pricing.Input) + (float64(u.OutputTokens) / 1000.0 * pricing.Output),
+	}
+}
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"fmt"
+	"pouch-ai/backend/domain"
+	"testing"
+)
+
+func newTestResponsesProvider(t *testing.T) *OpenAIProvider {
+	t.Helper()
+	pricing, err := NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	return NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, &approxCounter{})
+}
+
+func TestOpenAIProvider_ResponsesEstimate(t *testing.T) {
+	p := newTestResponsesProvider(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		tokens int
+	}{
+		{"string input", `{"model": "gpt-4o", "instructions": "0123", "input": "456789ab"}`, 3},
+		{"items", `{"model": "gpt-4o", "input": [
+			{"role": "user", "content": "0123"},
+			{"role": "user", "content": [{"type": "input_text", "text": "4567"}]},
+			{"type": "function_call_output", "call_id": "c1", "output": "89ab"}
+		]}`, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := p.EstimateEndpointUsage(domain.EndpointResponses, "gpt-4o", "application/json", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("EstimateEndpointUsage failed: %v", err)
+			}
+			if usage.InputTokens != tt.tokens {
+				t.Errorf("expected %d tokens, got %d", tt.tokens, usage.InputTokens)
+			}
+		})
+	}
+}
+
+func TestOpenAIProvider_ResponsesUsage(t *testing.T) {
+	p := newTestResponsesProvider(t)
+
+	usage, err := p.ParseEndpointUsage(domain.EndpointResponses, "gpt-4o", []byte(`{"id": "resp_1", "object": "response",
+		"usage": {"input_tokens": 1000, "output_tokens": 1000, "output_tokens_details": {"reasoning_tokens": 400}}}`))
+	if err != nil || usage == nil {
+		t.Fatalf("ParseEndpointUsage = %v, %v", usage, err)
+	}
+	// Reasoning is part of the output: 1k input at $0.005 and 1k output at $0.015
+	if usage.ReasoningTokens != 400 || fmt.Sprintf("%.3f", usage.TotalCost) != "0.020" {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	// A follow-up is billed for the stored conversation, without the reasoning
+	estimate, err := p.EstimateEndpointUsage(domain.EndpointResponses, "gpt-4o", "application/json",
+		[]byte(`{"model": "gpt-4o", "input": "0123", "previous_response_id": "resp_1"}`))
+	if err != nil {
+		t.Fatalf("EstimateEndpointUsage failed: %v", err)
+	}
+	if estimate.InputTokens != 1601 {
+		t.Errorf("expected 1601 input tokens, got %d", estimate.InputTokens)
+	}
+
+	// Configured copies share what they have seen
+	configured, _ := p.Configure(map[string]any{"api_key": "other"})
+	estimate, _ = configured.(*OpenAIProvider).EstimateEndpointUsage(domain.EndpointResponses, "gpt-4o", "application/json",
+		[]byte(`{"model": "gpt-4o", "input": "", "previous_response_id": "resp_1"}`))
+	if estimate.InputTokens != 1600 {
+		t.Errorf("expected 1600 input tokens from a configured copy, got %d", estimate.InputTokens)
+	}
+}
+
+func TestOpenAIProvider_ResponsesStream(t *testing.T) {
+	p := newTestResponsesProvider(t)
+
+	content, tokens, usage, err := p.ParseStreamChunk("o3-mini", []byte(`data: {"type": "response.output_text.delta", "item_id": "msg_1", "delta": "Hello world!"}`))
+	if err != nil || content != "Hello world!" || tokens != 3 || usage != nil {
+		t.Errorf("unexpected delta: %q, %d, %v, %v", content, tokens, usage, err)
+	}
+
+	// Event lines and other events are not metered
+	for _, line := range []string{"event: response.created", `data: {"type": "response.created", "response": {"id": "resp_2"}}`} {
+		if _, tokens, usage, err := p.ParseStreamChunk("o3-mini", []byte(line)); tokens != 0 || usage != nil || err != nil {
+			t.Errorf("unexpected metering of %q: %d, %v, %v", line, tokens, usage, err)
+		}
+	}
+
+	_, _, usage, err = p.ParseStreamChunk("gpt-4o", []byte(`data: {"type": "response.completed", "response": {"id": "resp_2",
+		"usage": {"input_tokens": 2000, "output_tokens": 500, "output_tokens_details": {"reasoning_tokens": 300}}}}`))
+	if err != nil || usage == nil {
+		t.Fatalf("expected usage from response.completed, got %v, %v", usage, err)
+	}
+	if usage.InputTokens != 2000 || usage.OutputTokens != 500 || usage.ReasoningTokens != 300 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+	if fmt.Sprintf("%.4f", usage.TotalCost) != "0.0175" {
+		t.Errorf("expected cost 0.0175, got %f", usage.TotalCost)
+	}
+
+	// Chat completion chunks report reasoning tokens too
+	_, _, usage, _ = p.ParseStreamChunk("gpt-4o", []byte(`data: {"choices": [], "usage": {"prompt_tokens": 10, "completion_tokens": 20, "completion_tokens_details": {"reasoning_tokens": 15}}}`))
+	if usage == nil || usage.ReasoningTokens != 15 {
+		t.Errorf("expected reasoning tokens from chat usage, got %+v", usage)
+	}
+}
@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"pouch-ai/backend/domain"
+)
+
+// newPassThroughRequest builds a verbatim upstream request; the provider adds
+// its own authentication.
+func newPassThroughRequest(ctx context.Context, method, url, contentType string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// parsePassThroughUsage reads the model and token usage of an arbitrary JSON
+// response. Both the chat completions field names and the input/output names
+// of the Responses and Anthropic APIs are accepted.
+func parsePassThroughUsage(body []byte) (domain.Model, *chatUsage, error) {
+	var resp struct {
+		Model string `json:"model"`
+		Usage *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			InputTokens      int `json:"input_tokens"`
+			OutputTokens     int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", nil, err
+	}
+	if resp.Usage == nil {
+		return domain.Model(resp.Model), nil, nil
+	}
+	return domain.Model(resp.Model), &chatUsage{
+		PromptTokens:     resp.Usage.PromptTokens + resp.Usage.InputTokens,
+		CompletionTokens: resp.Usage.CompletionTokens + resp.Usage.OutputTokens,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModelPrice is the USD price per 1k tokens for a model (or model prefix).
+// Audio models are priced per second of audio or per 1k input characters,
+// image models per image keyed by "quality:size". MaxOutputTokens is the
+// model's output limit, reserved when a request does not set max_tokens.
+type ModelPrice struct {
+	Input           float64            `json:"input"`
+	Output          float64            `json:"output"`
+	PerSecond       float64            `json:"per_second,omitempty"`
+	Per1KChars      float64            `json:"per_1k_chars,omitempty"`
+	Images          map[string]float64 `json:"images,omitempty"`
+	MaxOutputTokens int                `json:"max_output_tokens,omitempty"`
+}
+
+// wildcardModel is the pricing entry that matches any model.
+const wildcardModel = "*"
+
+type pricingEntry struct {
+	prefix string
+	price  ModelPrice
+}
+
+// PricingTable resolves model names to prices by exact match first, then by
+// the longest matching prefix (e.g. "gpt-4o-mini-2024-07-18" -> "gpt-4o-mini"),
+// then by the "*" wildcard entry if present.
+type PricingTable struct {
+	prices        map[string]ModelPrice
+	sortedEntries []pricingEntry
+	mu            sync.RWMutex
+}
+
+func NewPricingTable(prices map[string]ModelPrice) *PricingTable {
+	var entries []pricingEntry
+	for k, v := range prices {
+		if k == wildcardModel {
+			continue
+		}
+		entries = append(entries, pricingEntry{prefix: k, price: v})
+	}
+
+	// Sort by length descending, then lexicographically for stability
+	sort.Slice(entries, func(i, j int) bool {
+		if len(entries[i].prefix) != len(entries[j].prefix) {
+			return len(entries[i].prefix) > len(entries[j].prefix)
+		}
+		return entries[i].prefix < entries[j].prefix
+	})
+
+	return &PricingTable{
+		prices:        prices,
+		sortedEntries: entries,
+	}
+}
+
+// ParsePricingTable builds a PricingTable from a JSON object of model -> price.
+func ParsePricingTable(data []byte) (*PricingTable, error) {
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, err
+	}
+	return NewPricingTable(prices), nil
+}
+
+func (p *PricingTable) GetPrice(model string) (ModelPrice, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if price, ok := p.prices[model]; ok {
+		return price, nil
+	}
+
+	for _, entry := range p.sortedEntries {
+		if strings.HasPrefix(model, entry.prefix) {
+			return entry.price, nil
+		}
+	}
+
+	if price, ok := p.prices[wildcardModel]; ok {
+		return price, nil
+	}
+
+	return ModelPrice{}, fmt.Errorf("%w: %s", domain.ErrUnknownModel, model)
+}
+
+// Models returns the priced model names (and prefixes), without the wildcard.
+func (p *PricingTable) Models() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	models := make([]string, 0, len(p.prices))
+	for model := range p.prices {
+		if model != wildcardModel {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
@@ -7,6 +7,16 @@ import (
 func GetBuilders() []domain.ProviderBuilder {
 	return []domain.ProviderBuilder{
 		&OpenAIBuilder{},
+		&AnthropicBuilder{},
+		&GeminiBuilder{},
+		&AzureOpenAIBuilder{},
+		&BedrockBuilder{},
 		&MockBuilder{},
 	}
 }
+
+func GetSetBuilders() []domain.ProviderSetBuilder {
+	return []domain.ProviderSetBuilder{
+		&CompatibleBuilder{},
+	}
+}
@@ -0,0 +1,46 @@
+package providers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test vector "get-vanilla" from the AWS SigV4 test suite.
+func TestSignV4_GetVanilla(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("unexpected Authorization header:\n got: %s\nwant: %s", got, expected)
+	}
+	if req.Header.Get("X-Amz-Date") != "20150830T123600Z" {
+		t.Errorf("unexpected X-Amz-Date: %s", req.Header.Get("X-Amz-Date"))
+	}
+}
+
+func TestSigV4_Canonicalization(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://bedrock-runtime.us-east-1.amazonaws.com/model/"+awsURIEncode("anthropic.claude-3-haiku-20240307-v1:0")+"/converse?b=2&a=x y", nil)
+
+	if got := req.URL.EscapedPath(); got != "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse" {
+		t.Errorf("unexpected request path: %s", got)
+	}
+	// Non-S3 services sign the path encoded a second time
+	if got := sigV4URI(req); got != "/model/anthropic.claude-3-haiku-20240307-v1%253A0/converse" {
+		t.Errorf("unexpected canonical URI: %s", got)
+	}
+	if got := sigV4Query(req); got != "a=x%20y&b=2" {
+		t.Errorf("unexpected canonical query: %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// streamTranslator converts an upstream stream into OpenAI-style chat chunks.
+// next yields upstream payloads one at a time, handle returns the OpenAI chunk
+// payloads to emit for each of them, and finish (optional) may emit trailing
+// chunks once the upstream stream ends. A single "data: [DONE]" terminates
+// the translated stream.
+type streamTranslator struct {
+	next   func() ([]byte, error)
+	body   io.Closer
+	handle func(data []byte) [][]byte
+	finish func() [][]byte
+	out    bytes.Buffer
+	err    error
+}
+
+// newSSETranslator reads "data:" payloads from a server-sent event stream.
+// Event names, comments and upstream "[DONE]" markers are dropped.
+func newSSETranslator(body io.ReadCloser, handle func(data []byte) [][]byte, finish func() [][]byte) *streamTranslator {
+	src := bufio.NewReader(body)
+	next := func() ([]byte, error) {
+		for {
+			line, err := src.ReadBytes('\n')
+			line = bytes.TrimSpace(line)
+			if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+				data = bytes.TrimSpace(data)
+				if len(data) > 0 && !bytes.Equal(data, []byte("[DONE]")) {
+					return data, nil
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &streamTranslator{next: next, body: body, handle: handle, finish: finish}
+}
+
+// newJSONArrayTranslator reads the elements of a streamed JSON array.
+func newJSONArrayTranslator(src io.Reader, body io.Closer, handle func(data []byte) [][]byte, finish func() [][]byte) *streamTranslator {
+	dec := json.NewDecoder(src)
+	started := false
+	next := func() ([]byte, error) {
+		if !started {
+			started = true
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+		}
+		if !dec.More() {
+			return nil, io.EOF
+		}
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return nil, err
+		}
+		return elem, nil
+	}
+	return &streamTranslator{next: next, body: body, handle: handle, finish: finish}
+}
+
+func (t *streamTranslator) Read(p []byte) (int, error) {
+	for t.out.Len() == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		data, err := t.next()
+		if data != nil {
+			t.write(t.handle(data))
+		}
+		if err == io.EOF {
+			if t.finish != nil {
+				t.write(t.finish())
+			}
+			t.out.WriteString("data: [DONE]\n\n")
+		}
+		if err != nil {
+			t.err = err
+		}
+	}
+	return t.out.Read(p)
+}
+
+func (t *streamTranslator) Close() error {
+	return t.body.Close()
+}
+
+func (t *streamTranslator) write(chunks [][]byte) {
+	for _, chunk := range chunks {
+		t.out.WriteString("data: ")
+		t.out.Write(chunk)
+		t.out.WriteString("\n\n")
+	}
+}
+
+// encodeChunks marshals OpenAI chunks for emission by a stream translator.
+func encodeChunks(chunks ...*chatCompletion) [][]byte {
+	out := make([][]byte, 0, len(chunks))
+	for _, c := range chunks {
+		if c.Choices == nil {
+			c.Choices = []chatChoice{}
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
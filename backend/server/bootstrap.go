@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -15,6 +16,7 @@ import (
 	"pouch-ai/backend/domain"
 	"pouch-ai/backend/infra/engine"
 	"pouch-ai/backend/plugins"
+	"pouch-ai/backend/plugins/notifiers"
 	"pouch-ai/backend/service"
 	"pouch-ai/backend/util/logger"
 )
@@ -22,6 +24,8 @@ import (
 type Server struct {
 	echo *echo.Echo
 	Port int
+	// stop ends background jobs
+	stop context.CancelFunc
 }
 
 func New(cfg *config.Config, assets fs.FS) (*Server, error) {
@@ -49,11 +53,65 @@ func New(cfg *config.Config, assets fs.FS) (*Server, error) {
 	}
 
 	keyService := service.NewKeyService(keyRepo, pRegistry, mwRegistry)
+	notifier, err := notifiers.New(cfg.Alerts.Notifiers)
+	if err != nil {
+		return nil, err
+	}
+	keyService.SetAlerts(notifier, service.AlertPolicy{
+		Thresholds:         cfg.Alerts.Thresholds,
+		ProviderThresholds: cfg.Alerts.ProviderThresholds,
+	})
+	keyService.SetBillingPolicy(service.BillingPolicy{
+		DriftThreshold: cfg.BillingDriftThreshold,
+		MinDrift:       cfg.BillingDriftMin,
+	})
+
+	// Reservations still open were left by a previous run that did not settle them
+	reservationState := domain.ReservationRefunded
+	if cfg.ReservationPolicy == config.ReservationCharge {
+		reservationState = domain.ReservationCharged
+	}
+	if n, err := keyService.ReconcileReservations(context.Background(), time.Now(), reservationState); err != nil {
+		return nil, fmt.Errorf("failed to reconcile reservations: %w", err)
+	} else if n > 0 {
+		logger.L.Info("reconciled reservations from previous run", "count", n, "policy", cfg.ReservationPolicy)
+	}
+
+	// Budget periods may have ended while the server was down
+	budgetLocation, err := cfg.BudgetLocation()
+	if err != nil {
+		return nil, err
+	}
+	caps := make([]*domain.ProviderCap, len(cfg.ProviderCaps))
+	for i, c := range cfg.ProviderCaps {
+		caps[i] = &domain.ProviderCap{Provider: c.Provider, Limit: c.Limit, AlertThresholds: c.AlertThresholds}
+		if c.Period != "" {
+			caps[i].Schedule = &domain.ResetSchedule{Interval: domain.ResetInterval(c.Period), Day: c.Day, Timezone: c.Timezone}
+		}
+	}
+	if err := keyService.SetProviderCaps(context.Background(), caps, time.Now(), budgetLocation); err != nil {
+		return nil, fmt.Errorf("invalid provider caps: %w", err)
+	}
+	if n, err := keyService.ResetDueBudgets(context.Background(), time.Now(), budgetLocation); err != nil {
+		return nil, fmt.Errorf("failed to reset budgets: %w", err)
+	} else if n > 0 {
+		logger.L.Info("reset budgets whose period ended", "count", n, "timezone", cfg.BudgetTimezone)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	go keyService.RunReservationReconciler(ctx, cfg.ReservationTTL, reservationState)
+	go keyService.RunBudgetScheduler(ctx, budgetLocation)
+	go keyService.RunBillingReconciler(ctx)
 	executionHandler := engine.NewExecutionHandler(keyRepo)
 	proxyService := service.NewProxyService(executionHandler, mwRegistry, keyService)
+	proxyService.SetUnknownModelPolicy(domain.UnknownModelPolicy(cfg.UnknownModelPolicy), domain.Pricing{
+		Input:  cfg.UnknownModelInputPrice,
+		Output: cfg.UnknownModelOutputPrice,
+	})
 
 	// 4. Initialize Handlers
 	keyHandler := api.NewKeyHandler(keyService)
+	hierarchyHandler := api.NewHierarchyHandler(service.NewHierarchyService(keyRepo))
 	proxyHandler := api.NewProxyHandler(proxyService, pRegistry)
 
 	// 5. Echo Setup
@@ -87,20 +145,43 @@ func New(cfg *config.Config, assets fs.FS) (*Server, error) {
 
 	// Proxy Route
 	apiGroup.POST("/chat/completions", proxyHandler.Proxy, api.AuthMiddleware(keyService))
+	apiGroup.POST("/embeddings", proxyHandler.ProxyEndpoint(domain.EndpointEmbeddings), api.AuthMiddleware(keyService))
+	apiGroup.POST("/audio/transcriptions", proxyHandler.ProxyEndpoint(domain.EndpointTranscriptions), api.AuthMiddleware(keyService))
+	apiGroup.POST("/audio/speech", proxyHandler.ProxyEndpoint(domain.EndpointSpeech), api.AuthMiddleware(keyService))
+	apiGroup.POST("/images/generations", proxyHandler.ProxyEndpoint(domain.EndpointImages), api.AuthMiddleware(keyService))
+	apiGroup.POST("/images/edits", proxyHandler.ProxyEndpoint(domain.EndpointImageEdits), api.AuthMiddleware(keyService))
+	apiGroup.POST("/responses", proxyHandler.ProxyEndpoint(domain.EndpointResponses), api.AuthMiddleware(keyService))
+	apiGroup.GET("/models", proxyHandler.Models, api.AuthMiddleware(keyService))
+	apiGroup.Any("/*", proxyHandler.PassThrough(cfg.PassThrough), api.AuthMiddleware(keyService))
 
 	// Config Routes
 	apiGroup.GET("/config/app-keys", keyHandler.ListKeys)
 	apiGroup.POST("/config/app-keys", keyHandler.CreateKey)
 	apiGroup.PUT("/config/app-keys/:id", keyHandler.UpdateKey)
 	apiGroup.DELETE("/config/app-keys/:id", keyHandler.DeleteKey)
+	apiGroup.GET("/config/app-keys/:id/usage", keyHandler.GetKeyUsage)
 	apiGroup.GET("/config/providers", keyHandler.ListProviders)
 	apiGroup.GET("/config/providers/usage", keyHandler.GetProviderUsage)
+	apiGroup.GET("/config/providers/reconciliation", keyHandler.ReconcileBilling)
+	apiGroup.GET("/config/providers/caps", keyHandler.ListProviderCaps)
 	apiGroup.GET("/config/middlewares", keyHandler.ListMiddlewares)
+	apiGroup.GET("/config/reservations", keyHandler.ListReservations)
+	apiGroup.GET("/config/events", keyHandler.ListEvents)
+	apiGroup.GET("/config/budget-resets", keyHandler.ListBudgetResets)
+	apiGroup.GET("/config/reports/usage", keyHandler.UsageReport)
+	apiGroup.GET("/config/organizations", hierarchyHandler.ListOrganizations)
+	apiGroup.POST("/config/organizations", hierarchyHandler.CreateOrganization)
+	apiGroup.PUT("/config/organizations/:id", hierarchyHandler.UpdateOrganization)
+	apiGroup.DELETE("/config/organizations/:id", hierarchyHandler.DeleteOrganization)
+	apiGroup.GET("/config/projects", hierarchyHandler.ListProjects)
+	apiGroup.POST("/config/projects", hierarchyHandler.CreateProject)
+	apiGroup.PUT("/config/projects/:id", hierarchyHandler.UpdateProject)
+	apiGroup.DELETE("/config/projects/:id", hierarchyHandler.DeleteProject)
 
 	// UI
 	e.GET("/*", echo.WrapHandler(http.FileServer(http.FS(assets))))
 
-	return &Server{echo: e, Port: cfg.Port}, nil
+	return &Server{echo: e, Port: cfg.Port, stop: stop}, nil
 }
 
 func (s *Server) Start() error {
@@ -108,5 +189,6 @@ func (s *Server) Start() error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
 	return s.echo.Shutdown(ctx)
 }
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+	"slices"
+	"time"
+)
+
+// notifyTimeout bounds how long a notifier may take to deliver an alert.
+const notifyTimeout = 10 * time.Second
+
+// AlertPolicy holds the alert thresholds of keys that set none of their own,
+// as percentages of the key's budget.
+type AlertPolicy struct {
+	// Thresholds apply to keys whose provider has no thresholds of its own.
+	Thresholds []int
+	// ProviderThresholds are the thresholds of each provider's keys, by
+	// provider ID.
+	ProviderThresholds map[string][]int
+}
+
+// SetAlerts configures the default alert thresholds and where alerts are
+// delivered. Alerts are recorded as events even without a notifier.
+func (s *KeyService) SetAlerts(notifier domain.Notifier, policy AlertPolicy) {
+	s.notifier = notifier
+	s.alerts = policy
+}
+
+// alertThresholds returns the key's thresholds in ascending order. A soft
+// limit always alerts when the limit is reached.
+func (s *KeyService) alertThresholds(config *domain.KeyConfiguration) []int {
+	thresholds := config.AlertThresholds
+	if len(thresholds) == 0 {
+		if t, ok := s.alerts.ProviderThresholds[config.Provider.ID]; ok {
+			thresholds = t
+		} else {
+			thresholds = s.alerts.Thresholds
+		}
+	}
+
+	thresholds = slices.Clone(thresholds)
+	if config.SoftLimit && !slices.Contains(thresholds, 100) {
+		thresholds = append(thresholds, 100)
+	}
+	slices.Sort(thresholds)
+	return slices.Compact(thresholds)
+}
+
+// checkAlerts sends an alert when the usage of the key, or of its
+// provider's cap, has crossed thresholds that were not alerted on yet in the
+// current period. Only the highest one is sent when a single commit crosses
+// several.
+func (s *KeyService) checkAlerts(ctx context.Context, keyID domain.ID) {
+	marker, keyAlerts := s.repo.(domain.AlertRepository)
+	caps, capAlerts := s.repo.(domain.ProviderCapRepository)
+	if !keyAlerts && !capAlerts {
+		return
+	}
+	k, err := s.repo.GetByID(ctx, keyID)
+	if err != nil || k == nil {
+		if err != nil {
+			logger.L.Warn("failed to load key for budget alerts", "key_id", keyID, "error", err)
+		}
+		return
+	}
+	config := k.Configuration
+	if config == nil {
+		return
+	}
+	if capAlerts {
+		s.checkCapAlerts(ctx, caps, config.Provider.ID)
+	}
+	if !keyAlerts || config.BudgetLimit <= 0 {
+		return
+	}
+
+	crossed, err := crossedThreshold(s.alertThresholds(config), k.BudgetUsage/config.BudgetLimit*100, func(t int) (bool, error) {
+		return marker.MarkAlerted(ctx, k.ID, t, k.LastResetAt)
+	})
+	if err != nil {
+		logger.L.Warn("failed to record budget alert", "key_id", k.ID, "threshold", crossed, "error", err)
+		return
+	}
+	if crossed == 0 {
+		return
+	}
+
+	logger.L.Info("budget alert", "prefix", k.Prefix, "threshold", crossed, "usage", k.BudgetUsage, "limit", config.BudgetLimit)
+	s.sendAlert(ctx, &domain.Alert{
+		Scope:       domain.BudgetScopeKey,
+		KeyID:       k.ID,
+		KeyName:     k.Name,
+		KeyPrefix:   k.Prefix,
+		Provider:    config.Provider.ID,
+		Threshold:   crossed,
+		Usage:       k.BudgetUsage,
+		Limit:       config.BudgetLimit,
+		SoftLimit:   config.SoftLimit,
+		PeriodStart: k.LastResetAt,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// crossedThreshold marks each of the ascending thresholds reached by
+// percent and returns the highest one marked for the first time, or zero.
+// On error it returns the threshold that failed.
+func crossedThreshold(thresholds []int, percent float64, mark func(threshold int) (bool, error)) (int, error) {
+	crossed := 0
+	for _, t := range thresholds {
+		if percent < float64(t) {
+			break
+		}
+		first, err := mark(t)
+		if err != nil {
+			return t, err
+		}
+		if first {
+			crossed = t
+		}
+	}
+	return crossed, nil
+}
+
+// sendAlert records the alert as an event and hands it to the notifier.
+func (s *KeyService) sendAlert(ctx context.Context, alert *domain.Alert) {
+	event := &domain.Event{
+		KeyID:     alert.KeyID,
+		Type:      domain.EventBudgetAlert,
+		Message:   alert.Message(),
+		CreatedAt: alert.CreatedAt,
+	}
+	if err := s.RecordEvent(ctx, event); err != nil {
+		logger.L.Warn("failed to record event", "type", event.Type, "error", err)
+	}
+
+	if s.notifier == nil {
+		return
+	}
+	// Delivery must not hold up the request that crossed the threshold
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := s.notifier.Notify(ctx, alert); err != nil {
+			logger.L.Warn("failed to send budget alert", "scope", alert.Scope, "prefix", alert.KeyPrefix, "provider", alert.Provider, "threshold", alert.Threshold, "error", err)
+		}
+	}()
+}
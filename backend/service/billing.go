@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+	"time"
+)
+
+// billingCheckInterval is how often the billing reconciler looks for a
+// completed day to reconcile.
+const billingCheckInterval = time.Hour
+
+// maxBillingPeriods bounds how many periods one reconciliation may span, as
+// each period is a request to every provider's billing API.
+const maxBillingPeriods = 92
+
+// BillingPolicy sets when the drift between what a provider billed and what
+// the usage ledger recorded is flagged. Both bounds must be exceeded.
+type BillingPolicy struct {
+	// DriftThreshold is a percentage of the larger of the two costs.
+	DriftThreshold float64
+	// MinDrift, in USD, keeps small totals from being flagged for rounding.
+	MinDrift float64
+}
+
+// SetBillingPolicy configures when billing drift is flagged.
+func (s *KeyService) SetBillingPolicy(policy BillingPolicy) {
+	s.billing = policy
+}
+
+// ReconcileBilling compares, for each provider that reports its billing and
+// each day, week or month of q (or the whole range for ReportTotal), the
+// cost the provider billed with the cost in the usage ledger. The range is
+// required and counts whole UTC days; groupings are ignored. Keys with
+// credentials of their own are billed to other accounts, and left out.
+func (s *KeyService) ReconcileBilling(ctx context.Context, q domain.ReportQuery) ([]*domain.Reconciliation, error) {
+	if q.Period == domain.ReportHour {
+		return nil, &domain.ValidationError{Message: "billing cannot be reconciled by hour"}
+	}
+	if q.From.IsZero() || q.To.IsZero() {
+		return nil, &domain.ValidationError{Message: "billing reconciliation needs a range"}
+	}
+	q.From, q.To = utcDay(q.From), utcDay(q.To)
+	q.GroupBy = []domain.ReportGroup{domain.ReportByProvider, domain.ReportByKey}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	var periods [][2]time.Time
+	for start := q.From; start.Before(q.To); {
+		end := q.To
+		if next := nextReportPeriod(q.Period, start); !next.IsZero() && next.Before(end) {
+			end = next
+		}
+		periods = append(periods, [2]time.Time{start, end})
+		if len(periods) > maxBillingPeriods {
+			return nil, &domain.ValidationError{Message: "billing reconciliation spans too many periods"}
+		}
+		start = end
+	}
+
+	rows, err := s.UsageReport(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	// The ledger's periods start on their calendar boundary rather than at
+	// the start of the range
+	recorded := make(map[string]map[time.Time]float64)
+	shared := make(map[domain.ID]bool)
+	for _, r := range rows {
+		billed, ok := shared[r.KeyID]
+		if !ok {
+			k, err := s.repo.GetByID(ctx, r.KeyID)
+			if err != nil {
+				return nil, err
+			}
+			// Usage of deleted keys is counted as the shared account's
+			billed = k == nil || !s.ownCredentials(k)
+			shared[r.KeyID] = billed
+		}
+		if !billed {
+			continue
+		}
+		if recorded[r.Provider] == nil {
+			recorded[r.Provider] = make(map[time.Time]float64)
+		}
+		start := r.PeriodStart
+		if start.Before(q.From) {
+			start = q.From
+		}
+		recorded[r.Provider][start] += r.Cost
+	}
+
+	var results []*domain.Reconciliation
+	for _, p := range s.registry.List() {
+		billing, ok := p.(domain.BillingReporter)
+		if !ok {
+			continue
+		}
+		for _, period := range periods {
+			billed, err := billing.GetBilledUsage(ctx, period[0], period[1])
+			if errors.Is(err, domain.ErrNotSupported) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, s.reconcile(p.Name(), period[0], period[1], billed, recorded[p.Name()][period[0]]))
+		}
+	}
+	return results, nil
+}
+
+func (s *KeyService) reconcile(provider string, start, end time.Time, billed, recorded float64) *domain.Reconciliation {
+	r := &domain.Reconciliation{
+		Provider:    provider,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Billed:      billed,
+		Recorded:    recorded,
+		Drift:       billed - recorded,
+	}
+	if larger := math.Max(billed, recorded); larger > 0 {
+		r.DriftPercent = math.Abs(r.Drift) / larger * 100
+	}
+	r.Flagged = math.Abs(r.Drift) > s.billing.MinDrift && r.DriftPercent > s.billing.DriftThreshold
+	return r
+}
+
+// utcDay returns the start of t's day in UTC.
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// nextReportPeriod returns the start of the period after the one containing
+// the UTC day start, or the zero time for ReportTotal.
+func nextReportPeriod(period domain.ReportPeriod, start time.Time) time.Time {
+	switch period {
+	case domain.ReportDay:
+		return start.AddDate(0, 0, 1)
+	case domain.ReportWeek:
+		return start.AddDate(0, 0, 7-(int(start.Weekday())+6)%7)
+	case domain.ReportMonth:
+		return time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// RunBillingReconciler reconciles each UTC day with the providers' billing
+// once it is over, until ctx is done. Flagged drift is logged and recorded
+// as an event.
+func (s *KeyService) RunBillingReconciler(ctx context.Context) {
+	ticker := time.NewTicker(billingCheckInterval)
+	defer ticker.Stop()
+
+	var reconciled time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			today := utcDay(time.Now())
+			if !reconciled.Before(today) {
+				continue
+			}
+			results, err := s.ReconcileBilling(ctx, domain.ReportQuery{From: today.AddDate(0, 0, -1), To: today, Period: domain.ReportDay})
+			if err != nil {
+				logger.L.Warn("failed to reconcile billing", "error", err)
+				continue
+			}
+			reconciled = today
+			for _, r := range results {
+				if !r.Flagged {
+					continue
+				}
+				logger.L.Warn("billing drift", "provider", r.Provider, "day", r.PeriodStart.Format(time.DateOnly),
+					"billed", r.Billed, "recorded", r.Recorded, "drift_percent", r.DriftPercent)
+				if err := s.RecordEvent(ctx, &domain.Event{Type: domain.EventBillingDrift, Message: r.Message()}); err != nil {
+					logger.L.Warn("failed to record billing drift", "provider", r.Provider, "error", err)
+				}
+			}
+		}
+	}
+}
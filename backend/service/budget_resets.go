@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+	"time"
+)
+
+// budgetResetInterval is how often budgets are checked for a new period.
+const budgetResetInterval = time.Minute
+
+// ResetDueBudgets starts a new period for every key, project, organization
+// and provider cap whose period ended at or before now, with loc as the
+// timezone of schedules that have none. It returns how many were reset.
+func (s *KeyService) ResetDueBudgets(ctx context.Context, now time.Time, loc *time.Location) (int, error) {
+	keys, err := s.repo.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reset := 0
+	for _, k := range keys {
+		if k.Configuration == nil {
+			continue
+		}
+		at, due := domain.DueReset(k.LastResetAt, now, k.Configuration.ResetPeriod, k.Configuration.ResetSchedule, loc)
+		if !due {
+			continue
+		}
+		r, err := s.resetBudget(ctx, domain.BudgetScopeKey, k.ID, at)
+		if err != nil {
+			return reset, err
+		}
+		if r != nil {
+			s.resetCachedUsage(k.ID, r.Held, at)
+			reset++
+		}
+	}
+
+	if caps, ok := s.repo.(domain.ProviderCapRepository); ok {
+		list, err := caps.ListProviderCaps(ctx)
+		if err != nil {
+			return reset, err
+		}
+		for _, c := range list {
+			if c.Schedule == nil {
+				continue
+			}
+			if at, due := domain.DueReset(c.LastResetAt, now, 0, c.Schedule, loc); due {
+				r, err := s.resetBudget(ctx, domain.BudgetScopeProvider, c.ID, at)
+				if err != nil {
+					return reset, err
+				}
+				if r != nil {
+					reset++
+				}
+			}
+		}
+	}
+
+	hierarchy, ok := s.repo.(domain.HierarchyRepository)
+	if !ok {
+		return reset, nil
+	}
+	projects, err := hierarchy.ListProjects(ctx)
+	if err != nil {
+		return reset, err
+	}
+	for _, p := range projects {
+		if at, due := domain.DueReset(p.LastResetAt, now, p.ResetPeriod, p.ResetSchedule, loc); due {
+			r, err := s.resetBudget(ctx, domain.BudgetScopeProject, p.ID, at)
+			if err != nil {
+				return reset, err
+			}
+			if r != nil {
+				reset++
+			}
+		}
+	}
+	orgs, err := hierarchy.ListOrganizations(ctx)
+	if err != nil {
+		return reset, err
+	}
+	for _, o := range orgs {
+		if at, due := domain.DueReset(o.LastResetAt, now, o.ResetPeriod, o.ResetSchedule, loc); due {
+			r, err := s.resetBudget(ctx, domain.BudgetScopeOrganization, o.ID, at)
+			if err != nil {
+				return reset, err
+			}
+			if r != nil {
+				reset++
+			}
+		}
+	}
+	return reset, nil
+}
+
+// resetBudget zeroes a budget as of at, recording the reset if the
+// repository keeps them. It returns nil if the budget was not reset.
+func (s *KeyService) resetBudget(ctx context.Context, scope domain.BudgetScope, id domain.ID, at time.Time) (*domain.BudgetReset, error) {
+	resetter, ok := s.repo.(domain.BudgetResetRepository)
+	if !ok {
+		if scope != domain.BudgetScopeKey {
+			return nil, nil
+		}
+		if err := s.repo.ResetUsage(ctx, id, at); err != nil {
+			return nil, err
+		}
+		return &domain.BudgetReset{Scope: scope, ScopeID: id, ResetAt: at}, nil
+	}
+
+	r, err := resetter.ResetBudget(ctx, scope, id, at)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	logger.L.Info("budget reset", "scope", scope, "name", r.Name, "usage", r.Usage, "held", r.Held, "period_start", r.PeriodStart, "reset_at", r.ResetAt)
+	return r, nil
+}
+
+func (s *KeyService) resetCachedUsage(keyID domain.ID, held float64, at time.Time) {
+	s.cacheMu.Lock()
+	for _, entry := range s.cache {
+		if entry.key.ID == keyID {
+			entry.key.BudgetUsage = held
+			entry.key.LastResetAt = at
+			break
+		}
+	}
+	s.cacheMu.Unlock()
+}
+
+// ListBudgetResets returns up to limit of the most recent budget resets.
+func (s *KeyService) ListBudgetResets(ctx context.Context, limit int) ([]*domain.BudgetReset, error) {
+	resetter, ok := s.repo.(domain.BudgetResetRepository)
+	if !ok {
+		return nil, nil
+	}
+	return resetter.ListBudgetResets(ctx, limit)
+}
+
+// RunBudgetScheduler resets budgets as their periods end until ctx is done.
+// Periods that ended while the server was down should be caught up on
+// before serving, with ResetDueBudgets(ctx, time.Now(), loc).
+func (s *KeyService) RunBudgetScheduler(ctx context.Context, loc *time.Location) {
+	ticker := time.NewTicker(budgetResetInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ResetDueBudgets(ctx, time.Now(), loc); err != nil {
+				logger.L.Warn("failed to reset budgets", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+)
+
+// RecordEvent stores e for admins to review, if the repository keeps events.
+func (s *KeyService) RecordEvent(ctx context.Context, e *domain.Event) error {
+	events, ok := s.repo.(domain.EventRepository)
+	if !ok {
+		return nil
+	}
+	return events.RecordEvent(ctx, e)
+}
+
+// ListEvents returns up to limit of the most recent events.
+func (s *KeyService) ListEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	events, ok := s.repo.(domain.EventRepository)
+	if !ok {
+		return nil, nil
+	}
+	return events.ListEvents(ctx, limit)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"time"
+)
+
+// HierarchyService manages the organizations and projects that keys are
+// grouped into for budgeting.
+type HierarchyService struct {
+	repo domain.HierarchyRepository
+}
+
+func NewHierarchyService(repo domain.HierarchyRepository) *HierarchyService {
+	return &HierarchyService{repo: repo}
+}
+
+type OrganizationInput struct {
+	Name          string
+	BudgetLimit   float64
+	ResetPeriod   int
+	ResetSchedule *domain.ResetSchedule
+}
+
+type ProjectInput struct {
+	// OrgID is zero for a project outside any organization.
+	OrgID         domain.ID
+	Name          string
+	BudgetLimit   float64
+	ResetPeriod   int
+	ResetSchedule *domain.ResetSchedule
+}
+
+func (s *HierarchyService) CreateOrganization(ctx context.Context, input OrganizationInput) (*domain.Organization, error) {
+	now := time.Now()
+	o := &domain.Organization{
+		Name:          input.Name,
+		BudgetLimit:   input.BudgetLimit,
+		ResetPeriod:   input.ResetPeriod,
+		ResetSchedule: input.ResetSchedule,
+		LastResetAt:   now,
+		CreatedAt:     now,
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveOrganization(ctx, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (s *HierarchyService) ListOrganizations(ctx context.Context) ([]*domain.Organization, error) {
+	return s.repo.ListOrganizations(ctx)
+}
+
+func (s *HierarchyService) UpdateOrganization(ctx context.Context, id domain.ID, input OrganizationInput) error {
+	o, err := s.repo.GetOrganization(ctx, id)
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		return domain.ErrOrganizationNotFound
+	}
+
+	o.Name = input.Name
+	o.BudgetLimit = input.BudgetLimit
+	o.ResetPeriod = input.ResetPeriod
+	o.ResetSchedule = input.ResetSchedule
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	return s.repo.UpdateOrganization(ctx, o)
+}
+
+func (s *HierarchyService) DeleteOrganization(ctx context.Context, id domain.ID) error {
+	return s.repo.DeleteOrganization(ctx, id)
+}
+
+func (s *HierarchyService) CreateProject(ctx context.Context, input ProjectInput) (*domain.Project, error) {
+	now := time.Now()
+	p := &domain.Project{
+		OrgID:         input.OrgID,
+		Name:          input.Name,
+		BudgetLimit:   input.BudgetLimit,
+		ResetPeriod:   input.ResetPeriod,
+		ResetSchedule: input.ResetSchedule,
+		LastResetAt:   now,
+		CreatedAt:     now,
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkOrganization(ctx, p.OrgID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveProject(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *HierarchyService) ListProjects(ctx context.Context) ([]*domain.Project, error) {
+	return s.repo.ListProjects(ctx)
+}
+
+// UpdateProject changes a project's settings. Moving a project to another
+// organization does not move its past usage; the new organization is only
+// charged for usage from then on.
+func (s *HierarchyService) UpdateProject(ctx context.Context, id domain.ID, input ProjectInput) error {
+	p, err := s.repo.GetProject(ctx, id)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return domain.ErrProjectNotFound
+	}
+
+	p.OrgID = input.OrgID
+	p.Name = input.Name
+	p.BudgetLimit = input.BudgetLimit
+	p.ResetPeriod = input.ResetPeriod
+	p.ResetSchedule = input.ResetSchedule
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if err := s.checkOrganization(ctx, p.OrgID); err != nil {
+		return err
+	}
+	return s.repo.UpdateProject(ctx, p)
+}
+
+func (s *HierarchyService) DeleteProject(ctx context.Context, id domain.ID) error {
+	return s.repo.DeleteProject(ctx, id)
+}
+
+func (s *HierarchyService) checkOrganization(ctx context.Context, id domain.ID) error {
+	if id == 0 {
+		return nil
+	}
+	o, err := s.repo.GetOrganization(ctx, id)
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		return &domain.ValidationError{Message: fmt.Sprintf("%v: %d", domain.ErrOrganizationNotFound, id)}
+	}
+	return nil
+}
@@ -25,6 +25,14 @@ type KeyService struct {
 	mwRegistry domain.MiddlewareRegistry
 	cache      map[string]cachedKey
 	cacheMu    sync.RWMutex
+	// providers caches the provider instances configured for each key.
+	providers   map[domain.ID]domain.Provider
+	providersMu sync.RWMutex
+	// notifier and alerts are set with SetAlerts.
+	notifier domain.Notifier
+	alerts   AlertPolicy
+	// billing is set with SetBillingPolicy.
+	billing BillingPolicy
 }
 
 func NewKeyService(repo domain.Repository, registry domain.ProviderRegistry, mwRegistry domain.MiddlewareRegistry) *KeyService {
@@ -33,27 +41,35 @@ func NewKeyService(repo domain.Repository, registry domain.ProviderRegistry, mwR
 		registry:   registry,
 		mwRegistry: mwRegistry,
 		cache:      make(map[string]cachedKey),
+		providers:  make(map[domain.ID]domain.Provider),
 	}
 }
 
 type CreateKeyInput struct {
-	Name        string
-	Provider    domain.PluginConfig
-	ExpiresAt   *int64
-	Middlewares []domain.PluginConfig
-	BudgetLimit float64
-	ResetPeriod int
-	AutoRenew   bool
+	Name               string
+	Provider           domain.PluginConfig
+	ExpiresAt          *int64
+	Middlewares        []domain.PluginConfig
+	BudgetLimit        float64
+	ResetPeriod        int
+	ResetSchedule      *domain.ResetSchedule
+	AutoRenew          bool
+	AllowedModels      []string
+	ClampMaxTokens     bool
+	UnknownModelPolicy domain.UnknownModelPolicy
+	ProjectID          domain.ID
+	ModelBudgets       []domain.ModelBudget
+	AlertThresholds    []int
+	SoftLimit          bool
+	StreamCutoff       bool
 }
 
 func (s *KeyService) CreateKey(ctx context.Context, input CreateKeyInput) (string, *domain.Key, error) {
-	if input.Provider.ID != "" {
-		if _, err := s.registry.Get(input.Provider.ID); err != nil {
-			if errors.Is(err, registry.ErrNotFound) {
-				return "", nil, domain.ErrProviderNotFound
-			}
-			return "", nil, err
-		}
+	if err := s.checkProvider(input.Provider); err != nil {
+		return "", nil, err
+	}
+	if err := s.checkProject(ctx, input.ProjectID); err != nil {
+		return "", nil, err
 	}
 
 	rawKey, err := s.generateRandomKey()
@@ -71,15 +87,25 @@ func (s *KeyService) CreateKey(ctx context.Context, input CreateKeyInput) (strin
 		Prefix:    prefix,
 		AutoRenew: input.AutoRenew,
 		Configuration: &domain.KeyConfiguration{
-			Provider:    input.Provider,
-			Middlewares: input.Middlewares,
-			BudgetLimit: input.BudgetLimit,
-			ResetPeriod: input.ResetPeriod,
+			Provider:           input.Provider,
+			Middlewares:        input.Middlewares,
+			BudgetLimit:        input.BudgetLimit,
+			ResetPeriod:        input.ResetPeriod,
+			ResetSchedule:      input.ResetSchedule,
+			AllowedModels:      input.AllowedModels,
+			ClampMaxTokens:     input.ClampMaxTokens,
+			UnknownModelPolicy: input.UnknownModelPolicy,
+			ProjectID:          input.ProjectID,
+			ModelBudgets:       input.ModelBudgets,
+			AlertThresholds:    input.AlertThresholds,
+			SoftLimit:          input.SoftLimit,
+			StreamCutoff:       input.StreamCutoff,
 		},
 		BudgetUsage: 0,
 		LastResetAt: time.Now(),
 		CreatedAt:   time.Now(),
 	}
+	k.Configuration.OwnCredentials = s.ownCredentials(k)
 
 	if input.ExpiresAt != nil {
 		t := time.Unix(*input.ExpiresAt, 0)
@@ -133,14 +159,23 @@ func (s *KeyService) ListKeys(ctx context.Context) ([]*domain.Key, error) {
 }
 
 type UpdateKeyInput struct {
-	ID          int64
-	Name        string
-	Provider    domain.PluginConfig
-	ExpiresAt   *int64
-	Middlewares []domain.PluginConfig
-	BudgetLimit float64
-	ResetPeriod int
-	AutoRenew   bool
+	ID                 int64
+	Name               string
+	Provider           domain.PluginConfig
+	ExpiresAt          *int64
+	Middlewares        []domain.PluginConfig
+	BudgetLimit        float64
+	ResetPeriod        int
+	ResetSchedule      *domain.ResetSchedule
+	AutoRenew          bool
+	AllowedModels      []string
+	ClampMaxTokens     bool
+	UnknownModelPolicy domain.UnknownModelPolicy
+	ProjectID          domain.ID
+	ModelBudgets       []domain.ModelBudget
+	AlertThresholds    []int
+	SoftLimit          bool
+	StreamCutoff       bool
 }
 
 func (s *KeyService) UpdateKey(ctx context.Context, input UpdateKeyInput) error {
@@ -152,23 +187,31 @@ func (s *KeyService) UpdateKey(ctx context.Context, input UpdateKeyInput) error
 		return domain.ErrKeyNotFound
 	}
 
-	if input.Provider.ID != "" {
-		if _, err := s.registry.Get(input.Provider.ID); err != nil {
-			if errors.Is(err, registry.ErrNotFound) {
-				return domain.ErrProviderNotFound
-			}
-			return err
-		}
+	if err := s.checkProvider(input.Provider); err != nil {
+		return err
+	}
+	if err := s.checkProject(ctx, input.ProjectID); err != nil {
+		return err
 	}
 
 	k.Name = input.Name
 	k.AutoRenew = input.AutoRenew
 	k.Configuration = &domain.KeyConfiguration{
-		Provider:    input.Provider,
-		Middlewares: input.Middlewares,
-		BudgetLimit: input.BudgetLimit,
-		ResetPeriod: input.ResetPeriod,
-	}
+		Provider:           input.Provider,
+		Middlewares:        input.Middlewares,
+		BudgetLimit:        input.BudgetLimit,
+		ResetPeriod:        input.ResetPeriod,
+		ResetSchedule:      input.ResetSchedule,
+		AllowedModels:      input.AllowedModels,
+		ClampMaxTokens:     input.ClampMaxTokens,
+		UnknownModelPolicy: input.UnknownModelPolicy,
+		ProjectID:          input.ProjectID,
+		ModelBudgets:       input.ModelBudgets,
+		AlertThresholds:    input.AlertThresholds,
+		SoftLimit:          input.SoftLimit,
+		StreamCutoff:       input.StreamCutoff,
+	}
+	k.Configuration.OwnCredentials = s.ownCredentials(k)
 
 	k.ExpiresAt = nil
 	if input.ExpiresAt != nil {
@@ -187,6 +230,7 @@ func (s *KeyService) UpdateKey(ctx context.Context, input UpdateKeyInput) error
 	s.cacheMu.Lock()
 	delete(s.cache, k.KeyHash)
 	s.cacheMu.Unlock()
+	s.invalidateProvider(k.ID)
 
 	return nil
 }
@@ -201,22 +245,66 @@ func (s *KeyService) DeleteKey(ctx context.Context, id int64) error {
 		delete(s.cache, k.KeyHash)
 		s.cacheMu.Unlock()
 	}
+	s.invalidateProvider(domain.ID(id))
 	return nil
 }
 
-func (s *KeyService) ResetKeyUsage(ctx context.Context, k *domain.Key) error {
-	k.BudgetUsage = 0
-	k.LastResetAt = time.Now()
-	if err := s.repo.ResetUsage(ctx, k.ID, k.LastResetAt); err != nil {
-		return err
+// ResolveProvider returns the key's provider with the key's provider config
+// applied, so each key can use its own upstream credentials. Configured
+// instances are cached until the key is updated or deleted.
+func (s *KeyService) ResolveProvider(k *domain.Key) (domain.Provider, error) {
+	if k.Configuration == nil || k.Configuration.Provider.ID == "" {
+		return nil, domain.ErrProviderNotFound
 	}
-	s.cacheMu.Lock()
-	if entry, ok := s.cache[k.KeyHash]; ok {
-		entry.key.BudgetUsage = 0
-		entry.key.LastResetAt = k.LastResetAt
+	pc := k.Configuration.Provider
+
+	base, err := s.registry.Get(pc.ID)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotFound) {
+			return nil, domain.ErrProviderNotFound
+		}
+		return nil, err
 	}
-	s.cacheMu.Unlock()
-	return nil
+	if len(pc.Config) == 0 {
+		return base, nil
+	}
+
+	s.providersMu.RLock()
+	p, ok := s.providers[k.ID]
+	s.providersMu.RUnlock()
+	if ok && p.Name() == pc.ID {
+		return p, nil
+	}
+
+	p, err = base.Configure(pc.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure provider %s: %w", pc.ID, err)
+	}
+
+	s.providersMu.Lock()
+	s.providers[k.ID] = p
+	s.providersMu.Unlock()
+
+	return p, nil
+}
+
+// ownCredentials reports whether the key is billed to upstream credentials of
+// its own, rather than to its provider's shared account.
+func (s *KeyService) ownCredentials(k *domain.Key) bool {
+	if k.Configuration == nil || len(k.Configuration.Provider.Config) == 0 {
+		return false
+	}
+	base, err := s.registry.Get(k.Configuration.Provider.ID)
+	if err != nil || base == nil {
+		return false
+	}
+	return base.Schema().SetsCredentials(k.Configuration.Provider.Config)
+}
+
+func (s *KeyService) invalidateProvider(id domain.ID) {
+	s.providersMu.Lock()
+	delete(s.providers, id)
+	s.providersMu.Unlock()
 }
 
 func (s *KeyService) RenewKey(ctx context.Context, k *domain.Key) error {
@@ -258,40 +346,75 @@ func (s *KeyService) IncrementUsage(ctx context.Context, key *domain.Key, amount
 	return nil
 }
 
-func (s *KeyService) ReserveUsage(ctx context.Context, keyID domain.ID, amount float64) error {
-	k, err := s.repo.GetByID(ctx, keyID)
+// ReserveUsage reserves amount for a request. Model budgets are enforced
+// when the repository keeps a reservation ledger and model is set.
+func (s *KeyService) ReserveUsage(ctx context.Context, keyID domain.ID, requestID string, model domain.Model, amount float64) error {
+	// The limit check happens in the repository, atomically with the update
+	var err error
+	if ledger, ok := s.repo.(domain.ReservationRepository); ok && requestID != "" {
+		err = ledger.Reserve(ctx, &domain.Reservation{
+			KeyID:     keyID,
+			RequestID: requestID,
+			Model:     model,
+			Amount:    amount,
+			CreatedAt: time.Now(),
+		})
+	} else {
+		err = s.repo.ReserveUsage(ctx, keyID, amount)
+	}
 	if err != nil {
 		return err
 	}
-	if k == nil {
-		return domain.ErrKeyNotFound
-	}
 
-	if k.Configuration != nil && k.Configuration.BudgetLimit > 0 {
-		if k.BudgetUsage+amount > k.Configuration.BudgetLimit {
-			return fmt.Errorf("%w (limit: $%.2f, current+reservation: $%.2f)", domain.ErrBudgetExceeded, k.Configuration.BudgetLimit, k.BudgetUsage+amount)
-		}
-	}
+	s.adjustCachedUsage(keyID, amount)
+	return nil
+}
 
-	if err := s.repo.IncrementUsage(ctx, keyID, amount); err != nil {
-		return err
+// BudgetHeadroom returns the least room left in the budgets a reservation for
+// the key and model is checked against, and whether any of them is limited.
+// Without a reservation ledger only the key's own budget is known.
+func (s *KeyService) BudgetHeadroom(ctx context.Context, key *domain.Key, model domain.Model) (float64, bool, error) {
+	if ledger, ok := s.repo.(domain.ReservationRepository); ok {
+		return ledger.Headroom(ctx, key.ID, model)
+	}
+	config := key.Configuration
+	if config == nil || config.SoftLimit || config.BudgetLimit <= 0 {
+		return 0, false, nil
 	}
+	return config.BudgetLimit - key.BudgetUsage, true, nil
+}
 
-	s.cacheMu.Lock()
-	for _, entry := range s.cache {
-		if entry.key.ID == keyID {
-			entry.key.BudgetUsage += amount
-			break
-		}
+// ExtendReservation reserves amount more for an open request, against the
+// same budgets as ReserveUsage.
+func (s *KeyService) ExtendReservation(ctx context.Context, keyID domain.ID, requestID string, amount float64) error {
+	var err error
+	if ledger, ok := s.repo.(domain.ReservationRepository); ok && requestID != "" {
+		err = ledger.Extend(ctx, requestID, amount)
+	} else {
+		err = s.repo.ReserveUsage(ctx, keyID, amount)
+	}
+	if err != nil {
+		return err
 	}
-	s.cacheMu.Unlock()
 
+	s.adjustCachedUsage(keyID, amount)
 	return nil
 }
 
-func (s *KeyService) CommitUsage(ctx context.Context, keyID domain.ID, reserved, actual float64) error {
+func (s *KeyService) CommitUsage(ctx context.Context, keyID domain.ID, requestID string, reserved, actual float64) error {
+	if ledger, ok := s.repo.(domain.ReservationRepository); ok && requestID != "" {
+		diff, err := ledger.Commit(ctx, requestID, actual)
+		if err != nil {
+			return err
+		}
+		s.adjustCachedUsage(keyID, diff)
+		s.checkAlerts(ctx, keyID)
+		return nil
+	}
+
 	diff := actual - reserved
 	if diff == 0 {
+		s.checkAlerts(ctx, keyID)
 		return nil
 	}
 
@@ -299,6 +422,12 @@ func (s *KeyService) CommitUsage(ctx context.Context, keyID domain.ID, reserved,
 		return err
 	}
 
+	s.adjustCachedUsage(keyID, diff)
+	s.checkAlerts(ctx, keyID)
+	return nil
+}
+
+func (s *KeyService) adjustCachedUsage(keyID domain.ID, diff float64) {
 	s.cacheMu.Lock()
 	for _, entry := range s.cache {
 		if entry.key.ID == keyID {
@@ -307,8 +436,6 @@ func (s *KeyService) CommitUsage(ctx context.Context, keyID domain.ID, reserved,
 		}
 	}
 	s.cacheMu.Unlock()
-
-	return nil
 }
 
 func (s *KeyService) GetProviderUsage(ctx context.Context) (map[string]float64, error) {
@@ -322,6 +449,9 @@ func (s *KeyService) GetProviderUsage(ctx context.Context) (map[string]float64,
 		go func(p domain.Provider) {
 			defer wg.Done()
 			u, err := p.GetUsage(ctx)
+			if errors.Is(err, domain.ErrNotSupported) {
+				return
+			}
 			if err != nil {
 				// Log error but continue with other providers
 				logger.L.Error("failed to fetch usage", "provider", p.Name(), "error", err)
@@ -366,6 +496,45 @@ func (s *KeyService) ListMiddlewares(ctx context.Context) ([]domain.PluginInfo,
 
 // Helpers
 
+// checkProject verifies that the project a key is placed in exists.
+func (s *KeyService) checkProject(ctx context.Context, id domain.ID) error {
+	if id == 0 {
+		return nil
+	}
+	hierarchy, ok := s.repo.(domain.HierarchyRepository)
+	if !ok {
+		return &domain.ValidationError{Message: "projects are not supported"}
+	}
+	p, err := hierarchy.GetProject(ctx, id)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return &domain.ValidationError{Message: fmt.Sprintf("%v: %d", domain.ErrProjectNotFound, id)}
+	}
+	return nil
+}
+
+// checkProvider verifies that a key's provider exists and accepts its config.
+func (s *KeyService) checkProvider(pc domain.PluginConfig) error {
+	if pc.ID == "" {
+		return nil
+	}
+	p, err := s.registry.Get(pc.ID)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotFound) {
+			return domain.ErrProviderNotFound
+		}
+		return err
+	}
+	if len(pc.Config) > 0 {
+		if _, err := p.Configure(pc.Config); err != nil {
+			return &domain.ValidationError{Message: fmt.Sprintf("invalid provider config: %v", err)}
+		}
+	}
+	return nil
+}
+
 func (s *KeyService) generateRandomKey() (string, error) {
 	b := make([]byte, 24)
 	if _, err := rand.Read(b); err != nil {
@@ -389,14 +558,32 @@ func (s *KeyService) copyKey(k *domain.Key) *domain.Key {
 		t := *k.ExpiresAt
 		copy.ExpiresAt = &t
 	}
+	if k.ModelUsage != nil {
+		copy.ModelUsage = make(map[string]float64, len(k.ModelUsage))
+		for pattern, usage := range k.ModelUsage {
+			copy.ModelUsage[pattern] = usage
+		}
+	}
 	if k.Configuration != nil {
 		cfg := domain.KeyConfiguration{
 			Provider: domain.PluginConfig{
 				ID: k.Configuration.Provider.ID,
 			},
-			Middlewares: make([]domain.PluginConfig, len(k.Configuration.Middlewares)),
-			BudgetLimit: k.Configuration.BudgetLimit,
-			ResetPeriod: k.Configuration.ResetPeriod,
+			Middlewares:        make([]domain.PluginConfig, len(k.Configuration.Middlewares)),
+			BudgetLimit:        k.Configuration.BudgetLimit,
+			ResetPeriod:        k.Configuration.ResetPeriod,
+			AllowedModels:      append([]string(nil), k.Configuration.AllowedModels...),
+			ClampMaxTokens:     k.Configuration.ClampMaxTokens,
+			UnknownModelPolicy: k.Configuration.UnknownModelPolicy,
+			ProjectID:          k.Configuration.ProjectID,
+			ModelBudgets:       append([]domain.ModelBudget(nil), k.Configuration.ModelBudgets...),
+			AlertThresholds:    append([]int(nil), k.Configuration.AlertThresholds...),
+			SoftLimit:          k.Configuration.SoftLimit,
+			StreamCutoff:       k.Configuration.StreamCutoff,
+		}
+		if k.Configuration.ResetSchedule != nil {
+			schedule := *k.Configuration.ResetSchedule
+			cfg.ResetSchedule = &schedule
 		}
 		if k.Configuration.Provider.Config != nil {
 			cfg.Provider.Config = make(map[string]any)
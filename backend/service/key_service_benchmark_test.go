@@ -77,6 +77,10 @@ func (m *MockRepository) IncrementUsage(ctx context.Context, id domain.ID, amoun
 	return nil
 }
 
+func (m *MockRepository) ReserveUsage(ctx context.Context, id domain.ID, amount float64) error {
+	return m.IncrementUsage(ctx, id, amount)
+}
+
 func (m *MockRepository) ResetUsage(ctx context.Context, id domain.ID, lastResetAt time.Time) error {
 	for _, k := range m.keys {
 		if k.ID == id {
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+	"slices"
+	"time"
+)
+
+// SetProviderCaps replaces the provider caps with caps. New caps start in
+// the period containing now, in loc for schedules without a timezone, with
+// what the usage ledger recorded since its start; caps without a schedule
+// start at now.
+func (s *KeyService) SetProviderCaps(ctx context.Context, caps []*domain.ProviderCap, now time.Time, loc *time.Location) error {
+	seen := make(map[string]bool, len(caps))
+	for _, c := range caps {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if seen[c.Provider] {
+			return &domain.ValidationError{Message: fmt.Sprintf("provider %q is capped twice", c.Provider)}
+		}
+		seen[c.Provider] = true
+		c.LastResetAt = now
+		if c.Schedule != nil {
+			c.LastResetAt = c.Schedule.Start(now, loc)
+		}
+	}
+
+	repo, ok := s.repo.(domain.ProviderCapRepository)
+	if !ok {
+		if len(caps) > 0 {
+			return domain.ErrNotSupported
+		}
+		return nil
+	}
+	return repo.SyncProviderCaps(ctx, caps)
+}
+
+// ListProviderCaps returns the provider caps with their usage in the
+// current period.
+func (s *KeyService) ListProviderCaps(ctx context.Context) ([]*domain.ProviderCap, error) {
+	repo, ok := s.repo.(domain.ProviderCapRepository)
+	if !ok {
+		return nil, nil
+	}
+	return repo.ListProviderCaps(ctx)
+}
+
+// capThresholds returns the cap's alert thresholds in ascending order,
+// defaulting to the global ones. Reaching the cap always alerts.
+func (s *KeyService) capThresholds(c *domain.ProviderCap) []int {
+	thresholds := c.AlertThresholds
+	if len(thresholds) == 0 {
+		thresholds = s.alerts.Thresholds
+	}
+	thresholds = append(slices.Clone(thresholds), 100)
+	slices.Sort(thresholds)
+	return slices.Compact(thresholds)
+}
+
+// checkCapAlerts alerts on the thresholds newly crossed by the cap of the
+// provider, as checkAlerts does for keys.
+func (s *KeyService) checkCapAlerts(ctx context.Context, caps domain.ProviderCapRepository, provider string) {
+	c, err := caps.GetProviderCap(ctx, provider)
+	if err != nil || c == nil {
+		if err != nil {
+			logger.L.Warn("failed to load provider cap for alerts", "provider", provider, "error", err)
+		}
+		return
+	}
+
+	crossed, err := crossedThreshold(s.capThresholds(c), c.Usage/c.Limit*100, func(t int) (bool, error) {
+		return caps.MarkCapAlerted(ctx, c.ID, t, c.LastResetAt)
+	})
+	if err != nil {
+		logger.L.Warn("failed to record provider cap alert", "provider", provider, "threshold", crossed, "error", err)
+		return
+	}
+	if crossed == 0 {
+		return
+	}
+
+	logger.L.Info("provider cap alert", "provider", provider, "threshold", crossed, "usage", c.Usage, "limit", c.Limit)
+	s.sendAlert(ctx, &domain.Alert{
+		Scope:       domain.BudgetScopeProvider,
+		Provider:    provider,
+		Threshold:   crossed,
+		Usage:       c.Usage,
+		Limit:       c.Limit,
+		PeriodStart: c.LastResetAt,
+		CreatedAt:   time.Now(),
+	})
+}
@@ -1,26 +1,76 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"pouch-ai/backend/domain"
 	"pouch-ai/backend/util/logger"
-	"time"
+	"strconv"
+	"sync/atomic"
 )
 
 type ProxyService struct {
 	finalHandler domain.Handler
 	mwRegistry   domain.MiddlewareRegistry
 	keyService   *KeyService
+
+	// unknownModels applies to keys without a policy of their own; models
+	// are priced at fallbackPricing under UnknownModelFallback.
+	unknownModels   domain.UnknownModelPolicy
+	fallbackPricing domain.Pricing
 }
 
 func NewProxyService(finalHandler domain.Handler, mwRegistry domain.MiddlewareRegistry, keyService *KeyService) *ProxyService {
 	return &ProxyService{
-		finalHandler: finalHandler,
-		mwRegistry:   mwRegistry,
-		keyService:   keyService,
+		finalHandler:  finalHandler,
+		mwRegistry:    mwRegistry,
+		keyService:    keyService,
+		unknownModels: domain.UnknownModelReject,
 	}
 }
 
+// SetUnknownModelPolicy sets how requests for models without pricing are
+// handled for keys without a policy of their own, and the rate they are
+// priced at under UnknownModelFallback.
+func (s *ProxyService) SetUnknownModelPolicy(policy domain.UnknownModelPolicy, fallback domain.Pricing) {
+	s.unknownModels = policy
+	s.fallbackPricing = fallback
+}
+
+// ResolveProvider returns the provider instance configured for the key.
+func (s *ProxyService) ResolveProvider(k *domain.Key) (domain.Provider, error) {
+	return s.keyService.ResolveProvider(k)
+}
+
+// ListModels returns the models of the key's provider that the key may use.
+func (s *ProxyService) ListModels(ctx context.Context, k *domain.Key) ([]domain.Model, error) {
+	prov, err := s.ResolveProvider(k)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := prov.(domain.ModelLister)
+	if !ok {
+		return nil, domain.ErrNotSupported
+	}
+
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]domain.Model, 0, len(models))
+	for _, m := range models {
+		if k.Configuration.AllowsModel(m) {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed, nil
+}
+
 func (s *ProxyService) Execute(req *domain.Request) (*domain.Response, error) {
 	if req.Key == nil {
 		return nil, fmt.Errorf("no application key provided")
@@ -30,15 +80,25 @@ func (s *ProxyService) Execute(req *domain.Request) (*domain.Response, error) {
 	if err := s.validateKey(req); err != nil {
 		return nil, err
 	}
+	if req.Model != "" && !req.Key.Configuration.AllowsModel(req.Model) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrModelNotAllowed, req.Model)
+	}
+	if err := s.checkPricing(req); err != nil {
+		return nil, err
+	}
 
-	// 2. Budget Management (Reset & Reservation)
+	// 2. Budget Management (Reservation)
 	if err := s.manageBudget(req); err != nil {
 		return nil, err
 	}
 
 	// 3. Build & Execute Middleware Chain
 	chain := s.buildChain(req.Key.Configuration)
-	return chain.Handle(req)
+	resp, err := chain.Handle(req)
+	if err != nil {
+		s.releaseBudget(req)
+	}
+	return resp, err
 }
 
 func (s *ProxyService) validateKey(req *domain.Request) error {
@@ -59,41 +119,167 @@ func (s *ProxyService) validateKey(req *domain.Request) error {
 	return nil
 }
 
+// checkPricing applies the unknown model policy to requests for models the
+// provider has no pricing for, and records each of them as an event.
+func (s *ProxyService) checkPricing(req *domain.Request) error {
+	if req.Model == "" || (req.PassThrough != nil && req.PassThrough.Policy != domain.CostUsage) {
+		return nil
+	}
+	if _, err := req.Provider.GetPricing(req.Model); !errors.Is(err, domain.ErrUnknownModel) {
+		return nil
+	}
+
+	policy := s.unknownModels
+	if req.Key.Configuration != nil && req.Key.Configuration.UnknownModelPolicy != "" {
+		policy = req.Key.Configuration.UnknownModelPolicy
+	}
+
+	var message string
+	switch policy {
+	case domain.UnknownModelAllow:
+		message = "allowed without metering"
+	case domain.UnknownModelFallback:
+		if fp, ok := req.Provider.(domain.FallbackPricer); ok {
+			req.Provider = fp.WithFallbackPricing(s.fallbackPricing)
+			message = fmt.Sprintf("priced at the fallback rate (input %g, output %g per 1k tokens)", s.fallbackPricing.Input, s.fallbackPricing.Output)
+			break
+		}
+		policy = domain.UnknownModelReject
+		fallthrough
+	default:
+		message = "rejected"
+	}
+
+	logger.L.Warn("request for model without pricing", "prefix", req.Key.Prefix, "model", req.Model, "policy", policy)
+	event := &domain.Event{
+		KeyID:   req.Key.ID,
+		Type:    domain.EventUnpricedModel,
+		Model:   req.Model,
+		Message: fmt.Sprintf("request for %s %s", req.Model, message),
+	}
+	if err := s.keyService.RecordEvent(req.Context, event); err != nil {
+		logger.L.Warn("failed to record event", "type", event.Type, "error", err)
+	}
+
+	if policy == domain.UnknownModelReject {
+		return fmt.Errorf("%w: %s", domain.ErrUnknownModel, req.Model)
+	}
+	return nil
+}
+
 func (s *ProxyService) manageBudget(req *domain.Request) error {
 	config := req.Key.Configuration
 	if config == nil {
 		return nil
 	}
 
-	// 1. Budget Reset Logic
-	if config.ResetPeriod > 0 {
-		now := time.Now()
-		duration := time.Duration(config.ResetPeriod) * time.Second
-		if now.After(req.Key.LastResetAt.Add(duration)) {
-			if err := s.keyService.ResetKeyUsage(req.Context, req.Key); err != nil {
-				logger.L.Warn("failed to reset budget usage", "prefix", req.Key.Prefix, "error", err)
-			} else {
-				logger.L.Info("budget reset", "prefix", req.Key.Prefix)
-			}
+	// Budget Enforcement (Atomic Reservation); resets are left to the
+	// budget scheduler, see KeyService.RunBudgetScheduler
+	if config.ClampMaxTokens && req.IsChat() {
+		// Clamp to the tightest budget the reservation is checked against
+		remaining, limited, err := s.keyService.BudgetHeadroom(req.Context, req.Key, req.Model)
+		if err != nil {
+			return err
+		}
+		if limited {
+			clampMaxTokens(req, remaining)
 		}
 	}
-
-	// 2. Budget Enforcement (Atomic Reservation)
-	estimatedUsage, _ := req.Provider.EstimateUsage(req.Model, req.RawBody)
+	estimatedUsage := req.EstimateUsage()
 	reservedCost := 0.0
 	if estimatedUsage != nil {
 		reservedCost = estimatedUsage.TotalCost
 	}
 
-	if err := s.keyService.ReserveUsage(req.Context, req.Key.ID, reservedCost); err != nil {
+	if req.RequestID == "" {
+		req.RequestID = newRequestID()
+	}
+	if err := s.keyService.ReserveUsage(req.Context, req.Key.ID, req.RequestID, req.Model, reservedCost); err != nil {
 		return err
 	}
 
 	req.ReservedCost = reservedCost
-	req.Committer = s.keyService
+	req.Committer = &settlement{UsageCommitter: s.keyService}
+	if config.StreamCutoff && req.IsStream && req.IsChat() {
+		req.Reserver = s
+	}
 	return nil
 }
 
+// ExtendReservation grows the reservation of a stream as it spends past it.
+func (s *ProxyService) ExtendReservation(ctx context.Context, req *domain.Request, amount float64) error {
+	if err := s.keyService.ExtendReservation(ctx, req.Key.ID, req.RequestID, amount); err != nil {
+		return err
+	}
+	req.ReservedCost += amount
+	return nil
+}
+
+// settlement records whether a request's reservation was settled.
+type settlement struct {
+	domain.UsageCommitter
+	settled atomic.Bool
+}
+
+func (s *settlement) CommitRequest(ctx context.Context, e *domain.UsageEvent) error {
+	s.settled.Store(true)
+	return s.UsageCommitter.CommitRequest(ctx, e)
+}
+
+// releaseBudget settles the reservation of a request that failed before it
+// was committed at no cost, so that it is neither charged nor held until it
+// expires.
+func (s *ProxyService) releaseBudget(req *domain.Request) {
+	c, ok := req.Committer.(*settlement)
+	if !ok || c.settled.Load() || req.Key == nil {
+		return
+	}
+	// The request may have failed because the client went away
+	ctx := context.WithoutCancel(req.Context)
+	if err := c.CommitRequest(ctx, req.UsageEvent(0, &domain.Usage{})); err != nil {
+		logger.L.Warn("failed to release reservation", "prefix", req.Key.Prefix, "request_id", req.RequestID, "error", err)
+	}
+}
+
+// clampMaxTokens lowers a chat request's output cap so that its worst case
+// fits in the remaining budget, and sets one if the worst case is unknown.
+// The cap applies to each of the n choices requested. Requests that cannot
+// afford any output are left to fail the reservation.
+func clampMaxTokens(req *domain.Request, remaining float64) {
+	usage := req.EstimateUsage()
+	if usage == nil || (usage.OutputTokens > 0 && usage.TotalCost <= remaining) {
+		return
+	}
+	pricing, err := req.Provider.GetPricing(req.Model)
+	if err != nil || pricing.Output <= 0 {
+		return
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(req.RawBody, &body); err != nil {
+		return
+	}
+	choices := 1
+	if err := json.Unmarshal(body["n"], &choices); err != nil || choices < 1 {
+		choices = 1
+	}
+
+	inputCost := usage.TotalCost - float64(usage.OutputTokens)/1000.0*pricing.Output
+	affordable := int((remaining-inputCost)/pricing.Output*1000.0) / choices
+	if affordable <= 0 || (usage.OutputTokens > 0 && affordable >= usage.OutputTokens/choices) {
+		return
+	}
+
+	field := "max_tokens"
+	if _, ok := body["max_completion_tokens"]; ok {
+		field = "max_completion_tokens"
+	}
+	body[field] = json.RawMessage(strconv.Itoa(affordable))
+	if clamped, err := json.Marshal(body); err == nil {
+		req.RawBody = clamped
+		logger.L.Info("max tokens clamped to budget", "prefix", req.Key.Prefix, "max_tokens", affordable)
+	}
+}
+
 func (s *ProxyService) buildChain(config *domain.KeyConfiguration) domain.Handler {
 	if config == nil || len(config.Middlewares) == 0 {
 		return s.finalHandler
@@ -112,3 +298,9 @@ func (s *ProxyService) buildChain(config *domain.KeyConfiguration) domain.Handle
 
 	return domain.NewChain(s.finalHandler, mws...)
 }
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+	"time"
+)
+
+// reconcileInterval is how often stale reservations are looked for.
+const reconcileInterval = time.Minute
+
+// ListOpenReservations returns the reservations of requests that have not
+// settled yet.
+func (s *KeyService) ListOpenReservations(ctx context.Context) ([]*domain.Reservation, error) {
+	ledger, ok := s.repo.(domain.ReservationRepository)
+	if !ok {
+		return nil, nil
+	}
+	return ledger.ListReservations(ctx, domain.ReservationOpen, time.Now())
+}
+
+// ReconcileReservations expires the open reservations created at or before
+// the given time, either releasing their amount (ReservationRefunded) or
+// keeping it as the cost (ReservationCharged). It returns how many expired.
+func (s *KeyService) ReconcileReservations(ctx context.Context, before time.Time, state domain.ReservationState) (int, error) {
+	ledger, ok := s.repo.(domain.ReservationRepository)
+	if !ok {
+		return 0, nil
+	}
+
+	stale, err := ledger.ListReservations(ctx, domain.ReservationOpen, before)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, r := range stale {
+		ok, err := ledger.Expire(ctx, r.RequestID, state)
+		if err != nil {
+			return expired, err
+		}
+		if !ok {
+			// Settled in the meantime
+			continue
+		}
+		if state == domain.ReservationRefunded {
+			s.adjustCachedUsage(r.KeyID, -r.Amount)
+		}
+		logger.L.Warn("reservation expired", "request_id", r.RequestID, "key_id", r.KeyID, "amount", r.Amount, "state", state)
+		expired++
+	}
+	return expired, nil
+}
+
+// RunReservationReconciler expires the reservations older than ttl until ctx
+// is done. Reservations left open by a previous run should be reconciled
+// before serving, with ReconcileReservations(ctx, time.Now(), state).
+func (s *KeyService) RunReservationReconciler(ctx context.Context, ttl time.Duration, state domain.ReservationState) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ReconcileReservations(ctx, time.Now().Add(-ttl), state); err != nil {
+				logger.L.Warn("failed to reconcile reservations", "error", err)
+			}
+		}
+	}
+}
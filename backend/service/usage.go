@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+)
+
+// CommitRequest settles the request's reservation at e.ActualCost and
+// records e in the usage ledger, if the repository keeps one.
+func (s *KeyService) CommitRequest(ctx context.Context, e *domain.UsageEvent) error {
+	if err := s.CommitUsage(ctx, e.KeyID, e.RequestID, e.ReservedCost, e.ActualCost); err != nil {
+		return err
+	}
+
+	ledger, ok := s.repo.(domain.UsageRepository)
+	if !ok {
+		return nil
+	}
+	if err := ledger.RecordUsage(ctx, e); err != nil {
+		logger.L.Warn("failed to record usage", "key_id", e.KeyID, "request_id", e.RequestID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// KeyUsage is the usage of a key over a time range, by model.
+type KeyUsage struct {
+	Total  domain.UsageSummary
+	Models []*domain.UsageSummary
+	Events []*domain.UsageEvent
+}
+
+// GetKeyUsage returns the key's usage events matching q, newest first, with
+// their totals overall and by model.
+func (s *KeyService) GetKeyUsage(ctx context.Context, q domain.UsageQuery) (*KeyUsage, error) {
+	k, err := s.repo.GetByID(ctx, q.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, domain.ErrKeyNotFound
+	}
+
+	usage := &KeyUsage{}
+	ledger, ok := s.repo.(domain.UsageRepository)
+	if !ok {
+		return usage, nil
+	}
+	if usage.Models, err = ledger.SummarizeUsage(ctx, q); err != nil {
+		return nil, err
+	}
+	if usage.Events, err = ledger.ListUsage(ctx, q); err != nil {
+		return nil, err
+	}
+	for _, m := range usage.Models {
+		usage.Total.Requests += m.Requests
+		usage.Total.PromptTokens += m.PromptTokens
+		usage.Total.OutputTokens += m.OutputTokens
+		usage.Total.Cost += m.Cost
+	}
+	return usage, nil
+}
+
+// UsageReport returns the usage of the periods and groups selected by q,
+// read from the rollups of the usage ledger.
+func (s *KeyService) UsageReport(ctx context.Context, q domain.ReportQuery) ([]*domain.ReportRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	reports, ok := s.repo.(domain.ReportRepository)
+	if !ok {
+		return nil, domain.ErrNotSupported
+	}
+	return reports.UsageReport(ctx, q)
+}
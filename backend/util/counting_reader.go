@@ -3,36 +3,70 @@ package util
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"pouch-ai/backend/domain"
+	"pouch-ai/backend/util/logger"
+	"time"
 )
 
+// extendTokens is how many output tokens a capped stream's reservation is
+// extended by at a time.
+const extendTokens = 256
+
 type CountingReader struct {
-	inner       io.ReadCloser
-	provider    domain.Provider
-	model       domain.Model
-	committer   domain.UsageCommitter
-	keyID       domain.ID
-	ctx         context.Context
-	pending     []byte
-	totalTokens int
-	finalUsage  *domain.Usage
-	reserved    float64
+	inner        io.ReadCloser
+	req          *domain.Request
+	statusCode   int
+	promptTokens int
+	pending      []byte
+	totalTokens  int
+	finalUsage   *domain.Usage
+	pricing      domain.Pricing
+
+	// Set when the stream is cut off once its reservation cannot be extended
+	cancel context.CancelFunc
+	out    []byte
+	err    error
+	chunk  streamChunkMeta
+	cutOff bool
 }
 
-func NewCountingReader(inner io.ReadCloser, provider domain.Provider, model domain.Model, committer domain.UsageCommitter, keyID domain.ID, reserved float64, ctx context.Context) io.ReadCloser {
+// streamChunkMeta identifies the completion a chat stream belongs to.
+type streamChunkMeta struct {
+	ID      string `json:"id"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+}
+
+// NewCountingReader counts the output tokens of a streamed response and
+// commits the request's usage when closed. promptTokens is the estimate
+// used when the stream reports no usage.
+func NewCountingReader(inner io.ReadCloser, req *domain.Request, statusCode, promptTokens int) io.ReadCloser {
+	pricing, _ := req.Provider.GetPricing(req.Model)
 	return &CountingReader{
-		inner:     inner,
-		provider:  provider,
-		model:     model,
-		committer: committer,
-		keyID:     keyID,
-		reserved:  reserved,
-		ctx:       ctx,
+		inner:        inner,
+		req:          req,
+		statusCode:   statusCode,
+		promptTokens: promptTokens,
+		pricing:      pricing,
 	}
 }
 
+// NewCappedCountingReader is a CountingReader for a chat stream that extends
+// the request's reservation as the running cost outgrows it, and ends the
+// stream, as if it reached its max tokens, once the reservation cannot be
+// extended. cancel aborts the upstream request and is called on close.
+func NewCappedCountingReader(inner io.ReadCloser, req *domain.Request, statusCode, promptTokens int, cancel context.CancelFunc) io.ReadCloser {
+	r := NewCountingReader(inner, req, statusCode, promptTokens).(*CountingReader)
+	r.cancel = cancel
+	return r
+}
+
 func (r *CountingReader) Read(p []byte) (n int, err error) {
+	if r.cancel != nil {
+		return r.readCapped(p)
+	}
 	n, err = r.inner.Read(p)
 	if n > 0 {
 		r.pending = append(r.pending, p[:n]...)
@@ -41,33 +75,142 @@ func (r *CountingReader) Read(p []byte) (n int, err error) {
 			if idx == -1 {
 				break
 			}
-			line := r.pending[:idx+1]
-			_, tokens, usage, _ := r.provider.ParseStreamChunk(r.model, line)
-			if usage != nil {
-				r.finalUsage = usage
-			}
-			r.totalTokens += tokens
+			r.count(r.pending[:idx+1])
 			r.pending = r.pending[idx+1:]
 		}
 	}
 	return n, err
 }
 
+// readCapped passes the stream through a line at a time, so that it can be
+// ended between events.
+func (r *CountingReader) readCapped(p []byte) (int, error) {
+	for len(r.out) == 0 && r.err == nil {
+		n, err := r.inner.Read(p)
+		if n > 0 {
+			r.pending = append(r.pending, p[:n]...)
+			for !r.cutOff {
+				idx := bytes.IndexByte(r.pending, '\n')
+				if idx == -1 {
+					break
+				}
+				line := r.pending[:idx+1]
+				r.count(line)
+				r.out = append(r.out, line...)
+				r.pending = r.pending[idx+1:]
+				if r.finalUsage == nil && !r.reserve() {
+					r.cutOff = true
+					r.finish()
+				}
+			}
+		}
+		if r.cutOff {
+			r.cancel()
+			r.pending = nil
+			r.err = io.EOF
+		} else if err != nil {
+			r.out = append(r.out, r.pending...)
+			r.pending = nil
+			r.err = err
+		}
+	}
+
+	if len(r.out) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// count adds up the output of a line of the stream.
+func (r *CountingReader) count(line []byte) {
+	_, tokens, usage, _ := r.req.Provider.ParseStreamChunk(r.req.Model, line)
+	if usage != nil {
+		r.finalUsage = usage
+	}
+	r.totalTokens += tokens
+
+	if r.cancel != nil && r.chunk.ID == "" {
+		if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data: ")); ok {
+			_ = json.Unmarshal(data, &r.chunk)
+		}
+	}
+}
+
+// cost is the running cost of the stream, input included.
+func (r *CountingReader) cost() float64 {
+	return float64(r.promptTokens)/1000.0*r.pricing.Input + float64(r.totalTokens)/1000.0*r.pricing.Output
+}
+
+// reserve extends the reservation to cover the running cost, by at least
+// extendTokens of output, or else by just what is missing. It reports
+// whether the reservation covers the cost.
+func (r *CountingReader) reserve() bool {
+	missing := r.cost() - r.req.ReservedCost
+	if missing <= 0 {
+		return true
+	}
+	ctx := r.req.Context
+	step := max(missing, extendTokens/1000.0*r.pricing.Output)
+	if r.req.Reserver.ExtendReservation(ctx, r.req, step) == nil {
+		return true
+	}
+	return step > missing && r.req.Reserver.ExtendReservation(ctx, r.req, missing) == nil
+}
+
+// finish ends the current event and appends a final chunk with a length
+// finish reason, followed by the end of the stream.
+func (r *CountingReader) finish() {
+	if !bytes.HasSuffix(r.out, []byte("\n\n")) {
+		r.out = append(r.out, '\n')
+	}
+
+	type choice struct {
+		Index        int            `json:"index"`
+		Delta        map[string]any `json:"delta"`
+		FinishReason string         `json:"finish_reason"`
+	}
+	final := struct {
+		streamChunkMeta
+		Object  string   `json:"object"`
+		Choices []choice `json:"choices"`
+	}{
+		streamChunkMeta: r.chunk,
+		Object:          "chat.completion.chunk",
+		Choices:         []choice{{Delta: map[string]any{}, FinishReason: "length"}},
+	}
+	if final.Created == 0 {
+		final.Created = time.Now().Unix()
+	}
+	if final.Model == "" {
+		final.Model = string(r.req.Model)
+	}
+
+	data, _ := json.Marshal(final)
+	r.out = append(r.out, "data: "...)
+	r.out = append(r.out, data...)
+	r.out = append(r.out, "\n\ndata: [DONE]\n\n"...)
+}
+
 func (r *CountingReader) Close() error {
 	defer r.inner.Close()
+	if r.cancel != nil {
+		defer r.cancel()
+	}
 
-	var actual float64
-	if r.finalUsage != nil {
-		actual = r.finalUsage.TotalCost
-	} else {
-		pricing, err := r.provider.GetPricing(r.model)
-		if err == nil {
-			actual = float64(r.totalTokens) / 1000.0 * pricing.Output
-		}
+	// Streams that were cut off never get a final usage chunk
+	usage := r.finalUsage
+	if usage == nil {
+		usage = &domain.Usage{InputTokens: r.promptTokens, OutputTokens: r.totalTokens, TotalCost: r.cost()}
 	}
 
-	if r.committer != nil {
-		_ = r.committer.CommitUsage(r.ctx, r.keyID, r.reserved, actual)
+	if r.req.Committer != nil && r.req.Key != nil {
+		// The stream may have ended because the client went away
+		ctx := context.WithoutCancel(r.req.Context)
+		if err := r.req.Committer.CommitRequest(ctx, r.req.UsageEvent(r.statusCode, usage)); err != nil {
+			logger.L.Warn("failed to commit usage", "prefix", r.req.Key.Prefix, "request_id", r.req.RequestID, "error", err)
+		}
 	}
 
 	return nil
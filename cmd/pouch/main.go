@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	_ "time/tzdata" // Budget timezones must resolve without system zoneinfo
 
 	"pouch-ai/backend/config"
 	"pouch-ai/backend/server"
@@ -25,7 +26,28 @@ func main() {
 	port := flag.Int("port", cfg.Port, "Port to listen on")
 	openaiURL := flag.String("openai-url", cfg.OpenAIURL, "Target OpenAI API Base URL")
 	openaiKey := flag.String("openai-api-key", cfg.OpenAIKey, "OpenAI API Key")
+	anthropicURL := flag.String("anthropic-url", cfg.AnthropicURL, "Target Anthropic API Base URL")
+	anthropicKey := flag.String("anthropic-api-key", cfg.AnthropicKey, "Anthropic API Key")
+	geminiURL := flag.String("gemini-url", cfg.GeminiURL, "Target Gemini API Base URL")
+	geminiKey := flag.String("gemini-api-key", cfg.GeminiKey, "Gemini API Key")
+	azureURL := flag.String("azure-openai-url", cfg.AzureOpenAIURL, "Azure OpenAI resource endpoint (e.g. https://my-resource.openai.azure.com)")
+	azureKey := flag.String("azure-openai-api-key", cfg.AzureOpenAIKey, "Azure OpenAI API Key")
+	azureAPIVersion := flag.String("azure-openai-api-version", cfg.AzureOpenAIAPIVersion, "Azure OpenAI API version")
+	azureDeployments := flag.String("azure-openai-deployments", cfg.AzureOpenAIDeployments, "Comma-separated model=deployment mapping for Azure OpenAI")
+	bedrockRegion := flag.String("bedrock-region", cfg.BedrockRegion, "AWS region for Bedrock")
+	bedrockURL := flag.String("bedrock-url", cfg.BedrockURL, "Bedrock runtime endpoint override")
+	bedrockAccessKeyID := flag.String("bedrock-access-key-id", cfg.BedrockAccessKeyID, "AWS access key ID for Bedrock")
+	bedrockSecretAccessKey := flag.String("bedrock-secret-access-key", cfg.BedrockSecretAccessKey, "AWS secret access key for Bedrock")
 	dataDir := flag.String("data", cfg.DataDir, "Directory to store data")
+	configFile := flag.String("config", cfg.ConfigFile, "Path to a JSON config file (e.g. OpenAI-compatible providers)")
+	reservationTTL := flag.Duration("reservation-ttl", cfg.ReservationTTL, "How long a budget reservation may stay open before it is reconciled")
+	reservationPolicy := flag.String("reservation-policy", cfg.ReservationPolicy, "How stale reservations are reconciled: refund or charge")
+	unknownModelPolicy := flag.String("unknown-model-policy", cfg.UnknownModelPolicy, "How requests for models without pricing are handled: reject, fallback or allow")
+	unknownModelInputPrice := flag.Float64("unknown-model-input-price", cfg.UnknownModelInputPrice, "Fallback USD per 1k input tokens for models without pricing")
+	unknownModelOutputPrice := flag.Float64("unknown-model-output-price", cfg.UnknownModelOutputPrice, "Fallback USD per 1k output tokens for models without pricing")
+	budgetTimezone := flag.String("budget-timezone", cfg.BudgetTimezone, "IANA timezone that daily, weekly and monthly budget periods are aligned to")
+	billingDriftThreshold := flag.Float64("billing-drift-threshold", cfg.BillingDriftThreshold, "Percentage of drift between provider billing and the usage ledger that is flagged")
+	billingDriftMin := flag.Float64("billing-drift-min", cfg.BillingDriftMin, "Smallest drift in USD between provider billing and the usage ledger that is flagged")
 	corsOrigins := flag.String("cors-origins", strings.Join(cfg.AllowedOrigins, ","), "Comma-separated list of allowed CORS origins")
 	flag.Parse()
 
@@ -33,7 +55,28 @@ func main() {
 	cfg.Port = *port
 	cfg.OpenAIURL = *openaiURL
 	cfg.OpenAIKey = *openaiKey
+	cfg.AnthropicURL = *anthropicURL
+	cfg.AnthropicKey = *anthropicKey
+	cfg.GeminiURL = *geminiURL
+	cfg.GeminiKey = *geminiKey
+	cfg.AzureOpenAIURL = *azureURL
+	cfg.AzureOpenAIKey = *azureKey
+	cfg.AzureOpenAIAPIVersion = *azureAPIVersion
+	cfg.AzureOpenAIDeployments = *azureDeployments
+	cfg.BedrockRegion = *bedrockRegion
+	cfg.BedrockURL = *bedrockURL
+	cfg.BedrockAccessKeyID = *bedrockAccessKeyID
+	cfg.BedrockSecretAccessKey = *bedrockSecretAccessKey
 	cfg.DataDir = *dataDir
+	cfg.ConfigFile = *configFile
+	cfg.ReservationTTL = *reservationTTL
+	cfg.ReservationPolicy = *reservationPolicy
+	cfg.UnknownModelPolicy = *unknownModelPolicy
+	cfg.UnknownModelInputPrice = *unknownModelInputPrice
+	cfg.UnknownModelOutputPrice = *unknownModelOutputPrice
+	cfg.BudgetTimezone = *budgetTimezone
+	cfg.BillingDriftThreshold = *billingDriftThreshold
+	cfg.BillingDriftMin = *billingDriftMin
 	if *corsOrigins != "" {
 		cfg.AllowedOrigins = strings.Split(*corsOrigins, ",")
 		for i := range cfg.AllowedOrigins {
@@ -45,6 +88,9 @@ func main() {
 	if err := cfg.LoadEnv(); err != nil {
 		log.Fatalf("Failed to load environment variables: %v", err)
 	}
+	if err := cfg.LoadFile(); err != nil {
+		log.Fatalf("Failed to load config file: %v", err)
+	}
 
 	// Ensure absolute path for data integrity
 	absDataDir, err := filepath.Abs(cfg.DataDir)
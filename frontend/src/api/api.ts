@@ -1,4 +1,4 @@
-import type { Key, MiddlewareInfo, ProviderInfo, CreateKeyRequest, UpdateKeyRequest } from "../types";
+import type { Key, MiddlewareInfo, ProviderInfo, CreateKeyRequest, UpdateKeyRequest, Organization, OrganizationRequest, Project, ProjectRequest } from "../types";
 
 const BASE_URL = "/v1";
 
@@ -43,6 +43,34 @@ export const api = {
             method: "DELETE",
         }),
     },
+    organizations: {
+        list: () => request<Organization[]>("/config/organizations", { cache: "no-store" }),
+        create: (data: OrganizationRequest) => request<Organization>("/config/organizations", {
+            method: "POST",
+            body: JSON.stringify(data),
+        }),
+        update: (id: number, data: OrganizationRequest) => request<void>(`/config/organizations/${id}`, {
+            method: "PUT",
+            body: JSON.stringify(data),
+        }),
+        delete: (id: number) => request<void>(`/config/organizations/${id}`, {
+            method: "DELETE",
+        }),
+    },
+    projects: {
+        list: () => request<Project[]>("/config/projects", { cache: "no-store" }),
+        create: (data: ProjectRequest) => request<Project>("/config/projects", {
+            method: "POST",
+            body: JSON.stringify(data),
+        }),
+        update: (id: number, data: ProjectRequest) => request<void>(`/config/projects/${id}`, {
+            method: "PUT",
+            body: JSON.stringify(data),
+        }),
+        delete: (id: number) => request<void>(`/config/projects/${id}`, {
+            method: "DELETE",
+        }),
+    },
     plugins: {
         middlewares: () => request<{ middlewares: MiddlewareInfo[] }>("/config/middlewares", { cache: "no-store" }),
         providers: () => request<{ providers: ProviderInfo[] }>("/config/providers", { cache: "no-store" }),
@@ -17,6 +17,7 @@ export default function KeyCard({ keyData, onEdit, onRevoke }: Props) {
         name,
         prefix,
         budget_usage,
+        model_usage,
         configuration,
         auto_renew,
     } = keyData;
@@ -51,6 +52,11 @@ export default function KeyCard({ keyData, onEdit, onRevoke }: Props) {
                             <span class="text-[10px] font-medium text-white/20">/ {budgetLimit > 0 ? "$" + budgetLimit.toFixed(0) : "∞"}</span>
                         </div>
                         <ProgressBar percent={usagePercent} />
+                        {configuration?.model_budgets?.map(b => (
+                            <div key={b.model} class="text-[10px] font-medium text-white/30">
+                                {b.model}: ${(model_usage?.[b.model] || 0).toFixed(2)} / ${b.limit.toFixed(2)}
+                            </div>
+                        ))}
                     </div>
 
                     <div class="space-y-1 hidden md:block">
@@ -1,7 +1,7 @@
 import { useState, useEffect } from "preact/hooks";
-import type { MiddlewareInfo, ProviderInfo } from "../../types";
+import type { MiddlewareInfo, ProviderInfo, ResetInterval, UnknownModelPolicy } from "../../types";
 import { api } from "../../api/api";
-import KeyForm from "./KeyForm";
+import KeyForm, { buildResetSchedule, parseAlertThresholds, parseAllowedModels, parseModelBudgets } from "./KeyForm";
 
 interface Props {
     isOpen: boolean;
@@ -20,6 +20,17 @@ const INITIAL_FORM_DATA = {
     expiresAt: null,
     budgetLimit: "5.00",
     resetPeriod: "2592000",
+    resetInterval: "" as ResetInterval | "",
+    resetDay: "1",
+    resetTimezone: "",
+    allowedModels: "",
+    modelBudgets: "",
+    alertThresholds: "",
+    clampMaxTokens: false,
+    softLimit: false,
+    streamCutoff: false,
+    unknownModelPolicy: "" as UnknownModelPolicy,
+    projectId: 0,
 };
 
 export default function CreateKeyModal({ isOpen, onClose, onSuccess, middlewareInfos, providerInfos }: Props) {
@@ -62,6 +73,15 @@ export default function CreateKeyModal({ isOpen, onClose, onSuccess, middlewareI
                 middlewares: formData.middlewares,
                 budget_limit: parseFloat(formData.budgetLimit) || 0,
                 reset_period: parseInt(formData.resetPeriod) || 0,
+                reset_schedule: buildResetSchedule(formData.resetInterval, formData.resetDay, formData.resetTimezone),
+                allowed_models: parseAllowedModels(formData.allowedModels),
+                model_budgets: parseModelBudgets(formData.modelBudgets),
+                alert_thresholds: parseAlertThresholds(formData.alertThresholds),
+                clamp_max_tokens: formData.clampMaxTokens,
+                soft_limit: formData.softLimit,
+                stream_cutoff: formData.streamCutoff,
+                unknown_model_policy: formData.unknownModelPolicy,
+                project_id: formData.projectId || undefined,
             });
 
             onSuccess(data.key);
@@ -1,7 +1,7 @@
 import { useState, useEffect } from "preact/hooks";
-import type { Key, MiddlewareInfo, ProviderInfo } from "../../types";
+import type { Key, MiddlewareInfo, ProviderInfo, ResetInterval, UnknownModelPolicy } from "../../types";
 import { api } from "../../api/api";
-import KeyForm from "./KeyForm";
+import KeyForm, { buildResetSchedule, formatModelBudgets, parseAlertThresholds, parseAllowedModels, parseModelBudgets } from "./KeyForm";
 
 interface Props {
     isOpen: boolean;
@@ -20,6 +20,17 @@ const INITIAL_FORM_DATA = {
     expiresAt: null,
     budgetLimit: "0",
     resetPeriod: "0",
+    resetInterval: "" as ResetInterval | "",
+    resetDay: "1",
+    resetTimezone: "",
+    allowedModels: "",
+    modelBudgets: "",
+    alertThresholds: "",
+    clampMaxTokens: false,
+    softLimit: false,
+    streamCutoff: false,
+    unknownModelPolicy: "" as UnknownModelPolicy,
+    projectId: 0,
 };
 
 export default function EditKeyModal({ isOpen, onClose, editKey, middlewareInfos, providerInfos }: Props) {
@@ -39,6 +50,17 @@ export default function EditKeyModal({ isOpen, onClose, editKey, middlewareInfos
                 expiresAt: editKey.expires_at,
                 budgetLimit: (editKey.configuration?.budget_limit || 0).toString(),
                 resetPeriod: (editKey.configuration?.reset_period || 0).toString(),
+                resetInterval: editKey.configuration?.reset_schedule?.interval || "",
+                resetDay: (editKey.configuration?.reset_schedule?.day ?? 1).toString(),
+                resetTimezone: editKey.configuration?.reset_schedule?.timezone || "",
+                allowedModels: (editKey.configuration?.allowed_models || []).join(", "),
+                modelBudgets: formatModelBudgets(editKey.configuration?.model_budgets),
+                alertThresholds: (editKey.configuration?.alert_thresholds || []).join(", "),
+                clampMaxTokens: editKey.configuration?.clamp_max_tokens || false,
+                softLimit: editKey.configuration?.soft_limit || false,
+                streamCutoff: editKey.configuration?.stream_cutoff || false,
+                unknownModelPolicy: editKey.configuration?.unknown_model_policy || "",
+                projectId: editKey.configuration?.project_id || 0,
             });
         }
     }, [editKey]);
@@ -55,6 +77,15 @@ export default function EditKeyModal({ isOpen, onClose, editKey, middlewareInfos
                 middlewares: formData.middlewares,
                 budget_limit: parseFloat(formData.budgetLimit) || 0,
                 reset_period: parseInt(formData.resetPeriod) || 0,
+                reset_schedule: buildResetSchedule(formData.resetInterval, formData.resetDay, formData.resetTimezone),
+                allowed_models: parseAllowedModels(formData.allowedModels),
+                model_budgets: parseModelBudgets(formData.modelBudgets),
+                alert_thresholds: parseAlertThresholds(formData.alertThresholds),
+                clamp_max_tokens: formData.clampMaxTokens,
+                soft_limit: formData.softLimit,
+                stream_cutoff: formData.streamCutoff,
+                unknown_model_policy: formData.unknownModelPolicy,
+                project_id: formData.projectId || undefined,
             });
             window.dispatchEvent(new CustomEvent('refresh-keys'));
             onClose();
@@ -1,4 +1,6 @@
-import type { MiddlewareInfo, PluginConfig, ProviderInfo } from "../../types";
+import { useState, useEffect } from "preact/hooks";
+import type { MiddlewareInfo, ModelBudget, PluginConfig, Project, ProviderInfo, ResetInterval, ResetSchedule, UnknownModelPolicy } from "../../types";
+import { api } from "../../api/api";
 import MiddlewareComposition from "./MiddlewareComposition";
 import ProviderConfigSection from "./ProviderConfigSection";
 
@@ -11,6 +13,17 @@ interface KeyFormData {
     expiresAt: number | null;
     budgetLimit: string;
     resetPeriod: string;
+    resetInterval: ResetInterval | "";
+    resetDay: string;
+    resetTimezone: string;
+    allowedModels: string;
+    modelBudgets: string;
+    alertThresholds: string;
+    clampMaxTokens: boolean;
+    softLimit: boolean;
+    streamCutoff: boolean;
+    unknownModelPolicy: UnknownModelPolicy;
+    projectId: number;
 }
 
 interface Props {
@@ -23,6 +36,38 @@ interface Props {
     setExpirationDays?: (days: string) => void;
 }
 
+export function parseAllowedModels(value: string): string[] {
+    return value.split(",").map(m => m.trim()).filter(m => m !== "");
+}
+
+// parseModelBudgets reads "pattern=limit" pairs, e.g. "gpt-4*=5, o1=2".
+export function parseModelBudgets(value: string): ModelBudget[] {
+    return value.split(",")
+        .map(entry => entry.split("="))
+        .filter(([model, limit]) => model?.trim() && limit !== undefined)
+        .map(([model, limit]) => ({ model: model.trim(), limit: parseFloat(limit) || 0 }));
+}
+
+// parseAlertThresholds reads comma-separated percentages, e.g. "50, 80, 100".
+export function parseAlertThresholds(value: string): number[] {
+    return value.split(",").map(t => parseInt(t)).filter(t => t > 0);
+}
+
+export function formatModelBudgets(budgets: ModelBudget[] = []): string {
+    return budgets.map(b => `${b.model}=${b.limit}`).join(", ");
+}
+
+const WEEKDAYS = ["Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"];
+
+export function buildResetSchedule(interval: ResetInterval | "", day: string, timezone: string): ResetSchedule | undefined {
+    if (interval === "") return undefined;
+    return {
+        interval,
+        day: interval === "daily" ? 0 : parseInt(day) || 0,
+        timezone: timezone.trim() || undefined,
+    };
+}
+
 export default function KeyForm({
     formData,
     setFormData,
@@ -32,6 +77,12 @@ export default function KeyForm({
     expirationDays,
     setExpirationDays
 }: Props) {
+    const [projects, setProjects] = useState<Project[]>([]);
+
+    useEffect(() => {
+        api.projects.list().then(setProjects).catch(() => setProjects([]));
+    }, []);
+
     const handleProviderChange = (newProviderId: string) => {
         const info = providerInfos.find(p => p.id === newProviderId);
         const defaults = info?.schema ? Object.keys(info.schema).reduce((acc, key) => {
@@ -137,15 +188,166 @@ export default function KeyForm({
                     </label>
                     <div class="text-[10px] text-white/30 pl-8">Automatically reset budget and extend expiration</div>
                 </div>
+                <div class="form-control">
+                    <label class="label pb-1 cursor-pointer flex justify-start gap-3">
+                        <input
+                            type="checkbox"
+                            checked={formData.clampMaxTokens}
+                            onChange={(e) => setFormData(prev => ({ ...prev, clampMaxTokens: e.currentTarget.checked }))}
+                            class="checkbox checkbox-primary checkbox-sm rounded-md"
+                        />
+                        <span class="label-text text-sm font-medium text-white/70">Clamp Max Tokens</span>
+                    </label>
+                    <div class="text-[10px] text-white/30 pl-8">Lower max_tokens to what the remaining budget can afford</div>
+                </div>
+                <div class="form-control">
+                    <label class="label pb-1 cursor-pointer flex justify-start gap-3">
+                        <input
+                            type="checkbox"
+                            checked={formData.softLimit}
+                            onChange={(e) => setFormData(prev => ({ ...prev, softLimit: e.currentTarget.checked }))}
+                            class="checkbox checkbox-primary checkbox-sm rounded-md"
+                        />
+                        <span class="label-text text-sm font-medium text-white/70">Soft Limit</span>
+                    </label>
+                    <div class="text-[10px] text-white/30 pl-8">Allow requests past the budget and send an alert instead</div>
+                </div>
+                <div class="form-control">
+                    <label class="label pb-1 cursor-pointer flex justify-start gap-3">
+                        <input
+                            type="checkbox"
+                            checked={formData.streamCutoff}
+                            onChange={(e) => setFormData(prev => ({ ...prev, streamCutoff: e.currentTarget.checked }))}
+                            class="checkbox checkbox-primary checkbox-sm rounded-md"
+                        />
+                        <span class="label-text text-sm font-medium text-white/70">Stream Cutoff</span>
+                    </label>
+                    <div class="text-[10px] text-white/30 pl-8">End streaming responses once they use up the budget</div>
+                </div>
+                <div class="form-control">
+                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Alert Thresholds (%)</span></label>
+                    <input
+                        type="text"
+                        value={formData.alertThresholds}
+                        onInput={(e) => setFormData(prev => ({ ...prev, alertThresholds: e.currentTarget.value }))}
+                        placeholder="Server default, e.g. 50, 80, 100"
+                        class="input input-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                    />
+                </div>
+                <div class="form-control">
+                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Budget Reset</span></label>
+                    <select
+                        value={formData.resetInterval}
+                        onChange={(e) => setFormData(prev => ({ ...prev, resetInterval: e.currentTarget.value as ResetInterval | "", resetDay: "1" }))}
+                        class="select select-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                    >
+                        <option value="">Every N Seconds</option>
+                        <option value="daily">Daily</option>
+                        <option value="weekly">Weekly</option>
+                        <option value="monthly">Monthly</option>
+                    </select>
+                </div>
+                {formData.resetInterval === "" ? (
+                    <div class="form-control">
+                        <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Reset Period (Seconds)</span></label>
+                        <input
+                            type="number"
+                            value={formData.resetPeriod}
+                            onInput={(e) => setFormData(prev => ({ ...prev, resetPeriod: e.currentTarget.value }))}
+                            placeholder="2592000 = 30 days"
+                            class="input input-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                        />
+                    </div>
+                ) : (
+                    <div class="form-control">
+                        <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Timezone</span></label>
+                        <input
+                            type="text"
+                            value={formData.resetTimezone}
+                            onInput={(e) => setFormData(prev => ({ ...prev, resetTimezone: e.currentTarget.value }))}
+                            placeholder="Server default, e.g. Europe/Berlin"
+                            class="input input-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                        />
+                    </div>
+                )}
+                {formData.resetInterval === "weekly" && (
+                    <div class="form-control sm:col-span-2">
+                        <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Reset On</span></label>
+                        <select
+                            value={formData.resetDay}
+                            onChange={(e) => setFormData(prev => ({ ...prev, resetDay: e.currentTarget.value }))}
+                            class="select select-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                        >
+                            {WEEKDAYS.map((name, i) => (
+                                <option key={name} value={String(i)}>{name}</option>
+                            ))}
+                        </select>
+                    </div>
+                )}
+                {formData.resetInterval === "monthly" && (
+                    <div class="form-control sm:col-span-2">
+                        <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Reset On Day</span></label>
+                        <input
+                            type="number"
+                            min="1"
+                            max="31"
+                            value={formData.resetDay}
+                            onInput={(e) => setFormData(prev => ({ ...prev, resetDay: e.currentTarget.value }))}
+                            placeholder="1"
+                            class="input input-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                        />
+                        <div class="text-[10px] text-white/30 pt-1">Months without this day reset on their last day</div>
+                    </div>
+                )}
                 <div class="form-control sm:col-span-2">
-                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Reset Period (Seconds)</span></label>
+                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Allowed Models</span></label>
                     <input
-                        type="number"
-                        value={formData.resetPeriod}
-                        onInput={(e) => setFormData(prev => ({ ...prev, resetPeriod: e.currentTarget.value }))}
-                        placeholder="2592000 = 30 days"
+                        type="text"
+                        value={formData.allowedModels}
+                        onInput={(e) => setFormData(prev => ({ ...prev, allowedModels: e.currentTarget.value }))}
+                        placeholder="e.g. gpt-4o, gpt-4o-mini*"
                         class="input input-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
                     />
+                    <div class="text-[10px] text-white/30 pt-1">Comma-separated; a trailing * matches a prefix. Leave empty to allow all models.</div>
+                </div>
+                <div class="form-control sm:col-span-2">
+                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Model Budgets (USD)</span></label>
+                    <input
+                        type="text"
+                        value={formData.modelBudgets}
+                        onInput={(e) => setFormData(prev => ({ ...prev, modelBudgets: e.currentTarget.value }))}
+                        placeholder="e.g. gpt-4*=5, o1=2"
+                        class="input input-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                    />
+                    <div class="text-[10px] text-white/30 pt-1">Caps on some models within the key's budget, reset with it. Other models are only limited by the key's budget.</div>
+                </div>
+                <div class="form-control sm:col-span-2">
+                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Project</span></label>
+                    <select
+                        value={String(formData.projectId)}
+                        onChange={(e) => setFormData(prev => ({ ...prev, projectId: Number(e.currentTarget.value) }))}
+                        class="select select-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                    >
+                        <option value="0">None</option>
+                        {projects.map(p => (
+                            <option key={p.id} value={String(p.id)}>{p.name}</option>
+                        ))}
+                    </select>
+                    <div class="text-[10px] text-white/30 pt-1">Usage also counts against the project's budget and that of its organization</div>
+                </div>
+                <div class="form-control sm:col-span-2">
+                    <label class="label pb-1"><span class="label-text text-xs text-white/50 font-medium">Unknown Models</span></label>
+                    <select
+                        value={formData.unknownModelPolicy}
+                        onChange={(e) => setFormData(prev => ({ ...prev, unknownModelPolicy: e.currentTarget.value as UnknownModelPolicy }))}
+                        class="select select-bordered w-full bg-base-200/50 border-white/10 rounded-lg h-10"
+                    >
+                        <option value="">Server Default</option>
+                        <option value="reject">Reject</option>
+                        <option value="fallback">Price at Fallback Rate</option>
+                        <option value="allow">Allow Unmetered</option>
+                    </select>
+                    <div class="text-[10px] text-white/30 pt-1">How requests for models without pricing are handled</div>
                 </div>
             </div>
 
@@ -8,11 +8,36 @@ export interface KeyConfiguration {
     middlewares: PluginConfig[];
     budget_limit: number;
     reset_period: number;
+    reset_schedule?: ResetSchedule;
+    allowed_models?: string[];
+    clamp_max_tokens?: boolean;
+    unknown_model_policy?: UnknownModelPolicy;
+    project_id?: number;
+    model_budgets?: ModelBudget[];
+    alert_thresholds?: number[];
+    soft_limit?: boolean;
+    stream_cutoff?: boolean;
+    own_credentials?: boolean;
+}
+
+export type UnknownModelPolicy = "" | "reject" | "fallback" | "allow";
+
+export interface ModelBudget {
+    model: string;
+    limit: number;
+}
+
+export type ResetInterval = "daily" | "weekly" | "monthly";
+
+export interface ResetSchedule {
+    interval: ResetInterval;
+    day?: number;
+    timezone?: string;
 }
 
 export type FieldType = "string" | "number" | "boolean" | "select";
 
-export type FieldRole = "limit" | "period";
+export type FieldRole = "limit" | "period" | "credential";
 
 export interface FieldSchema {
     type: FieldType;
@@ -44,6 +69,15 @@ export interface CreateKeyRequest {
     middlewares: PluginConfig[];
     budget_limit: number;
     reset_period: number;
+    reset_schedule?: ResetSchedule;
+    allowed_models?: string[];
+    clamp_max_tokens?: boolean;
+    unknown_model_policy?: UnknownModelPolicy;
+    project_id?: number;
+    model_budgets?: ModelBudget[];
+    alert_thresholds?: number[];
+    soft_limit?: boolean;
+    stream_cutoff?: boolean;
 }
 
 export interface UpdateKeyRequest {
@@ -54,6 +88,15 @@ export interface UpdateKeyRequest {
     middlewares?: PluginConfig[];
     budget_limit?: number;
     reset_period?: number;
+    reset_schedule?: ResetSchedule;
+    allowed_models?: string[];
+    clamp_max_tokens?: boolean;
+    unknown_model_policy?: UnknownModelPolicy;
+    project_id?: number;
+    model_budgets?: ModelBudget[];
+    alert_thresholds?: number[];
+    soft_limit?: boolean;
+    stream_cutoff?: boolean;
 }
 
 export interface Key {
@@ -63,6 +106,41 @@ export interface Key {
     expires_at: number | null;
     auto_renew: boolean;
     budget_usage: number;
+    model_usage?: Record<string, number>;
     created_at: number;
     configuration: KeyConfiguration;
 }
+
+export interface Organization {
+    id: number;
+    name: string;
+    budget_limit: number;
+    budget_usage: number;
+    reset_period: number;
+    reset_schedule?: ResetSchedule;
+    last_reset_at: number;
+    created_at: number;
+}
+
+export interface Project {
+    id: number;
+    org_id?: number;
+    name: string;
+    budget_limit: number;
+    budget_usage: number;
+    reset_period: number;
+    reset_schedule?: ResetSchedule;
+    last_reset_at: number;
+    created_at: number;
+}
+
+export interface OrganizationRequest {
+    name: string;
+    budget_limit: number;
+    reset_period: number;
+    reset_schedule?: ResetSchedule;
+}
+
+export interface ProjectRequest extends OrganizationRequest {
+    org_id?: number;
+}
@@ -0,0 +1,63 @@
+package api_test
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestProxyEndpoint_Transcriptions(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audio/transcriptions" {
+			t.Errorf("unexpected upstream path: %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("upstream could not read multipart body: %v", err)
+		} else if r.FormValue("model") != "whisper-1" {
+			t.Errorf("unexpected model field: %q", r.FormValue("model"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"text": "hello", "usage": {"type": "duration", "seconds": 42}}`)
+	}))
+	defer upstream.Close()
+
+	repo := &usageRecordingRepository{}
+	handler := newEndpointTestHandler(t, upstream.URL, repo)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("model", "whisper-1")
+	fw, _ := mw.CreateFormFile("file", "speech.mp3")
+	fw.Write(bytes.Repeat([]byte{0xff}, 8000))
+	mw.Close()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &body)
+	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID:            1,
+		Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "openai"}},
+	})
+
+	if err := handler.ProxyEndpoint(domain.EndpointTranscriptions)(c); err != nil {
+		t.Fatalf("ProxyEndpoint failed: %v", err)
+	}
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "hello") {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Settled to the reported duration: 42 seconds at $0.0001/s
+	if got := fmt.Sprintf("%.4f", repo.total()); got != "0.0042" {
+		t.Errorf("expected committed usage 0.0042, got %s", got)
+	}
+}
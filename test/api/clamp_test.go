@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/api"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/infra/engine"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestProxy_ClampMaxTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field string
+		want  float64
+	}{
+		// $0.1 affords 6666 output tokens of gpt-4o after the 1 token prompt
+		{"max_tokens", `{"model": "gpt-4o", "max_tokens": 100000, "messages": [{"role": "user", "content": "hello"}]}`, "max_tokens", 6666},
+		{"max_completion_tokens", `{"model": "gpt-4o", "max_completion_tokens": 100000, "messages": [{"role": "user", "content": "hello"}]}`, "max_completion_tokens", 6666},
+		{"no cap", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hello"}]}`, "max_tokens", 6666},
+		// Shared between the choices
+		{"n choices", `{"model": "gpt-4o", "max_tokens": 100000, "n": 4, "messages": [{"role": "user", "content": "hello"}]}`, "max_tokens", 1666},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]any
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(body, &sent)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"choices": [{"message": {"content": "hi"}}], "usage": {"prompt_tokens": 1, "completion_tokens": 1}}`)
+			}))
+			defer upstream.Close()
+
+			repo := &usageRecordingRepository{}
+			handler := newEndpointTestHandler(t, upstream.URL, repo)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("app_key", &domain.Key{
+				ID: 1,
+				Configuration: &domain.KeyConfiguration{
+					Provider:       domain.PluginConfig{ID: "openai"},
+					BudgetLimit:    0.1,
+					ClampMaxTokens: true,
+				},
+			})
+
+			if err := handler.Proxy(c); err != nil {
+				t.Fatalf("Proxy failed: %v", err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			if got, ok := sent[tt.field].(float64); !ok || got != tt.want {
+				t.Errorf("expected %s clamped to %g, got %v", tt.field, tt.want, sent[tt.field])
+			}
+		})
+	}
+}
+
+// Requests are clamped to the tightest budget they are reserved against,
+// not only the key's
+func TestProxy_ClampMaxTokens_TightestBudget(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	var sent map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &sent)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "hi"}}], "usage": {"prompt_tokens": 1, "completion_tokens": 1}}`)
+	}))
+	defer upstream.Close()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	provider := providers.NewOpenAIProvider("test-key", upstream.URL, pricing, &charCounter{})
+	registry.Register(provider.Name(), provider)
+	mwRegistry := domain.NewMiddlewareRegistry()
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	keyService := service.NewKeyService(repo, registry, mwRegistry)
+	hierarchy := service.NewHierarchyService(repo)
+	handler := api.NewProxyHandler(service.NewProxyService(engine.NewExecutionHandler(repo), mwRegistry, keyService), registry)
+
+	p, err := hierarchy.CreateProject(ctx, service.ProjectInput{Name: "web", BudgetLimit: 0.1})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	tests := []struct {
+		name  string
+		input service.CreateKeyInput
+	}{
+		{"project", service.CreateKeyInput{ProjectID: p.ID}},
+		{"model budget", service.CreateKeyInput{ModelBudgets: []domain.ModelBudget{{Model: "gpt-4o", Limit: 0.1}}}},
+		{"soft key limit", service.CreateKeyInput{ProjectID: p.ID, BudgetLimit: 0.01, SoftLimit: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			input.Name = tt.name
+			input.Provider = domain.PluginConfig{ID: "openai"}
+			input.ClampMaxTokens = true
+			if input.BudgetLimit == 0 {
+				input.BudgetLimit = 10
+			}
+			_, k, err := keyService.CreateKey(ctx, input)
+			if err != nil {
+				t.Fatalf("CreateKey failed: %v", err)
+			}
+
+			body := `{"model": "gpt-4o", "max_tokens": 100000, "messages": [{"role": "user", "content": "hello"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.Set("app_key", k)
+
+			if err := handler.Proxy(c); err != nil {
+				t.Fatalf("Proxy failed: %v", err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			// Each request spends a little of the $0.1 project budget
+			if got, ok := sent["max_tokens"].(float64); !ok || got < 6600 || got > 6666 {
+				t.Errorf("expected max_tokens clamped to the $0.1 budget, got %v", sent["max_tokens"])
+			}
+		})
+	}
+}
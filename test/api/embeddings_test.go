@@ -0,0 +1,139 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"pouch-ai/backend/api"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/infra/engine"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// usageRecordingRepository sums the usage increments of reservations and commits.
+type usageRecordingRepository struct {
+	MockRepository
+	mu    sync.Mutex
+	usage float64
+}
+
+func (m *usageRecordingRepository) IncrementUsage(ctx context.Context, id domain.ID, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage += amount
+	return nil
+}
+
+func (m *usageRecordingRepository) ReserveUsage(ctx context.Context, id domain.ID, amount float64) error {
+	return m.IncrementUsage(ctx, id, amount)
+}
+
+func (m *usageRecordingRepository) total() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// charCounter counts four characters as one token.
+type charCounter struct{}
+
+func (c *charCounter) Count(model string, text string) (int, error) {
+	return len(text) / 4, nil
+}
+
+func newEndpointTestHandler(t *testing.T, upstream string, repo domain.Repository) *api.ProxyHandler {
+	t.Helper()
+	handler, _ := newEndpointTestHandlerWithService(t, upstream, repo)
+	return handler
+}
+
+func newEndpointTestHandlerWithService(t *testing.T, upstream string, repo domain.Repository) (*api.ProxyHandler, *service.ProxyService) {
+	t.Helper()
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+
+	registry := domain.NewProviderRegistry()
+	provider := providers.NewOpenAIProvider("test-key", upstream, pricing, &charCounter{})
+	registry.Register(provider.Name(), provider)
+
+	mwRegistry := domain.NewMiddlewareRegistry()
+	keyService := service.NewKeyService(repo, registry, mwRegistry)
+	proxyService := service.NewProxyService(engine.NewExecutionHandler(repo), mwRegistry, keyService)
+	return api.NewProxyHandler(proxyService, registry), proxyService
+}
+
+func TestProxyEndpoint_Embeddings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("unexpected upstream path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object": "list", "data": [{"object": "embedding", "index": 0, "embedding": [0.1, 0.2]}],
+			"model": "text-embedding-3-large", "usage": {"prompt_tokens": 1000, "total_tokens": 1000}}`)
+	}))
+	defer upstream.Close()
+
+	repo := &usageRecordingRepository{}
+	handler := newEndpointTestHandler(t, upstream.URL, repo)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model": "text-embedding-3-large", "input": "hello"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID:            1,
+		Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "openai"}},
+	})
+
+	if err := handler.ProxyEndpoint(domain.EndpointEmbeddings)(c); err != nil {
+		t.Fatalf("ProxyEndpoint failed: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"embedding"`) {
+		t.Errorf("expected embeddings response, got: %s", rec.Body.String())
+	}
+
+	// The reservation is settled to the reported usage: 1k tokens at $0.00013
+	if got := fmt.Sprintf("%.5f", repo.total()); got != "0.00013" {
+		t.Errorf("expected committed usage 0.00013, got %s", got)
+	}
+}
+
+func TestProxyEndpoint_UnsupportedProvider(t *testing.T) {
+	registry := domain.NewProviderRegistry()
+	mockProv := providers.NewMockProvider()
+	registry.Register(mockProv.Name(), mockProv)
+	mwRegistry := domain.NewMiddlewareRegistry()
+	keyService := service.NewKeyService(&MockRepository{}, registry, mwRegistry)
+	proxyService := service.NewProxyService(engine.NewExecutionHandler(nil), mwRegistry, keyService)
+	handler := api.NewProxyHandler(proxyService, registry)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model": "m", "input": "hello"}`))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID:            1,
+		Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "mock"}},
+	})
+
+	if err := handler.ProxyEndpoint(domain.EndpointEmbeddings)(c); err != nil {
+		t.Fatalf("ProxyEndpoint failed: %v", err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
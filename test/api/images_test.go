@@ -0,0 +1,50 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestProxyEndpoint_Images(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/generations" {
+			t.Errorf("unexpected upstream path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"created": 1, "data": [{"url": "https://images.local/1.png"}, {"url": "https://images.local/2.png"}]}`)
+	}))
+	defer upstream.Close()
+
+	repo := &usageRecordingRepository{}
+	handler := newEndpointTestHandler(t, upstream.URL, repo)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/images/generations",
+		strings.NewReader(`{"model": "dall-e-3", "prompt": "a lighthouse", "n": 2, "quality": "hd", "size": "1024x1792"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID:            1,
+		Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "openai"}},
+	})
+
+	if err := handler.ProxyEndpoint(domain.EndpointImages)(c); err != nil {
+		t.Fatalf("ProxyEndpoint failed: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Two hd 1024x1792 images at $0.12
+	if got := fmt.Sprintf("%.2f", repo.total()); got != "0.24" {
+		t.Errorf("expected committed usage 0.24, got %s", got)
+	}
+}
@@ -42,6 +42,9 @@ func (m *MockRepository) Delete(ctx context.Context, id domain.ID) error  { retu
 func (m *MockRepository) IncrementUsage(ctx context.Context, id domain.ID, amount float64) error {
 	return nil
 }
+func (m *MockRepository) ReserveUsage(ctx context.Context, id domain.ID, amount float64) error {
+	return nil
+}
 func (m *MockRepository) ResetUsage(ctx context.Context, id domain.ID, lastResetAt time.Time) error {
 	return nil
 }
@@ -142,3 +142,40 @@ func TestMockProvider_Streaming_Integration(t *testing.T) {
 		t.Errorf("Expected [DONE] marker")
 	}
 }
+
+func TestMockProvider_KeyConfig_Integration(t *testing.T) {
+	registry := domain.NewProviderRegistry()
+	mwRegistry := domain.NewMiddlewareRegistry()
+	keyService := service.NewKeyService(&MockRepository{}, registry, mwRegistry)
+	mockProv := providers.NewMockProvider()
+	registry.Register(mockProv.Name(), mockProv)
+
+	executionHandler := engine.NewExecutionHandler(&MockRepository{})
+	proxyService := service.NewProxyService(executionHandler, mwRegistry, keyService)
+	handler := api.NewProxyHandler(proxyService, registry)
+
+	e := echo.New()
+	reqBody := `{"model": "mock-gpt-4", "messages": [{"role": "user", "content": "Hello Mock"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	// The key's provider config must be applied to the upstream request
+	c.Set("app_key", &domain.Key{
+		ID: 1,
+		Configuration: &domain.KeyConfiguration{
+			Provider: domain.PluginConfig{ID: "mock", Config: map[string]any{"mock_response": "Configured per key"}},
+		},
+	})
+
+	if err := handler.Proxy(c); err != nil {
+		t.Fatalf("handler.Proxy failed: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "Configured per key") {
+		t.Errorf("Expected configured mock response, got: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestModels_FilteredByKey(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("unexpected upstream request: %s %v", r.URL.Path, r.Header)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object": "list", "data": [
+			{"id": "gpt-4o", "object": "model"},
+			{"id": "gpt-4o-mini", "object": "model"},
+			{"id": "dall-e-3", "object": "model"}]}`)
+	}))
+	defer upstream.Close()
+
+	handler := newEndpointTestHandler(t, upstream.URL, &MockRepository{})
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID: 1,
+		Configuration: &domain.KeyConfiguration{
+			Provider:      domain.PluginConfig{ID: "openai"},
+			AllowedModels: []string{"gpt-4o*"},
+		},
+	})
+
+	if err := handler.Models(c); err != nil {
+		t.Fatalf("Models failed: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Object string `json:"object"`
+		Data   []struct {
+			ID      string `json:"id"`
+			Object  string `json:"object"`
+			OwnedBy string `json:"owned_by"`
+			Pouch   struct {
+				Pricing *struct {
+					Input  float64 `json:"input"`
+					Output float64 `json:"output"`
+				} `json:"pricing"`
+			} `json:"pouch"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Object != "list" || len(resp.Data) != 2 {
+		t.Fatalf("expected 2 allowed models, got: %s", rec.Body.String())
+	}
+	if resp.Data[0].ID != "gpt-4o" || resp.Data[1].ID != "gpt-4o-mini" {
+		t.Errorf("unexpected models: %s", rec.Body.String())
+	}
+	m := resp.Data[0]
+	if m.Object != "model" || m.OwnedBy != "openai" || m.Pouch.Pricing == nil || m.Pouch.Pricing.Input <= 0 {
+		t.Errorf("expected model metadata with pricing, got: %+v", m)
+	}
+}
+
+func TestProxy_ModelNotAllowed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("disallowed model reached upstream")
+	}))
+	defer upstream.Close()
+
+	repo := &usageRecordingRepository{}
+	handler := newEndpointTestHandler(t, upstream.URL, repo)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4", "messages": []}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID: 1,
+		Configuration: &domain.KeyConfiguration{
+			Provider:      domain.PluginConfig{ID: "openai"},
+			AllowedModels: []string{"gpt-4o", "gpt-4o-mini"},
+		},
+	})
+
+	if err := handler.Proxy(c); err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if repo.total() != 0 {
+		t.Errorf("expected no usage, got %f", repo.total())
+	}
+}
@@ -0,0 +1,126 @@
+package api_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestPassThrough(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("missing upstream auth: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/responses":
+			fmt.Fprint(w, `{"id": "resp_1", "model": "gpt-4o", "usage": {"input_tokens": 1000, "output_tokens": 1000}}`)
+		case "/moderations":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"message": "bad request"}}`)
+		default:
+			fmt.Fprintf(w, `{"method": %q, "path": %q, "query": %q, "body": %q}`, r.Method, r.URL.Path, r.URL.RawQuery, body)
+		}
+	}))
+	defer upstream.Close()
+
+	repo := &usageRecordingRepository{}
+	handler := newEndpointTestHandler(t, upstream.URL, repo)
+	routes := []config.PassThroughRoute{
+		{Path: "files/*", Cost: config.CostFlat, Fee: 0.001},
+		{Path: "moderations", Cost: config.CostFlat, Fee: 0.5},
+		{Path: "responses", Cost: config.CostUsage},
+	}
+
+	e := echo.New()
+	e.Any("/v1/*", handler.PassThrough(routes), func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("app_key", &domain.Key{
+				ID:            1,
+				Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "openai"}},
+			})
+			return next(c)
+		}
+	})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("flat fee", func(t *testing.T) {
+		rec := do(http.MethodGet, "/v1/files/file-abc/content?limit=2", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		want := `{"method": "GET", "path": "/files/file-abc/content", "query": "limit=2", "body": ""}`
+		if rec.Body.String() != want {
+			t.Errorf("unexpected upstream request: %s", rec.Body.String())
+		}
+		if got := fmt.Sprintf("%.3f", repo.total()); got != "0.001" {
+			t.Errorf("expected usage 0.001, got %s", got)
+		}
+	})
+
+	t.Run("failed calls are not charged", func(t *testing.T) {
+		before := repo.total()
+		rec := do(http.MethodPost, "/v1/moderations", `{"input": "hi"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected upstream status 400, got %d", rec.Code)
+		}
+		if got := fmt.Sprintf("%.3f", repo.total()-before); got != "0.000" {
+			t.Errorf("expected no charge, got %s", got)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		before := repo.total()
+		rec := do(http.MethodPost, "/v1/responses", `{"model": "gpt-4o", "input": "hi"}`)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "resp_1") {
+			t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+		}
+		// 1k input tokens at $0.005 and 1k output tokens at $0.015
+		if got := fmt.Sprintf("%.3f", repo.total()-before); got != "0.020" {
+			t.Errorf("expected usage 0.020, got %s", got)
+		}
+	})
+
+	t.Run("unlisted path", func(t *testing.T) {
+		rec := do(http.MethodPost, "/v1/batches", `{}`)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected status 403, got %d", rec.Code)
+		}
+	})
+
+	// Paths matching a route must not resolve to another endpoint upstream
+	t.Run("non-canonical paths", func(t *testing.T) {
+		before := repo.total()
+		for _, path := range []string{
+			"/v1/files/../chat/completions",
+			"/v1/files/./file-abc",
+			"/v1/files//file-abc",
+			"/v1/files/file-abc/",
+			"/v1/files/..%2Fchat%2Fcompletions",
+			"/v1/files/%2e%2e/chat/completions",
+		} {
+			rec := do(http.MethodPost, path, `{"model": "gpt-4o"}`)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d: %s", path, rec.Code, rec.Body.String())
+			}
+		}
+		if got := fmt.Sprintf("%.3f", repo.total()-before); got != "0.000" {
+			t.Errorf("expected no charge, got %s", got)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/api"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/infra/engine"
+	"pouch-ai/backend/plugins/middlewares"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Requests that fail before they are committed release their reservation
+func TestProxy_FailedRequestReleasesReservation(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	// Nothing listens on the upstream once it is closed
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	provider := providers.NewOpenAIProvider("test-key", upstream.URL, pricing, &charCounter{})
+	registry.Register(provider.Name(), provider)
+
+	// One limiter shared across requests, allowing a single request
+	mwRegistry := domain.NewMiddlewareRegistry()
+	limiter := middlewares.NewRateLimitMiddleware(map[string]any{"limit": 1, "period": 3600})
+	mwRegistry.Register("rate_limit", domain.MiddlewareEntry{
+		Info:    middlewares.GetInfo(),
+		Factory: func(map[string]any) domain.Middleware { return limiter },
+	})
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	keyService := service.NewKeyService(repo, registry, mwRegistry)
+	handler := api.NewProxyHandler(service.NewProxyService(engine.NewExecutionHandler(repo), mwRegistry, keyService), registry)
+
+	_, k, err := keyService.CreateKey(ctx, service.CreateKeyInput{
+		Name:        "release",
+		Provider:    domain.PluginConfig{ID: "openai"},
+		BudgetLimit: 10,
+		Middlewares: []domain.PluginConfig{{ID: "rate_limit"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	e := echo.New()
+	// The first request fails to connect, the second is rate limited
+	for _, name := range []string{"dial error", "rate limited"} {
+		body := `{"model": "gpt-4o", "max_tokens": 100, "messages": [{"role": "user", "content": "hello"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("app_key", k)
+
+		_ = handler.Proxy(c)
+		if rec.Code == http.StatusOK {
+			t.Fatalf("%s: expected the request to fail, got %d", name, rec.Code)
+		}
+
+		open, err := keyService.ListOpenReservations(ctx)
+		if err != nil {
+			t.Fatalf("ListOpenReservations failed: %v", err)
+		}
+		if len(open) != 0 {
+			t.Errorf("%s: expected no open reservations, got %+v", name, open)
+		}
+		stored, err := repo.GetByID(ctx, k.ID)
+		if err != nil {
+			t.Fatalf("GetByID failed: %v", err)
+		}
+		if stored.BudgetUsage != 0 {
+			t.Errorf("%s: expected no usage, got %g", name, stored.BudgetUsage)
+		}
+	}
+}
+
+// cancelOnWrite cancels the request once the response starts, as a client
+// hanging up mid-stream would.
+type cancelOnWrite struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *cancelOnWrite) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+// Streams the client hangs up on are still charged
+func TestProxy_CancelledStreamIsCharged(t *testing.T) {
+	ct := newCutoffTest(t)
+	ctx := context.Background()
+
+	_, k, err := ct.keyService.CreateKey(ctx, service.CreateKeyInput{
+		Name:        "hangup",
+		Provider:    domain.PluginConfig{ID: "openai"},
+		BudgetLimit: 10,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	body := `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)).WithContext(reqCtx)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := echo.New().NewContext(req, &cancelOnWrite{ResponseRecorder: httptest.NewRecorder(), cancel: cancel})
+	c.Set("app_key", k)
+	_ = ct.handler.Proxy(c)
+
+	if n := ct.upstreamCancelled(); n != 1 {
+		t.Errorf("expected the upstream request to be cancelled, got %d cancellations", n)
+	}
+	if got := ct.usage(t, k); got <= 0 {
+		t.Errorf("expected the stream to be charged, got %g", got)
+	}
+	open, err := ct.keyService.ListOpenReservations(ctx)
+	if err != nil {
+		t.Fatalf("ListOpenReservations failed: %v", err)
+	}
+	if len(open) != 0 {
+		t.Errorf("expected no open reservations, got %+v", open)
+	}
+}
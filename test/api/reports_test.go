@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pouch-ai/backend/api"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestKeyHandler_UsageReport(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	provider := providers.NewOpenAIProvider("test-key", "", pricing, &charCounter{})
+	registry.Register(provider.Name(), provider)
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	keyService := service.NewKeyService(repo, registry, domain.NewMiddlewareRegistry())
+	keyHandler := api.NewKeyHandler(keyService)
+
+	_, k, err := keyService.CreateKey(ctx, service.CreateKeyInput{Name: "reports", Provider: domain.PluginConfig{ID: "openai"}})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	for _, e := range []*domain.UsageEvent{
+		{KeyID: k.ID, Model: "gpt-4o", Provider: "openai", PromptTokens: 10, OutputTokens: 5, ActualCost: 1.5, CreatedAt: time.Date(2026, 9, 3, 10, 0, 0, 0, time.UTC)},
+		{KeyID: k.ID, Model: "gpt-4o", Provider: "openai", PromptTokens: 20, OutputTokens: 5, ActualCost: 0.5, CreatedAt: time.Date(2026, 9, 20, 10, 0, 0, 0, time.UTC)},
+		{KeyID: k.ID, Model: "gpt-4o", Provider: "openai", PromptTokens: 40, OutputTokens: 5, ActualCost: 9, CreatedAt: time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)},
+	} {
+		if err := repo.RecordUsage(ctx, e); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+	}
+
+	e := echo.New()
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/config/reports/usage?"+query, nil)
+		rec := httptest.NewRecorder()
+		if err := keyHandler.UsageReport(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("UsageReport failed: %v", err)
+		}
+		return rec
+	}
+
+	rec := get("from=2026-09-01&to=2026-10-01&period=month")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp api.UsageReportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Rows) != 1 || resp.Rows[0].Period != "2026-09-01" || resp.Rows[0].KeyName != "reports" {
+		t.Fatalf("Unexpected rows: %+v", resp.Rows)
+	}
+	if resp.Total.Requests != 2 || resp.Total.PromptTokens != 30 || resp.Total.Cost != 2 {
+		t.Errorf("Unexpected total: %+v", resp.Total)
+	}
+
+	rec = get("from=2026-09-01&period=month&group_by=provider,model&format=csv")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := "period,provider,model,requests,prompt_tokens,output_tokens,cost\n" +
+		"2026-09-01,openai,gpt-4o,2,30,10,2\n" +
+		"2026-10-01,openai,gpt-4o,1,40,5,9\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", got, want)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	for _, query := range []string{"period=year", "group_by=team", "format=xml", "from=yesterday"} {
+		if rec := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pouch-ai/backend/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestProxyEndpoint_ResponsesStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/responses" {
+			t.Errorf("unexpected upstream path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: response.created\ndata: {\"type\": \"response.created\", \"response\": {\"id\": \"resp_1\"}}\n\n")
+		fmt.Fprint(w, "event: response.output_text.delta\ndata: {\"type\": \"response.output_text.delta\", \"delta\": \"Hello\"}\n\n")
+		fmt.Fprint(w, "event: response.completed\ndata: {\"type\": \"response.completed\", \"response\": {\"id\": \"resp_1\", "+
+			"\"usage\": {\"input_tokens\": 1000, \"output_tokens\": 2000, \"output_tokens_details\": {\"reasoning_tokens\": 1500}}}}\n\n")
+	}))
+	defer upstream.Close()
+
+	repo := &usageRecordingRepository{}
+	handler := newEndpointTestHandler(t, upstream.URL, repo)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model": "gpt-4o", "input": "Say hello", "stream": true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("app_key", &domain.Key{
+		ID:            1,
+		Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "openai"}},
+	})
+
+	if err := handler.ProxyEndpoint(domain.EndpointResponses)(c); err != nil {
+		t.Fatalf("ProxyEndpoint failed: %v", err)
+	}
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "response.completed") {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	// 1k input tokens at $0.005 and 2k output tokens (including reasoning) at $0.015
+	if got := fmt.Sprintf("%.3f", repo.total()); got != "0.035" {
+		t.Errorf("expected committed usage 0.035, got %s", got)
+	}
+}
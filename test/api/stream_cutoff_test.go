@@ -0,0 +1,248 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pouch-ai/backend/api"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/infra/engine"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// chunkCost is the cost of one streamed chunk: a gpt-4o output token.
+const chunkCost = 0.000015
+
+// promptCost is the cost of the "hello" prompt: a gpt-4o input token.
+const promptCost = 0.000005
+
+const cutoffFinal = `data: {"id":"chatcmpl-1","created":1700000000,"model":"gpt-4o","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}` + "\n\ndata: [DONE]\n\n"
+
+type cutoffTest struct {
+	handler    *api.ProxyHandler
+	keyService *service.KeyService
+	hierarchy  *service.HierarchyService
+	repo       *database.SQLiteKeyRepository
+	upstream   *httptest.Server
+	// cancelled counts the upstream streams cancelled by the proxy.
+	cancelled atomic.Int32
+}
+
+// newCutoffTest proxies to an upstream that streams a token at a time, and
+// holds the stream open until the request is cancelled.
+func newCutoffTest(t *testing.T) *cutoffTest {
+	t.Helper()
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	ct := &cutoffTest{}
+	ct.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 10000 && r.Context().Err() == nil; i++ {
+			fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"created\":1700000000,\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"word\"}}]}\n\n")
+			w.(http.Flusher).Flush()
+		}
+		// Hold the stream open until the proxy gives up on it
+		select {
+		case <-r.Context().Done():
+			ct.cancelled.Add(1)
+		case <-time.After(5 * time.Second):
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}
+	}))
+	t.Cleanup(ct.upstream.Close)
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	provider := providers.NewOpenAIProvider("test-key", ct.upstream.URL, pricing, &charCounter{})
+	registry.Register(provider.Name(), provider)
+	mwRegistry := domain.NewMiddlewareRegistry()
+
+	ct.repo = database.NewSQLiteKeyRepository(database.DB)
+	ct.keyService = service.NewKeyService(ct.repo, registry, mwRegistry)
+	ct.hierarchy = service.NewHierarchyService(ct.repo)
+	ct.handler = api.NewProxyHandler(service.NewProxyService(engine.NewExecutionHandler(ct.repo), mwRegistry, ct.keyService), registry)
+	return ct
+}
+
+// stream returns the response to a streamed chat request.
+func (ct *cutoffTest) stream(t *testing.T, k *domain.Key) (int, string) {
+	t.Helper()
+	body := `{"model": "gpt-4o", "stream": true, "max_tokens": 10, "messages": [{"role": "user", "content": "hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("app_key", k)
+
+	if err := ct.handler.Proxy(c); err != nil {
+		t.Errorf("Proxy failed: %v", err)
+	}
+	return rec.Code, rec.Body.String()
+}
+
+// upstreamCancelled waits for the upstream to finish, and returns how many
+// of its streams were cancelled.
+func (ct *cutoffTest) upstreamCancelled() int {
+	ct.upstream.Close()
+	return int(ct.cancelled.Load())
+}
+
+func (ct *cutoffTest) usage(t *testing.T, k *domain.Key) float64 {
+	t.Helper()
+	stored, err := ct.repo.GetByID(context.Background(), k.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	return stored.BudgetUsage
+}
+
+// checkCutOff checks that a stream was cut off, and returns what it cost.
+func checkCutOff(t *testing.T, code int, out string) float64 {
+	t.Helper()
+	if code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", code, out)
+		return 0
+	}
+	chunks := strings.Count(out, `"content":"word"`)
+	if chunks == 0 || chunks >= 10000 {
+		t.Errorf("expected the stream to be cut off, got %d chunks", chunks)
+	}
+	if !strings.HasSuffix(out, "}\n\n"+cutoffFinal) {
+		t.Errorf("expected the stream to end with a length finish and [DONE], got:\n%s", out[max(len(out)-400, 0):])
+	}
+	return promptCost + float64(chunks)*chunkCost
+}
+
+// checkCharged checks that usage is what the streams cost, input included.
+func checkCharged(t *testing.T, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("expected usage of %g, input included, got %g", want, got)
+	}
+}
+
+func TestProxy_StreamCutoff(t *testing.T) {
+	ct := newCutoffTest(t)
+	ctx := context.Background()
+
+	_, k, err := ct.keyService.CreateKey(ctx, service.CreateKeyInput{
+		Name:         "cutoff",
+		Provider:     domain.PluginConfig{ID: "openai"},
+		BudgetLimit:  0.001,
+		StreamCutoff: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	code, out := ct.stream(t, k)
+	cost := checkCutOff(t, code, out)
+	if n := ct.upstreamCancelled(); n != 1 {
+		t.Errorf("expected the upstream request to be cancelled, got %d cancellations", n)
+	}
+	// The chunk that uses up the budget is still sent
+	got := ct.usage(t, k)
+	checkCharged(t, got, cost)
+	if got <= 0.001 || got > 0.001+chunkCost {
+		t.Errorf("expected usage to stop at the 0.001 budget, got %g", got)
+	}
+	if open, _ := ct.keyService.ListOpenReservations(ctx); len(open) != 0 {
+		t.Errorf("expected no open reservations, got %+v", open)
+	}
+}
+
+// The stream stops at the tightest budget it is held against
+func TestProxy_StreamCutoff_ProjectBudget(t *testing.T) {
+	ct := newCutoffTest(t)
+	ctx := context.Background()
+
+	p, err := ct.hierarchy.CreateProject(ctx, service.ProjectInput{Name: "web", BudgetLimit: 0.001})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	_, k, err := ct.keyService.CreateKey(ctx, service.CreateKeyInput{
+		Name:         "cutoff",
+		Provider:     domain.PluginConfig{ID: "openai"},
+		BudgetLimit:  10,
+		ProjectID:    p.ID,
+		StreamCutoff: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	code, out := ct.stream(t, k)
+	cost := checkCutOff(t, code, out)
+	projects, err := ct.hierarchy.ListProjects(ctx)
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	got := projects[0].BudgetUsage
+	checkCharged(t, got, cost)
+	if got <= 0.001 || got > 0.001+chunkCost {
+		t.Errorf("expected project usage to stop at the 0.001 budget, got %g", got)
+	}
+}
+
+// Concurrent streams share the remaining budget rather than each spending it
+func TestProxy_StreamCutoff_Concurrent(t *testing.T) {
+	ct := newCutoffTest(t)
+
+	_, k, err := ct.keyService.CreateKey(context.Background(), service.CreateKeyInput{
+		Name:         "cutoff",
+		Provider:     domain.PluginConfig{ID: "openai"},
+		BudgetLimit:  0.005,
+		StreamCutoff: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	// Streams that start once the budget is used up are rejected
+	const streams = 4
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	cutOff, cost := 0, 0.0
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, out := ct.stream(t, k)
+			if code != http.StatusOK && strings.Contains(out, domain.ErrBudgetExceeded.Error()) {
+				return
+			}
+			c := checkCutOff(t, code, out)
+			mu.Lock()
+			cutOff, cost = cutOff+1, cost+c
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if n := ct.upstreamCancelled(); n == 0 || n != cutOff {
+		t.Errorf("expected each of the %d streams cut off to be cancelled upstream, got %d", cutOff, n)
+	}
+	got := ct.usage(t, k)
+	checkCharged(t, got, cost)
+	if got > 0.005+streams*chunkCost {
+		t.Errorf("expected usage to stop at the 0.005 budget, got %g", got)
+	}
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"pouch-ai/backend/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+// eventRecordingRepository keeps the recorded events in memory.
+type eventRecordingRepository struct {
+	usageRecordingRepository
+	eventsMu sync.Mutex
+	events   []*domain.Event
+}
+
+func (m *eventRecordingRepository) RecordEvent(ctx context.Context, e *domain.Event) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *eventRecordingRepository) ListEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	return m.events, nil
+}
+
+func TestProxy_UnknownModelPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    domain.UnknownModelPolicy
+		key       domain.UnknownModelPolicy
+		model     string
+		status    int
+		cost      float64
+		forwarded bool
+		events    int
+	}{
+		{"known model", domain.UnknownModelReject, "", "gpt-4o", http.StatusOK, 0.00009, true, 0},
+		{"reject", domain.UnknownModelReject, "", "gpt-unknown", http.StatusBadRequest, 0, false, 1},
+		{"fallback", domain.UnknownModelFallback, "", "gpt-unknown", http.StatusOK, 0.013, true, 1},
+		{"allow", domain.UnknownModelAllow, "", "gpt-unknown", http.StatusOK, 0, true, 1},
+		{"key overrides global", domain.UnknownModelAllow, domain.UnknownModelReject, "gpt-unknown", http.StatusBadRequest, 0, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded := false
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = true
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"choices": [{"message": {"content": "hi"}}], "usage": {"prompt_tokens": 3, "completion_tokens": 5}}`)
+			}))
+			defer upstream.Close()
+
+			repo := &eventRecordingRepository{}
+			handler, proxyService := newEndpointTestHandlerWithService(t, upstream.URL, repo)
+			proxyService.SetUnknownModelPolicy(tt.global, domain.Pricing{Input: 1, Output: 2})
+
+			e := echo.New()
+			body := fmt.Sprintf(`{"model": %q, "max_tokens": 10, "messages": [{"role": "user", "content": "hello world!"}]}`, tt.model)
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("app_key", &domain.Key{
+				ID: 1,
+				Configuration: &domain.KeyConfiguration{
+					Provider:           domain.PluginConfig{ID: "openai"},
+					UnknownModelPolicy: tt.key,
+				},
+			})
+
+			if err := handler.Proxy(c); err != nil {
+				t.Fatalf("Proxy failed: %v", err)
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if forwarded != tt.forwarded {
+				t.Errorf("expected forwarded=%v, got %v", tt.forwarded, forwarded)
+			}
+			if got := repo.total(); math.Abs(got-tt.cost) > 1e-9 {
+				t.Errorf("expected cost %f, got %f", tt.cost, got)
+			}
+			if len(repo.events) != tt.events {
+				t.Fatalf("expected %d events, got %d", tt.events, len(repo.events))
+			}
+			if tt.events > 0 {
+				ev := repo.events[0]
+				if ev.Type != domain.EventUnpricedModel || ev.Model != domain.Model(tt.model) || ev.KeyID != 1 {
+					t.Errorf("unexpected event: %+v", ev)
+				}
+			}
+		})
+	}
+}
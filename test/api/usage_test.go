@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pouch-ai/backend/api"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/infra/engine"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestKeyHandler_GetKeyUsage(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"hi\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\": [], \"usage\": {\"prompt_tokens\": 20, \"completion_tokens\": 8}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "hi"}}], "usage": {"prompt_tokens": 10, "completion_tokens": 4}}`)
+	}))
+	defer upstream.Close()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	provider := providers.NewOpenAIProvider("test-key", upstream.URL, pricing, &charCounter{})
+	registry.Register(provider.Name(), provider)
+	mwRegistry := domain.NewMiddlewareRegistry()
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	keyService := service.NewKeyService(repo, registry, mwRegistry)
+	proxyHandler := api.NewProxyHandler(service.NewProxyService(engine.NewExecutionHandler(repo), mwRegistry, keyService), registry)
+	keyHandler := api.NewKeyHandler(keyService)
+
+	_, k, err := keyService.CreateKey(context.Background(), service.CreateKeyInput{
+		Name:        "ledger",
+		Provider:    domain.PluginConfig{ID: "openai"},
+		BudgetLimit: 10,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	e := echo.New()
+	for _, body := range []string{
+		`{"model": "gpt-4o", "messages": [{"role": "user", "content": "hello"}]}`,
+		`{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "hello"}]}`,
+		`{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "hello"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("app_key", k)
+		if err := proxyHandler.Proxy(c); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("Proxy(%s) = %v, status %d: %s", body, err, rec.Code, rec.Body.String())
+		}
+	}
+
+	getUsage := func(query string) api.KeyUsageResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/v1/config/app-keys/1/usage?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(k.ID))
+		if err := keyHandler.GetKeyUsage(c); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GetKeyUsage(%s) = %v, status %d: %s", query, err, rec.Code, rec.Body.String())
+		}
+		var resp api.KeyUsageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode usage: %v", err)
+		}
+		return resp
+	}
+
+	usage := getUsage("")
+	if len(usage.Events) != 3 {
+		t.Fatalf("expected 3 usage events, got %+v", usage.Events)
+	}
+	if usage.Total.Requests != 3 || usage.Total.OutputTokens != 16 {
+		t.Errorf("unexpected total %+v", usage.Total)
+	}
+	if len(usage.Models) != 2 || usage.Models[0].Model != "gpt-4o" || usage.Models[0].Requests != 2 || usage.Models[1].Model != "gpt-4o-mini" {
+		t.Errorf("unexpected per-model usage %+v", usage.Models)
+	}
+
+	// Newest first
+	mini, stream := usage.Events[0], usage.Events[1]
+	if mini.Model != "gpt-4o-mini" || mini.Stream || mini.StatusCode != http.StatusOK || mini.Provider != "openai" {
+		t.Errorf("unexpected event %+v", mini)
+	}
+	if mini.ReservedCost < mini.ActualCost || mini.ActualCost <= 0 || mini.RequestID == "" {
+		t.Errorf("expected the reserved and actual cost of the request, got %+v", mini)
+	}
+	if !stream.Stream || stream.PromptTokens != 20 || stream.OutputTokens != 8 {
+		t.Errorf("expected the streamed request's reported usage, got %+v", stream)
+	}
+
+	keys, err := keyService.ListKeys(context.Background())
+	if err != nil {
+		t.Fatalf("ListKeys failed: %v", err)
+	}
+	if diff := keys[0].BudgetUsage - usage.Total.Cost; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("expected the ledger to add up to the key's usage %v, got %v", keys[0].BudgetUsage, usage.Total.Cost)
+	}
+
+	// Time ranges filter events and totals
+	future := time.Now().Add(time.Hour)
+	if usage := getUsage("from=" + future.Format(time.RFC3339)); len(usage.Events) != 0 || usage.Total.Requests != 0 {
+		t.Errorf("expected no usage from %v, got %+v", future, usage)
+	}
+	if usage := getUsage(fmt.Sprintf("to=%d&limit=1", future.Unix())); len(usage.Events) != 1 || usage.Total.Requests != 3 {
+		t.Errorf("expected 1 event of 3 requests, got %+v", usage)
+	}
+}
@@ -0,0 +1,138 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/plugins/notifiers"
+	"pouch-ai/backend/service"
+	"testing"
+	"time"
+)
+
+func TestKeyService_BudgetAlerts(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	// A local receiver stands in for the webhook
+	received := make(chan domain.Alert, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a domain.Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("invalid alert payload: %v", err)
+		}
+		received <- a
+	}))
+	t.Cleanup(receiver.Close)
+
+	notifier, err := notifiers.New([]config.NotifierConfig{{Type: config.NotifierWebhook, URL: receiver.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	svc := service.NewKeyService(database.NewSQLiteKeyRepository(database.DB), &mockRegistry{}, domain.NewMiddlewareRegistry())
+	svc.SetAlerts(notifier, service.AlertPolicy{
+		Thresholds:         []int{50},
+		ProviderThresholds: map[string][]int{"anthropic": {90}},
+	})
+
+	expectAlert := func(keyID domain.ID, threshold int) {
+		t.Helper()
+		select {
+		case a := <-received:
+			if a.KeyID != keyID || a.Threshold != threshold {
+				t.Errorf("expected a %d%% alert for key %d, got %+v", threshold, keyID, a)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %d%% alert received", threshold)
+		}
+	}
+	spend := func(keyID domain.ID, requestID string, amount float64) error {
+		t.Helper()
+		if err := svc.ReserveUsage(ctx, keyID, requestID, "", amount); err != nil {
+			return err
+		}
+		return svc.CommitUsage(ctx, keyID, requestID, amount, amount)
+	}
+
+	_, k, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:            "alerted",
+		Provider:        domain.PluginConfig{ID: "openai"},
+		BudgetLimit:     10,
+		ResetPeriod:     3600,
+		AlertThresholds: []int{50, 80},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	for i, amount := range []float64{4, 2, 1, 2} {
+		if err := spend(k.ID, "hard-"+string(rune('a'+i)), amount); err != nil {
+			t.Fatalf("spend %v failed: %v", amount, err)
+		}
+		switch i {
+		case 1:
+			expectAlert(k.ID, 50)
+		case 3:
+			expectAlert(k.ID, 80)
+		}
+	}
+	if err := spend(k.ID, "hard-over", 2); !errors.Is(err, domain.ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded without a soft limit, got %v", err)
+	}
+
+	// A soft limit lets the request through and alerts at 100%, using the
+	// provider's thresholds as the key sets none
+	_, soft, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:        "soft",
+		Provider:    domain.PluginConfig{ID: "anthropic"},
+		BudgetLimit: 10,
+		ResetPeriod: 3600,
+		SoftLimit:   true,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	if err := spend(soft.ID, "soft-a", 12); err != nil {
+		t.Fatalf("expected the soft limit to allow the request, got %v", err)
+	}
+	expectAlert(soft.ID, 100)
+	if err := spend(soft.ID, "soft-b", 1); err != nil {
+		t.Fatalf("spend past the soft limit failed: %v", err)
+	}
+
+	// Each threshold is alerted once per period, and is recorded as an event
+	events, err := svc.ListEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 alert events, got %+v", events)
+	}
+	for _, e := range events {
+		if e.Type != domain.EventBudgetAlert || e.Message == "" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+	select {
+	case a := <-received:
+		t.Errorf("unexpected extra alert %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A new period alerts again
+	if _, err := svc.ResetDueBudgets(ctx, time.Now().Add(2*time.Hour), time.UTC); err != nil {
+		t.Fatalf("ResetDueBudgets failed: %v", err)
+	}
+	if err := spend(k.ID, "next-period", 5); err != nil {
+		t.Fatalf("spend failed after reset: %v", err)
+	}
+	expectAlert(k.ID, 50)
+}
@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyService_ReconcileBilling(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	// Stand-in for the OpenAI billing API, in cents per day
+	billed := map[string]float64{"2026-09-01": 500, "2026-09-02": 1000, "2026-09-03": 300}
+	var queried []string
+	billing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dashboard/billing/usage" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.NotFound(w, r)
+			return
+		}
+		start, end := r.URL.Query().Get("start_date"), r.URL.Query().Get("end_date")
+		queried = append(queried, start+".."+end)
+		total := 0.0
+		for day, cents := range billed {
+			if day >= start && day < end {
+				total += cents
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]float64{"total_usage": total})
+	}))
+	defer billing.Close()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	registry.Register("openai", providers.NewOpenAIProvider("test-key", billing.URL, pricing, nil))
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	svc := service.NewKeyService(repo, registry, domain.NewMiddlewareRegistry())
+	svc.SetBillingPolicy(service.BillingPolicy{DriftThreshold: 10, MinDrift: 1})
+
+	for _, e := range []struct {
+		provider string
+		at       string
+		cost     float64
+	}{
+		{"openai", "2026-08-31T23:59:59Z", 7},
+		{"openai", "2026-09-01T09:00:00Z", 2},
+		{"openai", "2026-09-01T18:00:00Z", 3},
+		// Half of the 2nd bypassed pouch
+		{"openai", "2026-09-02T12:00:00Z", 4},
+		{"anthropic", "2026-09-02T12:00:00Z", 6},
+		{"openai", "2026-09-03T12:00:00Z", 2.9},
+	} {
+		at, _ := time.Parse(time.RFC3339, e.at)
+		if err := repo.RecordUsage(ctx, &domain.UsageEvent{Model: "gpt-4o", Provider: e.provider, ActualCost: e.cost, CreatedAt: at}); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+	}
+
+	reconcile := func(q domain.ReportQuery) string {
+		t.Helper()
+		results, err := svc.ReconcileBilling(ctx, q)
+		if err != nil {
+			t.Fatalf("ReconcileBilling(%+v) failed: %v", q, err)
+		}
+		var lines []string
+		for _, r := range results {
+			lines = append(lines, fmt.Sprintf("%s %s..%s billed=%.2f recorded=%.2f drift=%.2f (%.0f%%) flagged=%v", r.Provider,
+				r.PeriodStart.Format(time.DateOnly), r.PeriodEnd.Format(time.DateOnly), r.Billed, r.Recorded, r.Drift, r.DriftPercent, r.Flagged))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	// The end of the range is truncated to its day
+	got := reconcile(domain.ReportQuery{
+		Period: domain.ReportDay,
+		From:   time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2026, 9, 4, 15, 0, 0, 0, time.UTC),
+	})
+	want := "openai 2026-09-01..2026-09-02 billed=5.00 recorded=5.00 drift=0.00 (0%) flagged=false\n" +
+		"openai 2026-09-02..2026-09-03 billed=10.00 recorded=4.00 drift=6.00 (60%) flagged=true\n" +
+		"openai 2026-09-03..2026-09-04 billed=3.00 recorded=2.90 drift=0.10 (3%) flagged=false"
+	if got != want {
+		t.Errorf("daily reconciliation:\n%s\nwant:\n%s", got, want)
+	}
+	if want := "2026-09-01..2026-09-02,2026-09-02..2026-09-03,2026-09-03..2026-09-04"; strings.Join(queried, ",") != want {
+		t.Errorf("billing queried for %v, want %s", queried, want)
+	}
+
+	// The first month starts with the range
+	got = reconcile(domain.ReportQuery{
+		Period: domain.ReportMonth,
+		From:   time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC),
+	})
+	if want := "openai 2026-09-01..2026-09-04 billed=18.00 recorded=11.90 drift=6.10 (34%) flagged=true"; got != want {
+		t.Errorf("monthly reconciliation:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Spend that was recorded but never billed drifts as well
+	got = reconcile(domain.ReportQuery{
+		From: time.Date(2026, 8, 30, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC),
+	})
+	if want := "openai 2026-08-30..2026-09-02 billed=5.00 recorded=12.00 drift=-7.00 (58%) flagged=true"; got != want {
+		t.Errorf("total reconciliation:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, q := range []domain.ReportQuery{
+		{Period: domain.ReportHour, From: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)},
+		{Period: domain.ReportDay, From: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{Period: domain.ReportDay, From: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		if _, err := svc.ReconcileBilling(ctx, q); !domain.IsValidationError(err) {
+			t.Errorf("ReconcileBilling(%+v): expected a validation error, got %v", q, err)
+		}
+	}
+}
+
+// Keys with credentials of their own are billed to another account, and are
+// not reconciled with the shared one
+func TestKeyService_ReconcileBilling_OwnCredentials(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	// Stand-in for the OpenAI billing API of the shared account, $5 a day
+	billing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]float64{"total_usage": 500})
+	}))
+	defer billing.Close()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	registry.Register("openai", providers.NewOpenAIProvider("test-key", billing.URL, pricing, nil))
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	svc := service.NewKeyService(repo, registry, domain.NewMiddlewareRegistry())
+	svc.SetBillingPolicy(service.BillingPolicy{DriftThreshold: 10, MinDrift: 1})
+
+	_, shared, err := svc.CreateKey(ctx, service.CreateKeyInput{Name: "shared", Provider: domain.PluginConfig{ID: "openai"}})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	_, own, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:     "own",
+		Provider: domain.PluginConfig{ID: "openai", Config: map[string]any{"api_key": "team-key"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	at := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range []*domain.UsageEvent{
+		{KeyID: shared.ID, Model: "gpt-4o", Provider: "openai", ActualCost: 5, CreatedAt: at},
+		{KeyID: own.ID, Model: "gpt-4o", Provider: "openai", ActualCost: 8, CreatedAt: at},
+	} {
+		if err := repo.RecordUsage(ctx, e); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+	}
+
+	results, err := svc.ReconcileBilling(ctx, domain.ReportQuery{
+		Period: domain.ReportDay,
+		From:   time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("ReconcileBilling failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected one reconciliation, got %d", len(results))
+	}
+	if r := results[0]; r.Recorded != 5 || r.Flagged {
+		t.Errorf("expected only the shared key's $5 to be reconciled, got recorded=%.2f flagged=%v", r.Recorded, r.Flagged)
+	}
+}
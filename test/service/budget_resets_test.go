@@ -0,0 +1,175 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/service"
+	"testing"
+	"time"
+)
+
+func TestKeyService_ResetDueBudgets(t *testing.T) {
+	svc, hs := newHierarchyTestServices(t)
+	ctx := context.Background()
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, tokyo)
+
+	p, err := hs.CreateProject(ctx, service.ProjectInput{
+		Name:          "nightly",
+		BudgetLimit:   10,
+		ResetSchedule: &domain.ResetSchedule{Interval: domain.ResetDaily},
+	})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	rawKey, k, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:          "monthly-key",
+		Provider:      domain.PluginConfig{ID: "openai"},
+		BudgetLimit:   50,
+		ResetSchedule: &domain.ResetSchedule{Interval: domain.ResetMonthly, Day: 1},
+		ProjectID:     p.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	createProjectKey(t, svc, "idle-key", 0)
+
+	// Last reset in February; the key is cached with its usage
+	lastReset := time.Date(2026, 2, 10, 9, 0, 0, 0, tokyo)
+	if _, err := database.DB.Exec("UPDATE app_keys SET last_reset_at = ?", lastReset.Unix()); err != nil {
+		t.Fatalf("Failed to age keys: %v", err)
+	}
+	if _, err := database.DB.Exec("UPDATE projects SET last_reset_at = ?", lastReset.Unix()); err != nil {
+		t.Fatalf("Failed to age project: %v", err)
+	}
+	if _, err := svc.VerifyKey(ctx, rawKey); err != nil {
+		t.Fatalf("VerifyKey failed: %v", err)
+	}
+	if err := svc.IncrementUsage(ctx, k, 1.5); err != nil {
+		t.Fatalf("IncrementUsage failed: %v", err)
+	}
+
+	// Only the key and the project have a schedule; the idle key never resets
+	if n, err := svc.ResetDueBudgets(ctx, now, tokyo); err != nil || n != 2 {
+		t.Fatalf("ResetDueBudgets() = %d, %v, want 2 resets", n, err)
+	}
+	if n, err := svc.ResetDueBudgets(ctx, now, tokyo); err != nil || n != 0 {
+		t.Fatalf("ResetDueBudgets() again = %d, %v, want no resets", n, err)
+	}
+
+	verified, err := svc.VerifyKey(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("VerifyKey failed: %v", err)
+	}
+	monthStart := time.Date(2026, 3, 1, 0, 0, 0, 0, tokyo)
+	if verified.BudgetUsage != 0 || !verified.LastResetAt.Equal(monthStart) {
+		t.Errorf("expected the cached key reset at %v, got usage %v at %v", monthStart, verified.BudgetUsage, verified.LastResetAt)
+	}
+
+	resets, err := svc.ListBudgetResets(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListBudgetResets failed: %v", err)
+	}
+	if len(resets) != 2 {
+		t.Fatalf("expected 2 recorded resets, got %d", len(resets))
+	}
+	byScope := make(map[domain.BudgetScope]*domain.BudgetReset)
+	for _, r := range resets {
+		byScope[r.Scope] = r
+	}
+
+	keyReset := byScope[domain.BudgetScopeKey]
+	if keyReset == nil || keyReset.ScopeID != k.ID || keyReset.Usage != 1.5 || !keyReset.PeriodStart.Equal(lastReset) || !keyReset.ResetAt.Equal(monthStart) {
+		t.Errorf("unexpected key reset: %+v", keyReset)
+	}
+	dayStart := time.Date(2026, 3, 20, 0, 0, 0, 0, tokyo)
+	projectReset := byScope[domain.BudgetScopeProject]
+	if projectReset == nil || projectReset.Name != "nightly" || projectReset.Usage != 1.5 || !projectReset.ResetAt.Equal(dayStart) {
+		t.Errorf("unexpected project reset: %+v", projectReset)
+	}
+}
+
+// Reservations open across a reset are settled against the new period
+func TestKeyService_ResetDueBudgets_OpenReservations(t *testing.T) {
+	svc, hs := newHierarchyTestServices(t)
+	ctx := context.Background()
+
+	daily := &domain.ResetSchedule{Interval: domain.ResetDaily}
+	org, err := hs.CreateOrganization(ctx, service.OrganizationInput{Name: "team", BudgetLimit: 10, ResetSchedule: daily})
+	if err != nil {
+		t.Fatalf("CreateOrganization failed: %v", err)
+	}
+	p, err := hs.CreateProject(ctx, service.ProjectInput{OrgID: org.ID, Name: "web", BudgetLimit: 10, ResetSchedule: daily})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	_, k, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:          "web-key",
+		Provider:      domain.PluginConfig{ID: "openai"},
+		BudgetLimit:   10,
+		ResetSchedule: daily,
+		ProjectID:     p.ID,
+		ModelBudgets:  []domain.ModelBudget{{Model: "gpt-4o", Limit: 5}},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	// $1 spent yesterday, and $2 still held by a request in flight
+	if err := svc.ReserveUsage(ctx, k.ID, "req-done", "gpt-4o", 1); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+	if err := svc.CommitUsage(ctx, k.ID, "req-done", 1, 1); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, k.ID, "req-open", "gpt-4o", 2); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1).Unix()
+	for _, table := range []string{"app_keys", "projects", "organizations"} {
+		if _, err := database.DB.Exec("UPDATE "+table+" SET last_reset_at = ?", yesterday); err != nil {
+			t.Fatalf("Failed to age %s: %v", table, err)
+		}
+	}
+	if n, err := svc.ResetDueBudgets(ctx, now, time.Local); err != nil || n != 3 {
+		t.Fatalf("ResetDueBudgets() = %d, %v, want 3 resets", n, err)
+	}
+
+	resets, err := svc.ListBudgetResets(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListBudgetResets failed: %v", err)
+	}
+	for _, r := range resets {
+		if r.Usage != 1 {
+			t.Errorf("expected $1 spent in the period that ended by %s %q, got %v", r.Scope, r.Name, r.Usage)
+		}
+	}
+
+	check := func(want string) {
+		t.Helper()
+		stored, err := database.NewSQLiteKeyRepository(database.DB).GetByID(ctx, k.ID)
+		if err != nil {
+			t.Fatalf("GetByID failed: %v", err)
+		}
+		usages := budgetUsages(t, hs)
+		got := fmt.Sprintf("key %.2f, model %.2f, project %s, org %s", stored.BudgetUsage, stored.ModelUsage["gpt-4o"], usages["web"], usages["team"])
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+	check("key 2.00, model 2.00, project 2.00, org 2.00")
+
+	// The request costs $1.50, charged to the new period
+	if err := svc.CommitUsage(ctx, k.ID, "req-open", 2, 1.5); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	check("key 1.50, model 1.50, project 1.50, org 1.50")
+}
@@ -0,0 +1,41 @@
+package service_test
+
+import (
+	"context"
+	"pouch-ai/backend/domain"
+	"testing"
+)
+
+func TestKeyService_Events(t *testing.T) {
+	svc, k := newBudgetTestService(t, 0)
+	ctx := context.Background()
+
+	for _, model := range []domain.Model{"gpt-a", "gpt-b", "gpt-c"} {
+		if err := svc.RecordEvent(ctx, &domain.Event{KeyID: k.ID, Type: domain.EventUnpricedModel, Model: model, Message: "rejected"}); err != nil {
+			t.Fatalf("RecordEvent failed: %v", err)
+		}
+	}
+
+	events, err := svc.ListEvents(ctx, 2)
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Model != "gpt-c" || events[1].Model != "gpt-b" {
+		t.Fatalf("expected the 2 newest events, got %+v", events)
+	}
+	if events[0].KeyID != k.ID || events[0].Type != domain.EventUnpricedModel || events[0].CreatedAt.IsZero() {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+
+	// Events are kept after their key is deleted
+	if err := svc.DeleteKey(ctx, int64(k.ID)); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+	events, err = svc.ListEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(events) != 3 || events[0].KeyID != 0 {
+		t.Errorf("expected 3 events without a key, got %+v", events)
+	}
+}
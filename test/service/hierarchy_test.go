@@ -0,0 +1,233 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/service"
+	"testing"
+	"time"
+)
+
+func newHierarchyTestServices(t *testing.T) (*service.KeyService, *service.HierarchyService) {
+	t.Helper()
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	return service.NewKeyService(repo, &mockRegistry{}, domain.NewMiddlewareRegistry()), service.NewHierarchyService(repo)
+}
+
+func createProjectKey(t *testing.T, svc *service.KeyService, name string, projectID domain.ID) *domain.Key {
+	t.Helper()
+	_, k, err := svc.CreateKey(context.Background(), service.CreateKeyInput{
+		Name:      name,
+		Provider:  domain.PluginConfig{ID: "openai"},
+		ProjectID: projectID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	return k
+}
+
+func budgetUsages(t *testing.T, hs *service.HierarchyService) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	usages := make(map[string]string)
+	orgs, err := hs.ListOrganizations(ctx)
+	if err != nil {
+		t.Fatalf("ListOrganizations failed: %v", err)
+	}
+	for _, o := range orgs {
+		usages[o.Name] = fmt.Sprintf("%.2f", o.BudgetUsage)
+	}
+	projects, err := hs.ListProjects(ctx)
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	for _, p := range projects {
+		usages[p.Name] = fmt.Sprintf("%.2f", p.BudgetUsage)
+	}
+	return usages
+}
+
+func TestHierarchy_ReserveAtEveryLevel(t *testing.T) {
+	svc, hs := newHierarchyTestServices(t)
+	ctx := context.Background()
+
+	org, err := hs.CreateOrganization(ctx, service.OrganizationInput{Name: "team", BudgetLimit: 1})
+	if err != nil {
+		t.Fatalf("CreateOrganization failed: %v", err)
+	}
+	web, err := hs.CreateProject(ctx, service.ProjectInput{OrgID: org.ID, Name: "web", BudgetLimit: 0.8})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	api, err := hs.CreateProject(ctx, service.ProjectInput{OrgID: org.ID, Name: "api"})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	webKey := createProjectKey(t, svc, "web-key", web.ID)
+	apiKey := createProjectKey(t, svc, "api-key", api.ID)
+
+	if err := svc.ReserveUsage(ctx, webKey.ID, "req-1", "", 0.6); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+	// The project has room left but the organization does not
+	if err := svc.ReserveUsage(ctx, apiKey.ID, "req-2", "", 0.6); !errors.Is(err, domain.ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded from the organization, got %v", err)
+	}
+	// The project limit is hit before the organization's
+	if err := svc.ReserveUsage(ctx, webKey.ID, "req-3", "", 0.3); !errors.Is(err, domain.ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded from the project, got %v", err)
+	}
+	if got := storedUsage(t, apiKey.ID); got != "0.00" {
+		t.Errorf("expected the rejected reservation to be rolled back, got key usage %s", got)
+	}
+	want := map[string]string{"team": "0.60", "web": "0.60", "api": "0.00"}
+	if got := budgetUsages(t, hs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected usages %v, got %v", want, got)
+	}
+
+	// Settling below the reservation releases the difference at every level
+	if err := svc.CommitUsage(ctx, webKey.ID, "req-1", 0.6, 0.2); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, apiKey.ID, "req-4", "", 0.6); err != nil {
+		t.Fatalf("ReserveUsage failed after commit: %v", err)
+	}
+	want = map[string]string{"team": "0.80", "web": "0.20", "api": "0.60"}
+	if got := budgetUsages(t, hs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected usages %v, got %v", want, got)
+	}
+
+	// Expired reservations are refunded at every level
+	if _, err := svc.ReconcileReservations(ctx, time.Now(), domain.ReservationRefunded); err != nil {
+		t.Fatalf("ReconcileReservations failed: %v", err)
+	}
+	want = map[string]string{"team": "0.20", "web": "0.20", "api": "0.00"}
+	if got := budgetUsages(t, hs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected usages %v, got %v", want, got)
+	}
+}
+
+// Reservations are settled against the key's project at commit time, so a
+// key cannot change projects while it holds any
+func TestHierarchy_MoveKeyWithReservations(t *testing.T) {
+	svc, hs := newHierarchyTestServices(t)
+	ctx := context.Background()
+
+	web, err := hs.CreateProject(ctx, service.ProjectInput{Name: "web", BudgetLimit: 1})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	api, err := hs.CreateProject(ctx, service.ProjectInput{Name: "api", BudgetLimit: 1})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	k := createProjectKey(t, svc, "web-key", web.ID)
+	if err := svc.ReserveUsage(ctx, k.ID, "req-1", "", 0.6); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+
+	input := service.UpdateKeyInput{ID: int64(k.ID), Name: "web-key", Provider: domain.PluginConfig{ID: "openai"}, ProjectID: api.ID}
+	if err := svc.UpdateKey(ctx, input); !domain.IsValidationError(err) {
+		t.Fatalf("expected a validation error moving a key with reservations, got %v", err)
+	}
+	// Updates that keep the project are not affected
+	input.ProjectID = web.ID
+	input.Name = "renamed"
+	if err := svc.UpdateKey(ctx, input); err != nil {
+		t.Fatalf("UpdateKey failed: %v", err)
+	}
+
+	if err := svc.CommitUsage(ctx, k.ID, "req-1", 0.6, 0.2); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	input.ProjectID = api.ID
+	if err := svc.UpdateKey(ctx, input); err != nil {
+		t.Fatalf("UpdateKey failed after commit: %v", err)
+	}
+	want := map[string]string{"web": "0.20", "api": "0.00"}
+	if got := budgetUsages(t, hs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected usages %v, got %v", want, got)
+	}
+}
+
+func TestHierarchy_ResetPeriod(t *testing.T) {
+	svc, hs := newHierarchyTestServices(t)
+	ctx := context.Background()
+
+	p, err := hs.CreateProject(ctx, service.ProjectInput{Name: "batch", BudgetLimit: 1, ResetPeriod: 3600})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	k := createProjectKey(t, svc, "batch-key", p.ID)
+
+	if err := svc.ReserveUsage(ctx, k.ID, "req-1", "", 1); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, k.ID, "req-2", "", 0.5); !errors.Is(err, domain.ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if err := svc.CommitUsage(ctx, k.ID, "req-1", 1, 1); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+
+	// Once the period has passed, the scheduler starts the project's budget over
+	if _, err := database.DB.Exec("UPDATE projects SET last_reset_at = ?", time.Now().Add(-2*time.Hour).Unix()); err != nil {
+		t.Fatalf("Failed to age project: %v", err)
+	}
+	if n, err := svc.ResetDueBudgets(ctx, time.Now(), time.UTC); err != nil || n != 1 {
+		t.Fatalf("ResetDueBudgets() = %d, %v, want 1 reset", n, err)
+	}
+	if err := svc.ReserveUsage(ctx, k.ID, "req-3", "", 0.5); err != nil {
+		t.Fatalf("ReserveUsage failed after the reset period: %v", err)
+	}
+	if got := budgetUsages(t, hs)["batch"]; got != "0.50" {
+		t.Errorf("expected project usage 0.50, got %s", got)
+	}
+}
+
+func TestHierarchy_Validation(t *testing.T) {
+	svc, hs := newHierarchyTestServices(t)
+	ctx := context.Background()
+
+	if _, err := hs.CreateProject(ctx, service.ProjectInput{OrgID: 42, Name: "orphan"}); !domain.IsValidationError(err) {
+		t.Errorf("expected a validation error for a missing organization, got %v", err)
+	}
+	if _, err := hs.CreateOrganization(ctx, service.OrganizationInput{Name: "team", BudgetLimit: -1}); !domain.IsValidationError(err) {
+		t.Errorf("expected a validation error for a negative limit, got %v", err)
+	}
+	if _, _, err := svc.CreateKey(ctx, service.CreateKeyInput{Name: "key", Provider: domain.PluginConfig{ID: "openai"}, ProjectID: 42}); !domain.IsValidationError(err) {
+		t.Errorf("expected a validation error for a missing project, got %v", err)
+	}
+	if err := hs.UpdateProject(ctx, 42, service.ProjectInput{Name: "missing"}); !errors.Is(err, domain.ErrProjectNotFound) {
+		t.Errorf("expected ErrProjectNotFound, got %v", err)
+	}
+
+	// Deleting a project leaves its keys without one
+	p, err := hs.CreateProject(ctx, service.ProjectInput{Name: "temp", BudgetLimit: 1})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	k := createProjectKey(t, svc, "temp-key", p.ID)
+	if err := hs.DeleteProject(ctx, p.ID); err != nil {
+		t.Fatalf("DeleteProject failed: %v", err)
+	}
+	stored, err := database.NewSQLiteKeyRepository(database.DB).GetByID(ctx, k.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.Configuration.ProjectID != 0 {
+		t.Errorf("expected the key to have no project, got %d", stored.Configuration.ProjectID)
+	}
+	if err := svc.ReserveUsage(ctx, k.ID, "req-1", "", 5); err != nil {
+		t.Errorf("expected an unlimited reservation without a project, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/service"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newBudgetTestService(t *testing.T, limit float64) (*service.KeyService, *domain.Key) {
+	t.Helper()
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	svc := service.NewKeyService(database.NewSQLiteKeyRepository(database.DB), &mockRegistry{}, domain.NewMiddlewareRegistry())
+	_, k, err := svc.CreateKey(context.Background(), service.CreateKeyInput{
+		Name:        "budget-key",
+		Provider:    domain.PluginConfig{ID: "openai"},
+		BudgetLimit: limit,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	return svc, k
+}
+
+func TestKeyService_ReserveUsage_Concurrent(t *testing.T) {
+	svc, k := newBudgetTestService(t, 5)
+
+	// 100 concurrent reservations of $0.25 against a $5 limit: exactly 20 fit
+	var wg sync.WaitGroup
+	var reserved, rejected atomic.Int32
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := svc.ReserveUsage(context.Background(), k.ID, fmt.Sprintf("req-%d", i), "", 0.25)
+			switch {
+			case err == nil:
+				reserved.Add(1)
+			case errors.Is(err, domain.ErrBudgetExceeded):
+				rejected.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if reserved.Load() != 20 || rejected.Load() != 80 {
+		t.Errorf("expected 20 reserved and 80 rejected, got %d and %d", reserved.Load(), rejected.Load())
+	}
+
+	stored, err := database.NewSQLiteKeyRepository(database.DB).GetByID(context.Background(), k.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.BudgetUsage != 5 {
+		t.Errorf("expected usage to stop at the limit, got %f", stored.BudgetUsage)
+	}
+}
+
+func TestKeyService_ReserveUsage_Errors(t *testing.T) {
+	svc, k := newBudgetTestService(t, 1)
+
+	if err := svc.ReserveUsage(context.Background(), k.ID, "req-1", "", 1); err != nil {
+		t.Fatalf("reservation up to the limit failed: %v", err)
+	}
+	if err := svc.ReserveUsage(context.Background(), k.ID, "req-2", "", 0.01); !errors.Is(err, domain.ErrBudgetExceeded) {
+		t.Errorf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if err := svc.ReserveUsage(context.Background(), k.ID+1, "req-3", "", 0.01); !errors.Is(err, domain.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestKeyService_ReserveUsage_Unlimited(t *testing.T) {
+	svc, k := newBudgetTestService(t, 0)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.ReserveUsage(context.Background(), k.ID, fmt.Sprintf("req-%d", i), "", 100); err != nil {
+			t.Fatalf("reservation without a limit failed: %v", err)
+		}
+	}
+}
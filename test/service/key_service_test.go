@@ -2,7 +2,9 @@ package service_test
 
 import (
 	"context"
+	"errors"
 	"pouch-ai/backend/domain"
+	"pouch-ai/backend/plugins/providers"
 	"pouch-ai/backend/service"
 	"testing"
 	"time"
@@ -65,6 +67,10 @@ func (m *mockRepo) IncrementUsage(ctx context.Context, id domain.ID, amount floa
 	return nil
 }
 
+func (m *mockRepo) ReserveUsage(ctx context.Context, id domain.ID, amount float64) error {
+	return nil
+}
+
 func (m *mockRepo) ResetUsage(ctx context.Context, id domain.ID, lastResetAt time.Time) error {
 	return nil
 }
@@ -114,3 +120,66 @@ func TestKeyService_VerifyKey(t *testing.T) {
 		t.Errorf("Expected name test-key, got %s", key.Name)
 	}
 }
+
+func TestKeyService_ResolveProvider(t *testing.T) {
+	repo := &mockRepo{keys: make(map[domain.ID]*domain.Key)}
+	reg := domain.NewProviderRegistry()
+	reg.Register("openai", providers.NewOpenAIProvider("server-key", "https://api.openai.com/v1", nil, nil))
+	svc := service.NewKeyService(repo, reg, domain.NewMiddlewareRegistry())
+
+	_, key, err := svc.CreateKey(context.Background(), service.CreateKeyInput{
+		Name: "team-a",
+		Provider: domain.PluginConfig{ID: "openai", Config: map[string]any{
+			"api_key":  "team-a-key",
+			"base_url": "https://team-a.example.com/v1",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	upstream := func(p domain.Provider) (string, string) {
+		req, err := p.PrepareHTTPRequest(context.Background(), "gpt-4o", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("PrepareHTTPRequest failed: %v", err)
+		}
+		return req.URL.Host, req.Header.Get("Authorization")
+	}
+
+	p1, err := svc.ResolveProvider(key)
+	if err != nil {
+		t.Fatalf("ResolveProvider failed: %v", err)
+	}
+	if host, auth := upstream(p1); host != "team-a.example.com" || auth != "Bearer team-a-key" {
+		t.Errorf("key config not applied: %s %s", host, auth)
+	}
+
+	p2, _ := svc.ResolveProvider(key)
+	if p1 != p2 {
+		t.Error("expected configured provider to be cached")
+	}
+
+	err = svc.UpdateKey(context.Background(), service.UpdateKeyInput{
+		ID:       int64(key.ID),
+		Name:     "team-a",
+		Provider: domain.PluginConfig{ID: "openai", Config: map[string]any{"api_key": "rotated-key"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update key: %v", err)
+	}
+
+	p3, _ := svc.ResolveProvider(repo.keys[key.ID])
+	if host, auth := upstream(p3); host != "api.openai.com" || auth != "Bearer rotated-key" {
+		t.Errorf("expected updated config after UpdateKey, got %s %s", host, auth)
+	}
+
+	// Keys without provider config use the shared instance
+	base, _ := reg.Get("openai")
+	if p, _ := svc.ResolveProvider(&domain.Key{ID: 2, Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "openai"}}}); p != base {
+		t.Error("expected the registered provider for keys without config")
+	}
+
+	if _, err := svc.ResolveProvider(&domain.Key{ID: 3, Configuration: &domain.KeyConfiguration{Provider: domain.PluginConfig{ID: "missing"}}}); !errors.Is(err, domain.ErrProviderNotFound) {
+		t.Errorf("expected ErrProviderNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/service"
+	"testing"
+	"time"
+)
+
+func TestKeyService_ModelBudgets(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	svc := service.NewKeyService(database.NewSQLiteKeyRepository(database.DB), &mockRegistry{}, domain.NewMiddlewareRegistry())
+	_, k, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:        "junior-key",
+		Provider:    domain.PluginConfig{ID: "openai"},
+		BudgetLimit: 50,
+		ResetPeriod: 3600,
+		ModelBudgets: []domain.ModelBudget{
+			{Model: "gpt-4*", Limit: 5},
+			{Model: "o1", Limit: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	modelUsage := func() string {
+		t.Helper()
+		keys, err := svc.ListKeys(ctx)
+		if err != nil || len(keys) != 1 {
+			t.Fatalf("ListKeys() = %v, %v", keys, err)
+		}
+		return fmt.Sprint(keys[0].ModelUsage)
+	}
+
+	// Cheap models only count against the key budget
+	if err := svc.ReserveUsage(ctx, k.ID, "req-1", "gpt-3.5-turbo", 20); err != nil {
+		t.Fatalf("ReserveUsage failed for an uncapped model: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, k.ID, "req-2", "gpt-4o", 4); err != nil {
+		t.Fatalf("ReserveUsage failed within the model budget: %v", err)
+	}
+	err = svc.ReserveUsage(ctx, k.ID, "req-3", "gpt-4o-mini", 2)
+	if !errors.Is(err, domain.ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded for the gpt-4* budget, got %v", err)
+	}
+	if got := modelUsage(); got != "map[gpt-4*:4 o1:0]" {
+		t.Errorf("expected the rejected reservation to leave usage untouched, got %s", got)
+	}
+
+	// Settling below the reservation frees room in the model budget
+	if err := svc.CommitUsage(ctx, k.ID, "req-2", 4, 2.5); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, k.ID, "req-3", "gpt-4o-mini", 2); err != nil {
+		t.Fatalf("ReserveUsage failed after commit: %v", err)
+	}
+	if got := modelUsage(); got != "map[gpt-4*:4.5 o1:0]" {
+		t.Errorf("unexpected model usage %s", got)
+	}
+
+	// Refunded reservations are released from the model budget too
+	if _, err := svc.ReconcileReservations(ctx, time.Now(), domain.ReservationRefunded); err != nil {
+		t.Fatalf("ReconcileReservations failed: %v", err)
+	}
+	if got := modelUsage(); got != "map[gpt-4*:2.5 o1:0]" {
+		t.Errorf("unexpected model usage after refund %s", got)
+	}
+
+	// Model budgets reset with the key
+	if _, err := database.DB.Exec("UPDATE app_keys SET last_reset_at = ?", time.Now().Add(-2*time.Hour).Unix()); err != nil {
+		t.Fatalf("Failed to age key: %v", err)
+	}
+	if _, err := svc.ResetDueBudgets(ctx, time.Now(), time.UTC); err != nil {
+		t.Fatalf("ResetDueBudgets failed: %v", err)
+	}
+	if got := modelUsage(); got != "map[gpt-4*:0 o1:0]" {
+		t.Errorf("expected model usage to reset, got %s", got)
+	}
+}
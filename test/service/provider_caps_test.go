@@ -0,0 +1,248 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pouch-ai/backend/config"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/plugins/notifiers"
+	"pouch-ai/backend/plugins/providers"
+	"pouch-ai/backend/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyService_ProviderCaps(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	received := make(chan domain.Alert, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a domain.Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("invalid alert payload: %v", err)
+		}
+		received <- a
+	}))
+	t.Cleanup(receiver.Close)
+	notifier, err := notifiers.New([]config.NotifierConfig{{Type: config.NotifierWebhook, URL: receiver.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	svc := service.NewKeyService(repo, &mockRegistry{}, domain.NewMiddlewareRegistry())
+	svc.SetAlerts(notifier, service.AlertPolicy{})
+
+	var keys []*domain.Key
+	for _, in := range []service.CreateKeyInput{
+		{Name: "web", Provider: domain.PluginConfig{ID: "openai"}, BudgetLimit: 100},
+		{Name: "batch", Provider: domain.PluginConfig{ID: "openai"}, BudgetLimit: 100},
+		{Name: "claude", Provider: domain.PluginConfig{ID: "anthropic"}},
+	} {
+		_, k, err := svc.CreateKey(ctx, in)
+		if err != nil {
+			t.Fatalf("CreateKey failed: %v", err)
+		}
+		keys = append(keys, k)
+	}
+	web, batch, claude := keys[0], keys[1], keys[2]
+
+	// Spend from before the cap existed counts from the start of its period
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	for _, e := range []*domain.UsageEvent{
+		{KeyID: web.ID, Provider: "openai", ActualCost: 3, CreatedAt: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{KeyID: web.ID, Provider: "openai", ActualCost: 50, CreatedAt: time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC)},
+		{KeyID: claude.ID, Provider: "anthropic", ActualCost: 50, CreatedAt: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		if err := repo.RecordUsage(ctx, e); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+	}
+
+	monthly := &domain.ResetSchedule{Interval: domain.ResetMonthly}
+	if err := svc.SetProviderCaps(ctx, []*domain.ProviderCap{
+		{Provider: "openai", Limit: 10, Schedule: monthly, AlertThresholds: []int{50}},
+	}, now, time.UTC); err != nil {
+		t.Fatalf("SetProviderCaps failed: %v", err)
+	}
+	capOf := func() *domain.ProviderCap {
+		t.Helper()
+		caps, err := svc.ListProviderCaps(ctx)
+		if err != nil {
+			t.Fatalf("ListProviderCaps failed: %v", err)
+		}
+		if len(caps) != 1 {
+			t.Fatalf("expected one cap, got %d", len(caps))
+		}
+		return caps[0]
+	}
+	if c := capOf(); c.Usage != 3 || c.Headroom() != 7 || !c.LastResetAt.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected new cap: %+v", c)
+	}
+
+	// The keys' own budgets have room, but the cap is shared
+	if err := svc.ReserveUsage(ctx, web.ID, "web-1", "gpt-4o", 4); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+	err = svc.ReserveUsage(ctx, batch.ID, "batch-1", "gpt-4o", 4)
+	if !errors.Is(err, domain.ErrBudgetExceeded) || !strings.Contains(err.Error(), `provider "openai"`) {
+		t.Fatalf("expected the provider cap to be exceeded, got %v", err)
+	}
+	if k, _ := repo.GetByID(ctx, batch.ID); k.BudgetUsage != 0 {
+		t.Errorf("rejected reservation was charged to the key: %v", k.BudgetUsage)
+	}
+	if err := svc.ReserveUsage(ctx, claude.ID, "claude-1", "claude-sonnet-4", 40); err != nil {
+		t.Errorf("uncapped provider was limited: %v", err)
+	}
+
+	// Settling below the reservation gives the difference back
+	if err := svc.CommitUsage(ctx, web.ID, "web-1", 4, 2.5); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	if c := capOf(); c.Usage != 5.5 {
+		t.Errorf("expected cap usage 5.5, got %v", c.Usage)
+	}
+	select {
+	case a := <-received:
+		if a.Scope != domain.BudgetScopeProvider || a.Provider != "openai" || a.Threshold != 50 || a.KeyID != 0 {
+			t.Errorf("expected a 50%% alert for the openai cap, got %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no provider cap alert received")
+	}
+
+	if err := svc.ReserveUsage(ctx, batch.ID, "batch-2", "gpt-4o", 4.5); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+	if err := svc.CommitUsage(ctx, batch.ID, "batch-2", 4.5, 4.5); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	select {
+	case a := <-received:
+		if a.Scope != domain.BudgetScopeProvider || a.Threshold != 100 {
+			t.Errorf("expected a 100%% alert for the openai cap, got %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no provider cap alert received at the cap")
+	}
+
+	// Changing the limit keeps the period's usage
+	if err := svc.SetProviderCaps(ctx, []*domain.ProviderCap{
+		{Provider: "openai", Limit: 20, Schedule: monthly},
+	}, now, time.UTC); err != nil {
+		t.Fatalf("SetProviderCaps failed: %v", err)
+	}
+	if c := capOf(); c.Usage != 10 || c.Headroom() != 10 {
+		t.Errorf("unexpected cap after raising the limit: %+v", c)
+	}
+
+	if _, err := svc.ResetDueBudgets(ctx, time.Date(2026, 11, 1, 0, 0, 1, 0, time.UTC), time.UTC); err != nil {
+		t.Fatalf("ResetDueBudgets failed: %v", err)
+	}
+	if c := capOf(); c.Usage != 0 || !c.LastResetAt.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("cap was not reset for the new month: %+v", c)
+	}
+	resets, err := svc.ListBudgetResets(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListBudgetResets failed: %v", err)
+	}
+	if len(resets) == 0 || resets[0].Scope != domain.BudgetScopeProvider || resets[0].Name != "openai" || resets[0].Usage != 10 {
+		t.Errorf("expected the cap reset to be recorded, got %+v", resets)
+	}
+
+	for _, caps := range [][]*domain.ProviderCap{
+		{{Provider: "openai"}},
+		{{Provider: "openai", Limit: 1}, {Provider: "openai", Limit: 2}},
+		{{Provider: "openai", Limit: 1, Schedule: &domain.ResetSchedule{Interval: "yearly"}}},
+	} {
+		if err := svc.SetProviderCaps(ctx, caps, now, time.UTC); !domain.IsValidationError(err) {
+			t.Errorf("expected a validation error for %+v, got %v", caps[0], err)
+		}
+	}
+
+	if err := svc.SetProviderCaps(ctx, nil, now, time.UTC); err != nil {
+		t.Fatalf("SetProviderCaps failed: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, batch.ID, "batch-3", "gpt-4o", 50); err != nil {
+		t.Errorf("removed cap still applies: %v", err)
+	}
+}
+
+// Keys billed to credentials of their own neither count against nor are
+// limited by the cap of the shared account
+func TestKeyService_ProviderCaps_OwnCredentials(t *testing.T) {
+	if err := database.InitDB(t.TempDir()); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	pricing, err := providers.NewOpenAIPricing()
+	if err != nil {
+		t.Fatalf("Failed to create pricing: %v", err)
+	}
+	registry := domain.NewProviderRegistry()
+	registry.Register("openai", providers.NewOpenAIProvider("test-key", "http://openai.local/v1", pricing, nil))
+	repo := database.NewSQLiteKeyRepository(database.DB)
+	svc := service.NewKeyService(repo, registry, domain.NewMiddlewareRegistry())
+
+	_, shared, err := svc.CreateKey(ctx, service.CreateKeyInput{Name: "shared", Provider: domain.PluginConfig{ID: "openai"}})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	_, own, err := svc.CreateKey(ctx, service.CreateKeyInput{
+		Name:     "own",
+		Provider: domain.PluginConfig{ID: "openai", Config: map[string]any{"api_key": "team-key"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	for _, e := range []*domain.UsageEvent{
+		{KeyID: shared.ID, Provider: "openai", ActualCost: 3, CreatedAt: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{KeyID: own.ID, Provider: "openai", ActualCost: 50, CreatedAt: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		if err := repo.RecordUsage(ctx, e); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+	}
+	if err := svc.SetProviderCaps(ctx, []*domain.ProviderCap{
+		{Provider: "openai", Limit: 10, Schedule: &domain.ResetSchedule{Interval: domain.ResetMonthly}},
+	}, now, time.UTC); err != nil {
+		t.Fatalf("SetProviderCaps failed: %v", err)
+	}
+	capUsage := func() float64 {
+		t.Helper()
+		c, err := repo.GetProviderCap(ctx, "openai")
+		if err != nil || c == nil {
+			t.Fatalf("GetProviderCap failed: %v", err)
+		}
+		return c.Usage
+	}
+	if got := capUsage(); got != 3 {
+		t.Errorf("expected the new cap to count only the shared key's spend, got %v", got)
+	}
+
+	if err := svc.ReserveUsage(ctx, own.ID, "own-1", "gpt-4o", 40); err != nil {
+		t.Fatalf("key with its own credentials was limited by the cap: %v", err)
+	}
+	if err := svc.CommitUsage(ctx, own.ID, "own-1", 40, 30); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	if err := svc.ReserveUsage(ctx, shared.ID, "shared-1", "gpt-4o", 7); err != nil {
+		t.Fatalf("shared key was limited by another account's spend: %v", err)
+	}
+	if got := capUsage(); got != 10 {
+		t.Errorf("expected cap usage 10, got %v", got)
+	}
+}
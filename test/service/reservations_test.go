@@ -0,0 +1,100 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"testing"
+	"time"
+)
+
+func storedUsage(t *testing.T, id domain.ID) string {
+	t.Helper()
+	k, err := database.NewSQLiteKeyRepository(database.DB).GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	return fmt.Sprintf("%.2f", k.BudgetUsage)
+}
+
+func TestKeyService_CommitUsage_SettlesReservation(t *testing.T) {
+	svc, k := newBudgetTestService(t, 10)
+	ctx := context.Background()
+
+	if err := svc.ReserveUsage(ctx, k.ID, "req-1", "", 1); err != nil {
+		t.Fatalf("ReserveUsage failed: %v", err)
+	}
+	open, err := svc.ListOpenReservations(ctx)
+	if err != nil {
+		t.Fatalf("ListOpenReservations failed: %v", err)
+	}
+	if len(open) != 1 || open[0].RequestID != "req-1" || open[0].Amount != 1 || open[0].KeyID != k.ID {
+		t.Fatalf("unexpected open reservations: %+v", open)
+	}
+
+	if err := svc.CommitUsage(ctx, k.ID, "req-1", 1, 0.4); err != nil {
+		t.Fatalf("CommitUsage failed: %v", err)
+	}
+	if got := storedUsage(t, k.ID); got != "0.40" {
+		t.Errorf("expected usage 0.40, got %s", got)
+	}
+	if open, _ := svc.ListOpenReservations(ctx); len(open) != 0 {
+		t.Errorf("expected no open reservations, got %+v", open)
+	}
+
+	// A second commit for the same request is not applied twice
+	if err := svc.CommitUsage(ctx, k.ID, "req-1", 1, 0.4); err == nil {
+		t.Errorf("expected an error committing a settled reservation")
+	}
+	if got := storedUsage(t, k.ID); got != "0.40" {
+		t.Errorf("expected usage 0.40, got %s", got)
+	}
+}
+
+func TestKeyService_ReconcileReservations(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     domain.ReservationState
+		afterExp  string
+		afterLate string
+	}{
+		{"Refund", domain.ReservationRefunded, "0.00", "0.30"},
+		{"Charge", domain.ReservationCharged, "1.00", "0.30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, k := newBudgetTestService(t, 10)
+			ctx := context.Background()
+
+			if err := svc.ReserveUsage(ctx, k.ID, "stale", "", 1); err != nil {
+				t.Fatalf("ReserveUsage failed: %v", err)
+			}
+
+			// Reservations newer than the cutoff are kept
+			if n, err := svc.ReconcileReservations(ctx, time.Now().Add(-time.Hour), tt.state); err != nil || n != 0 {
+				t.Fatalf("expected nothing to reconcile, got %d, %v", n, err)
+			}
+
+			n, err := svc.ReconcileReservations(ctx, time.Now(), tt.state)
+			if err != nil || n != 1 {
+				t.Fatalf("expected 1 reconciled reservation, got %d, %v", n, err)
+			}
+			if got := storedUsage(t, k.ID); got != tt.afterExp {
+				t.Errorf("expected usage %s after expiry, got %s", tt.afterExp, got)
+			}
+			if open, _ := svc.ListOpenReservations(ctx); len(open) != 0 {
+				t.Errorf("expected no open reservations, got %+v", open)
+			}
+
+			// A request that settles after its reservation expired is charged its actual cost
+			if err := svc.CommitUsage(ctx, k.ID, "stale", 1, 0.3); err != nil {
+				t.Fatalf("CommitUsage failed: %v", err)
+			}
+			if got := storedUsage(t, k.ID); got != tt.afterLate {
+				t.Errorf("expected usage %s after late commit, got %s", tt.afterLate, got)
+			}
+		})
+	}
+}
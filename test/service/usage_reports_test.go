@@ -0,0 +1,122 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"pouch-ai/backend/database"
+	"pouch-ai/backend/domain"
+	"pouch-ai/backend/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyService_UsageReport(t *testing.T) {
+	dir := t.TempDir()
+	if err := database.InitDB(dir); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+	ctx := context.Background()
+
+	svc := service.NewKeyService(database.NewSQLiteKeyRepository(database.DB), &mockRegistry{}, domain.NewMiddlewareRegistry())
+	var keys []*domain.Key
+	for _, name := range []string{"web", "batch"} {
+		_, k, err := svc.CreateKey(ctx, service.CreateKeyInput{Name: name, Provider: domain.PluginConfig{ID: "openai"}})
+		if err != nil {
+			t.Fatalf("CreateKey failed: %v", err)
+		}
+		keys = append(keys, k)
+	}
+	web, batch := keys[0], keys[1]
+
+	spend := func(k *domain.Key, model domain.Model, at string, cost float64) {
+		t.Helper()
+		createdAt, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &domain.UsageEvent{KeyID: k.ID, Model: model, Provider: "openai", PromptTokens: 10, OutputTokens: 5, ActualCost: cost, StatusCode: 200, CreatedAt: createdAt}
+		if err := svc.CommitRequest(ctx, e); err != nil {
+			t.Fatalf("CommitRequest failed: %v", err)
+		}
+	}
+	spend(web, "gpt-4o", "2026-08-31T23:30:00Z", 1)
+	spend(web, "gpt-4o", "2026-09-01T08:10:00Z", 2)
+	spend(web, "gpt-4o", "2026-09-01T08:50:00Z", 2)
+	spend(web, "gpt-4o-mini", "2026-09-15T12:00:00Z", 0.5)
+	spend(batch, "gpt-4o-mini", "2026-09-30T23:59:59Z", 4)
+	spend(batch, "gpt-4o-mini", "2026-10-01T00:00:00Z", 8)
+
+	report := func(q domain.ReportQuery) string {
+		t.Helper()
+		rows, err := svc.UsageReport(ctx, q)
+		if err != nil {
+			t.Fatalf("UsageReport(%+v) failed: %v", q, err)
+		}
+		var lines []string
+		for _, r := range rows {
+			period := ""
+			if !r.PeriodStart.IsZero() {
+				period = r.PeriodStart.Format(time.RFC3339) + " "
+			}
+			lines = append(lines, fmt.Sprintf("%s%s/%s/%s %d %g", period, r.KeyName, r.Provider, r.Model, r.Requests, r.Cost))
+		}
+		return strings.Join(lines, "\n")
+	}
+	september := domain.ReportQuery{
+		From:    time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		GroupBy: []domain.ReportGroup{domain.ReportByKey},
+	}
+
+	// What did we spend last month per app
+	if got, want := report(september), "web// 3 4.5\nbatch// 1 4"; got != want {
+		t.Errorf("monthly spend per key:\n%s\nwant:\n%s", got, want)
+	}
+
+	q := september
+	q.Period = domain.ReportMonth
+	q.From = time.Time{}
+	q.GroupBy = []domain.ReportGroup{domain.ReportByModel, domain.ReportByProvider}
+	want := "2026-08-01T00:00:00Z /openai/gpt-4o 1 1\n" +
+		"2026-09-01T00:00:00Z /openai/gpt-4o-mini 2 4.5\n" +
+		"2026-09-01T00:00:00Z /openai/gpt-4o 2 4"
+	if got := report(q); got != want {
+		t.Errorf("spend by month and model:\n%s\nwant:\n%s", got, want)
+	}
+
+	q = september
+	q.Period = domain.ReportWeek
+	q.GroupBy = nil
+	// 2026-09-01 is a Tuesday
+	want = "2026-08-31T00:00:00Z // 2 4\n" +
+		"2026-09-14T00:00:00Z // 1 0.5\n" +
+		"2026-09-28T00:00:00Z // 1 4"
+	if got := report(q); got != want {
+		t.Errorf("spend by week:\n%s\nwant:\n%s", got, want)
+	}
+
+	q.Period = domain.ReportHour
+	q.To = time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)
+	if got, want := report(q), "2026-09-01T08:00:00Z // 2 4"; got != want {
+		t.Errorf("spend by hour:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := svc.UsageReport(ctx, domain.ReportQuery{Period: "year"}); !domain.IsValidationError(err) {
+		t.Errorf("expected a validation error for an unknown period, got %v", err)
+	}
+
+	// Usage recorded without rollups is rolled up on startup
+	if _, err := database.DB.Exec("DELETE FROM usage_hourly; DELETE FROM usage_daily"); err != nil {
+		t.Fatalf("Failed to clear rollups: %v", err)
+	}
+	database.DB.Close()
+	if err := database.InitDB(dir); err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	svc = service.NewKeyService(database.NewSQLiteKeyRepository(database.DB), &mockRegistry{}, domain.NewMiddlewareRegistry())
+	if got, want := report(september), "web// 3 4.5\nbatch// 1 4"; got != want {
+		t.Errorf("monthly spend per key after backfill:\n%s\nwant:\n%s", got, want)
+	}
+}